@@ -6,9 +6,8 @@ require (
 	github.com/gopacket/gopacket v1.3.1
 	github.com/hwipl/packet-go v0.0.0-20241223073328-6eee85d5ccdb
 	github.com/hwipl/smc-go v0.0.0-20240924114116-ca917b025fe2
+	golang.org/x/net v0.33.0
+	golang.org/x/sys v0.28.0
 )
 
-require (
-	golang.org/x/net v0.33.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
-)
+require golang.org/x/text v0.21.0 // indirect
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// jsonAnnotation is a user-defined marker in the JSON output
+type jsonAnnotation struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	Text string    `json:"text"`
+}
+
+// annotate emits the user-defined marker text as annotation event to all
+// output sinks
+func annotate(text string) {
+	emit(&event{typ: eventAnnotation, text: text})
+}
+
+// printAnnotation prints the user-defined marker text
+func printAnnotation(text string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sAnnotation: %s\n", t, text)
+}
+
+// annotationJSON returns the user-defined marker text set at time t as JSON
+// event
+func annotationJSON(t time.Time, text string) *jsonAnnotation {
+	return &jsonAnnotation{
+		Time: t,
+		Type: eventAnnotation,
+		Text: text,
+	}
+}
+
+// handleAnnotations handles http requests for annotations
+func handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	var a jsonAnnotation
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	text := strings.TrimSpace(a.Text)
+	if text == "" {
+		http.Error(w, "empty annotation", http.StatusBadRequest)
+		return
+	}
+	annotate(text)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registerAnnotationAPI registers the annotation http api
+func registerAnnotationAPI() {
+	httpControlMux.HandleFunc("/api/v1/annotations", handleAnnotations)
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package cmd
+
+// handleAnnotationSignal is not supported on this platform
+func handleAnnotationSignal() {}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleAnnotations(t *testing.T) {
+	var text, js bytes.Buffer
+	stdout = &text
+	jsonOutput = &js
+	defer func() { jsonOutput = nil }()
+	*showTimestamps = false
+	jsonEvents.types = map[string]bool{eventAnnotation: true}
+	defer func() { jsonEvents.types = nil }()
+
+	// test wrong method and empty annotation
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/annotations", nil)
+	w := httptest.NewRecorder()
+	handleAnnotations(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got = %d; want %d", w.Code,
+			http.StatusMethodNotAllowed)
+	}
+	r = httptest.NewRequest(http.MethodPost, "/api/v1/annotations",
+		strings.NewReader(`{"text":" "}`))
+	w = httptest.NewRecorder()
+	handleAnnotations(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// test annotation
+	r = httptest.NewRequest(http.MethodPost, "/api/v1/annotations",
+		strings.NewReader(`{"text":"changed pnet config now"}`))
+	w = httptest.NewRecorder()
+	handleAnnotations(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	want := "Annotation: changed pnet config now\n"
+	if text.String() != want {
+		t.Errorf("got = %s; want %s", text.String(), want)
+	}
+	var got jsonAnnotation
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != eventAnnotation || got.Text != "changed pnet config now" {
+		t.Errorf("got = %v; want annotation", got)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleAnnotationSignal emits a numbered marker as annotation event on each
+// SIGUSR1
+func handleAnnotationSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for n := 1; ; n++ {
+			<-c
+			annotate(fmt.Sprintf("SIGUSR1 marker %d", n))
+		}
+	}()
+}
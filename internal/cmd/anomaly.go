@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+const (
+	// anomalyInterval is the interval in which handshakes are counted
+	anomalyInterval = time.Minute
+
+	// anomalyAlpha is the smoothing factor of the baseline EWMA
+	anomalyAlpha = 0.3
+
+	// anomalyWarmup is the number of intervals used to learn the baseline
+	// before anomalies are reported
+	anomalyWarmup = 5
+
+	// anomalyMinBaseline is the minimum baseline for reporting a drop to
+	// zero handshakes
+	anomalyMinBaseline = 1.0
+
+	// anomalyMaxIdle is the maximum number of idle intervals evaluated at
+	// once; after more idle intervals, baselines are considered decayed
+	anomalyMaxIdle = 60
+
+	// anomalyMinRate is the baseline below which peers are removed
+	anomalyMinRate = 0.01
+)
+
+var (
+	// anomalies stores the handshake rate anomaly table
+	anomalies anomalyTable
+)
+
+// anomalyKey identifies a peer pair
+type anomalyKey struct {
+	client gopacket.Endpoint
+	server gopacket.Endpoint
+}
+
+// anomalyPeer stores the handshake count in the current interval and the
+// baseline handshake rate of a peer pair
+type anomalyPeer struct {
+	count     uint64
+	baseline  float64
+	intervals int
+	dropped   bool
+}
+
+// anomalyTable stores the handshake rates of peer pairs protected by a mutex
+type anomalyTable struct {
+	lock  sync.Mutex
+	start time.Time
+	amap  map[anomalyKey]*anomalyPeer
+}
+
+// init initializes the anomaly table
+func (at *anomalyTable) init() {
+	at.lock.Lock()
+	if at.amap == nil {
+		at.amap = make(map[anomalyKey]*anomalyPeer)
+	}
+	at.lock.Unlock()
+}
+
+// closeInterval evaluates the handshake counts of the current interval
+// against the baselines, updates the baselines, and returns the anomalies,
+// at must be locked
+func (at *anomalyTable) closeInterval() []string {
+	var events []string
+	event := func(key anomalyKey, p *anomalyPeer, kind string) {
+		events = append(events, fmt.Sprintf("%s -> %s: %d handshakes "+
+			"in %s, baseline %.1f (%s)", key.client, key.server,
+			p.count, anomalyInterval, p.baseline, kind))
+	}
+	for key, p := range at.amap {
+		count := float64(p.count)
+		if p.intervals >= anomalyWarmup {
+			// handshake rate spiked
+			if count > *anomalyFactor*max(p.baseline, 1) {
+				event(key, p, "spike")
+			}
+
+			// handshake rate dropped to zero
+			if p.count == 0 && !p.dropped &&
+				p.baseline >= anomalyMinBaseline {
+				p.dropped = true
+				event(key, p, "drop to zero")
+			}
+		}
+		if p.count > 0 {
+			p.dropped = false
+		}
+
+		// update baseline
+		if p.intervals == 0 {
+			p.baseline = count
+		} else {
+			p.baseline = anomalyAlpha*count +
+				(1-anomalyAlpha)*p.baseline
+		}
+		p.intervals++
+		p.count = 0
+		if p.baseline < anomalyMinRate {
+			delete(at.amap, key)
+		}
+	}
+	sort.Strings(events)
+	return events
+}
+
+// advance closes all intervals that ended before time ts and returns the
+// anomalies, at must be locked
+func (at *anomalyTable) advance(ts time.Time) []string {
+	if at.start.IsZero() {
+		at.start = ts.Truncate(anomalyInterval)
+		return nil
+	}
+
+	var events []string
+	n := int(ts.Sub(at.start) / anomalyInterval)
+	for i := 0; i < n && i < anomalyMaxIdle; i++ {
+		events = append(events, at.closeInterval()...)
+	}
+	if n > 0 {
+		at.start = at.start.Add(time.Duration(n) * anomalyInterval)
+	}
+	return events
+}
+
+// add adds a handshake of the peer pair in the network flow net at time ts
+// to the anomaly table and returns the anomalies of intervals that ended
+// before ts
+func (at *anomalyTable) add(net gopacket.Flow, ts time.Time) []string {
+	key := anomalyKey{
+		client: net.Src(),
+		server: net.Dst(),
+	}
+
+	at.lock.Lock()
+	defer at.lock.Unlock()
+
+	if at.amap == nil {
+		return nil
+	}
+	events := at.advance(ts)
+	p := at.amap[key]
+	if p == nil {
+		p = &anomalyPeer{}
+		at.amap[key] = p
+	}
+	p.count++
+	return events
+}
+
+// tick closes all intervals that ended before time ts and returns the
+// anomalies
+func (at *anomalyTable) tick(ts time.Time) []string {
+	at.lock.Lock()
+	defer at.lock.Unlock()
+	return at.advance(ts)
+}
+
+// printAnomaly prints the handshake rate anomaly alert
+func printAnomaly(alert string) {
+	fmt.Fprintf(stdout, "%sAnomaly: %s\n", timestamp(), alert)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestAnomalyTable(t *testing.T) {
+	var at anomalyTable
+
+	// initialize anomaly table and test flow
+	at.init()
+	*anomalyFactor = 3
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	ts := time.Unix(0, 0)
+
+	// learn baseline of 2 handshakes per interval
+	for i := 0; i < anomalyWarmup; i++ {
+		for j := 0; j < 2; j++ {
+			if got := at.add(net, ts); got != nil {
+				t.Errorf("got = %v; want nil", got)
+			}
+		}
+		ts = ts.Add(anomalyInterval)
+	}
+
+	// test spike
+	for i := 0; i < 7; i++ {
+		at.add(net, ts)
+	}
+	ts = ts.Add(anomalyInterval)
+	got := at.tick(ts)
+	want := []string{"1.2.3.4 -> 5.6.7.8: 7 handshakes in 1m0s, " +
+		"baseline 2.0 (spike)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test drop to zero, reported only once
+	ts = ts.Add(anomalyInterval)
+	got = at.tick(ts)
+	want = []string{"1.2.3.4 -> 5.6.7.8: 0 handshakes in 1m0s, " +
+		"baseline 3.5 (drop to zero)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+	ts = ts.Add(anomalyInterval)
+	got = at.tick(ts)
+	if got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+
+	// test removal of idle peers
+	ts = ts.Add(anomalyMaxIdle * anomalyInterval)
+	at.tick(ts)
+	if len(at.amap) != 0 {
+		t.Errorf("len(at.amap) = %d; want 0", len(at.amap))
+	}
+	*anomalyFactor = 0
+}
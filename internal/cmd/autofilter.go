@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gopacket/gopacket/layers"
+)
+
+// pcapFilterSet checks if the pcap filter is set on the command line
+func pcapFilterSet() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "pcap-filter" {
+			set = true
+		}
+	})
+	return set
+}
+
+// autoPcapFilter is the pcap filter generated by setAutoFilter, if any
+var autoPcapFilter string
+
+// autoFilter returns the pcap filter that only passes tcp packets,
+// optionally restricted to the comma-separated lists of tcp ports and
+// subnets. If IPv4 defragmentation is enabled, port restrictions also pass
+// all IPv4 fragments after the first because they do not contain the tcp
+// header
+func autoFilter(ports, nets string) (string, error) {
+	filter := "tcp"
+	if ports != "" {
+		var matches []string
+		for _, p := range strings.Split(ports, ",") {
+			p = strings.TrimSpace(p)
+			port, err := strconv.ParseUint(p, 10, 16)
+			if err != nil || port == 0 {
+				return "", fmt.Errorf("invalid port %q", p)
+			}
+			matches = append(matches, fmt.Sprintf("port %d", port))
+		}
+		filter += " and (" + strings.Join(matches, " or ") + ")"
+	}
+	if nets != "" {
+		var matches []string
+		for _, n := range strings.Split(nets, ",") {
+			n = strings.TrimSpace(n)
+			_, ipnet, err := net.ParseCIDR(n)
+			if err != nil {
+				return "", fmt.Errorf("invalid subnet %q", n)
+			}
+			matches = append(matches, "net "+ipnet.String())
+		}
+		filter += " and (" + strings.Join(matches, " or ") + ")"
+	}
+	if ports != "" && *ipDefrag {
+		filter = fmt.Sprintf("(%s) or (ip and ip[6:2] & 0x1fff != 0)",
+			filter)
+	}
+	return filter, nil
+}
+
+// vlanFilter returns filter extended to packets with VLAN tags if the link
+// type is Ethernet. libpcap rejects VLAN matches for other link types, e.g.,
+// of the any device, so filter is returned unchanged for them
+func vlanFilter(filter string, linkType layers.LinkType) string {
+	if linkType != layers.LinkTypeEthernet {
+		return filter
+	}
+	if filter == "tcp" {
+		return "tcp or (vlan and tcp)"
+	}
+	return fmt.Sprintf("(%s) or (vlan and (%s))", filter, filter)
+}
+
+// setAutoFilter sets the pcap filter to the generated filter if the pcap
+// filter is not set on the command line
+func setAutoFilter() {
+	if pcapFilterSet() {
+		if *filterPorts != "" || *filterNets != "" {
+			log.Fatal("filter ports and subnets cannot be used " +
+				"with a pcap filter")
+		}
+		return
+	}
+	filter, err := autoFilter(*filterPorts, *filterNets)
+	if err != nil {
+		log.Fatal(err)
+	}
+	*pcapFilter = filter
+	autoPcapFilter = filter
+}
+
+// printPcapFilter prints the pcap filter used for capturing on Ethernet
+// including the prefilter, if enabled
+func printPcapFilter() {
+	if err := exids.init(*smcExIDs); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(stdout, captureFilter(*pcapFilter,
+		layers.LinkTypeEthernet))
+}
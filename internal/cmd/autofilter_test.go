@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcap"
+)
+
+func TestAutoFilter(t *testing.T) {
+	defer func(d bool) { *ipDefrag = d }(*ipDefrag)
+	*ipDefrag = false
+	for _, test := range []struct {
+		ports, nets string
+		want        string
+		ok          bool
+	}{
+		{"", "", "tcp", true},
+		{"12345", "", "tcp and (port 12345)", true},
+		{"1, 2", "10.1.2.3/8,fd00::/8", "tcp and (port 1 or port 2) " +
+			"and (net 10.0.0.0/8 or net fd00::/8)", true},
+		{"0", "", "", false},
+		{"65536", "", "", false},
+		{"http", "", "", false},
+		{"", "10.0.0.1", "", false},
+	} {
+		got, err := autoFilter(test.ports, test.nets)
+		if (err == nil) != test.ok {
+			t.Errorf("%q, %q: got error %v; want ok %t",
+				test.ports, test.nets, err, test.ok)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q, %q: got %s; want %s", test.ports,
+				test.nets, got, test.want)
+		}
+	}
+
+	// test IPv4 defragmentation, fragments after the first have no ports
+	*ipDefrag = true
+	want := "(tcp and (port 12345)) or (ip and ip[6:2] & 0x1fff != 0)"
+	if got, _ := autoFilter("12345", ""); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	if got, _ := autoFilter("", ""); got != "tcp" {
+		t.Errorf("got %s; want tcp", got)
+	}
+}
+
+func TestVLANFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter   string
+		linkType layers.LinkType
+		want     string
+	}{
+		{"tcp", layers.LinkTypeEthernet, "tcp or (vlan and tcp)"},
+		{"tcp and (port 1)", layers.LinkTypeEthernet,
+			"(tcp and (port 1)) or (vlan and (tcp and (port 1)))"},
+		{"tcp", layers.LinkTypeLinuxSLL, "tcp"},
+		{"tcp and (port 1)", layers.LinkTypeRaw, "tcp and (port 1)"},
+		{"tcp", layers.LinkTypeIPv4, "tcp"},
+	} {
+		got := vlanFilter(test.filter, test.linkType)
+		if got != test.want {
+			t.Errorf("%s, %s: got %s; want %s", test.filter,
+				test.linkType, got, test.want)
+		}
+	}
+}
+
+func TestCaptureFilterLinkTypes(t *testing.T) {
+	defer func(f string, p, d bool) {
+		autoPcapFilter, *pcapPrefilter, *ipDefrag = f, p, d
+	}(autoPcapFilter, *pcapPrefilter, *ipDefrag)
+	*pcapPrefilter = false
+	*ipDefrag = true
+
+	// the generated filter compiles for all link types, only user
+	// filters are not changed
+	filter, err := autoFilter("12345", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	autoPcapFilter = filter
+	for _, linkType := range []layers.LinkType{
+		layers.LinkTypeEthernet,
+		layers.LinkTypeLinuxSLL,
+		layers.LinkTypeRaw,
+	} {
+		f := captureFilter(filter, linkType)
+		if _, err := pcap.CompileBPFFilter(linkType, 262144,
+			f); err != nil {
+			t.Errorf("%s: %s: %v", linkType, f, err)
+		}
+	}
+	if got := captureFilter("port 1", layers.LinkTypeEthernet); got !=
+		"port 1" {
+		t.Errorf("got %s; want port 1", got)
+	}
+}
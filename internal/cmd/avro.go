@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+const (
+	// avroMagic is the magic of Avro object container files
+	avroMagic = "Obj\x01"
+
+	// avroBlockRecords is the maximum number of records in a data block
+	avroBlockRecords = 1000
+
+	// avroSchema is the schema of the handshake records in the Avro
+	// output
+	avroSchema = `{"type":"record","name":"Handshake",` +
+		`"namespace":"smc_clc","fields":[` +
+		`{"name":"time","type":{"type":"long",` +
+		`"logicalType":"timestamp-micros"}},` +
+		`{"name":"session","type":"long"},` +
+		`{"name":"src_addr","type":"string"},` +
+		`{"name":"src_port","type":"int"},` +
+		`{"name":"dst_addr","type":"string"},` +
+		`{"name":"dst_port","type":"int"},` +
+		`{"name":"result","type":"string"},` +
+		`{"name":"path","type":["null","string"]},` +
+		`{"name":"version","type":"int"},` +
+		`{"name":"diagnosis","type":["null","string"]},` +
+		`{"name":"duration","type":"double"},` +
+		`{"name":"client_messages","type":"long"},` +
+		`{"name":"client_bytes","type":"long"},` +
+		`{"name":"server_messages","type":"long"},` +
+		`{"name":"server_bytes","type":"long"},` +
+		`{"name":"server_qpn","type":["null","long"]},` +
+		`{"name":"server_psn","type":["null","long"]},` +
+		`{"name":"client_qpn","type":["null","long"]},` +
+		`{"name":"client_psn","type":["null","long"]}]}`
+)
+
+var (
+	// avroEvents is the Avro sink
+	avroEvents avroSink
+)
+
+// avroAppendLong appends the zigzag encoded long v to buf
+func avroAppendLong(buf []byte, v int64) []byte {
+	return binary.AppendVarint(buf, v)
+}
+
+// avroAppendString appends the string s with its length to buf
+func avroAppendString(buf []byte, s string) []byte {
+	buf = avroAppendLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
+
+// avroAppendDouble appends the double v to buf
+func avroAppendDouble(buf []byte, v float64) []byte {
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+// avroAppendOptionalString appends the union of null and string with s to
+// buf, an empty string is null
+func avroAppendOptionalString(buf []byte, s string) []byte {
+	if s == "" {
+		return avroAppendLong(buf, 0)
+	}
+	buf = avroAppendLong(buf, 1)
+	return avroAppendString(buf, s)
+}
+
+// avroAppendOptionalLong appends the union of null and long with v to buf if
+// ok, otherwise null
+func avroAppendOptionalLong(buf []byte, v int64, ok bool) []byte {
+	if !ok {
+		return avroAppendLong(buf, 0)
+	}
+	buf = avroAppendLong(buf, 1)
+	return avroAppendLong(buf, v)
+}
+
+// avroHeader returns the header of an Avro object container file with the
+// handshake schema, the null codec, and the sync marker
+func avroHeader(marker []byte) []byte {
+	h := []byte(avroMagic)
+	h = avroAppendLong(h, 2)
+	h = avroAppendString(h, "avro.schema")
+	h = avroAppendString(h, avroSchema)
+	h = avroAppendString(h, "avro.codec")
+	h = avroAppendString(h, "null")
+	h = avroAppendLong(h, 0)
+	return append(h, marker...)
+}
+
+// avroPort returns the port number of the tcp port endpoint e
+func avroPort(e gopacket.Endpoint) uint16 {
+	return binary.BigEndian.Uint16(e.Raw())
+}
+
+// avroHandshakeRecord returns the handshake r finished at time t as Avro
+// record
+func avroHandshakeRecord(t time.Time, r *handshakeResult) []byte {
+	net, trans := r.key.net, r.key.trans
+	b := avroAppendLong(nil, t.UnixMicro())
+	b = avroAppendLong(b, int64(r.id))
+	b = avroAppendString(b, net.Src().String())
+	b = avroAppendLong(b, int64(avroPort(trans.Src())))
+	b = avroAppendString(b, net.Dst().String())
+	b = avroAppendLong(b, int64(avroPort(trans.Dst())))
+	if r.confirmed {
+		b = avroAppendString(b, "confirmed")
+		b = avroAppendOptionalString(b, r.path.String())
+	} else {
+		b = avroAppendString(b, "declined")
+		b = avroAppendOptionalString(b, "")
+	}
+	b = avroAppendLong(b, int64(r.version))
+	if r.confirmed {
+		b = avroAppendOptionalString(b, "")
+	} else {
+		b = avroAppendOptionalString(b, r.diagnosis)
+	}
+	b = avroAppendDouble(b, r.total.Seconds())
+	b = avroAppendLong(b, int64(r.client.messages))
+	b = avroAppendLong(b, int64(r.client.bytes))
+	b = avroAppendLong(b, int64(r.server.messages))
+	b = avroAppendLong(b, int64(r.server.bytes))
+	b = avroAppendOptionalLong(b, int64(r.serverQP.qpn), r.qps)
+	b = avroAppendOptionalLong(b, int64(r.serverQP.psn), r.qps)
+	b = avroAppendOptionalLong(b, int64(r.clientQP.qpn), r.qps)
+	return avroAppendOptionalLong(b, int64(r.clientQP.psn), r.qps)
+}
+
+// avroSink renders handshake events as records of an Avro object container
+// file, records are buffered and written in data blocks
+type avroSink struct {
+	lock    sync.Mutex
+	file    *rotatingFile
+	marker  []byte
+	block   []byte
+	records int64
+}
+
+// init initializes the Avro sink with the output file that is rotated after
+// maxSize bytes or maxAge and keeps keep rotated files
+func (a *avroSink) init(file string, maxSize int64, maxAge time.Duration,
+	keep int) error {
+	marker := make([]byte, 16)
+	if _, err := rand.Read(marker); err != nil {
+		return err
+	}
+	header := avroHeader(marker)
+	f, err := openRotatingFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		header, maxSize, maxAge, keep)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.file = f
+	a.marker = marker
+	a.block = nil
+	a.records = 0
+	return nil
+}
+
+// writeBlock writes the buffered records as data block, a must be locked
+func (a *avroSink) writeBlock() {
+	if a.file == nil || a.records == 0 {
+		return
+	}
+	b := avroAppendLong(nil, a.records)
+	b = avroAppendLong(b, int64(len(a.block)))
+	b = append(b, a.block...)
+	b = append(b, a.marker...)
+	if _, err := a.file.Write(b); err != nil {
+		log.Println("Error writing Avro output:", err)
+	}
+	a.block = a.block[:0]
+	a.records = 0
+}
+
+// flush writes the buffered records to the Avro output
+func (a *avroSink) flush() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.writeBlock()
+}
+
+// close writes the buffered records and closes the Avro output
+func (a *avroSink) close() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.file == nil {
+		return
+	}
+	a.writeBlock()
+	if err := a.file.Close(); err != nil {
+		log.Println("Error closing Avro output:", err)
+	}
+	a.file = nil
+}
+
+// accepts checks if the Avro sink renders events of type typ
+func (a *avroSink) accepts(typ string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.file != nil && typ == eventHandshake
+}
+
+// render renders the handshake event e as Avro record
+func (a *avroSink) render(e *event) {
+	if e.typ != eventHandshake {
+		return
+	}
+	r := avroHandshakeRecord(e.time, e.result)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.file == nil {
+		return
+	}
+	a.block = append(a.block, r...)
+	a.records++
+	if a.records >= avroBlockRecords {
+		a.writeBlock()
+	}
+}
+
+// setAvroOutput sets the Avro output according to the Avro and output
+// rotation command line arguments, the returned function writes the buffered
+// records and closes the Avro output
+func setAvroOutput() func() {
+	if *avroFile == "" {
+		return func() {}
+	}
+	if err := avroEvents.init(*avroFile, *outputRotateSize,
+		*outputRotateInterval, *outputRotateKeep); err != nil {
+		log.Fatal(err)
+	}
+	return avroEvents.close
+}
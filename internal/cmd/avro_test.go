@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// avroTestDecoder decodes values of Avro object container files
+type avroTestDecoder struct {
+	t *testing.T
+	b []byte
+}
+
+// long decodes a zigzag encoded long
+func (d *avroTestDecoder) long() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.t.Fatal("invalid long")
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// bytes decodes bytes with their length
+func (d *avroTestDecoder) bytes() []byte {
+	n := d.long()
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+// value decodes a value of the schema type typ
+func (d *avroTestDecoder) value(typ any) any {
+	switch typ := typ.(type) {
+	case string:
+		switch typ {
+		case "null":
+			return nil
+		case "int", "long":
+			return d.long()
+		case "string":
+			return string(d.bytes())
+		case "double":
+			v := binary.LittleEndian.Uint64(d.b)
+			d.b = d.b[8:]
+			return math.Float64frombits(v)
+		}
+	case map[string]any:
+		return d.value(typ["type"])
+	case []any:
+		return d.value(typ[d.long()])
+	}
+	d.t.Fatalf("unknown schema type %v", typ)
+	return nil
+}
+
+// avroTestRecords decodes the records of the Avro object container file data
+// to maps from field name to value
+func avroTestRecords(t *testing.T, data []byte) []map[string]any {
+	if !bytes.HasPrefix(data, []byte(avroMagic)) {
+		t.Fatal("invalid magic")
+	}
+	d := &avroTestDecoder{t, data[len(avroMagic):]}
+	meta := make(map[string]string)
+	for n := d.long(); n != 0; n = d.long() {
+		for i := int64(0); i < n; i++ {
+			k := string(d.bytes())
+			meta[k] = string(d.bytes())
+		}
+	}
+	if meta["avro.codec"] != "null" {
+		t.Fatalf("codec = %q; want null", meta["avro.codec"])
+	}
+	var schema struct {
+		Fields []struct {
+			Name string
+			Type any
+		}
+	}
+	if err := json.Unmarshal([]byte(meta["avro.schema"]),
+		&schema); err != nil {
+		t.Fatal(err)
+	}
+	marker := d.b[:16]
+	d.b = d.b[16:]
+
+	var records []map[string]any
+	for len(d.b) > 0 {
+		count := d.long()
+		size := d.long()
+		block := &avroTestDecoder{t, d.b[:size]}
+		d.b = d.b[size:]
+		for i := int64(0); i < count; i++ {
+			r := make(map[string]any)
+			for _, f := range schema.Fields {
+				r[f.Name] = block.value(f.Type)
+			}
+			records = append(records, r)
+		}
+		if len(block.b) != 0 {
+			t.Fatalf("%d bytes left in block", len(block.b))
+		}
+		if !bytes.Equal(d.b[:16], marker) {
+			t.Fatal("invalid sync marker")
+		}
+		d.b = d.b[16:]
+	}
+	return records
+}
+
+func TestAvroSink(t *testing.T) {
+	var a avroSink
+
+	// check disabled Avro sink
+	if a.accepts(eventHandshake) {
+		t.Error("a.accepts() = true; want false")
+	}
+
+	// render confirmed and declined handshakes
+	file := filepath.Join(t.TempDir(), "clc.avro")
+	if err := a.init(file, 0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if a.accepts(eventMessage) || !a.accepts(eventHandshake) {
+		t.Error("a.accepts() does not accept only handshakes")
+	}
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	ts := time.Unix(1, 500000)
+	a.render(&event{typ: eventHandshake, time: ts,
+		result: &handshakeResult{
+			id:        7,
+			key:       handshakeKey{net, trans},
+			version:   1,
+			diagnosis: "0x3030000",
+			total:     time.Second / 2,
+			client:    flowCounts{1, 52},
+		}})
+	a.flush()
+	a.render(&event{typ: eventHandshake, time: ts,
+		result: &handshakeResult{
+			id:        8,
+			key:       handshakeKey{net, trans},
+			version:   2,
+			confirmed: true,
+			qps:       true,
+			serverQP:  smcrQP{qpn: 228, psn: 1},
+			clientQP:  smcrQP{qpn: 229, psn: 2},
+			client:    flowCounts{2, 120},
+			server:    flowCounts{1, 68},
+		}})
+	a.close()
+
+	// check records
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := avroTestRecords(t, data)
+	common := map[string]any{
+		"time":     int64(1000500),
+		"src_addr": "1.2.3.4",
+		"src_port": int64(123),
+		"dst_addr": "5.6.7.8",
+		"dst_port": int64(456),
+	}
+	want := []map[string]any{{
+		"session":         int64(7),
+		"result":          "declined",
+		"path":            nil,
+		"version":         int64(1),
+		"diagnosis":       "0x3030000",
+		"duration":        0.5,
+		"client_messages": int64(1),
+		"client_bytes":    int64(52),
+		"server_messages": int64(0),
+		"server_bytes":    int64(0),
+		"server_qpn":      nil,
+		"server_psn":      nil,
+		"client_qpn":      nil,
+		"client_psn":      nil,
+	}, {
+		"session":         int64(8),
+		"result":          "confirmed",
+		"path":            "SMC-R",
+		"version":         int64(2),
+		"diagnosis":       nil,
+		"duration":        0.0,
+		"client_messages": int64(2),
+		"client_bytes":    int64(120),
+		"server_messages": int64(1),
+		"server_bytes":    int64(68),
+		"server_qpn":      int64(228),
+		"server_psn":      int64(1),
+		"client_qpn":      int64(229),
+		"client_psn":      int64(2),
+	}}
+	for _, w := range want {
+		for k, v := range common {
+			w[k] = v
+		}
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %v; want %v", records, want)
+	}
+}
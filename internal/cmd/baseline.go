@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	// baselineRateDelta is the minimum change of the success rate in
+	// percentage points reported as deviation
+	baselineRateDelta = 5.0
+
+	// baselineShareDelta is the minimum change of the share of a decline
+	// reason in all declines in percentage points reported as deviation
+	baselineShareDelta = 10.0
+
+	// baselineLatencyFactor is the minimum relative change of the median
+	// and average handshake durations reported as deviation
+	baselineLatencyFactor = 0.5
+)
+
+// baselineStats are the statistics of a run saved as baseline and compared
+// with the statistics of later runs, durations are in seconds
+type baselineStats struct {
+	Attempted   uint64             `json:"attempted"`
+	Succeeded   uint64             `json:"succeeded"`
+	Declined    uint64             `json:"declined"`
+	Fallbacks   uint64             `json:"fallbacks"`
+	SuccessRate float64            `json:"success_rate"`
+	Declines    map[string]float64 `json:"declines"`
+	Median      float64            `json:"median_duration"`
+	Average     float64            `json:"avg_duration"`
+}
+
+// currentBaseline returns the statistics of the current run
+func currentBaseline() *baselineStats {
+	b := &baselineStats{Declines: declines.shares()}
+	b.Attempted, b.Succeeded, b.Declined, b.Fallbacks = stats.counts()
+	b.SuccessRate = 100 * ratio(b.Succeeded, b.Attempted)
+
+	durations := report.sortedDurations()
+	if n := len(durations); n > 0 {
+		var sum time.Duration
+		for _, d := range durations {
+			sum += d
+		}
+		b.Median = durations[n/2].Seconds()
+		b.Average = (sum / time.Duration(n)).Seconds()
+	}
+	return b
+}
+
+// readBaseline reads the baseline statistics from file
+func readBaseline(file string) (*baselineStats, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b := &baselineStats{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", file, err)
+	}
+	return b, nil
+}
+
+// saveBaseline saves the statistics of the current run as baseline to file
+func saveBaseline(file string) error {
+	data, err := json.MarshalIndent(currentBaseline(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// latencyDeviation returns the deviation of the handshake duration current
+// from the baseline duration base in seconds named name or an empty string
+// if the change is not significant
+func latencyDeviation(name string, base, current float64) string {
+	if base == 0 || current == 0 {
+		return ""
+	}
+	change := (current - base) / base
+	if math.Abs(change) < baselineLatencyFactor {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s -> %s (%+.0f%%)", name,
+		time.Duration(base*float64(time.Second)),
+		time.Duration(current*float64(time.Second)), 100*change)
+}
+
+// baselineDeviations returns the significant deviations of the statistics
+// current from the baseline statistics base
+func baselineDeviations(base, current *baselineStats) []string {
+	var lines []string
+
+	// compare success rates
+	if base.Attempted > 0 && current.Attempted > 0 &&
+		math.Abs(current.SuccessRate-base.SuccessRate) >=
+			baselineRateDelta {
+		lines = append(lines, fmt.Sprintf("Success Rate: %.1f%% -> "+
+			"%.1f%% (%+.1f points)", base.SuccessRate,
+			current.SuccessRate,
+			current.SuccessRate-base.SuccessRate))
+	}
+
+	// compare decline mix
+	codes := make(map[string]bool)
+	for code := range base.Declines {
+		codes[code] = true
+	}
+	for code := range current.Declines {
+		codes[code] = true
+	}
+	for _, code := range sortedKeys(codes) {
+		b := 100 * base.Declines[code]
+		c := 100 * current.Declines[code]
+		if math.Abs(c-b) < baselineShareDelta {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Decline Mix: %s: %.1f%% -> "+
+			"%.1f%% of declines", code, b, c))
+	}
+
+	// compare latencies
+	for _, line := range []string{
+		latencyDeviation("Median Duration", base.Median,
+			current.Median),
+		latencyDeviation("Average Duration", base.Average,
+			current.Average),
+	} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// writeBaselineComparison compares the statistics of the current run with
+// the baseline in file and writes the deviations to w
+func writeBaselineComparison(w io.Writer, file string) error {
+	base, err := readBaseline(file)
+	if err != nil {
+		return err
+	}
+	lines := baselineDeviations(base, currentBaseline())
+	if len(lines) == 0 {
+		lines = []string{"no significant deviations"}
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "Baseline: %s\n", line)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBaselineDeviations(t *testing.T) {
+	no := "0x3030000 (no SMC device found (R or D))"
+	ind := "0x3010000 (peer did not indicate SMC)"
+	base := &baselineStats{
+		Attempted:   10,
+		SuccessRate: 90,
+		Declines:    map[string]float64{no: 1},
+		Median:      0.002,
+		Average:     0.003,
+	}
+
+	// test without deviations
+	current := &baselineStats{
+		Attempted:   20,
+		SuccessRate: 88,
+		Declines:    map[string]float64{no: 0.95, ind: 0.05},
+		Median:      0.0025,
+		Average:     0.003,
+	}
+	if got := baselineDeviations(base, current); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+
+	// test with deviations
+	current = &baselineStats{
+		Attempted:   20,
+		SuccessRate: 70,
+		Declines:    map[string]float64{no: 0.5, ind: 0.5},
+		Median:      0.005,
+		Average:     0.003,
+	}
+	want := []string{
+		"Success Rate: 90.0% -> 70.0% (-20.0 points)",
+		"Decline Mix: " + ind + ": 0.0% -> 50.0% of declines",
+		"Decline Mix: " + no + ": 100.0% -> 50.0% of declines",
+		"Median Duration: 2ms -> 5ms (+150%)",
+	}
+	got := baselineDeviations(base, current)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
+
+func TestSaveBaseline(t *testing.T) {
+	dir, err := os.MkdirTemp("", "smc-clc-baseline")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "stats.json")
+
+	// test saving and reading baseline of current run
+	if err := saveBaseline(file); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readBaseline(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := currentBaseline()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test invalid baseline
+	if err := os.WriteFile(file, []byte("invalid"), 0644); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := readBaseline(file); err == nil {
+		t.Errorf("got = nil; want error")
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+var (
+	// budgets stores the connection attempt budget table
+	budgets budgetTable
+)
+
+// attemptBudget is the maximum number of SMC connection attempts of the
+// clients in prefix per window, a nil prefix matches all clients
+type attemptBudget struct {
+	prefix *net.IPNet
+	limit  int
+	window time.Duration
+}
+
+// String converts the attempt budget to a string
+func (b *attemptBudget) String() string {
+	return fmt.Sprintf("%d/%s", b.limit, b.window)
+}
+
+// prefixLen returns the length of the prefix of the attempt budget or -1 if
+// it matches all clients
+func (b *attemptBudget) prefixLen() int {
+	if b.prefix == nil {
+		return -1
+	}
+	ones, _ := b.prefix.Mask.Size()
+	return ones
+}
+
+// parseAttemptBudgets parses the comma-separated list of attempt budgets in
+// spec. Each budget is limit/window with an optional prefix, e.g., 100/1m or
+// 10.0.0.0/8=1000/1m
+func parseAttemptBudgets(spec string) ([]*attemptBudget, error) {
+	var budgets []*attemptBudget
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		b := &attemptBudget{}
+		if prefix, budget, ok := strings.Cut(s, "="); ok {
+			_, ipnet, err := net.ParseCIDR(prefix)
+			if err != nil {
+				return nil, fmt.Errorf("invalid budget prefix "+
+					"%q", prefix)
+			}
+			b.prefix = ipnet
+			s = budget
+		}
+		limit, window, ok := strings.Cut(s, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid budget %q", s)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid budget limit %q", limit)
+		}
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid budget window %q",
+				window)
+		}
+		b.limit, b.window = n, d
+		budgets = append(budgets, b)
+	}
+	return budgets, nil
+}
+
+// budgetAlert is a client that exceeded its attempt budget
+type budgetAlert struct {
+	client   string
+	attempts int
+	budget   *attemptBudget
+}
+
+// String converts the budget alert to a string
+func (a *budgetAlert) String() string {
+	return fmt.Sprintf("%s: more than %d SMC connection attempts in %s",
+		a.client, a.budget.limit, a.budget.window)
+}
+
+// budgetEntry stores the connection attempts of a client in the current
+// window of its attempt budget
+type budgetEntry struct {
+	budget      *attemptBudget
+	windowStart time.Time
+	count       int
+	reported    bool
+}
+
+// budgetTable stores the attempt budgets and the connection attempts of the
+// clients protected by a mutex
+type budgetTable struct {
+	lock    sync.Mutex
+	budgets []*attemptBudget
+	bmap    map[gopacket.Endpoint]*budgetEntry
+}
+
+// init initializes the budget table with the attempt budgets in spec, an
+// empty spec disables the budgets
+func (bt *budgetTable) init(spec string) error {
+	var budgets []*attemptBudget
+	if spec != "" {
+		var err error
+		if budgets, err = parseAttemptBudgets(spec); err != nil {
+			return err
+		}
+	}
+
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	bt.budgets = budgets
+	bt.bmap = make(map[gopacket.Endpoint]*budgetEntry)
+	return nil
+}
+
+// enabled checks if there are attempt budgets
+func (bt *budgetTable) enabled() bool {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	return len(bt.budgets) > 0
+}
+
+// lookup returns the attempt budget with the longest prefix matching client
+// or nil if there is no such budget, bt must be locked
+func (bt *budgetTable) lookup(client gopacket.Endpoint) *attemptBudget {
+	ip := net.IP(client.Raw())
+	var match *attemptBudget
+	for _, b := range bt.budgets {
+		if b.prefix != nil && !b.prefix.Contains(ip) {
+			continue
+		}
+		if match == nil || b.prefixLen() > match.prefixLen() {
+			match = b
+		}
+	}
+	return match
+}
+
+// add adds a connection attempt of client at time ts to the budget table, it
+// returns an alert if the client exceeded its attempt budget with this
+// attempt
+func (bt *budgetTable) add(client gopacket.Endpoint,
+	ts time.Time) *budgetAlert {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	e := bt.bmap[client]
+	if e == nil {
+		b := bt.lookup(client)
+		if b == nil {
+			return nil
+		}
+		e = &budgetEntry{budget: b, windowStart: ts}
+		bt.bmap[client] = e
+	}
+
+	// count attempts in current window
+	if ts.Sub(e.windowStart) >= e.budget.window {
+		e.windowStart = ts
+		e.count = 0
+		e.reported = false
+	}
+	e.count++
+	if e.count <= e.budget.limit || e.reported {
+		return nil
+	}
+	e.reported = true
+	return &budgetAlert{
+		client:   client.String(),
+		attempts: e.count,
+		budget:   e.budget,
+	}
+}
+
+// expire removes the clients whose window ended before time now from the
+// budget table
+func (bt *budgetTable) expire(now time.Time) {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	for client, e := range bt.bmap {
+		if now.Sub(e.windowStart) >= e.budget.window {
+			delete(bt.bmap, client)
+		}
+	}
+}
+
+// printBudgetAlert prints the budget alert a
+func printBudgetAlert(a *budgetAlert) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sBudget Alert: %s\n", t, a)
+}
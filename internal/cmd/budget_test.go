@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestParseAttemptBudgets(t *testing.T) {
+	// test valid budgets
+	budgets, err := parseAttemptBudgets("100/1m, 10.0.0.0/8=1000/30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(budgets) != 2 {
+		t.Fatalf("len(budgets) = %d; want 2", len(budgets))
+	}
+	if got, want := budgets[0].String(), "100/1m0s"; got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	if got, want := budgets[1].prefix.String(), "10.0.0.0/8"; got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test invalid budgets
+	for _, spec := range []string{"100", "x/1m", "0/1m", "100/x",
+		"100/0s", "10.0.0.1=100/1m"} {
+		if _, err := parseAttemptBudgets(spec); err == nil {
+			t.Errorf("parseAttemptBudgets(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestBudgetTable(t *testing.T) {
+	var bt budgetTable
+
+	// initialize budget table and test clients
+	if err := bt.init("2/1m,10.0.0.0/24=3/1m,10.0.0.0/8=1/1m"); err != nil {
+		t.Fatal(err)
+	}
+	if !bt.enabled() {
+		t.Fatal("bt.enabled() = false; want true")
+	}
+	client := func(ip string) gopacket.Endpoint {
+		return layers.NewIPEndpoint(net.ParseIP(ip).To4())
+	}
+	ts := time.Unix(0, 0)
+
+	// test attempts of clients with default and prefix budgets
+	for _, test := range []struct {
+		ip    string
+		want  []bool
+		alert string
+	}{
+		{"1.2.3.4", []bool{false, false, true, false},
+			"1.2.3.4: more than 2 SMC connection attempts in 1m0s"},
+		{"10.0.0.1", []bool{false, false, false, true},
+			"10.0.0.1: more than 3 SMC connection attempts in 1m0s"},
+		{"10.1.0.1", []bool{false, true, false, false},
+			"10.1.0.1: more than 1 SMC connection attempts in 1m0s"},
+	} {
+		for i, want := range test.want {
+			a := bt.add(client(test.ip), ts)
+			if got := a != nil; got != want {
+				t.Fatalf("%s: bt.add() #%d = %t; want %t",
+					test.ip, i, got, want)
+			}
+			if a != nil && a.String() != test.alert {
+				t.Errorf("got = %s; want %s", a, test.alert)
+			}
+		}
+	}
+
+	// test attempts in next window
+	ts = ts.Add(time.Minute)
+	if a := bt.add(client("10.1.0.1"), ts); a != nil {
+		t.Errorf("bt.add() = %s; want nil", a)
+	}
+	if a := bt.add(client("10.1.0.1"), ts); a == nil {
+		t.Errorf("bt.add() = nil; want alert")
+	}
+
+	// test expiring ended windows
+	bt.expire(ts)
+	if len(bt.bmap) != 1 {
+		t.Errorf("len(bt.bmap) = %d; want 1", len(bt.bmap))
+	}
+
+	// test disabled budgets
+	if err := bt.init(""); err != nil {
+		t.Fatal(err)
+	}
+	if bt.enabled() {
+		t.Error("bt.enabled() = true; want false")
+	}
+	if a := bt.add(client("1.2.3.4"), ts); a != nil {
+		t.Errorf("bt.add() = %s; want nil", a)
+	}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// bufferSizes stores the buffer size table
+	bufferSizes bufferSizeTable
+)
+
+// bufferSizeKey identifies a buffer size of a side of handshakes on a path
+type bufferSizeKey struct {
+	path   clc.Path
+	server bool
+	size   clc.RMBESize
+}
+
+// String converts the buffer size key to a string
+func (k bufferSizeKey) String() string {
+	side := "Client"
+	if k.server {
+		side = "Server"
+	}
+	buffer := "RMBE"
+	if k.path == clc.SMCTypeD {
+		buffer = "DMBE"
+	}
+	return fmt.Sprintf("%s %s %s Size %s", k.path, side, buffer, k.size)
+}
+
+// bufferSizeTable stores the number of successful handshakes per negotiated
+// RMBE or DMBE size of servers and clients protected by a mutex
+type bufferSizeTable struct {
+	lock  sync.Mutex
+	sizes map[bufferSizeKey]uint64
+}
+
+// init initializes the buffer size table
+func (bt *bufferSizeTable) init() {
+	bt.lock.Lock()
+	if bt.sizes == nil {
+		bt.sizes = make(map[bufferSizeKey]uint64)
+	}
+	bt.lock.Unlock()
+}
+
+// add adds the buffer sizes of server and client of the finished handshake r
+// to the buffer size table if the handshake succeeded
+func (bt *bufferSizeTable) add(r *handshakeResult) {
+	if !r.confirmed || !r.buffers {
+		return
+	}
+
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	if bt.sizes == nil {
+		return
+	}
+	bt.sizes[bufferSizeKey{r.path, true, r.serverBuffer}]++
+	bt.sizes[bufferSizeKey{r.path, false, r.clientBuffer}]++
+}
+
+// lines returns the buffer size distribution with one line per path, side,
+// and size including its share of the handshakes on the path
+func (bt *bufferSizeTable) lines() []string {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	keys := make([]bufferSizeKey, 0, len(bt.sizes))
+	totals := make(map[clc.Path]uint64)
+	for key, n := range bt.sizes {
+		keys = append(keys, key)
+		if key.server {
+			totals[key.path] += n
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		if keys[i].server != keys[j].server {
+			return keys[i].server
+		}
+		return keys[i].size < keys[j].size
+	})
+
+	var lines []string
+	for _, key := range keys {
+		n := bt.sizes[key]
+		lines = append(lines, fmt.Sprintf("%s: %d handshakes (%.1f%%)",
+			key, n, 100*float64(n)/float64(totals[key.path])))
+	}
+	return lines
+}
+
+// messageBufferSize returns the compressed RMBE or DMBE size in the accept
+// or confirm message msg and if msg contains a buffer size
+func messageBufferSize(msg clc.Message) (clc.RMBESize, bool) {
+	switch m := msg.(type) {
+	case *clc.AcceptSMCR:
+		return m.RMBESize, true
+	case *clc.ConfirmSMCR:
+		return m.RMBESize, true
+	case *clc.AcceptSMCD:
+		return m.DMBESize, true
+	case *clc.ConfirmSMCD:
+		return m.DMBESize, true
+	case *clc.AcceptSMCDv2:
+		return m.DMBESize, true
+	case *clc.ConfirmSMCDv2:
+		return m.DMBESize, true
+	}
+	return 0, false
+}
+
+// writeBufferSizes writes the buffer size distribution to w
+func writeBufferSizes(w io.Writer) {
+	for _, line := range bufferSizes.lines() {
+		fmt.Fprintf(w, "Buffer Sizes: %s\n", line)
+	}
+}
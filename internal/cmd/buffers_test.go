@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestBufferSizeTable(t *testing.T) {
+	var bt bufferSizeTable
+
+	// test buffer sizes in accept and confirm messages
+	accept := testHandshakeMessage("e2d4c3d902004418b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e40000157d010000" +
+		"0005230000000000f0a600000072f5fe" +
+		"e2d4c3d9")
+	if got, ok := messageBufferSize(accept); !ok || got != 2 {
+		t.Errorf("got = %s, %t; want 2, true", got, ok)
+	}
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	if _, ok := messageBufferSize(proposal); ok {
+		t.Errorf("got = true; want false")
+	}
+
+	// add successful, declined, and SMC-D handshakes
+	bt.init()
+	smcr := &handshakeResult{confirmed: true, buffers: true,
+		path: clc.SMCTypeR, serverBuffer: 2, clientBuffer: 1}
+	bt.add(smcr)
+	bt.add(smcr)
+	bt.add(&handshakeResult{confirmed: true, buffers: true,
+		path: clc.SMCTypeR, serverBuffer: 3, clientBuffer: 1})
+	bt.add(&handshakeResult{})
+	bt.add(&handshakeResult{confirmed: true, buffers: true,
+		path: clc.SMCTypeD, serverBuffer: 0, clientBuffer: 0})
+
+	// test distribution
+	want := []string{
+		"SMC-R Server RMBE Size 2 (65536): 2 handshakes (66.7%)",
+		"SMC-R Server RMBE Size 3 (131072): 1 handshakes (33.3%)",
+		"SMC-R Client RMBE Size 1 (32768): 3 handshakes (100.0%)",
+		"SMC-D Server DMBE Size 0 (16384): 1 handshakes (100.0%)",
+		"SMC-D Client DMBE Size 0 (16384): 1 handshakes (100.0%)",
+	}
+	got := bt.lines()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+// CEF header fields
+const (
+	cefVendor  = "hwipl"
+	cefProduct = "smc-clc"
+)
+
+// CEF severities
+const (
+	cefLow     = 1
+	cefWarning = 3
+	cefMedium  = 5
+	cefError   = 6
+	cefHigh    = 7
+)
+
+var (
+	// cefEvents is the CEF sink
+	cefEvents cefSink
+
+	// cefHeaderEscaper escapes the header fields of CEF records
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`,
+		"\n", " ", "\r", " ")
+
+	// cefValueEscaper escapes the extension values of CEF records
+	cefValueEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`,
+		"\n", `\n`, "\r", `\r`)
+)
+
+// cefVersion returns the version of smc-clc for the CEF header
+func cefVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
+
+// cefExtension is the extension of a CEF record: key-value pairs in the
+// order they are added
+type cefExtension []string
+
+// add adds the key with value to the extension, empty values are omitted
+func (c *cefExtension) add(key, value string) {
+	if value == "" {
+		return
+	}
+	*c = append(*c, key+"="+cefValueEscaper.Replace(value))
+}
+
+// addLabel adds the custom key with value and its label to the extension
+func (c *cefExtension) addLabel(key, label, value string) {
+	if value == "" {
+		return
+	}
+	c.add(key, value)
+	c.add(key+"Label", label)
+}
+
+// addFlow adds the source and destination addresses and ports of the network
+// flow net and the transport flow trans to the extension, IPv6 addresses use
+// the custom IPv6 address keys
+func (c *cefExtension) addFlow(net, trans gopacket.Flow) {
+	c.addSource(net.Src().String())
+	c.add("spt", trans.Src().String())
+	c.addAddress("dst", "c6a3", "Destination IPv6 Address",
+		net.Dst().String())
+	c.add("dpt", trans.Dst().String())
+	c.add("proto", "TCP")
+}
+
+// addSource adds the source IP address addr to the extension
+func (c *cefExtension) addSource(addr string) {
+	c.addAddress("src", "c6a2", "Source IPv6 Address", addr)
+}
+
+// addAddress adds the IP address addr to the extension with the key v4 or,
+// if it is an IPv6 address, with the custom key v6 and its label
+func (c *cefExtension) addAddress(v4, v6, label, addr string) {
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		c.addLabel(v6, label, addr)
+		return
+	}
+	c.add(v4, addr)
+}
+
+// cefRecord returns a CEF record with the signature id, name, and severity
+// of an event at time t with the extension ext
+func cefRecord(t time.Time, id, name string, severity int,
+	ext cefExtension) string {
+	header := []string{"CEF:0", cefVendor, cefProduct, cefVersion(), id,
+		name, fmt.Sprint(severity)}
+	for i := range header[1:] {
+		header[i+1] = cefHeaderEscaper.Replace(header[i+1])
+	}
+	ext = append(cefExtension{fmt.Sprintf("rt=%d", t.UnixMilli())},
+		ext...)
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// cefHandshakeRecord returns the handshake r finished at time t as CEF record
+func cefHandshakeRecord(t time.Time, r *handshakeResult) string {
+	var ext cefExtension
+	ext.addFlow(r.key.net, r.key.trans)
+	ext.addLabel("cn1", "Session", fmt.Sprint(r.id))
+	ext.addLabel("cn2", "SMC Version", fmt.Sprint(r.version))
+	ext.addLabel("cfp1", "Duration Seconds",
+		fmt.Sprint(r.total.Seconds()))
+	ext.add("out", fmt.Sprint(r.client.bytes))
+	ext.add("in", fmt.Sprint(r.server.bytes))
+	if !r.confirmed {
+		ext.add("outcome", "failure")
+		ext.addLabel("cs2", "Diagnosis", r.diagnosis)
+		return cefRecord(t, "handshake-declined",
+			"SMC handshake declined", cefMedium, ext)
+	}
+	ext.add("outcome", "success")
+	ext.addLabel("cs1", "SMC Path", r.path.String())
+	return cefRecord(t, "handshake-confirmed", "SMC handshake confirmed",
+		cefLow, ext)
+}
+
+// cefFallbackRecord returns the connection of the network flow net and the
+// transport flow trans that fell back to tcp because of reason at time t as
+// CEF record
+func cefFallbackRecord(t time.Time, net, trans gopacket.Flow,
+	reason string) string {
+	var ext cefExtension
+	ext.addFlow(net, trans)
+	ext.add("reason", reason)
+	return cefRecord(t, "fallback", "SMC connection fell back to TCP",
+		cefWarning, ext)
+}
+
+// cefOverflowRecord returns the flow of the network flow net and the
+// transport flow trans rejected or evicted, as given by action, because the
+// flow table was full at time t as CEF record
+func cefOverflowRecord(t time.Time, net, trans gopacket.Flow,
+	action string) string {
+	var ext cefExtension
+	ext.addFlow(net, trans)
+	ext.add("act", action)
+	return cefRecord(t, "flow-overflow", "Flow table full", cefMedium,
+		ext)
+}
+
+// cefAlertRecord returns the budget alert a raised at time t as CEF record
+func cefAlertRecord(t time.Time, a *budgetAlert) string {
+	var ext cefExtension
+	ext.addSource(a.client)
+	ext.add("cnt", fmt.Sprint(a.attempts))
+	ext.addLabel("cn1", "Budget", fmt.Sprint(a.budget.limit))
+	ext.addLabel("cs1", "Budget Window", a.budget.window.String())
+	ext.add("msg", a.String())
+	return cefRecord(t, "attempt-budget",
+		"SMC connection attempt budget exceeded", cefHigh, ext)
+}
+
+// cefPeerAlertRecord returns the alert of source about the peers in the
+// network flow net and the transport flow trans, if set, raised at time t as
+// CEF record
+func cefPeerAlertRecord(t time.Time, net, trans gopacket.Flow, source,
+	alert string) string {
+	var ext cefExtension
+	ext.addSource(endpointAddr(net.Src()))
+	ext.add("spt", endpointAddr(trans.Src()))
+	ext.addAddress("dst", "c6a3", "Destination IPv6 Address",
+		endpointAddr(net.Dst()))
+	ext.add("dpt", endpointAddr(trans.Dst()))
+	ext.addLabel("cs1", "Alert Source", source)
+	ext.add("msg", alert)
+	return cefRecord(t, source, "SMC alert", cefHigh, ext)
+}
+
+// cefErrorRecord returns the error err of source found at time t in the
+// messages of the network flow net and the transport flow trans as CEF record
+func cefErrorRecord(t time.Time, net, trans gopacket.Flow, source,
+	err string) string {
+	var ext cefExtension
+	ext.addFlow(net, trans)
+	ext.addLabel("cs1", "Error Source", source)
+	ext.add("msg", err)
+	return cefRecord(t, "error-"+source, "SMC message error", cefError,
+		ext)
+}
+
+// cefSink renders handshake, fallback, overflow, alert, and error events as
+// CEF records to the CEF output
+type cefSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// setOutput sets the CEF output to w, nil disables the CEF output
+func (c *cefSink) setOutput(w io.Writer) {
+	c.lock.Lock()
+	c.w = w
+	c.lock.Unlock()
+}
+
+// accepts checks if the CEF sink renders events of type typ
+func (c *cefSink) accepts(typ string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.w == nil {
+		return false
+	}
+	switch typ {
+	case eventHandshake, eventFallback, eventOverflow, eventAlert,
+		eventError:
+		return true
+	}
+	return false
+}
+
+// render renders the event e as CEF record
+func (c *cefSink) render(e *event) {
+	var record string
+	switch e.typ {
+	case eventHandshake:
+		record = cefHandshakeRecord(e.time, e.result)
+	case eventFallback:
+		record = cefFallbackRecord(e.time, e.net, e.trans, e.reason)
+	case eventOverflow:
+		record = cefOverflowRecord(e.time, e.net, e.trans, e.reason)
+	case eventAlert:
+		if e.reason == alertBudget {
+			record = cefAlertRecord(e.time, e.alert)
+			break
+		}
+		record = cefPeerAlertRecord(e.time, e.net, e.trans, e.reason,
+			e.text)
+	case eventError:
+		record = cefErrorRecord(e.time, e.net, e.trans, e.reason,
+			e.text)
+	default:
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.w == nil {
+		return
+	}
+	if _, err := fmt.Fprintln(c.w, record); err != nil {
+		log.Println("Error writing CEF output:", err)
+	}
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestCEFSink(t *testing.T) {
+	var buf bytes.Buffer
+	var c cefSink
+
+	// check disabled CEF sink
+	if c.accepts(eventHandshake) {
+		t.Error("c.accepts() = true; want false")
+	}
+
+	// render handshake and message events
+	c.setOutput(&buf)
+	defer c.setOutput(nil)
+	if c.accepts(eventMessage) {
+		t.Error("c.accepts(message) = true; want false")
+	}
+	net, _ := gopacket.FlowFromEndpoints(
+		layers.NewIPEndpoint(net.ParseIP("2001:db8::1")),
+		layers.NewIPEndpoint(net.ParseIP("2001:db8::2")))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	c.render(&event{
+		typ:  eventHandshake,
+		time: time.UnixMilli(1500),
+		result: &handshakeResult{
+			id:        1,
+			key:       handshakeKey{net, trans},
+			version:   1,
+			diagnosis: "0x3030000 (no SMC device found (R or D))",
+		},
+	})
+	c.render(&event{typ: eventMessage})
+
+	// check CEF record
+	want := "CEF:0|hwipl|smc-clc|" + cefVersion() + "|handshake-declined|" +
+		"SMC handshake declined|5|rt=1500 c6a2=2001:db8::1 " +
+		"c6a2Label=Source IPv6 Address spt=123 c6a3=2001:db8::2 " +
+		"c6a3Label=Destination IPv6 Address " +
+		"dpt=456 proto=TCP cn1=1 cn1Label=Session cn2=1 " +
+		"cn2Label=SMC Version cfp1=0 cfp1Label=Duration Seconds " +
+		"out=0 in=0 outcome=failure cs2=0x3030000 (no SMC device " +
+		"found (R or D)) cs2Label=Diagnosis\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got = %q; want %q", got, want)
+	}
+}
+
+func TestCEFEscape(t *testing.T) {
+	var ext cefExtension
+	ext.add("msg", "a=b\\c\nd")
+	got := cefRecord(time.UnixMilli(0), "error-check", "a|b", cefError,
+		ext)
+	want := "|error-check|a\\|b|6|rt=0 msg=a\\=b\\\\c\\nd"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got = %q; want suffix %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+var (
+	// churn stores the connection churn table
+	churn churnTable
+)
+
+// churnKey identifies a client connecting to a service
+type churnKey struct {
+	client  gopacket.Endpoint
+	server  gopacket.Endpoint
+	service gopacket.Endpoint
+}
+
+// String converts the churn key to a string
+func (k churnKey) String() string {
+	return fmt.Sprintf("%s -> %s:%s", k.client, k.server, k.service)
+}
+
+// churnEntry stores the connection attempts of a client to a service
+type churnEntry struct {
+	// current one second window
+	windowStart time.Time
+	windowCount int
+	reported    bool
+
+	// current summary interval
+	attempts int
+	reused   int
+	peak     int
+	exceeded bool
+	ports    map[gopacket.Endpoint]bool
+}
+
+// churnTable stores connection churn entries protected by a mutex
+type churnTable struct {
+	lock sync.Mutex
+	cmap map[churnKey]*churnEntry
+}
+
+// init initializes the churn table
+func (ct *churnTable) init() {
+	ct.lock.Lock()
+	if ct.cmap == nil {
+		ct.cmap = make(map[churnKey]*churnEntry)
+	}
+	ct.lock.Unlock()
+}
+
+// add adds a connection attempt identified by the network flow net and the
+// transport flow trans at time ts to the churn table, it returns true if the
+// client exceeded the churn threshold with this attempt
+func (ct *churnTable) add(net, trans gopacket.Flow, ts time.Time) bool {
+	key := churnKey{
+		client:  net.Src(),
+		server:  net.Dst(),
+		service: trans.Dst(),
+	}
+
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+
+	e := ct.cmap[key]
+	if e == nil {
+		e = &churnEntry{ports: make(map[gopacket.Endpoint]bool)}
+		ct.cmap[key] = e
+	}
+
+	// count attempts and reused source ports in summary interval
+	e.attempts++
+	if e.ports[trans.Src()] {
+		e.reused++
+	}
+	e.ports[trans.Src()] = true
+
+	// count attempts in current one second window
+	if ts.Sub(e.windowStart) >= time.Second {
+		e.windowStart = ts
+		e.windowCount = 0
+		e.reported = false
+	}
+	e.windowCount++
+	if e.windowCount > e.peak {
+		e.peak = e.windowCount
+	}
+	if e.windowCount <= *churnThreshold || e.reported {
+		return false
+	}
+	e.reported = true
+	e.exceeded = true
+	return true
+}
+
+// summary returns the churn summary of all clients that exceeded the churn
+// threshold since the last call and resets the summary interval
+func (ct *churnTable) summary() []string {
+	var lines []string
+
+	ct.lock.Lock()
+	for key, e := range ct.cmap {
+		if e.exceeded {
+			lines = append(lines, fmt.Sprintf("%s: %d attempts, "+
+				"%d reused source ports, peak %d attempts/s",
+				key, e.attempts, e.reused, e.peak))
+		}
+		delete(ct.cmap, key)
+	}
+	ct.lock.Unlock()
+
+	sort.Strings(lines)
+	return lines
+}
+
+// churnAlert returns the alert event about the connection churn of the
+// client identified by the network flow net and the transport flow trans
+func churnAlert(net, trans gopacket.Flow) *event {
+	return &event{typ: eventAlert, reason: alertChurn, net: net,
+		trans: trans, text: fmt.Sprintf("more than %d SMC connection "+
+			"attempts per second", *churnThreshold)}
+}
+
+// emitChurnSummary emits the churn summary of all clients that exceeded the
+// churn threshold as alert events
+func emitChurnSummary() {
+	for _, line := range churn.summary() {
+		emit(&event{typ: eventAlert, reason: alertChurnSummary,
+			text: line})
+	}
+}
+
+// printChurnWarning prints the churn alert about the client identified by the
+// network flow net and the transport flow trans
+func printChurnWarning(net, trans gopacket.Flow, alert string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sChurn: %s -> %s:%s: %s\n", t, net.Src(),
+		net.Dst(), trans.Dst(), alert)
+}
+
+// printChurnSummary prints the churn summary line of a client that exceeded
+// the churn threshold
+func printChurnSummary(line string) {
+	fmt.Fprintf(stdout, "Churn Summary: %s\n", line)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestChurnTable(t *testing.T) {
+	var ct churnTable
+
+	// initialize churn table and test flows
+	ct.init()
+	*churnThreshold = 2
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans := func(port uint16) gopacket.Flow {
+		f, _ := gopacket.FlowFromEndpoints(
+			layers.NewTCPPortEndpoint(layers.TCPPort(port)),
+			layers.NewTCPPortEndpoint(456))
+		return f
+	}
+	ts := time.Unix(0, 0)
+
+	// test attempts below threshold
+	for i, want := range []bool{false, false, true, false} {
+		got := ct.add(net, trans(uint16(100+i%3)), ts)
+		if got != want {
+			t.Errorf("ct.add() = %t; want %t", got, want)
+		}
+	}
+
+	// test attempts in next window
+	ts = ts.Add(time.Second)
+	got := ct.add(net, trans(200), ts)
+	if got != false {
+		t.Errorf("ct.add() = %t; want %t", got, false)
+	}
+
+	// test summary
+	lines := ct.summary()
+	if len(lines) != 1 {
+		t.Fatalf("len(lines) = %d; want 1", len(lines))
+	}
+	want := "1.2.3.4 -> 5.6.7.8:456: 5 attempts, 1 reused source " +
+		"ports, peak 4 attempts/s"
+	if lines[0] != want {
+		t.Errorf("got = %s; want %s", lines[0], want)
+	}
+
+	// test summary after reset
+	lines = ct.summary()
+	if len(lines) != 0 {
+		t.Errorf("len(lines) = %d; want 0", len(lines))
+	}
+	*churnThreshold = 0
+}
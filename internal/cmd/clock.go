@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// clock is the time source of the timer, the reassembly flush, and
+	// the statistics intervals
+	clock timeSource
+)
+
+// clockTicker delivers ticks of a time source in intervals on its channel
+type clockTicker struct {
+	C <-chan time.Time
+
+	// ticks of the wall clock or, when replaying, the channel, the
+	// interval, and the time of the next tick
+	wall     *time.Ticker
+	c        chan time.Time
+	interval time.Duration
+	next     time.Time
+}
+
+// timeSource provides the current time: the wall clock when capturing live
+// or, when replaying pcap files, the timestamp of the last packet. When
+// replaying, it paces the packets at the replay speed, 0 is maximum speed
+type timeSource struct {
+	lock    sync.Mutex
+	replay  bool
+	speed   float64
+	last    time.Time
+	first   time.Time
+	start   time.Time
+	tickers []*clockTicker
+}
+
+// parseReplaySpeed parses the replay speed in spec: "max" or a factor like
+// "1x" or "10x". It returns 0 for maximum speed
+func parseReplaySpeed(spec string) (float64, error) {
+	if spec == "max" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(spec, "x"), 64)
+	if err != nil || !strings.HasSuffix(spec, "x") || speed <= 0 {
+		return 0, fmt.Errorf("invalid replay speed %q", spec)
+	}
+	return speed, nil
+}
+
+// init initializes the time source, replay indicates if pcap files are
+// replayed at the replay speed in spec
+func (ts *timeSource) init(replay bool, spec string) error {
+	speed, err := parseReplaySpeed(spec)
+	if err != nil {
+		return err
+	}
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.replay, ts.speed = replay, speed
+	ts.last, ts.first, ts.start = time.Time{}, time.Time{}, time.Time{}
+	ts.tickers = nil
+	return nil
+}
+
+// now returns the current time of the time source
+func (ts *timeSource) now() time.Time {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if !ts.replay || ts.last.IsZero() {
+		return time.Now()
+	}
+	return ts.last
+}
+
+// advance advances the time source to the packet timestamp t when
+// replaying: it waits until the packet is due at the replay speed and
+// delivers the ticks of the tickers up to t
+func (ts *timeSource) advance(t time.Time) {
+	ts.lock.Lock()
+	if !ts.replay {
+		ts.lock.Unlock()
+		return
+	}
+
+	// pace packet at replay speed
+	var wait time.Duration
+	if ts.first.IsZero() {
+		ts.first, ts.start = t, time.Now()
+	} else if ts.speed > 0 {
+		due := ts.start.Add(time.Duration(float64(t.Sub(ts.first)) /
+			ts.speed))
+		wait = time.Until(due)
+	}
+	ts.lock.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	// deliver ticks, like the wall clock tickers, drop ticks for slow
+	// receivers
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	if !t.After(ts.last) {
+		return
+	}
+	ts.last = t
+	for _, tick := range ts.tickers {
+		if tick.next.IsZero() {
+			tick.next = t.Add(tick.interval)
+			continue
+		}
+		if t.Before(tick.next) {
+			continue
+		}
+		select {
+		case tick.c <- tick.next:
+		default:
+		}
+		missed := t.Sub(tick.next) / tick.interval
+		tick.next = tick.next.Add((missed + 1) * tick.interval)
+	}
+}
+
+// newTicker returns a new ticker of the time source with interval
+func (ts *timeSource) newTicker(interval time.Duration) *clockTicker {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if !ts.replay {
+		wall := time.NewTicker(interval)
+		return &clockTicker{C: wall.C, wall: wall}
+	}
+	c := make(chan time.Time, 1)
+	tick := &clockTicker{C: c, c: c, interval: interval}
+	if !ts.last.IsZero() {
+		tick.next = ts.last.Add(interval)
+	}
+	ts.tickers = append(ts.tickers, tick)
+	return tick
+}
+
+// stopTicker stops the ticker tick of the time source
+func (ts *timeSource) stopTicker(tick *clockTicker) {
+	if tick.wall != nil {
+		tick.wall.Stop()
+		return
+	}
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	for i, t := range ts.tickers {
+		if t == tick {
+			ts.tickers = append(ts.tickers[:i], ts.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseReplaySpeed(t *testing.T) {
+	for _, test := range []struct {
+		spec  string
+		speed float64
+		err   bool
+	}{
+		{"max", 0, false},
+		{"1x", 1, false},
+		{"10x", 10, false},
+		{"0.5x", 0.5, false},
+		{"10", 0, true},
+		{"0x", 0, true},
+		{"fast", 0, true},
+	} {
+		speed, err := parseReplaySpeed(test.spec)
+		if speed != test.speed || (err != nil) != test.err {
+			t.Errorf("%s: got = %g, %v; want %g, %t", test.spec,
+				speed, err, test.speed, test.err)
+		}
+	}
+}
+
+func TestTimeSourceReplay(t *testing.T) {
+	var ts timeSource
+	if err := ts.init(true, "max"); err != nil {
+		t.Fatal(err)
+	}
+
+	// test clock and ticker driven by packet timestamps
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tick := ts.newTicker(time.Minute)
+	ts.advance(start)
+	if got := ts.now(); !got.Equal(start) {
+		t.Errorf("got = %s; want %s", got, start)
+	}
+	ts.advance(start.Add(30 * time.Second))
+	select {
+	case <-tick.C:
+		t.Errorf("got tick before interval; want no tick")
+	default:
+	}
+	ts.advance(start.Add(5 * time.Minute))
+	select {
+	case got := <-tick.C:
+		if want := start.Add(time.Minute); !got.Equal(want) {
+			t.Errorf("got = %s; want %s", got, want)
+		}
+	default:
+		t.Errorf("got no tick; want tick")
+	}
+
+	// test timestamps going back do not move clock
+	ts.advance(start)
+	if got, want := ts.now(), start.Add(5*time.Minute); !got.Equal(want) {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test stopped ticker
+	ts.stopTicker(tick)
+	ts.advance(start.Add(10 * time.Minute))
+	select {
+	case <-tick.C:
+		t.Errorf("got tick of stopped ticker; want no tick")
+	default:
+	}
+}
@@ -5,51 +5,366 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 )
 
 var (
 	// pcap variables
-	pcapFile = flag.String("f", "",
-		"read packets from a pcap file and set it to `file`")
-	pcapDevice = flag.String("i", "", "read packets from "+
-		"a network interface (default) and set it to `interface`")
+	pcapFiles = pcapFileFlag("f", "read packets from a pcap file "+
+		"and set it to `file`, repeat or use a glob pattern to read "+
+		"multiple files one after the other")
+	pcapDir = flag.String("f-dir", "", "read packets from completed "+
+		"pcap files in directory `dir` (e.g.: tcpdump ring buffer)")
+	pcapDirPattern = flag.String("pattern", "*",
+		"set pcap file name pattern in pcap directory to `pattern`")
+	pcapDirDelete = flag.Bool("f-delete", false,
+		"delete processed files in pcap directory")
+	pcapDirArchive = flag.String("f-archive", "",
+		"move processed files in pcap directory to directory `dir`")
+	pcapFD = flag.Int("f-fd", -1, "read packets in pcap format from "+
+		"inherited file descriptor `fd` (e.g.: 3 with systemd socket "+
+		"activation)")
+	pcapUnix = flag.String("f-unix", "", "read packets in pcap format "+
+		"from a file descriptor received over the unix socket `path`")
+	pcapDevices = interfaceFlag("i", "read packets from "+
+		"a network interface (default) and set it to `interface`, "+
+		"repeat or comma-separate to capture on multiple interfaces")
+	remoteHost = flag.String("remote", "", "read packets captured on "+
+		"the remote host `destination` (e.g.: user@host) over ssh")
+	remoteCapture = flag.String("remote-command", "tcpdump", "run "+
+		"capture `command` on the remote host: tcpdump or dumpcap, "+
+		"optionally prefixed (e.g.: \"sudo tcpdump\")")
+	containerName = flag.String("container", "", "read packets from "+
+		"the host side veth interfaces of the container `name`")
+	containerRuntime = flag.String("container-runtime", "auto",
+		"resolve containers with `runtime`: docker, cri, or auto")
 	pcapPromisc = flag.Bool("pcap-promisc", true,
 		"set network interface to promiscuous mode")
 	pcapSnaplen = flag.Int("pcap-snaplen", 2048,
 		"set pcap snaplen to `bytes`")
+	snaplenAuto = flag.Bool("pcap-snaplen-auto", false, "raise the "+
+		"snaplen and restart the live capture when packets of "+
+		"monitored connections are truncated")
 	pcapTimeout = flag.Int("pcap-timeout", 0,
 		"set pcap timeout to `milliseconds`")
+	pcapBufferSize = flag.Int("pcap-buffer-size", 0, "set pcap "+
+		"capture buffer size to `bytes` (0 uses the libpcap default)")
+	pcapImmediate = flag.Bool("pcap-immediate", false, "set pcap "+
+		"immediate mode to deliver packets without buffering")
+	pcapTimestampSource = flag.String("pcap-timestamp-source", "", "set "+
+		"pcap timestamp `source`, e.g.: host, adapter, "+
+		"adapter_unsynced")
 	pcapMaxPkts = flag.Int("pcap-maxpkts", 0, "set maximum packets to "+
 		"capture to `number` (may require pcap-timeout argument)")
 	pcapMaxTime = flag.Int("pcap-maxtime", 0, "set maximum capturing "+
 		"time to `seconds` (may require pcap-timeout argument)")
-	pcapFilter = flag.String("pcap-filter", "",
-		"set pcap packet filter to `filter` (e.g.: \"not port 22\")")
+	pcapFilter = flag.String("pcap-filter", "", "set pcap packet "+
+		"filter to `filter` instead of the generated filter "+
+		"(e.g.: \"not port 22\")")
+	filterPorts = flag.String("filter-ports", "", "restrict the "+
+		"generated pcap filter to tcp ports in `list` (comma-separated)")
+	filterNets = flag.String("filter-nets", "", "restrict the "+
+		"generated pcap filter to subnets in `list` (comma-separated, "+
+		"e.g.: 10.0.0.0/8,fd00::/8)")
+	printFilter = flag.Bool("print-filter", false,
+		"print the pcap filter and exit")
+	captureXDP = flag.Bool("xdp", false, "read packets from the "+
+		"network interfaces with AF_XDP sockets (captured packets "+
+		"are not passed to the network stack, use a mirror port)")
+	xdpForce = flag.Bool("xdp-force", false, "with -xdp, also capture "+
+		"on network interfaces with IP addresses, this takes their "+
+		"traffic away from the host")
+	pcapPrefilter = flag.Bool("pcap-prefilter", false, "only capture "+
+		"SMC SYNs, SYN-ACKs, FINs, RSTs, and CLC messages with a "+
+		"kernel packet filter to reduce the load on busy links")
+	replaySpeed = flag.String("replay-speed", "max", "replay pcap "+
+		"files at `speed`: 1x (real time), Nx (e.g.: 10x), or max")
+	ipDefrag = flag.Bool("defrag", false, "reassemble fragmented IPv4 "+
+		"packets before tcp stream reassembly")
+	dedupWindow = flag.Duration("dedup", 0, "drop duplicate packets "+
+		"of mirrored traffic seen again within `window` (0 disables)")
+	flushNew = flag.Duration("flush-new", 10*time.Second, "flush "+
+		"reassembly of connections without proposal after `duration` "+
+		"without activity")
+	flushHandshake = flag.Duration("flush-handshake", time.Minute,
+		"flush reassembly of connections in handshake after "+
+			"`duration` without activity")
+	flushDone = flag.Duration("flush-done", 0, "flush reassembly of "+
+		"connections with finished handshake after `duration`")
+	maxFlows = flag.Int("max-flows", 0, "track at most `number` flows "+
+		"of SMC connections (0 disables)")
+	flowOverflow = flag.String("flow-overflow", "reject-new", "set "+
+		"`policy` for new flows when the flow table is full: "+
+		"reject-new or evict-oldest")
+	pcapSampleRate = flag.Int("sample-rate", 1,
+		"handle only 1 of `number` SMC connections")
+	smcExIDs = flag.String("exids", "", "also detect SMC connections "+
+		"with tcp experimental option ExIDs in `list` "+
+		"(comma-separated hex values, e.g.: e2d4c3d9)")
 
 	// display variables
 	showReserved = flag.Bool("show-reserved", false,
 		"show reserved message fields")
 	showTimestamps = flag.Bool("show-timestamps", true,
 		"show timestamps of messages")
+	timestampFormat = flag.String("timestamp-format", "15:04:05.000000",
+		"set timestamp format to `layout` (see go package time)")
 	showDumps = flag.Bool("show-hex", false,
 		"show hex dumps of messages")
+	showGIDTypes = flag.Bool("show-gid-types", true,
+		"show RoCE GID types of SMC-R GIDs")
+	showHostnames = flag.Bool("show-hostnames", true,
+		"show peer hostnames from SMCv2 first contact extensions")
+	showFallbacks = flag.Bool("show-fallbacks", false, "show "+
+		"connections with SMC option that fell back to TCP")
+	showInvalid = flag.Bool("show-invalid", false,
+		"show invalid messages with header fields and hex dumps")
+	showSessions = flag.Bool("show-sessions", false, "show handshake "+
+		"session IDs in messages, summaries, and latencies")
+	showSummary = flag.Bool("summary", false, "show one summary line "+
+		"per handshake instead of messages")
+	showTable = flag.Bool("table", false, "show messages as table rows "+
+		"with aligned columns for time, source, destination, type, "+
+		"version, path, and key fields")
+	exitSummary = flag.Bool("exit-summary", true, "show summary of "+
+		"packets, flows, messages, parse errors, and declines at exit "+
+		"or on SIGINT")
+	smartSampleRate = flag.Int("smart-sample", 0, "show messages with "+
+		"hex dumps of all declined, anomalous, and incomplete "+
+		"handshakes but of only 1 of `number` successful handshakes "+
+		"(0 disables)")
+
+	// analysis variables
+	churnThreshold = flag.Int("churn-threshold", 0, "report clients "+
+		"with more than `number` SMC connection attempts per second "+
+		"to the same service (0 disables)")
+	attemptBudgets = flag.String("attempt-budget", "", "report clients "+
+		"exceeding SMC connection attempt budgets in `list` "+
+		"(comma-separated [prefix=]number/duration, e.g.: "+
+		"100/1m,10.0.0.0/8=1000/1m)")
+	anomalyFactor = flag.Float64("anomaly-factor", 0, "report peer "+
+		"pairs with handshake rates above `factor` times or dropping "+
+		"to zero from their learned baseline (0 disables)")
+	showStats = flag.Bool("show-stats", false,
+		"show handshake statistics at exit")
+	statsInterval = flag.Int("stats-interval", 0, "show handshake "+
+		"statistics every `seconds` (0 disables)")
+	showQuality = flag.Bool("show-quality", false,
+		"show capture quality with advice at exit")
+	declineSummary = flag.Bool("decline-summary", false,
+		"show summary of decline reasons at exit")
+	pathSummary = flag.Bool("path-summary", false, "show path "+
+		"switches and summary of paths servers select for proposals "+
+		"offering SMC-R and SMC-D")
+	bufferSummary = flag.Bool("buffer-summary", false, "show "+
+		"distribution of negotiated RMBE and DMBE sizes at exit")
+	showInventory = flag.Bool("inventory", false, "show SMC-R GIDs "+
+		"and RoCE MACs seen per host at exit")
+	declineThreshold = flag.Int("decline-threshold", 0, "report peer "+
+		"pairs with `number` consecutive declined handshakes "+
+		"(0 disables)")
+	baselineFile = flag.String("baseline", "", "compare statistics "+
+		"of stats subcommand with baseline in `file` and report "+
+		"significant deviations")
+	saveBaselineFile = flag.String("save-baseline", "", "save "+
+		"statistics of stats subcommand as baseline to `file`")
+	checkHandshakes = flag.Bool("check-handshakes", false,
+		"check handshakes for inconsistent message parameters")
+	checkLinkIDs = flag.Bool("check-link-ids", false, "warn when "+
+		"SMC-D link IDs reappear with different parameters")
+	checkSYNOpts = flag.Bool("check-syn-options", false, "warn about "+
+		"tcp options in SYNs and SYN-ACKs of SMC connections that "+
+		"interfere with the SMC option")
+	checkRoundTrip = flag.Bool("check-roundtrip", false, "re-serialize "+
+		"parsed messages and report differences to their original "+
+		"bytes")
+	showLatencies = flag.Bool("show-latencies", false,
+		"show latencies of handshake stages")
+	durationBuckets = flag.String("duration-buckets",
+		"1ms,2ms,5ms,10ms,20ms,50ms,100ms,200ms,500ms,1s",
+		"set handshake duration histogram buckets to `list` "+
+			"(comma-separated durations)")
+	rulesFile = flag.String("rules", "", "apply rules in `file` to "+
+		"messages, reloaded when file changes")
+	learnExIDs = flag.Bool("learn-exids", false, "learn tcp "+
+		"experimental option ExIDs from SYNs of connections with "+
+		"CLC traffic")
+	errorCorpusDir = flag.String("error-corpus", "", "save messages "+
+		"with parse errors and surrounding stream bytes to `dir`")
+	errorCorpusSize = flag.Int64("error-corpus-size", 10<<20,
+		"limit size of error corpus directory to `bytes`")
+	researchFile = flag.String("research", "", "research mode: write "+
+		"reserved areas of all messages to `file`")
+	eventLogFile = flag.String("event-log", "", "write CLC messages "+
+		"with capture metadata to binary event log `file` for the "+
+		"replay subcommand")
 
 	// output, changed by http output
 	stdout     io.Writer = os.Stdout
 	stderr     io.Writer = os.Stderr
 	httpListen           = flag.String("http", "", "use http server "+
 		"output and listen on `address` "+
-		"(e.g.: :8000 or 127.0.0.1:8080)")
+		"(e.g.: :8000, 127.0.0.1:8080, or unix:/run/smc-clc.sock)")
+	grpcListen = flag.String("grpc", "", "stream events to gRPC "+
+		"subscribers and listen on `address` (e.g.: :9000)")
+	httpBufferSize = flag.Int("http-buffer-size", 1<<20, "limit text "+
+		"output of http server to `bytes`, discards oldest lines "+
+		"(0 disables)")
+	httpBufferLines = flag.Int("http-buffer-lines", 0, "limit text "+
+		"output of http server to `number` lines, discards oldest "+
+		"lines (0 disables)")
+	httpBasePath = flag.String("http-base-path", "", "serve http "+
+		"server output and apis under base `path` (e.g.: /smc-clc), "+
+		"for reverse proxies that do not strip the path prefix")
+	httpControl = flag.String("http-control", "", "serve http control "+
+		"apis (settings, annotations, debug, profiling, and shutdown) "+
+		"on separate `address` (e.g.: 127.0.0.1:8001)")
+	httpCORS = flag.String("http-cors", "", "allow cross-origin "+
+		"requests to http server from comma-separated `origins` "+
+		"(e.g.: https://dashboard.example.com or *)")
+	httpPprof = flag.Bool("http-pprof", false,
+		"enable profiling api in http server at /debug/pprof/")
+	dumpState = flag.Bool("dump-state-on-exit", false, "dump flow "+
+		"table, stream, and assembler state as JSON on exit")
+	writeFile = flag.String("w", "", "write all packets of monitored "+
+		"SMC connections to pcap `file` while showing messages, file "+
+		"names ending with .pcapng write pcapng files with the "+
+		"decoded messages as packet comments")
+	writeFileSize = flag.Int("C", 0, "rotate the file of -w when it "+
+		"exceeds `megabytes` (millions of bytes) like tcpdump, "+
+		"further files get a number appended")
+	writeFileCount = flag.Int("W", 0, "with -C, limit the number of "+
+		"files of -w to `number` and overwrite the oldest file")
+	extractFile = flag.String("o", "", "write packets of SMC "+
+		"connections up to the end of their handshakes to pcap `file` "+
+		"(extract subcommand)")
+	outputSpec = flag.String("output", "text", "set output to "+
+		"`format`: text, json, jsonl, json:file, text+json:file, "+
+		"csv, csv:file, text+csv:file, protobuf, protobuf:file, "+
+		"text+protobuf:file, cef, cef:file, or text+cef:file (e.g.: "+
+		"text+json:clc.jsonl)")
+	outputRotateSize = flag.Int64("output-rotate-size", 0, "rotate "+
+		"output and Avro files when they exceed `bytes` (0 disables)")
+	outputRotateInterval = flag.Duration("output-rotate-interval", 0,
+		"rotate output and Avro files after `duration` (e.g.: 24h, 0 "+
+			"disables)")
+	outputRotateKeep = flag.Int("output-rotate-keep", 5, "keep `number` "+
+		"of rotated output and Avro files")
+	avroFile = flag.String("avro", "", "write finished handshakes as "+
+		"records to Avro object container `file`")
+	outputEvents = flag.String("json-events",
+		"message,handshake,fallback,stats,overflow,annotation,"+
+			"alert,error",
+		"write events of types in `list` to JSON, syslog, Kafka, "+
+			"and MQTT output (comma-separated)")
+	syslogAddress = flag.String("syslog", "", "write events as JSON in "+
+		"syslog messages to syslog server at `address` (e.g.: "+
+		"udp://127.0.0.1:514, tcp://127.0.0.1:601, or unix:///dev/log)")
+	syslogFacility = flag.String("syslog-facility", "daemon",
+		"set syslog facility to `name` (e.g.: daemon or local0)")
+	syslogSeverity = flag.String("syslog-severity", "info",
+		"set syslog severity to `name` (e.g.: info or notice)")
+	kafkaBrokers = flag.String("kafka", "", "write events to Kafka "+
+		"with bootstrap brokers in `list` (comma-separated host:port)")
+	kafkaTopic = flag.String("kafka-topic", "smc-clc",
+		"set Kafka topic to `topic`")
+	kafkaFormat = flag.String("kafka-format", "json", "set Kafka "+
+		"record `format`: json or protobuf")
+	mqttBroker = flag.String("mqtt", "", "publish events to MQTT "+
+		"broker at `address` (e.g.: 127.0.0.1:1883)")
+	mqttTopic = flag.String("mqtt-topic", "smc-clc", "set MQTT topic "+
+		"prefix to `prefix`, events are published to prefix/type")
+	mqttQoS = flag.Int("mqtt-qos", 0, "set MQTT QoS to `level`: 0, 1, "+
+		"or 2")
+
+	// profiling variables
+	cpuProfile = flag.String("cpuprofile", "",
+		"write cpu profile to `file`")
+	memProfile = flag.String("memprofile", "",
+		"write memory profile to `file` on exit")
 )
 
 // Run is the main entry point of the smc-clc program: it parses the command
-// line arguments, starts the http server (if enabled via the command line),
-// and starts handling packets
+// line arguments and the demo, stats, extract, replay, and selftest-live
+// subcommands, starts the http server (if enabled via the command line),
+// starts handling packets until the end of the input or SIGINT, and prints
+// the end-of-run summary
 func Run() {
 	flag.Parse()
-	if *httpListen != "" {
-		setHTTPOutput()
+	switch flag.Arg(0) {
+	case "demo":
+		demoMode = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+	case "stats":
+		statsMode = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if len(*pcapFiles) == 0 && *pcapDir == "" {
+			log.Fatal("stats subcommand requires a pcap file " +
+				"(-f) or directory (-f-dir)")
+		}
+	case "selftest-live":
+		selftestMode = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+	case "replay":
+		replayMode = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() > 0 {
+			replayFile = flag.Arg(0)
+			flag.CommandLine.Parse(flag.Args()[1:])
+		}
+		if replayFile == "" {
+			log.Fatal("replay subcommand requires an event " +
+				"log file")
+		}
+	case "extract":
+		extractMode = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() > 0 {
+			pcapFiles.Set(flag.Arg(0))
+			flag.CommandLine.Parse(flag.Args()[1:])
+		}
+		if len(*pcapFiles) == 0 || *extractFile == "" {
+			log.Fatal("extract subcommand requires an input pcap " +
+				"file and an output pcap file (-o)")
+		}
+	}
+	if !statsMode && (*baselineFile != "" || *saveBaselineFile != "") {
+		log.Fatal("baseline requires the stats subcommand")
+	}
+	setAutoFilter()
+	if *printFilter {
+		printPcapFilter()
+		return
 	}
+	setContainerDevices()
+	stopHTTP := setHTTPOutput()
 	log.SetOutput(stderr)
+	closeOutput := setOutput()
+	closeSyslog := setSyslogOutput()
+	closeKafka := setKafkaOutput()
+	closeMQTT := setMQTTOutput()
+	closeAvro := setAvroOutput()
+	stopGRPC := func() {}
+	if *grpcListen != "" {
+		stopGRPC = startGRPCServer(*grpcListen)
+	}
+	if statsMode || extractMode {
+		textOutput = false
+	}
+	stopCPUProfile := startCPUProfile()
+	handleInterrupt()
+	handleAnnotationSignal()
 	listen()
+	if *exitSummary && textOutput {
+		writeRunSummary(stdout)
+	}
+	stopCPUProfile()
+	stopGRPC()
+	closeAvro()
+	closeMQTT()
+	closeKafka()
+	closeSyslog()
+	closeOutput()
+	stopHTTP()
+	writeMemProfile()
 }
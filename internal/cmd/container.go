@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// dockerSocket is the default unix socket of the docker engine api
+	dockerSocket = "/var/run/docker.sock"
+)
+
+var (
+	// containerProc is the proc file system with the container processes
+	containerProc = "/proc"
+
+	// crictlCommand is the command line tool for the CRI api
+	crictlCommand = "crictl"
+)
+
+// dockerHost returns the unix socket of the docker engine api from the
+// environment or the default socket
+func dockerHost() string {
+	if host, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"),
+		"unix://"); ok {
+		return host
+	}
+	return dockerSocket
+}
+
+// dockerContainerPID returns the process ID of the running container name
+// from the docker engine api at the unix socket
+func dockerContainerPID(socket, name string) (int, error) {
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _,
+			_ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err := client.Get("http://docker/containers/" +
+		url.PathEscape(name) + "/json")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &e) != nil || e.Message == "" {
+			e.Message = resp.Status
+		}
+		return 0, fmt.Errorf("docker: %s", e.Message)
+	}
+
+	var c struct {
+		State struct {
+			Running bool `json:"Running"`
+			Pid     int  `json:"Pid"`
+		} `json:"State"`
+	}
+	if err := json.Unmarshal(body, &c); err != nil {
+		return 0, err
+	}
+	if !c.State.Running || c.State.Pid == 0 {
+		return 0, fmt.Errorf("container %s is not running", name)
+	}
+	return c.State.Pid, nil
+}
+
+// criContainerPID returns the process ID of the running container name from
+// the CRI api with crictl
+func criContainerPID(name string) (int, error) {
+	out, err := exec.Command(crictlCommand, "ps", "-q", "--name",
+		"^"+regexp.QuoteMeta(name)+"$").Output()
+	if err != nil {
+		return 0, fmt.Errorf("crictl: %w", err)
+	}
+	ids := strings.Fields(string(out))
+	switch {
+	case len(ids) == 0:
+		return 0, fmt.Errorf("container %s not found", name)
+	case len(ids) > 1:
+		return 0, fmt.Errorf("container name %s is ambiguous: %s",
+			name, strings.Join(ids, ", "))
+	}
+
+	out, err = exec.Command(crictlCommand, "inspect", "-o", "json",
+		ids[0]).Output()
+	if err != nil {
+		return 0, fmt.Errorf("crictl: %w", err)
+	}
+	var c struct {
+		Info struct {
+			Pid int `json:"pid"`
+		} `json:"info"`
+	}
+	if err := json.Unmarshal(out, &c); err != nil {
+		return 0, err
+	}
+	if c.Info.Pid == 0 {
+		return 0, fmt.Errorf("container %s is not running", name)
+	}
+	return c.Info.Pid, nil
+}
+
+// containerPID returns the process ID of the running container name from
+// the container runtime: docker, cri, or auto to use docker if its socket
+// exists and cri otherwise
+func containerPID(runtime, name string) (int, error) {
+	if runtime == "auto" {
+		runtime = "cri"
+		if _, err := os.Stat(dockerHost()); err == nil {
+			runtime = "docker"
+		}
+	}
+	switch runtime {
+	case "docker":
+		return dockerContainerPID(dockerHost(), name)
+	case "cri":
+		return criContainerPID(name)
+	}
+	return 0, fmt.Errorf("invalid container runtime %q", runtime)
+}
+
+// readSysfsInt reads the integer in the sysfs file
+func readSysfsInt(file string) (int, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// hostInterface returns the name of the network interface of the host with
+// index ifindex
+func hostInterface(ifindex int) (string, error) {
+	entries, err := os.ReadDir(sysfsNet)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		i, err := readSysfsInt(filepath.Join(sysfsNet, e.Name(),
+			"ifindex"))
+		if err == nil && i == ifindex {
+			return e.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no host interface with index %d", ifindex)
+}
+
+// containerVeths returns the host side veth interfaces of the network
+// interfaces in the network namespace of the container process pid
+func containerVeths(pid int) ([]string, error) {
+	// make sure the container has its own network namespace
+	proc := filepath.Join(containerProc, strconv.Itoa(pid))
+	netns, err := os.Readlink(filepath.Join(proc, "ns", "net"))
+	if err != nil {
+		return nil, err
+	}
+	hostns, err := os.Readlink(filepath.Join(containerProc, "self", "ns",
+		"net"))
+	if err == nil && netns == hostns {
+		return nil, errors.New("container uses the host network, " +
+			"capture on the host interfaces with -i")
+	}
+
+	// the iflink of a veth in the container is the ifindex of its peer
+	// on the host
+	dir := filepath.Join(proc, "root", "sys", "class", "net")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var veths []string
+	for _, e := range entries {
+		ifindex, err := readSysfsInt(filepath.Join(dir, e.Name(),
+			"ifindex"))
+		if err != nil {
+			continue
+		}
+		iflink, err := readSysfsInt(filepath.Join(dir, e.Name(),
+			"iflink"))
+		if err != nil || iflink == ifindex {
+			// loopback or not a veth
+			continue
+		}
+		veth, err := hostInterface(iflink)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find host side of "+
+				"container interface %s: %w", e.Name(), err)
+		}
+		veths = append(veths, veth)
+	}
+	if len(veths) == 0 {
+		return nil, fmt.Errorf("no veth interfaces in network "+
+			"namespace %s", netns)
+	}
+	return veths, nil
+}
+
+// setContainerDevices sets the network interfaces to the host side veth
+// interfaces of the container set on the command line, if any
+func setContainerDevices() {
+	if *containerName == "" {
+		return
+	}
+	if len(*pcapDevices) > 0 || len(*pcapFiles) > 0 || *pcapDir != "" ||
+		*pcapFD >= 0 || *pcapUnix != "" || *remoteHost != "" {
+		log.Fatal("container cannot be used with other packet sources")
+	}
+	pid, err := containerPID(*containerRuntime, *containerName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	veths, err := containerVeths(pid)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Container %s (pid %d) uses interfaces %s\n",
+		*containerName, pid, strings.Join(veths, ","))
+	*pcapDevices = veths
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDockerContainerPID(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/containers/payments-api/json":
+				w.Write([]byte(`{"State":{"Running":true,` +
+					`"Pid":4242}}`))
+			case "/containers/stopped/json":
+				w.Write([]byte(`{"State":{"Running":false,` +
+					`"Pid":0}}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message":` +
+					`"No such container"}`))
+			}
+		}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	pid, err := dockerContainerPID(socket, "payments-api")
+	if err != nil || pid != 4242 {
+		t.Errorf("got %d, %v; want 4242", pid, err)
+	}
+	if _, err := dockerContainerPID(socket, "stopped"); err == nil {
+		t.Error("stopped container: got no error")
+	}
+	_, err = dockerContainerPID(socket, "missing")
+	if err == nil || err.Error() != "docker: No such container" {
+		t.Errorf("missing container: got %v", err)
+	}
+}
+
+func TestCRIContainerPID(t *testing.T) {
+	crictl := filepath.Join(t.TempDir(), "crictl")
+	script := "#!/bin/sh\n" +
+		"case \"$1\" in\n" +
+		"ps) echo abc123 ;;\n" +
+		"inspect) echo '{\"info\":{\"pid\":1234}}' ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(crictl, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(c string) { crictlCommand = c }(crictlCommand)
+	crictlCommand = crictl
+
+	pid, err := criContainerPID("payments-api")
+	if err != nil || pid != 1234 {
+		t.Errorf("got %d, %v; want 1234", pid, err)
+	}
+}
+
+func TestContainerVeths(t *testing.T) {
+	// fake proc and sysfs with a container with eth0 and lo
+	dir := t.TempDir()
+	writeFile := func(file, content string) {
+		file = filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := os.WriteFile(file, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink := func(target, file string) {
+		file = filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink("net:[1]", "proc/self/ns/net")
+	symlink("net:[2]", "proc/10/ns/net")
+	symlink("net:[1]", "proc/20/ns/net")
+	writeFile("proc/10/root/sys/class/net/lo/ifindex", "1\n")
+	writeFile("proc/10/root/sys/class/net/lo/iflink", "1\n")
+	writeFile("proc/10/root/sys/class/net/eth0/ifindex", "2\n")
+	writeFile("proc/10/root/sys/class/net/eth0/iflink", "7\n")
+	writeFile("sys/eth0/ifindex", "2\n")
+	writeFile("sys/veth1a2b3c/ifindex", "7\n")
+
+	defer func(p, s string) {
+		containerProc = p
+		sysfsNet = s
+	}(containerProc, sysfsNet)
+	containerProc = filepath.Join(dir, "proc")
+	sysfsNet = filepath.Join(dir, "sys")
+
+	veths, err := containerVeths(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"veth1a2b3c"}; !slices.Equal(veths, want) {
+		t.Errorf("got %v; want %v", veths, want)
+	}
+
+	// host network
+	if _, err := containerVeths(20); err == nil {
+		t.Error("host network: got no error")
+	}
+}
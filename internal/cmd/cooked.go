@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// anyDevice is the pseudo-device for capturing on all network interfaces
+const anyDevice = "any"
+
+// cookedDuplicate checks if packet has a Linux cooked link layer and is the
+// outgoing copy of a loopback packet. When capturing on the any pseudo-device,
+// loopback packets are captured twice, once outgoing and once incoming, so
+// only the incoming copy should be handled
+func cookedDuplicate(packet gopacket.Packet) bool {
+	switch sll := packet.LinkLayer().(type) {
+	case *layers.LinuxSLL:
+		return sll.AddrType ==
+			uint16(layers.ARPHardwareTypeLoopback) &&
+			sll.PacketType == layers.LinuxSLLPacketTypeOutgoing
+	case *layers.LinuxSLL2:
+		return sll.ARPHardwareType ==
+			layers.ARPHardwareTypeLoopback &&
+			sll.PacketType == layers.LinuxSLL2PacketTypeOutgoing
+	}
+	return false
+}
+
+// devicePromisc returns if device should be set to promiscuous mode. The any
+// pseudo-device does not support promiscuous mode
+func devicePromisc(device string) bool {
+	return *pcapPromisc && device != anyDevice
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestCookedDuplicate(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		linkType layers.LinkType
+		data     []byte
+		want     bool
+	}{
+		{"sll loopback outgoing", layers.LinkTypeLinuxSLL, []byte{
+			0, 4, 3, 4, 0, 6, 0, 0, 0, 0, 0, 0, 0, 0, 8, 0,
+		}, true},
+		{"sll loopback host", layers.LinkTypeLinuxSLL, []byte{
+			0, 0, 3, 4, 0, 6, 0, 0, 0, 0, 0, 0, 0, 0, 8, 0,
+		}, false},
+		{"sll ethernet outgoing", layers.LinkTypeLinuxSLL, []byte{
+			0, 4, 0, 1, 0, 6, 1, 2, 3, 4, 5, 6, 0, 0, 8, 0,
+		}, false},
+		{"sll2 loopback outgoing", layers.LinkTypeLinuxSLL2, []byte{
+			8, 0, 0, 0, 0, 0, 0, 1, 3, 4, 4, 6,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		}, true},
+		{"sll2 loopback host", layers.LinkTypeLinuxSLL2, []byte{
+			8, 0, 0, 0, 0, 0, 0, 1, 3, 4, 0, 6,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		}, false},
+		{"sll2 ethernet outgoing", layers.LinkTypeLinuxSLL2, []byte{
+			8, 0, 0, 0, 0, 0, 0, 2, 0, 1, 4, 6,
+			1, 2, 3, 4, 5, 6, 0, 0,
+		}, false},
+		{"ethernet", layers.LinkTypeEthernet, []byte{
+			1, 2, 3, 4, 5, 6, 1, 2, 3, 4, 5, 7, 8, 0,
+		}, false},
+	} {
+		packet := gopacket.NewPacket(test.data, test.linkType,
+			gopacket.Default)
+		if packet.LinkLayer() == nil {
+			t.Errorf("%s: no link layer", test.name)
+			continue
+		}
+		if got := cookedDuplicate(packet); got != test.want {
+			t.Errorf("%s: got %t; want %t", test.name, got,
+				test.want)
+		}
+	}
+}
+
+func TestDevicePromisc(t *testing.T) {
+	defer func(p bool) { *pcapPromisc = p }(*pcapPromisc)
+	for _, test := range []struct {
+		promisc bool
+		device  string
+		want    bool
+	}{
+		{true, "eth0", true},
+		{true, "any", false},
+		{false, "eth0", false},
+		{false, "any", false},
+	} {
+		*pcapPromisc = test.promisc
+		if got := devicePromisc(test.device); got != test.want {
+			t.Errorf("%t, %s: got %t; want %t", test.promisc,
+				test.device, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// corpusContextLen is the maximum number of stream bytes before and
+	// after a message with parse error saved in the error corpus
+	corpusContextLen = 256
+)
+
+var (
+	// corpus stores the error corpus
+	corpus errorCorpus
+)
+
+// errorCorpus saves messages with parse errors and the surrounding stream
+// bytes to files in a size-capped directory protected by a mutex
+type errorCorpus struct {
+	lock    sync.Mutex
+	dir     string
+	maxSize int64
+	size    int64
+	full    bool
+}
+
+// init initializes the error corpus in directory dir with maximum size
+// maxSize, existing files in dir count towards the size
+func (ec *errorCorpus) init(dir string, maxSize int64) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		size += info.Size()
+	}
+
+	ec.lock.Lock()
+	ec.dir = dir
+	ec.maxSize = maxSize
+	ec.size = size
+	ec.full = false
+	ec.lock.Unlock()
+	return nil
+}
+
+// add saves the message msg with parse error reason and the stream bytes
+// before and after it to the error corpus. The raw stream bytes are saved
+// in a .bin file and a description in a .txt file, both named after the
+// hash of the raw stream bytes. It returns the name of the .bin file or an
+// empty string if the message is not saved
+func (ec *errorCorpus) add(reason string, before, msg, after []byte) string {
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+
+	if ec.dir == "" {
+		return ""
+	}
+
+	// get raw stream bytes and description
+	raw := make([]byte, 0, len(before)+len(msg)+len(after))
+	raw = append(raw, before...)
+	raw = append(raw, msg...)
+	raw = append(raw, after...)
+	desc := fmt.Sprintf("Error: %s\nMessage Offset: %d\n"+
+		"Message Length: %d\nStream Bytes: %d\n", reason, len(before),
+		len(msg), len(raw))
+
+	// skip known messages and check size limit
+	name := fmt.Sprintf("%x", sha256.Sum256(raw))[:16]
+	bin := filepath.Join(ec.dir, name+".bin")
+	if _, err := os.Stat(bin); err == nil {
+		return ""
+	}
+	size := int64(len(raw) + len(desc))
+	if ec.size+size > ec.maxSize {
+		if !ec.full {
+			log.Println("Error corpus full, not saving messages")
+			ec.full = true
+		}
+		return ""
+	}
+
+	// write files
+	if err := os.WriteFile(bin, raw, 0644); err != nil {
+		log.Println("Error writing error corpus:", err)
+		return ""
+	}
+	txt := filepath.Join(ec.dir, name+".txt")
+	if err := os.WriteFile(txt, []byte(desc), 0644); err != nil {
+		log.Println("Error writing error corpus:", err)
+	}
+	ec.size += size
+	return bin
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorCorpus(t *testing.T) {
+	var ec errorCorpus
+
+	// prepare error corpus directory
+	dir, err := os.MkdirTemp("", "smc-clc-corpus")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ec.init(dir, 1024); err != nil {
+		log.Fatal(err)
+	}
+
+	// prepare stream with decline message with invalid trailer between
+	// valid decline messages
+	valid, err := hex.DecodeString("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	if err != nil {
+		log.Fatal(err)
+	}
+	invalid := append([]byte{}, valid...)
+	copy(invalid[len(invalid)-4:], []byte{0, 0, 0, 0})
+	var stream []byte
+	for _, m := range [][]byte{valid, invalid, valid} {
+		stream = append(stream, m...)
+	}
+
+	// test saving message with parse error and surrounding stream bytes
+	d := newDecoder(bytes.NewReader(stream))
+	d.errors = &ec
+	for i := 0; i < 3; i++ {
+		if _, err := d.next(); err != nil {
+			t.Fatalf("d.next() error = %v; want nil", err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.bin"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got = %v; want 1 file", files)
+	}
+	got, err := os.ReadFile(files[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !bytes.Equal(got, stream) {
+		t.Errorf("got = %x; want %x", got, stream)
+	}
+	desc, err := os.ReadFile(strings.TrimSuffix(files[0], ".bin") +
+		".txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	want := "Error: invalid trailer\nMessage Offset: 28\n"
+	if !strings.HasPrefix(string(desc), want) {
+		t.Errorf("got = %s; want %s", desc, want)
+	}
+
+	// test known message is not saved again
+	if got := ec.add("invalid trailer", valid, invalid, valid); got != "" {
+		t.Errorf("got = %s; want \"\"", got)
+	}
+
+	// test size limit, existing files count towards size
+	if err := ec.init(dir, int64(len(stream)+len(desc))+10); err != nil {
+		log.Fatal(err)
+	}
+	if got := ec.add("invalid trailer", nil, invalid, nil); got != "" {
+		t.Errorf("got = %s; want \"\"", got)
+	}
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// csvColumns are the columns of the CSV output: common fields of all
+	// rows followed by fields of specific message types and handshakes,
+	// new columns are only appended to keep the column set stable
+	csvColumns = []string{"time", "session", "src", "dst", "type",
+		"version", "path", "flag", "length", "peer_id", "ib_gid",
+		"ib_mac", "qpn", "psn", "rmbe_size", "qp_mtu", "smcd_gid",
+		"token", "dmbe_size", "link_id", "eid", "diagnosis", "os_type",
+		"result", "duration", "warnings"}
+
+	// csvEvents is the CSV sink
+	csvEvents csvSink
+)
+
+// csvRow is a row of the CSV output, columns without values are left empty
+type csvRow map[string]string
+
+// record converts the CSV row to a CSV record with all columns
+func (r csvRow) record() []string {
+	record := make([]string, len(csvColumns))
+	for i, c := range csvColumns {
+		record[i] = r[c]
+	}
+	return record
+}
+
+// csvMessageRow returns the CLC message msg of the handshake session with
+// parse warnings sent over the network flow net and the transport flow trans
+// at time t as CSV row
+func csvMessageRow(t time.Time, net, trans gopacket.Flow, msg clc.Message,
+	session uint64, warnings parseWarnings) csvRow {
+	r := csvRow{
+		"time":     t.Format(time.RFC3339Nano),
+		"src":      fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		"dst":      fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		"type":     "invalid",
+		"warnings": strings.Join(warnings, "; "),
+	}
+	if session != 0 {
+		r["session"] = fmt.Sprint(session)
+	}
+	if hdr := messageHeader(msg); hdr != nil {
+		r["type"] = strings.ToLower(hdr.Type.String())
+		r["version"] = fmt.Sprint(hdr.Version)
+		r["path"] = hdr.Path.String()
+		r["flag"] = fmt.Sprint(hdr.Flag)
+		r["length"] = fmt.Sprint(hdr.Length)
+	}
+
+	switch m := msg.(type) {
+	case *clc.Proposal:
+		r["peer_id"] = m.SenderPeerID.String()
+		r["ib_gid"] = m.IBGID.String()
+		r["ib_mac"] = m.IBMAC.String()
+		if m.IPAreaOffset == clc.SMCDIPAreaOffset {
+			r["smcd_gid"] = fmt.Sprintf("%#x", m.SMCDGID)
+		}
+	case *clc.ProposalV2:
+		r["peer_id"] = m.SenderPeerID.String()
+		r["ib_gid"] = m.IBGID.String()
+		r["ib_mac"] = m.IBMAC.String()
+		r["smcd_gid"] = fmt.Sprintf("%#x", m.SMCDGID)
+	case *clc.AcceptSMCR:
+		csvAcceptSMCR(r, m)
+	case *clc.ConfirmSMCR:
+		csvAcceptSMCR(r, &m.AcceptSMCR)
+	case *clc.AcceptSMCD:
+		csvAcceptSMCD(r, m)
+	case *clc.ConfirmSMCD:
+		csvAcceptSMCD(r, &m.AcceptSMCD)
+	case *clc.AcceptSMCDv2:
+		csvAcceptSMCDv2(r, m)
+	case *clc.ConfirmSMCDv2:
+		csvAcceptSMCDv2(r, &m.AcceptSMCDv2)
+	case *clc.Decline:
+		r["peer_id"] = m.SenderPeerID.String()
+		r["diagnosis"] = m.PeerDiagnosis.String()
+	case *clc.DeclineV2:
+		r["peer_id"] = m.SenderPeerID.String()
+		r["diagnosis"] = m.PeerDiagnosis.String()
+		r["os_type"] = m.OSType.String()
+	}
+	return r
+}
+
+// csvAcceptSMCR fills the CSV row r with the fields of the SMC-R accept or
+// confirm message m
+func csvAcceptSMCR(r csvRow, m *clc.AcceptSMCR) {
+	r["peer_id"] = m.SenderPeerID.String()
+	r["ib_gid"] = m.IBGID.String()
+	r["ib_mac"] = m.IBMAC.String()
+	r["qpn"] = fmt.Sprint(m.QPN)
+	r["psn"] = fmt.Sprint(m.PSN)
+	r["rmbe_size"] = m.RMBESize.String()
+	r["qp_mtu"] = m.QPMTU.String()
+}
+
+// csvAcceptSMCD fills the CSV row r with the fields of the SMC-D accept or
+// confirm message m
+func csvAcceptSMCD(r csvRow, m *clc.AcceptSMCD) {
+	r["smcd_gid"] = fmt.Sprintf("%#x", m.GID)
+	r["token"] = fmt.Sprintf("%#x", m.Token)
+	r["dmbe_size"] = m.DMBESize.String()
+	r["link_id"] = fmt.Sprint(m.LinkID)
+}
+
+// csvAcceptSMCDv2 fills the CSV row r with the fields of the SMCv2 SMC-D
+// accept or confirm message m
+func csvAcceptSMCDv2(r csvRow, m *clc.AcceptSMCDv2) {
+	r["smcd_gid"] = fmt.Sprintf("%#x", m.GID)
+	r["token"] = fmt.Sprintf("%#x", m.Token)
+	r["dmbe_size"] = m.DMBESize.String()
+	r["link_id"] = fmt.Sprint(m.LinkID)
+	r["eid"] = m.EID.String()
+	if m.Length == clc.AcceptSMCDv2FCELen {
+		r["os_type"] = m.OSType.String()
+	}
+}
+
+// csvHandshakeRow returns the handshake r finished at time t as CSV row
+func csvHandshakeRow(t time.Time, r *handshakeResult) csvRow {
+	net, trans := r.key.net, r.key.trans
+	row := csvRow{
+		"time":     t.Format(time.RFC3339Nano),
+		"session":  fmt.Sprint(r.id),
+		"src":      fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		"dst":      fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		"type":     eventHandshake,
+		"version":  fmt.Sprint(r.version),
+		"result":   "declined",
+		"duration": fmt.Sprint(r.total.Seconds()),
+	}
+	if r.confirmed {
+		row["result"] = "confirmed"
+		row["path"] = r.path.String()
+	} else {
+		row["diagnosis"] = r.diagnosis
+	}
+	if r.qps {
+		row["qpn"] = fmt.Sprintf("%d/%d", r.serverQP.qpn,
+			r.clientQP.qpn)
+		row["psn"] = fmt.Sprintf("%d/%d", r.serverQP.psn,
+			r.clientQP.psn)
+	}
+	return row
+}
+
+// csvHeader returns the CSV header row
+func csvHeader() []byte {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(csvColumns)
+	w.Flush()
+	return b.Bytes()
+}
+
+// csvSink renders message and handshake events as CSV rows to the CSV output
+type csvSink struct {
+	lock sync.Mutex
+	w    *csv.Writer
+}
+
+// setOutput sets the CSV output to w and writes the header row, nil disables
+// the CSV output
+func (c *csvSink) setOutput(w io.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.w = nil
+	if w == nil {
+		return
+	}
+	c.w = csv.NewWriter(w)
+	c.write(csvColumns)
+}
+
+// write writes record to the CSV output and flushes it, c must be locked
+func (c *csvSink) write(record []string) {
+	if err := c.w.Write(record); err != nil {
+		log.Println("Error writing CSV output:", err)
+		return
+	}
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		log.Println("Error writing CSV output:", err)
+	}
+}
+
+// accepts checks if the CSV sink renders events of type typ
+func (c *csvSink) accepts(typ string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.w == nil {
+		return false
+	}
+	return typ == eventMessage || typ == eventHandshake
+}
+
+// render renders the event e as CSV row
+func (c *csvSink) render(e *event) {
+	var row csvRow
+	switch e.typ {
+	case eventMessage:
+		row = csvMessageRow(e.time, e.net, e.trans, e.msg, e.session,
+			e.warnings)
+	case eventHandshake:
+		row = csvHandshakeRow(e.time, e.result)
+	default:
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.w != nil {
+		c.write(row.record())
+	}
+}
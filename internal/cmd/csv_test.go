@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestCSVSink(t *testing.T) {
+	var buf bytes.Buffer
+	var c csvSink
+
+	// check disabled CSV sink
+	if c.accepts(eventMessage) {
+		t.Error("c.accepts() = true; want false")
+	}
+
+	// render decline message and fallback events
+	c.setOutput(&buf)
+	defer c.setOutput(nil)
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	msg := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	for _, e := range []*event{
+		{typ: eventMessage, net: net, trans: trans, msg: msg,
+			session: 3, warnings: parseWarnings{"a", "b"}},
+		{typ: eventFallback, net: net, trans: trans},
+	} {
+		if c.accepts(e.typ) {
+			c.render(e)
+		}
+	}
+
+	// check header and decline message row
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("len(records) = %d; want 2", len(records))
+	}
+	for i, r := range records {
+		if len(r) != len(csvColumns) {
+			t.Errorf("len(records[%d]) = %d; want %d", i, len(r),
+				len(csvColumns))
+		}
+	}
+	got := csvRow{}
+	for i, column := range records[0] {
+		got[column] = records[1][i]
+	}
+	for column, want := range map[string]string{
+		"session":  "3",
+		"src":      "1.2.3.4:123",
+		"dst":      "5.6.7.8:456",
+		"type":     "decline",
+		"version":  "1",
+		"length":   "28",
+		"qpn":      "",
+		"warnings": "a; b",
+	} {
+		if got[column] != want {
+			t.Errorf("%s = %q; want %q", column, got[column], want)
+		}
+	}
+	if got["diagnosis"] == "" {
+		t.Error("diagnosis is empty")
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// declines stores the decline reason table
+	declines declineTable
+)
+
+// declineKey identifies the decline reason of a peer pair, sender is the
+// peer that sent the decline message
+type declineKey struct {
+	diagnosis clc.PeerDiagnosis
+	sender    gopacket.Endpoint
+	receiver  gopacket.Endpoint
+}
+
+// declineTable stores the number of decline messages per decline reason and
+// per decline reason and peer pair protected by a mutex
+type declineTable struct {
+	lock  sync.Mutex
+	codes map[clc.PeerDiagnosis]uint64
+	pairs map[declineKey]uint64
+}
+
+// init initializes the decline table
+func (dt *declineTable) init() {
+	dt.lock.Lock()
+	if dt.codes == nil {
+		dt.codes = make(map[clc.PeerDiagnosis]uint64)
+		dt.pairs = make(map[declineKey]uint64)
+	}
+	dt.lock.Unlock()
+}
+
+// add adds the CLC message msg sent over the network flow net to the decline
+// table if it is a decline message
+func (dt *declineTable) add(net gopacket.Flow, msg clc.Message) {
+	var diagnosis clc.PeerDiagnosis
+	switch m := msg.(type) {
+	case *clc.Decline:
+		diagnosis = m.PeerDiagnosis
+	case *clc.DeclineV2:
+		diagnosis = m.PeerDiagnosis
+	default:
+		return
+	}
+
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	if dt.codes == nil {
+		return
+	}
+	dt.codes[diagnosis]++
+	dt.pairs[declineKey{diagnosis, net.Src(), net.Dst()}]++
+}
+
+// shares returns the shares of the decline reasons in all declines
+func (dt *declineTable) shares() map[string]float64 {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	var total uint64
+	for _, n := range dt.codes {
+		total += n
+	}
+	shares := make(map[string]float64)
+	for code, n := range dt.codes {
+		shares[code.String()] = float64(n) / float64(total)
+	}
+	return shares
+}
+
+// summary returns the decline summary ordered by number of declines: one line
+// per decline reason followed by one line per peer pair with this reason
+func (dt *declineTable) summary() []string {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	codes := make([]clc.PeerDiagnosis, 0, len(dt.codes))
+	for code := range dt.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if dt.codes[codes[i]] != dt.codes[codes[j]] {
+			return dt.codes[codes[i]] > dt.codes[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	var keys []declineKey
+	for key := range dt.pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if dt.pairs[keys[i]] != dt.pairs[keys[j]] {
+			return dt.pairs[keys[i]] > dt.pairs[keys[j]]
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	var lines []string
+	for _, code := range codes {
+		lines = append(lines, fmt.Sprintf("%s: %d declines", code,
+			dt.codes[code]))
+		for _, key := range keys {
+			if key.diagnosis != code {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s: "+
+				"%d declines", code, key.sender, key.receiver,
+				dt.pairs[key]))
+		}
+	}
+	return lines
+}
+
+// codeSummary returns the number of declines per decline reason ordered by
+// number of declines
+func (dt *declineTable) codeSummary() []string {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	codes := make([]clc.PeerDiagnosis, 0, len(dt.codes))
+	for code := range dt.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if dt.codes[codes[i]] != dt.codes[codes[j]] {
+			return dt.codes[codes[i]] > dt.codes[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	var lines []string
+	for _, code := range codes {
+		lines = append(lines, fmt.Sprintf("%s: %d declines", code,
+			dt.codes[code]))
+	}
+	return lines
+}
+
+// writeDeclineSummary writes the decline summary to w
+func writeDeclineSummary(w io.Writer) {
+	for _, line := range declines.summary() {
+		fmt.Fprintf(w, "Decline Summary: %s\n", line)
+	}
+}
+
+// handleDeclines handles http requests for the decline summary
+func handleDeclines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	writeDeclineSummary(w)
+}
+
+// registerDeclineAPI registers the decline summary http api
+func registerDeclineAPI() {
+	http.HandleFunc("/api/v1/declines", handleDeclines)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestDeclineTable(t *testing.T) {
+	var dt declineTable
+
+	// initialize decline table and test flows
+	dt.init()
+	net1, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	net2, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 5)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	decline := func(diagnosis string) string {
+		return "e2d4c3d904001c102525252525252500" + diagnosis +
+			"00000000e2d4c3d9"
+	}
+
+	// add declines and other message
+	dt.add(net1, testHandshakeMessage(decline("03030000")))
+	dt.add(net2, testHandshakeMessage(decline("03030000")))
+	dt.add(net2, testHandshakeMessage(decline("03030000")))
+	dt.add(net1, testHandshakeMessage(decline("03010000")))
+	dt.add(net1, testHandshakeMessage("e2d4c3d901003410b1a098039babcdef"+
+		"fe800000000000009a039bfffeabcdef"+
+		"98039babcdef00007f00000008000000"+
+		"e2d4c3d9"))
+
+	// test summary
+	no := "0x3030000 (no SMC device found (R or D))"
+	ind := "0x3010000 (peer did not indicate SMC)"
+	want := []string{
+		no + ": 3 declines",
+		no + ": 1.2.3.5 -> 5.6.7.8: 2 declines",
+		no + ": 1.2.3.4 -> 5.6.7.8: 1 declines",
+		ind + ": 1 declines",
+		ind + ": 1.2.3.4 -> 5.6.7.8: 1 declines",
+	}
+	got := dt.summary()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
+
+func TestHandleDeclines(t *testing.T) {
+	declines.init()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	declines.add(net, testHandshakeMessage(
+		"e2d4c3d904001c102525252525252500"+
+			"0303000000000000e2d4c3d9"))
+
+	// test http api
+	w := httptest.NewRecorder()
+	handleDeclines(w, httptest.NewRequest("GET", "/api/v1/declines", nil))
+	var buf bytes.Buffer
+	writeDeclineSummary(&buf)
+	want := buf.String()
+	got := w.Body.String()
+	if got != want || got == "" {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	declines.codes, declines.pairs = nil, nil
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+)
+
+var (
+	// declineLoops stores the consecutive declines table
+	declineLoops declineLoopTable
+)
+
+// declinePeers identifies a peer pair by the client and server ips
+type declinePeers struct {
+	client, server gopacket.Endpoint
+}
+
+// declineLoopTable stores the number of consecutive declined handshakes per
+// peer pair protected by a mutex
+type declineLoopTable struct {
+	lock  sync.Mutex
+	peers map[declinePeers]int
+}
+
+// init initializes the consecutive declines table
+func (dt *declineLoopTable) init() {
+	dt.lock.Lock()
+	if dt.peers == nil {
+		dt.peers = make(map[declinePeers]int)
+	}
+	dt.lock.Unlock()
+}
+
+// add adds the finished handshake r to the consecutive declines table. A
+// successful handshake resets the number of consecutive declines of the peer
+// pair. It returns true if the number of consecutive declines of the peer
+// pair reaches threshold
+func (dt *declineLoopTable) add(r *handshakeResult, threshold int) bool {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	if dt.peers == nil {
+		return false
+	}
+	key := declinePeers{r.key.net.Src(), r.key.net.Dst()}
+	if r.confirmed {
+		delete(dt.peers, key)
+		return false
+	}
+	dt.peers[key]++
+	return dt.peers[key] == threshold
+}
+
+// declineLoopAlert returns the alert event that the peer pair of the
+// declined handshake r reached the consecutive declines threshold
+func declineLoopAlert(r *handshakeResult) *event {
+	return &event{typ: eventAlert, reason: alertDeclineLoop,
+		net: r.key.net, text: fmt.Sprintf("%d consecutive declines, "+
+			"last: %s", *declineThreshold, r.diagnosis)}
+}
+
+// printDeclineLoop prints the decline loop alert about the peer pair in the
+// network flow net
+func printDeclineLoop(net gopacket.Flow, alert string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sDecline Loop: %s -> %s: %s\n", t, net.Src(),
+		net.Dst(), alert)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestDeclineLoopTable(t *testing.T) {
+	var dt declineLoopTable
+
+	// prepare handshake results
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	declined := &handshakeResult{
+		key:       handshakeKey{net: net},
+		diagnosis: "0x3030000 (no SMC device found (R or D))",
+	}
+	confirmed := &handshakeResult{
+		key:       handshakeKey{net: net},
+		confirmed: true,
+	}
+
+	// test table without init
+	if dt.add(declined, 1) {
+		t.Errorf("got = true; want false")
+	}
+
+	// test threshold is reached once, success resets the declines
+	dt.init()
+	var got []bool
+	for _, r := range []*handshakeResult{declined, declined, declined,
+		declined, confirmed, declined, declined} {
+		got = append(got, dt.add(r, 2))
+	}
+	want := []bool{false, true, false, false, false, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got = %v; want %v", got, want)
+			break
+		}
+	}
+
+	// test alert event in text and JSON sinks
+	var text, js bytes.Buffer
+	stdout = &text
+	jsonOutput = &js
+	defer func() { jsonOutput = nil }()
+	jsonEvents.types = map[string]bool{eventAlert: true}
+	defer func() { jsonEvents.types = nil }()
+	*showTimestamps = false
+	*declineThreshold = 2
+	defer func() { *declineThreshold = 0 }()
+	emit(declineLoopAlert(declined))
+	wantWarning := "Decline Loop: 1.2.3.4 -> 5.6.7.8: 2 consecutive " +
+		"declines, last: 0x3030000 (no SMC device found (R or D))\n"
+	if text.String() != wantWarning {
+		t.Errorf("got = %s; want %s", text.String(), wantWarning)
+	}
+	var gotAlert jsonPeerAlert
+	if err := json.Unmarshal(js.Bytes(), &gotAlert); err != nil {
+		t.Fatal(err)
+	}
+	wantAlert := jsonPeerAlert{
+		Time:   gotAlert.Time,
+		Src:    "1.2.3.4",
+		Dst:    "5.6.7.8",
+		Type:   eventAlert,
+		Source: alertDeclineLoop,
+		Alert: "2 consecutive declines, last: 0x3030000 (no SMC " +
+			"device found (R or D))",
+	}
+	if gotAlert != wantAlert {
+		t.Errorf("got = %v; want %v", gotAlert, wantAlert)
+	}
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+const (
+	// CLC message buffer size for 2 CLC messages per flow/direction
+	clcMessageBufSize = clc.MaxMessageSize * 2
+)
+
+var (
+	// errInvalidMessage is returned by the decoder if the data in the
+	// stream does not contain a valid CLC message header
+	errInvalidMessage = errors.New("invalid CLC message")
+)
+
+// decoder reads CLC messages from a reader, it handles partial reads and
+// message framing
+type decoder struct {
+	r     io.Reader
+	buf   []byte
+	total int
+	err   error
+
+	// offset is the number of bytes in the stream before the buffer
+	offset int64
+
+	// invalid enables returning messages that fail validation as
+	// invalidMessage instead of parsing them
+	invalid bool
+
+	// warnings are the parse warnings of the last returned message
+	warnings parseWarnings
+
+	// stats counts detected and successfully parsed messages if set
+	stats *parseStats
+
+	// errors saves messages with parse errors if set, history contains
+	// the last stream bytes before the buffer
+	errors  *errorCorpus
+	history []byte
+}
+
+// newDecoder creates a new decoder that reads CLC messages from r
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{
+		r:   r,
+		buf: make([]byte, clcMessageBufSize),
+	}
+}
+
+// fill reads from the reader until there are at least n bytes in the buffer
+func (d *decoder) fill(n int) error {
+	for d.total < n {
+		if d.err != nil {
+			if d.err == io.EOF && d.total > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return d.err
+		}
+		var c int
+		c, d.err = d.r.Read(d.buf[d.total:])
+		d.total += c
+	}
+	return nil
+}
+
+// consume removes the first n bytes from the buffer
+func (d *decoder) consume(n int) {
+	if d.errors != nil {
+		d.history = append(d.history, d.buf[:n]...)
+		if len(d.history) > corpusContextLen {
+			d.history = d.history[len(d.history)-corpusContextLen:]
+		}
+	}
+	copy(d.buf, d.buf[n:d.total])
+	d.total -= n
+	d.offset += int64(n)
+}
+
+// next reads the next CLC message from the reader and returns it. It returns
+// io.EOF if there are no more messages in the stream, io.ErrUnexpectedEOF if
+// the stream ends in the middle of a message, and errInvalidMessage if the
+// stream does not contain a CLC message
+func (d *decoder) next() (clc.Message, error) {
+	d.warnings = nil
+
+	// get enough bytes for the CLC header
+	if err := d.fill(clc.HeaderLen); err != nil {
+		return nil, err
+	}
+
+	// parse header of current CLC message
+	msg, length := clc.NewMessage(d.buf[:clc.HeaderLen])
+	if msg == nil || int(length) < clc.HeaderLen {
+		return d.nextInvalid()
+	}
+
+	// get the complete message
+	if err := d.fill(int(length)); err != nil {
+		return nil, err
+	}
+
+	// parse message; it keeps a reference to the message bytes, so
+	// copy them out of the buffer first
+	buf := make([]byte, length)
+	copy(buf, d.buf[:length])
+	reason := validateMessage(msg, buf)
+	d.stats.add(reason == "")
+	if reason != "" {
+		d.saveError(reason, int(length))
+	}
+	d.consume(int(length))
+	if d.invalid && reason != "" {
+		msg = newInvalidMessage(reason)
+	}
+	msg.Parse(buf)
+	if reason == "" {
+		d.warnings = checkWarnings(msg, buf)
+	}
+
+	return msg, nil
+}
+
+// saveError saves the message with parse error reason and length n at the
+// start of the buffer and the surrounding stream bytes in the error corpus
+func (d *decoder) saveError(reason string, n int) {
+	if d.errors == nil {
+		return
+	}
+	after := d.buf[n:d.total]
+	if len(after) > corpusContextLen {
+		after = after[:corpusContextLen]
+	}
+	d.errors.add(reason, d.history, d.buf[:n], after)
+}
+
+// nextInvalid handles a CLC message with an invalid header. If invalid
+// messages are enabled and the header contains an eyecatcher, it returns the
+// message as invalidMessage. Otherwise, it returns errInvalidMessage
+func (d *decoder) nextInvalid() (clc.Message, error) {
+	if !clc.HasEyecatcher(d.buf[:clc.HeaderLen]) {
+		return nil, errInvalidMessage
+	}
+	d.stats.add(false)
+	d.saveError("invalid message header", clc.HeaderLen)
+	if !d.invalid {
+		return nil, errInvalidMessage
+	}
+	length := binary.BigEndian.Uint16(d.buf[5:7])
+
+	// message with unknown type, read it completely
+	if length >= clc.HeaderLen+clc.TrailerLen &&
+		length <= clc.MaxMessageSize {
+		if err := d.fill(int(length)); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, length)
+		copy(buf, d.buf[:length])
+		d.consume(int(length))
+		msg := newInvalidMessage("unknown message type")
+		msg.Parse(buf)
+		return msg, nil
+	}
+
+	// message length is invalid, only header is available and we cannot
+	// find the next message in the stream
+	reason := "message too short"
+	if length > clc.MaxMessageSize {
+		reason = "message too big"
+	}
+	buf := make([]byte, clc.HeaderLen)
+	copy(buf, d.buf[:clc.HeaderLen])
+	d.err = errInvalidMessage
+	d.total = 0
+	msg := newInvalidMessage(reason)
+	msg.Parse(buf)
+	return msg, nil
+}
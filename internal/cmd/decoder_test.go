@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"log"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDecoder(t *testing.T) {
+	// prepare decline message
+	declineMsg := "e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9"
+	msg, err := hex.DecodeString(declineMsg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// test two messages with partial reads
+	stream := append(append([]byte{}, msg...), msg...)
+	d := newDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+	want := "Decline: Eyecatcher: SMC-R, Type: 4 (Decline), " +
+		"Length: 28, Version: 1, Out of Sync: 0, Path: SMC-R, " +
+		"Peer ID: 9509@25:25:25:25:25:00, " +
+		"Peer Diagnosis: 0x3030000 (no SMC device found (R or D)), " +
+		"Trailer: SMC-R"
+	for i := 0; i < 2; i++ {
+		clcMsg, err := d.next()
+		if err != nil {
+			t.Fatalf("d.next() error = %v; want nil", err)
+		}
+		got := clcMsg.String()
+		if got != want {
+			t.Errorf("got = %s; want %s", got, want)
+		}
+	}
+	if _, err := d.next(); err != io.EOF {
+		t.Errorf("d.next() error = %v; want %v", err, io.EOF)
+	}
+
+	// test stream that ends in the middle of a message
+	d = newDecoder(bytes.NewReader(msg[:20]))
+	if _, err := d.next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("d.next() error = %v; want %v", err,
+			io.ErrUnexpectedEOF)
+	}
+
+	// test stream without CLC message
+	d = newDecoder(bytes.NewReader(make([]byte, len(msg))))
+	if _, err := d.next(); err != errInvalidMessage {
+		t.Errorf("d.next() error = %v; want %v", err,
+			errInvalidMessage)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+var (
+	// dedups stores the recently seen packets for deduplication
+	dedups dedupTable
+)
+
+// dedupEntry is a packet hash and the time the packet was seen
+type dedupEntry struct {
+	hash uint64
+	seen time.Time
+}
+
+// dedupTable stores the hashes of the packets seen within the dedup window
+// in a map and in the order they were seen, and the number of duplicates
+// protected by a mutex
+type dedupTable struct {
+	lock       sync.Mutex
+	window     time.Duration
+	hashes     map[uint64]bool
+	order      []dedupEntry
+	duplicates uint64
+}
+
+// init initializes the dedup table with the dedup window, 0 disables
+// deduplication
+func (dt *dedupTable) init(window time.Duration) {
+	dt.lock.Lock()
+	dt.window = window
+	dt.hashes = make(map[uint64]bool)
+	dt.order = nil
+	dt.duplicates = 0
+	dt.lock.Unlock()
+}
+
+// dedupHash returns the hash of the packet with the network flow net, the
+// IPv4 header ip4, if any, and the tcp segment tcp. It only contains fields
+// that are equal in copies of the packet from different mirror points, so
+// link layer headers, TTL, and IP checksum are ignored
+func dedupHash(net gopacket.Flow, ip4 *layers.IPv4,
+	tcp *layers.TCP) uint64 {
+	h := fnv.New64a()
+	h.Write(net.Src().Raw())
+	h.Write(net.Dst().Raw())
+	if ip4 != nil {
+		h.Write(binary.BigEndian.AppendUint16(nil, ip4.Id))
+	}
+	h.Write(tcp.Contents)
+	h.Write(tcp.Payload)
+	return h.Sum64()
+}
+
+// duplicate checks if the packet with the tcp segment tcp is a duplicate of
+// a packet seen within the dedup window
+func (dt *dedupTable) duplicate(packet gopacket.Packet,
+	tcp *layers.TCP) bool {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	if dt.window <= 0 {
+		return false
+	}
+
+	// forget packets outside the dedup window
+	now := packet.Metadata().Timestamp
+	for len(dt.order) > 0 && now.Sub(dt.order[0].seen) > dt.window {
+		delete(dt.hashes, dt.order[0].hash)
+		dt.order = dt.order[1:]
+	}
+
+	ip4, _ := packet.NetworkLayer().(*layers.IPv4)
+	hash := dedupHash(packet.NetworkLayer().NetworkFlow(), ip4, tcp)
+	if dt.hashes[hash] {
+		dt.duplicates++
+		return true
+	}
+	dt.hashes[hash] = true
+	dt.order = append(dt.order, dedupEntry{hash, now})
+	return false
+}
+
+// count returns the number of duplicate packets
+func (dt *dedupTable) count() uint64 {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+	return dt.duplicates
+}
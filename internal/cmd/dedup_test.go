@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestDedupTable(t *testing.T) {
+	// create packet with IP ID, ttl, sequence number, and timestamp
+	newPacket := func(id uint16, ttl uint8, seq uint32,
+		ts time.Time) (gopacket.Packet, *layers.TCP) {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, ttl},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{Version: 4, TTL: ttl, Id: id,
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    net.IPv4(127, 0, 0, 1),
+			DstIP:    net.IPv4(127, 0, 0, 2)}
+		tcp := &layers.TCP{SrcPort: 12345, DstPort: 45678, Seq: seq,
+			ACK: true, Window: 1024}
+		tcp.SetNetworkLayerForChecksum(ip)
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true,
+			ComputeChecksums: true}
+		err := gopacket.SerializeLayers(buf, opts, eth, ip, tcp,
+			gopacket.Payload("SMC-R"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet,
+			gopacket.Default)
+		p.Metadata().Timestamp = ts
+		return p, p.TransportLayer().(*layers.TCP)
+	}
+
+	var dt dedupTable
+	now := time.Unix(10000, 0)
+
+	// disabled
+	dt.init(0)
+	p, tcp := newPacket(1, 64, 100, now)
+	if dt.duplicate(p, tcp) || dt.duplicate(p, tcp) {
+		t.Error("disabled: got duplicate")
+	}
+
+	// copy from another mirror point within the window
+	dt.init(10 * time.Millisecond)
+	if dt.duplicate(p, tcp) {
+		t.Error("first packet: got duplicate")
+	}
+	p, tcp = newPacket(1, 63, 100, now.Add(time.Millisecond))
+	if !dt.duplicate(p, tcp) {
+		t.Error("copy: got no duplicate")
+	}
+
+	// other packets: other IP ID, other sequence number
+	p, tcp = newPacket(2, 64, 100, now.Add(2*time.Millisecond))
+	if dt.duplicate(p, tcp) {
+		t.Error("other IP ID: got duplicate")
+	}
+	p, tcp = newPacket(1, 64, 200, now.Add(2*time.Millisecond))
+	if dt.duplicate(p, tcp) {
+		t.Error("other sequence number: got duplicate")
+	}
+
+	// copy outside the window
+	p, tcp = newPacket(1, 64, 100, now.Add(time.Second))
+	if dt.duplicate(p, tcp) {
+		t.Error("outside window: got duplicate")
+	}
+	if n := dt.count(); n != 1 {
+		t.Errorf("got %d duplicates; want 1", n)
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/ip4defrag"
+	"github.com/gopacket/gopacket/layers"
+)
+
+const (
+	// defragTimeout is the time after which incomplete fragmented IPv4
+	// packets are discarded
+	defragTimeout = 30 * time.Second
+)
+
+// defragPacket returns packet with its IPv4 fragments reassembled with the
+// defragmenter d. It returns packet itself if it is not fragmented and nil
+// if it is an incomplete or invalid fragment
+func defragPacket(d *ip4defrag.IPv4Defragmenter,
+	packet gopacket.Packet) gopacket.Packet {
+	ip, ok := packet.NetworkLayer().(*layers.IPv4)
+	if !ok {
+		return packet
+	}
+	out, err := d.DefragIPv4WithTimestamp(ip,
+		packet.Metadata().Timestamp)
+	if err != nil || out == nil {
+		return nil
+	}
+	if out == ip {
+		return packet
+	}
+
+	// rebuild the packet from the link layer headers of the last
+	// fragment and the reassembled IPv4 packet
+	var prefix []byte
+	for _, l := range packet.Layers() {
+		if l == gopacket.Layer(ip) {
+			break
+		}
+		prefix = append(prefix, l.LayerContents()...)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{
+		FixLengths:       true,
+		ComputeChecksums: true,
+	}
+	if err := gopacket.SerializeLayers(buf, opts, out,
+		gopacket.Payload(out.Payload)); err != nil {
+		return nil
+	}
+	data := append(prefix, buf.Bytes()...)
+
+	ci := packet.Metadata().CaptureInfo
+	ci.CaptureLength = len(data)
+	ci.Length = len(data)
+	defragged := gopacket.NewPacket(data, packet.Layers()[0].LayerType(),
+		gopacket.Default)
+	defragged.Metadata().CaptureInfo = ci
+	return defragged
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/ip4defrag"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestDefragPacket(t *testing.T) {
+	// create tcp segment with payload
+	payload := bytes.Repeat([]byte("SMC-R"), 20)
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Id:       1234,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IPv4(127, 0, 0, 1),
+		DstIP:    net.IPv4(127, 0, 0, 2),
+	}
+	tcp := &layers.TCP{SrcPort: 12345, DstPort: 45678, ACK: true,
+		PSH: true, Window: 1024}
+	tcp.SetNetworkLayerForChecksum(ip)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true,
+		ComputeChecksums: true}
+	err := gopacket.SerializeLayers(buf, opts, tcp,
+		gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	segment := append([]byte{}, buf.Bytes()...)
+
+	// split tcp segment into two IPv4 fragments in ethernet frames
+	fragment := func(offset, end int, more bool) gopacket.Packet {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		frag := *ip
+		frag.FragOffset = uint16(offset / 8)
+		if more {
+			frag.Flags = layers.IPv4MoreFragments
+		}
+		buf := gopacket.NewSerializeBuffer()
+		err := gopacket.SerializeLayers(buf, opts, eth, &frag,
+			gopacket.Payload(segment[offset:end]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gopacket.NewPacket(buf.Bytes(),
+			layers.LayerTypeEthernet, gopacket.Default)
+	}
+
+	// first fragment is incomplete, second completes packet
+	d := ip4defrag.NewIPv4Defragmenter()
+	if p := defragPacket(d, fragment(0, 64, true)); p != nil {
+		t.Fatalf("first fragment: got %v; want nil", p)
+	}
+	p := defragPacket(d, fragment(64, len(segment), false))
+	if p == nil {
+		t.Fatal("second fragment: got nil; want packet")
+	}
+	if p.LinkLayer() == nil {
+		t.Error("reassembled packet has no link layer")
+	}
+	got, ok := p.TransportLayer().(*layers.TCP)
+	if !ok {
+		t.Fatal("reassembled packet has no tcp layer")
+	}
+	if got.SrcPort != 12345 || !bytes.Equal(got.Payload, payload) {
+		t.Errorf("got %v, %q; want 12345, %q", got.SrcPort,
+			got.Payload, payload)
+	}
+	if ci := p.Metadata().CaptureInfo; ci.CaptureLength != len(p.Data()) {
+		t.Errorf("got capture length %d; want %d", ci.CaptureLength,
+			len(p.Data()))
+	}
+
+	// packets that are not fragmented are returned as they are
+	unfragmented := fragment(0, len(segment), false)
+	if p := defragPacket(d, unfragmented); p != unfragmented {
+		t.Errorf("got %v; want %v", p, unfragmented)
+	}
+}
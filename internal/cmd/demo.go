@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/packet-go/pkg/tcp"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// demoMode indicates if demo sessions are replayed instead of reading
+	// packets from a pcap file or network interface
+	demoMode bool
+
+	// demoPacketDelay is the delay between packets of a demo session
+	demoPacketDelay = time.Millisecond
+
+	// demoSessionDelay is the delay between demo sessions
+	demoSessionDelay = time.Second
+)
+
+// demoMessage is a message sent in a demo session
+type demoMessage struct {
+	fromClient bool
+	payload    string
+}
+
+// demoSession is a sample tcp connection with SMC handshake
+type demoSession struct {
+	clientIP   string
+	clientPort uint16
+	serverIP   string
+	serverPort uint16
+	smcServer  bool
+	messages   []demoMessage
+}
+
+// demoSessions are the bundled sample sessions
+var demoSessions = []demoSession{
+	// SMC-R handshake
+	{
+		"127.0.0.1", 60294, "127.0.0.1", 50000, true,
+		[]demoMessage{
+			{true, "e2d4c3d901003410b1a098039babcdef" +
+				"fe800000000000009a039bfffeabcdef" +
+				"98039babcdef00007f00000008000000" +
+				"e2d4c3d9"},
+			{false, "e2d4c3d902004418b1a098039babcdef" +
+				"fe800000000000009a039bfffeabcdef" +
+				"98039babcdef0000e40000157d010000" +
+				"0005230000000000f0a600000072f5fe" +
+				"e2d4c3d9"},
+			{true, "e2d4c3d903004410b1a098039babcdef" +
+				"fe800000000000009a039bfffeabcdef" +
+				"98039babcdef0000e50000187f010000" +
+				"0006230000000000f0a40000000d89a4" +
+				"e2d4c3d9"},
+		},
+	},
+
+	// SMC-R handshake declined by server
+	{
+		"127.0.0.1", 60295, "127.0.0.1", 50000, true,
+		[]demoMessage{
+			{true, "e2d4c3d901003410b1a098039babcdef" +
+				"fe800000000000009a039bfffeabcdef" +
+				"98039babcdef00007f00000008000000" +
+				"e2d4c3d9"},
+			{false, "e2d4c3d904001c102525252525252500" +
+				"0303000000000000e2d4c3d9"},
+		},
+	},
+
+	// server without SMC support, fallback to tcp
+	{
+		"127.0.0.1", 60296, "127.0.0.1", 50001, false,
+		[]demoMessage{
+			{true, hex.EncodeToString([]byte("hello"))},
+			{false, hex.EncodeToString([]byte("world"))},
+		},
+	},
+}
+
+// packets returns the packets of the demo session
+func (s *demoSession) packets() [][]byte {
+	options := []layers.TCPOption{
+		{
+			OptionType:   tcpOptionExp2,
+			OptionLength: 6,
+			OptionData:   clc.SMCREyecatcher,
+		},
+	}
+	client := tcp.NewPeer("00:00:00:00:00:00", s.clientIP, s.clientPort,
+		100)
+	server := tcp.NewPeer("00:00:00:00:00:00", s.serverIP, s.serverPort,
+		100)
+	conn := tcp.NewConn(client, server)
+	conn.Options.SYN = options
+	if s.smcServer {
+		conn.Options.SYNACK = options
+	}
+	conn.Connect()
+	for _, m := range s.messages {
+		payload, err := hex.DecodeString(m.payload)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if m.fromClient {
+			conn.Send(client, server, payload)
+		} else {
+			conn.Send(server, client, payload)
+		}
+	}
+	conn.Disconnect()
+	return conn.Packets
+}
+
+// listenDemo replays the demo sessions at real-time pace and handles their
+// packets with handler
+func listenDemo(handler *handler) {
+	log.Printf("Replaying demo sessions:\n")
+	for _, s := range demoSessions {
+		for _, p := range s.packets() {
+			if interrupted.Load() {
+				return
+			}
+			time.Sleep(demoPacketDelay)
+			packet := gopacket.NewPacket(p,
+				layers.LayerTypeEthernet, gopacket.Default)
+			packet.Metadata().Timestamp = time.Now()
+			handler.HandlePacket(packet)
+		}
+
+		// give the streams time to handle the session
+		time.Sleep(demoSessionDelay)
+	}
+}
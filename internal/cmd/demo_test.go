@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestDemoSessions(t *testing.T) {
+	// count packets with smc option and payload in demo sessions
+	var options, payloads int
+	for _, s := range demoSessions {
+		for _, p := range s.packets() {
+			packet := gopacket.NewPacket(p,
+				layers.LayerTypeEthernet, gopacket.Default)
+			tcp, ok := packet.TransportLayer().(*layers.TCP)
+			if !ok {
+				t.Fatal("demo packet is not a tcp packet")
+			}
+			if clc.CheckSMCOption(tcp) {
+				options++
+			}
+			if len(tcp.Payload) > 0 {
+				payloads++
+			}
+		}
+	}
+
+	// test smc options in SYNs and SYN-ACKs of 2 SMC servers and SYN of
+	// 1 fallback server
+	want := 5
+	got := options
+	if got != want {
+		t.Errorf("got = %d; want %d", got, want)
+	}
+
+	// test payloads
+	want = 7
+	got = payloads
+	if got != want {
+		t.Errorf("got = %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// event types
+const (
+	eventMessage    = "message"
+	eventHandshake  = "handshake"
+	eventFallback   = "fallback"
+	eventStats      = "stats"
+	eventOverflow   = "overflow"
+	eventAnnotation = "annotation"
+	eventAlert      = "alert"
+	eventError      = "error"
+	eventHeartbeat  = "heartbeat"
+)
+
+// alert event sources
+const (
+	alertBudget       = "attempt-budget"
+	alertDeclineLoop  = "decline-loop"
+	alertChurn        = "churn"
+	alertChurnSummary = "churn-summary"
+	alertAnomaly      = "anomaly"
+	alertRule         = "rule"
+	alertRuleTags     = "rule-tags"
+)
+
+// error event sources
+const (
+	errorCheck        = "check"
+	errorRoundTrip    = "round-trip"
+	errorLinkID       = "link-id"
+	errorSYNOption    = "syn-option"
+	errorSYNACKOption = "syn-ack-option"
+	errorSnaplen      = "snaplen"
+)
+
+var (
+	// eventTypes are all event types
+	eventTypes = []string{eventMessage, eventHandshake, eventFallback,
+		eventStats, eventOverflow, eventAnnotation, eventAlert,
+		eventError, eventHeartbeat}
+
+	// sinks are the output sinks that render events
+	sinks = []sink{textSink{}, &jsonEvents, &csvEvents, &protoEvents,
+		&cefEvents, &syslogEvents, &kafkaEvents, &mqttEvents,
+		&grpcEvents, &avroEvents, &messageHistory}
+
+	// jsonEvents is the JSON sink
+	jsonEvents jsonSink
+)
+
+// event is an output event: a CLC message, a finished handshake, a
+// connection that fell back to tcp, handshake statistics, a flow rejected
+// or evicted because the flow table was full, a user-defined marker, an
+// alert, e.g., a client that exceeded its connection attempt budget or a
+// decline loop, an error found in the messages, e.g., a handshake
+// inconsistency, or a periodic heartbeat. All events flow through emit to the
+// sinks, so new outputs only add a sink
+type event struct {
+	typ string
+
+	// common metadata: time of the event, set by emit if not set
+	time time.Time
+
+	// message, fallback, overflow, and error events
+	net, trans gopacket.Flow
+
+	// message event: message, its handshake session ID, 0 if the
+	// message is not part of a tracked handshake, and its parse warnings
+	msg      clc.Message
+	session  uint64
+	warnings parseWarnings
+
+	// handshake event
+	result *handshakeResult
+
+	// fallback event: reason, overflow event: action, i.e., rejected or
+	// evicted, alert and error event: source, e.g., check
+	reason string
+
+	// stats event: counts of attempted, succeeded, declined, and fallen
+	// back handshakes, interval, and statistics of last interval
+	counts   [4]uint64
+	interval time.Duration
+	last     string
+
+	// annotation event: user-defined marker, alert event: alert about the
+	// peers in net, error event: error
+	text string
+
+	// attempt budget alert event: client that exceeded its attempt budget
+	alert *budgetAlert
+
+	// heartbeat event: run totals
+	totals *runCounts
+}
+
+// sink renders the output events it accepts
+type sink interface {
+	accepts(typ string) bool
+	render(e *event)
+}
+
+// emit sends the event e to all sinks that accept its type
+func emit(e *event) {
+	if e.time.IsZero() {
+		e.time = time.Now()
+	}
+	for _, s := range sinks {
+		if s.accepts(e.typ) {
+			s.render(e)
+		}
+	}
+}
+
+// parseEventTypes parses the comma-separated list of event types in spec
+func parseEventTypes(spec string) (map[string]bool, error) {
+	types := make(map[string]bool)
+	if spec == "" {
+		return types, nil
+	}
+	for _, typ := range strings.Split(spec, ",") {
+		typ = strings.TrimSpace(typ)
+		known := false
+		for _, t := range eventTypes {
+			if typ == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown event type %q", typ)
+		}
+		types[typ] = true
+	}
+	return types, nil
+}
+
+// textSink renders events as human-readable text to stdout depending on the
+// display command line arguments
+type textSink struct{}
+
+// accepts checks if the text sink renders events of type typ
+func (textSink) accepts(typ string) bool {
+	if !textOutput || textOutputPaused() {
+		return false
+	}
+	switch typ {
+	case eventMessage:
+		return !*showSummary && *smartSampleRate == 0
+	case eventHandshake:
+		return *showSummary || *showLatencies
+	case eventFallback:
+		return *showFallbacks
+	case eventStats, eventOverflow, eventAnnotation, eventAlert,
+		eventError:
+		return true
+	}
+	return false
+}
+
+// render renders the event e as text
+func (textSink) render(e *event) {
+	switch e.typ {
+	case eventMessage:
+		printCLC(e.net, e.trans, e.msg, e.session, e.warnings)
+	case eventHandshake:
+		if *showLatencies {
+			printLatencies(e.result)
+		}
+		if *showSummary {
+			printSummary(e.result)
+		}
+	case eventFallback:
+		printFallback(fallbackKey{e.net, e.trans}, e.reason)
+	case eventStats:
+		printStatsInterval(e.interval, e.last)
+	case eventOverflow:
+		printOverflow(e.net, e.trans, e.reason)
+	case eventAnnotation:
+		printAnnotation(e.text)
+	case eventAlert:
+		switch e.reason {
+		case alertBudget:
+			printBudgetAlert(e.alert)
+		case alertDeclineLoop:
+			printDeclineLoop(e.net, e.text)
+		case alertChurn:
+			printChurnWarning(e.net, e.trans, e.text)
+		case alertChurnSummary:
+			printChurnSummary(e.text)
+		case alertAnomaly:
+			printAnomaly(e.text)
+		case alertRule:
+			printRuleAlert(e.net, e.trans, "Alert", e.text)
+		case alertRuleTags:
+			printRuleAlert(e.net, e.trans, "Tags", e.text)
+		}
+	case eventError:
+		switch e.reason {
+		case errorCheck:
+			printCheck(e.net, e.trans, e.text)
+		case errorRoundTrip:
+			printRoundTrip(e.net, e.trans, e.text)
+		case errorLinkID:
+			printLinkReuse(e.net, e.trans, e.text)
+		case errorSYNOption:
+			printSYNOptionWarning(e.net, e.trans, "SYN", e.text)
+		case errorSYNACKOption:
+			printSYNOptionWarning(e.net, e.trans, "SYN-ACK", e.text)
+		case errorSnaplen:
+			printSnaplenWarning(e.net, e.trans, e.text)
+		}
+	}
+}
+
+// jsonSink renders the event types selected on the command line as JSON lines
+// to the JSON output
+type jsonSink struct {
+	types map[string]bool
+}
+
+// accepts checks if the JSON sink renders events of type typ
+func (j *jsonSink) accepts(typ string) bool {
+	return j.types[typ]
+}
+
+// render renders the event e as JSON line
+func (j *jsonSink) render(e *event) {
+	if v := jsonEvent(e); v != nil {
+		writeJSON(v)
+	}
+}
+
+// jsonEvent returns the event e as JSON event, nil for unknown event types
+func jsonEvent(e *event) any {
+	switch e.typ {
+	case eventMessage:
+		return clcJSON(e.time, e.net, e.trans, e.msg, e.session,
+			e.warnings)
+	case eventHandshake:
+		return handshakeJSON(e.time, e.result)
+	case eventFallback:
+		return fallbackJSON(e.time, e.net, e.trans, e.reason)
+	case eventStats:
+		return statsJSON(e.time, e.counts, e.interval)
+	case eventOverflow:
+		return overflowJSON(e.time, e.net, e.trans, e.reason)
+	case eventAnnotation:
+		return annotationJSON(e.time, e.text)
+	case eventAlert:
+		if e.reason == alertBudget {
+			return budgetAlertJSON(e.time, e.alert)
+		}
+		return alertJSON(e.time, e.net, e.trans, e.reason, e.text)
+	case eventError:
+		return errorJSON(e.time, e.net, e.trans, e.reason, e.text)
+	case eventHeartbeat:
+		return heartbeatJSON(e.time, e.totals)
+	}
+	return nil
+}
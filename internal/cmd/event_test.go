@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestParseEventTypes(t *testing.T) {
+	// test valid event types
+	got, err := parseEventTypes("message, fallback")
+	want := map[string]bool{eventMessage: true, eventFallback: true}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v, %v; want %v, nil", got, err, want)
+	}
+
+	// test invalid event type
+	if _, err := parseEventTypes("message,unknown"); err == nil {
+		t.Errorf("got = nil; want error")
+	}
+}
+
+func TestEmit(t *testing.T) {
+	var text, js bytes.Buffer
+	stdout = &text
+	jsonOutput = &js
+	defer func() { jsonOutput = nil }()
+	*showTimestamps = false
+	*showFallbacks = true
+	defer func() { *showFallbacks = false }()
+
+	// emit fallback and handshake events with JSON sink accepting only
+	// handshake events
+	jsonEvents.types = map[string]bool{eventHandshake: true}
+	defer func() { jsonEvents.types = nil }()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	emit(&event{typ: eventFallback, net: net, trans: trans,
+		reason: fallbackNoOption})
+	emit(&event{typ: eventHandshake, result: &handshakeResult{
+		key:       handshakeKey{net, trans},
+		version:   1,
+		diagnosis: "0x3030000 (no SMC device found (R or D))",
+	}})
+
+	// check text output
+	want := "1.2.3.4:123 -> 5.6.7.8:456: Fell back to TCP: " +
+		fallbackNoOption + "\n"
+	if text.String() != want {
+		t.Errorf("got = %s; want %s", text.String(), want)
+	}
+
+	// check JSON output
+	var got jsonHandshake
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != eventHandshake || got.Result != "declined" ||
+		!strings.HasPrefix(got.Diagnosis, "0x3030000") {
+		t.Errorf("got = %v; want declined handshake", got)
+	}
+}
+
+func TestEmitError(t *testing.T) {
+	var text, js bytes.Buffer
+	stdout = &text
+	jsonOutput = &js
+	defer func() { jsonOutput = nil }()
+	*showTimestamps = false
+
+	// emit error and heartbeat events with JSON sink accepting both
+	jsonEvents.types = map[string]bool{eventError: true,
+		eventHeartbeat: true}
+	defer func() { jsonEvents.types = nil }()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	e := &event{typ: eventError, reason: errorCheck, net: net,
+		trans: trans, text: "Server and Client PSN 1 equal"}
+	emit(e)
+	emit(&event{typ: eventHeartbeat, totals: &runCounts{packets: 3,
+		flows: 2, messages: 1}})
+
+	// check common metadata and text output without heartbeat
+	if e.time.IsZero() {
+		t.Error("e.time is zero; want time of emit")
+	}
+	want := "1.2.3.4:123 -> 5.6.7.8:456: Check: Server and Client " +
+		"PSN 1 equal\n"
+	if text.String() != want {
+		t.Errorf("got = %s; want %s", text.String(), want)
+	}
+
+	// check JSON output
+	lines := strings.Split(strings.TrimSpace(js.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("len(lines) = %d; want 2", len(lines))
+	}
+	var gotError jsonError
+	if err := json.Unmarshal([]byte(lines[0]), &gotError); err != nil {
+		t.Fatal(err)
+	}
+	if gotError.Source != errorCheck || gotError.Src != "1.2.3.4:123" ||
+		!gotError.Time.Equal(e.time) {
+		t.Errorf("got = %v; want check error", gotError)
+	}
+	var gotHeartbeat jsonHeartbeat
+	if err := json.Unmarshal([]byte(lines[1]), &gotHeartbeat); err != nil {
+		t.Fatal(err)
+	}
+	if gotHeartbeat.Packets != 3 || gotHeartbeat.Messages != 1 {
+		t.Errorf("got = %v; want heartbeat", gotHeartbeat)
+	}
+}
+
+func TestEmitAlerts(t *testing.T) {
+	var text, js bytes.Buffer
+	stdout = &text
+	jsonOutput = &js
+	defer func() { jsonOutput = nil }()
+	*showTimestamps = false
+
+	// emit alert and error events with JSON sink accepting both
+	jsonEvents.types = map[string]bool{eventAlert: true, eventError: true}
+	defer func() { jsonEvents.types = nil }()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	for _, test := range []struct {
+		e    *event
+		want string
+	}{
+		{&event{typ: eventAlert, reason: alertChurn, net: net,
+			trans: trans, text: "churn"},
+			"Churn: 1.2.3.4 -> 5.6.7.8:456: churn\n"},
+		{&event{typ: eventAlert, reason: alertChurnSummary,
+			text: "summary"}, "Churn Summary: summary\n"},
+		{&event{typ: eventAlert, reason: alertAnomaly,
+			text: "anomaly"}, "Anomaly: anomaly\n"},
+		{&event{typ: eventAlert, reason: alertRule, net: net,
+			trans: trans, text: "rule"},
+			"1.2.3.4:123 -> 5.6.7.8:456: Alert: rule\n"},
+		{&event{typ: eventAlert, reason: alertRuleTags, net: net,
+			trans: trans, text: "a, b"},
+			"1.2.3.4:123 -> 5.6.7.8:456: Tags: a, b\n"},
+		{&event{typ: eventError, reason: errorSYNACKOption, net: net,
+			trans: trans, text: "option"},
+			"1.2.3.4:123 -> 5.6.7.8:456: SYN-ACK Option Warning: " +
+				"option\n"},
+		{&event{typ: eventError, reason: errorSnaplen, net: net,
+			trans: trans, text: "truncated"},
+			"1.2.3.4:123 -> 5.6.7.8:456: Snaplen Warning: " +
+				"truncated\n"},
+	} {
+		text.Reset()
+		js.Reset()
+		emit(test.e)
+
+		// check text output
+		if text.String() != test.want {
+			t.Errorf("got = %s; want %s", text.String(), test.want)
+		}
+
+		// check JSON output
+		var got struct {
+			Type   string `json:"type"`
+			Source string `json:"source"`
+		}
+		if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != test.e.typ || got.Source != test.e.reason {
+			t.Errorf("got = %v; want %s %s", got, test.e.typ,
+				test.e.reason)
+		}
+	}
+}
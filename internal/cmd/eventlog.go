@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+const (
+	// eventLogMagic is the header of binary event log files
+	eventLogMagic = "smc-clc event log 1\n"
+)
+
+var (
+	// replayMode indicates if CLC messages are read from a binary event
+	// log instead of packets
+	replayMode bool
+
+	// replayFile is the binary event log file in replay mode
+	replayFile string
+
+	// eventLogs stores the event log table
+	eventLogs eventLogTable
+)
+
+// eventLogRecord is a CLC message in the binary event log with its raw bytes,
+// its capture timestamp, and the network and transport flows it was sent over
+type eventLogRecord struct {
+	seen       time.Time
+	net, trans gopacket.Flow
+	raw        []byte
+}
+
+// marshal returns the record in the binary event log format: the capture
+// timestamp in nanoseconds, the address length, the source and destination
+// addresses and ports, and the length and raw bytes of the message. All
+// numbers are big endian
+func (r *eventLogRecord) marshal() []byte {
+	src, dst := r.net.Endpoints()
+	sport, dport := r.trans.Endpoints()
+	b := binary.BigEndian.AppendUint64(nil, uint64(r.seen.UnixNano()))
+	b = append(b, byte(len(src.Raw())))
+	b = append(b, src.Raw()...)
+	b = append(b, dst.Raw()...)
+	b = append(b, sport.Raw()...)
+	b = append(b, dport.Raw()...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(r.raw)))
+	return append(b, r.raw...)
+}
+
+// readEventLogRecord reads the next record from the binary event log r
+func readEventLogRecord(r io.Reader) (*eventLogRecord, error) {
+	var hdr [9]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := int(hdr[8])
+	endpoint := layers.EndpointIPv4
+	switch n {
+	case 4:
+	case 16:
+		endpoint = layers.EndpointIPv6
+	default:
+		return nil, fmt.Errorf("invalid address length %d in event "+
+			"log", n)
+	}
+	addrs := make([]byte, 2*n+6)
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	raw := make([]byte, binary.BigEndian.Uint16(addrs[2*n+4:]))
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	ts := int64(binary.BigEndian.Uint64(hdr[:]))
+	return &eventLogRecord{
+		seen: time.Unix(0, ts),
+		net:  gopacket.NewFlow(endpoint, addrs[:n], addrs[n:2*n]),
+		trans: gopacket.NewFlow(layers.EndpointTCPPort,
+			addrs[2*n:2*n+2], addrs[2*n+2:2*n+4]),
+		raw: raw,
+	}, nil
+}
+
+// eventLogRaw returns the raw bytes of the CLC message msg including invalid
+// messages
+func eventLogRaw(msg clc.Message) []byte {
+	if m, ok := msg.(*invalidMessage); ok {
+		return m.raw
+	}
+	return messageRaw(msg)
+}
+
+// eventLogTable writes the CLC messages with their capture metadata to the
+// binary event log protected by a mutex
+type eventLogTable struct {
+	lock    sync.Mutex
+	file    *os.File
+	records uint64
+}
+
+// init initializes the event log table and creates the event log file
+func (et *eventLogTable) init(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(eventLogMagic); err != nil {
+		f.Close()
+		return err
+	}
+
+	et.lock.Lock()
+	et.file = f
+	et.records = 0
+	et.lock.Unlock()
+	return nil
+}
+
+// add writes the CLC message msg sent over the network flow net and the
+// transport flow trans and seen at time seen to the event log
+func (et *eventLogTable) add(seen time.Time, net, trans gopacket.Flow,
+	msg clc.Message) {
+	raw := eventLogRaw(msg)
+	if len(raw) == 0 {
+		return
+	}
+	r := &eventLogRecord{seen: seen, net: net, trans: trans, raw: raw}
+
+	et.lock.Lock()
+	defer et.lock.Unlock()
+	if et.file == nil {
+		return
+	}
+	if _, err := et.file.Write(r.marshal()); err != nil {
+		log.Println("Error writing event log:", err)
+		return
+	}
+	et.records++
+}
+
+// close closes the event log file and returns the number of written records
+func (et *eventLogTable) close() uint64 {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	if et.file == nil {
+		return 0
+	}
+	if err := et.file.Close(); err != nil {
+		log.Println("Error closing event log:", err)
+	}
+	et.file = nil
+	return et.records
+}
+
+// replayEventLogRecord decodes the CLC message in the event log record r
+// with the current display settings and emits it like a captured message
+func replayEventLogRecord(r *eventLogRecord) {
+	d := newDecoder(bytes.NewReader(r.raw))
+	d.invalid = *showInvalid
+	d.stats = &parsing
+	msg, err := d.next()
+	if err != nil {
+		return
+	}
+
+	checks, result := handshakes.add(r.net, r.trans, msg, r.seen)
+	session := handshakes.session(r.net, r.trans)
+	if result != nil {
+		session = result.id
+	}
+	emit(&event{typ: eventMessage, time: r.seen, net: r.net,
+		trans: r.trans, msg: msg, session: session,
+		warnings: d.warnings})
+	runTotals.addMessage(msg)
+	declines.add(r.net, msg)
+	stats.addMessage(msg)
+	if *checkHandshakes {
+		for _, c := range checks {
+			emit(&event{typ: eventError, time: r.seen, net: r.net,
+				trans: r.trans, reason: errorCheck, text: c})
+		}
+	}
+	if result == nil {
+		return
+	}
+	emit(&event{typ: eventHandshake, time: r.seen, result: result})
+	durations.add(result.total)
+	bufferSizes.add(result)
+}
+
+// listenEventLog reads the CLC messages from the binary event log file and
+// renders them with the current display settings
+func listenEventLog(file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(eventLogMagic))
+	if _, err := io.ReadFull(r, magic); err != nil ||
+		string(magic) != eventLogMagic {
+		log.Fatalf("%s is not an smc-clc event log", file)
+	}
+	log.Printf("Replaying event log %s:\n", file)
+	for !interrupted.Load() {
+		rec, err := readEventLogRecord(r)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			log.Println("Error reading event log:", err)
+			return
+		}
+		replayEventLogRecord(rec)
+	}
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// eventLogTestMessage returns the first CLC message of the demo sessions
+// with its raw bytes
+func eventLogTestMessage(t *testing.T) []byte {
+	for _, p := range demoSessions[0].packets() {
+		packet := gopacket.NewPacket(p, layers.LayerTypeEthernet,
+			gopacket.Default)
+		if packet.TransportLayer() == nil {
+			continue
+		}
+		payload := packet.TransportLayer().LayerPayload()
+		if len(payload) > 0 {
+			return payload
+		}
+	}
+	t.Fatal("no CLC message in demo session")
+	return nil
+}
+
+func TestEventLogTable(t *testing.T) {
+	raw := eventLogTestMessage(t)
+	msg, err := newDecoder(bytes.NewReader(raw)).next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write message over IPv4 and IPv6 flows to event log
+	file := filepath.Join(t.TempDir(), "events.log")
+	var et eventLogTable
+	if err := et.init(file); err != nil {
+		t.Fatal(err)
+	}
+	seen := time.Unix(1700000000, 123456789)
+	trans := gopacket.NewFlow(layers.EndpointTCPPort, []byte{0xeb, 0x86},
+		[]byte{0xc3, 0x50})
+	nets := []gopacket.Flow{
+		gopacket.NewFlow(layers.EndpointIPv4,
+			net.ParseIP("127.0.0.1").To4(),
+			net.ParseIP("127.0.0.2").To4()),
+		gopacket.NewFlow(layers.EndpointIPv6, net.ParseIP("fd00::1"),
+			net.ParseIP("fd00::2")),
+	}
+	for _, n := range nets {
+		et.add(seen, n, trans, msg)
+	}
+	if n := et.close(); n != uint64(len(nets)) {
+		t.Errorf("close() = %d; want %d", n, len(nets))
+	}
+
+	// read records from event log
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	magic := make([]byte, len(eventLogMagic))
+	if _, err := io.ReadFull(r, magic); err != nil ||
+		string(magic) != eventLogMagic {
+		t.Fatalf("got magic %q; want %q", magic, eventLogMagic)
+	}
+	for _, n := range nets {
+		rec, err := readEventLogRecord(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rec.seen.Equal(seen) {
+			t.Errorf("got time %v; want %v", rec.seen, seen)
+		}
+		if rec.net != n || rec.trans != trans {
+			t.Errorf("got flows %s %s; want %s %s", rec.net,
+				rec.trans, n, trans)
+		}
+		if !bytes.Equal(rec.raw, raw) {
+			t.Errorf("got raw %x; want %x", rec.raw, raw)
+		}
+	}
+	if _, err := readEventLogRecord(r); err != io.EOF {
+		t.Errorf("got %v; want EOF", err)
+	}
+}
+
+func TestReadEventLogRecordInvalid(t *testing.T) {
+	rec := &eventLogRecord{
+		net: gopacket.NewFlow(layers.EndpointIPv4,
+			net.ParseIP("127.0.0.1").To4(),
+			net.ParseIP("127.0.0.2").To4()),
+		trans: gopacket.NewFlow(layers.EndpointTCPPort, []byte{0, 1},
+			[]byte{0, 2}),
+		raw: []byte{1, 2, 3},
+	}
+	b := rec.marshal()
+
+	// truncated record
+	_, err := readEventLogRecord(bytes.NewReader(b[:len(b)-1]))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v; want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	// invalid address length
+	b[8] = 5
+	if _, err := readEventLogRecord(bytes.NewReader(b)); err == nil {
+		t.Error("got nil error; want error")
+	}
+}
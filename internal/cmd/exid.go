@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+const (
+	// tcpOptionExp1 and tcpOptionExp2 are the tcp experimental options
+	tcpOptionExp1 = 253
+	tcpOptionExp2 = 254
+)
+
+var (
+	// exids stores the ExID whitelist and learning table
+	exids exidTable
+)
+
+// exidKey identifies a tcp connection in the ExID table
+type exidKey struct {
+	net, trans gopacket.Flow
+}
+
+// exidTable stores the ExID whitelist used for SMC connection detection and
+// the ExIDs learned from SYNs of connections with CLC traffic protected by a
+// mutex
+type exidTable struct {
+	lock      sync.Mutex
+	whitelist [][]byte
+	pending   map[exidKey][]string
+	learned   map[string]bool
+}
+
+// init initializes the ExID table with the ExIDs in the comma-separated list
+// of hex values list
+func (et *exidTable) init(list string) error {
+	var whitelist [][]byte
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+		if s == "" {
+			continue
+		}
+		exid, err := hex.DecodeString(s)
+		if err != nil || (len(exid) != 2 && len(exid) != 4) {
+			return fmt.Errorf("invalid ExID: %s", s)
+		}
+		whitelist = append(whitelist, exid)
+	}
+
+	et.lock.Lock()
+	et.whitelist = whitelist
+	if et.pending == nil {
+		et.pending = make(map[exidKey][]string)
+		et.learned = make(map[string]bool)
+	}
+	et.lock.Unlock()
+	return nil
+}
+
+// check checks if a tcp experimental option in the tcp header starts with an
+// ExID in the whitelist
+func (et *exidTable) check(tcp *layers.TCP) bool {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	for _, opt := range tcp.Options {
+		if opt.OptionType != tcpOptionExp1 &&
+			opt.OptionType != tcpOptionExp2 {
+			continue
+		}
+		for _, exid := range et.whitelist {
+			if bytes.HasPrefix(opt.OptionData, exid) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ids returns the ExIDs in the whitelist
+func (et *exidTable) ids() [][]byte {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+	return append([][]byte(nil), et.whitelist...)
+}
+
+// addPending adds the ExIDs exids of the SYN of the connection identified by
+// the network flow net and the transport flow trans to the ExID table
+func (et *exidTable) addPending(net, trans gopacket.Flow, exids []string) {
+	et.lock.Lock()
+	if et.pending != nil {
+		et.pending[exidKey{net, trans}] = exids
+	}
+	et.lock.Unlock()
+}
+
+// learn adds the pending ExIDs of both directions of the connection
+// identified by the network flow net and the transport flow trans to the
+// learned ExIDs and returns the ExIDs that were not learned before
+func (et *exidTable) learn(net, trans gopacket.Flow) []string {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	var learned []string
+	keys := []exidKey{{net, trans}, {net.Reverse(), trans.Reverse()}}
+	for _, key := range keys {
+		for _, exid := range et.pending[key] {
+			if !et.learned[exid] {
+				et.learned[exid] = true
+				learned = append(learned, exid)
+			}
+		}
+		delete(et.pending, key)
+	}
+	return learned
+}
+
+// del removes the pending ExIDs of the connection identified by the network
+// flow net and the transport flow trans from the ExID table
+func (et *exidTable) del(net, trans gopacket.Flow) {
+	et.lock.Lock()
+	delete(et.pending, exidKey{net, trans})
+	et.lock.Unlock()
+}
+
+// list returns the sorted learned ExIDs as comma-separated list
+func (et *exidTable) list() string {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	var list []string
+	for exid := range et.learned {
+		list = append(list, exid)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+// tcpExIDs returns the ExIDs of the tcp experimental options in the tcp
+// header as hex strings
+func tcpExIDs(tcp *layers.TCP) []string {
+	var list []string
+	for _, opt := range tcp.Options {
+		if opt.OptionType != tcpOptionExp1 &&
+			opt.OptionType != tcpOptionExp2 {
+			continue
+		}
+		exid := opt.OptionData
+		switch {
+		case len(exid) >= 4:
+			list = append(list, hex.EncodeToString(exid[:4]))
+		case len(exid) >= 2:
+			list = append(list, hex.EncodeToString(exid[:2]))
+		}
+	}
+	return list
+}
+
+// checkSMCOption checks if the SMC option or a tcp experimental option with
+// a whitelisted ExID is set in the tcp header
+func checkSMCOption(tcp *layers.TCP) bool {
+	return clc.CheckSMCOption(tcp) || exids.check(tcp)
+}
+
+// printLearnedExID prints an ExID learned from the connection identified by
+// the network flow net and the transport flow trans
+func printLearnedExID(net, trans gopacket.Flow, exid string) {
+	exidFmt := "%s%s:%s -> %s:%s: Learned ExID: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, exidFmt, t, net.Src(), trans.Src(), net.Dst(),
+		trans.Dst(), exid)
+}
+
+// printExIDWhitelist prints the learned ExIDs in a format suitable for the
+// exids command line argument
+func printExIDWhitelist() {
+	fmt.Fprintf(stdout, "ExID Whitelist: -exids %s\n", exids.list())
+}
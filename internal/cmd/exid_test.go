@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"log"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestExIDTable(t *testing.T) {
+	var et exidTable
+
+	// test invalid whitelist
+	if err := et.init("e2d4c3"); err == nil {
+		t.Errorf("got = nil; want error")
+	}
+
+	// test whitelist
+	if err := et.init("0x1234, abcdef01"); err != nil {
+		log.Fatal(err)
+	}
+	tcp := &layers.TCP{Options: []layers.TCPOption{
+		{
+			OptionType:   254,
+			OptionLength: 8,
+			OptionData:   []byte{0x12, 0x34, 0x56, 0x78},
+		},
+	}}
+	if !et.check(tcp) {
+		t.Errorf("got = false; want true")
+	}
+	tcp.Options[0].OptionData = []byte{0xab, 0xcd, 0xef, 0x02}
+	if et.check(tcp) {
+		t.Errorf("got = true; want false")
+	}
+
+	// test ExIDs in tcp header
+	tcp.Options = append(tcp.Options, layers.TCPOption{
+		OptionType:   254,
+		OptionLength: 6,
+		OptionData:   clc.SMCREyecatcher,
+	}, layers.TCPOption{
+		OptionType:   253,
+		OptionLength: 4,
+		OptionData:   []byte{0xf9, 0x89},
+	})
+	want := []string{"abcdef02", "e2d4c3d9", "f989"}
+	got := tcpExIDs(tcp)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test learning
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	et.addPending(net, trans, want)
+	et.addPending(net.Reverse(), trans.Reverse(), []string{"e2d4c3d9"})
+	want = []string{"e2d4c3d9", "abcdef02", "f989"}
+	got = et.learn(net.Reverse(), trans.Reverse())
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+	got = et.learn(net, trans)
+	if got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+	if list := et.list(); list != "abcdef02,e2d4c3d9,f989" {
+		t.Errorf("got = %s; want %s", list, "abcdef02,e2d4c3d9,f989")
+	}
+}
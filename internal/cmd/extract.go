@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+const (
+	// extractSnaplen is the snaplen in the extracted pcap file, it is the
+	// maximum snaplen of libpcap, so it fits packets of all input files
+	extractSnaplen = 262144
+)
+
+var (
+	// extractMode indicates if the packets of SMC connections are written
+	// to a pcap file instead of printing messages
+	extractMode bool
+
+	// extracts stores the extract table
+	extracts extractTable
+)
+
+// extractKey identifies a connection by the network and transport flows in
+// client to server direction
+type extractKey struct {
+	net, trans gopacket.Flow
+}
+
+// extractTable writes the packets of SMC connections up to the end of their
+// handshakes to a pcap file and stores the connections with finished
+// handshakes protected by a mutex
+type extractTable struct {
+	lock   sync.Mutex
+	export *pcapExport
+	done   map[extractKey]bool
+}
+
+// init initializes the extract table and creates the pcap or pcapng file
+func (et *extractTable) init(file string) error {
+	pe, err := newPcapExport(file)
+	if err != nil {
+		return err
+	}
+
+	et.lock.Lock()
+	et.export = pe
+	et.done = make(map[extractKey]bool)
+	et.lock.Unlock()
+	return nil
+}
+
+// lookup returns the key of the connection identified by the network flow
+// net and the transport flow trans in either direction and if its handshake
+// is finished, et must be locked
+func (et *extractTable) lookup(net, trans gopacket.Flow) (extractKey, bool) {
+	key := extractKey{net, trans}
+	if et.done[key] {
+		return key, true
+	}
+	rkey := extractKey{net.Reverse(), trans.Reverse()}
+	if et.done[rkey] {
+		return rkey, true
+	}
+	return key, false
+}
+
+// write writes the packet sent over the network flow net and the transport
+// flow trans to the pcap file if the handshake of its connection is not
+// finished. A SYN starts a new connection
+func (et *extractTable) write(packet gopacket.Packet, net,
+	trans gopacket.Flow, syn bool) {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	if et.export == nil {
+		return
+	}
+	key, done := et.lookup(net, trans)
+	if done && !syn {
+		return
+	}
+	delete(et.done, key)
+
+	if err := et.export.write(packet); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// annotate attaches the comment to the packet sent over the network flow net
+// and the transport flow trans at time seen in the pcapng file
+func (et *extractTable) annotate(net, trans gopacket.Flow, seen time.Time,
+	comment string) {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	if et.export == nil {
+		return
+	}
+	et.export.annotate(net, trans, seen, comment)
+}
+
+// flush writes the packets queued for comments to the pcapng file
+func (et *extractTable) flush() {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	if et.export == nil {
+		return
+	}
+	if err := et.export.flush(false); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writePcapPacket writes the packet to the pcap writer w of file f, the
+// first packet creates the writer and writes the file header with the link
+// type of the current listener
+func writePcapPacket(w **pcapgo.Writer, f io.Writer,
+	packet gopacket.Packet) error {
+	if *w == nil {
+		*w = pcapgo.NewWriter(f)
+		err := (*w).WriteFileHeader(extractSnaplen, captureLinkType())
+		if err != nil {
+			return err
+		}
+	}
+
+	// generated packets, e.g., of demo sessions, have no capture info
+	ci := packet.Metadata().CaptureInfo
+	if ci.CaptureLength == 0 {
+		ci.CaptureLength = len(packet.Data())
+		ci.Length = ci.CaptureLength
+	}
+	return (*w).WritePacket(ci, packet.Data())
+}
+
+// finish marks the handshake of the connection identified by the network
+// flow net and the transport flow trans as finished
+func (et *extractTable) finish(net, trans gopacket.Flow) {
+	et.lock.Lock()
+	if et.done != nil {
+		et.done[extractKey{net, trans}] = true
+	}
+	et.lock.Unlock()
+}
+
+// close writes the queued packets and closes the pcap or pcapng file
+func (et *extractTable) close() {
+	et.lock.Lock()
+	defer et.lock.Unlock()
+
+	if et.export == nil {
+		return
+	}
+	if err := et.export.close(); err != nil {
+		log.Println("Error closing extract file:", err)
+	}
+	et.export = nil
+}
+
+// captureLinkType returns the link type of the first current pcap listener
+// or ethernet if there is none
+func captureLinkType() layers.LinkType {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	if len(currentListeners) == 0 ||
+		currentListeners[0].PcapHandle == nil {
+		return layers.LinkTypeEthernet
+	}
+	return currentListeners[0].PcapHandle.LinkType()
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+func TestExtractTable(t *testing.T) {
+	var et extractTable
+
+	// prepare output file and packets of demo session
+	dir, err := os.MkdirTemp("", "smc-clc-extract")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "clc.pcap")
+	if err := et.init(file); err != nil {
+		log.Fatal(err)
+	}
+	var packets []gopacket.Packet
+	for _, p := range demoSessions[0].packets() {
+		packets = append(packets, gopacket.NewPacket(p,
+			layers.LayerTypeEthernet, gopacket.Default))
+	}
+	write := func(p gopacket.Packet) {
+		tcp := p.TransportLayer().(*layers.TCP)
+		et.write(p, p.NetworkLayer().NetworkFlow(),
+			p.TransportLayer().TransportFlow(), tcp.SYN && !tcp.ACK)
+	}
+
+	// write SYN and SYN-ACK, finish handshake in server direction, and
+	// write more packets of the connection and SYN of a new connection
+	write(packets[0])
+	write(packets[1])
+	et.finish(packets[1].NetworkLayer().NetworkFlow(),
+		packets[1].TransportLayer().TransportFlow())
+	write(packets[2])
+	write(packets[3])
+	write(packets[0])
+	et.close()
+
+	// test written packets
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if r.LinkType() != layers.LinkTypeEthernet {
+		t.Errorf("got = %s; want %s", r.LinkType(),
+			layers.LinkTypeEthernet)
+	}
+	got := 0
+	for {
+		if _, _, err := r.ReadPacketData(); err != nil {
+			break
+		}
+		got++
+	}
+	if got != 3 {
+		t.Errorf("got = %d; want 3", got)
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+)
+
+// fallback reasons
+const (
+	fallbackNoSYNACK  = "no SYN-ACK seen"
+	fallbackNoOption  = "server did not set SMC option"
+	fallbackNoMessage = "no CLC handshake"
+)
+
+var (
+	// fallbacks stores the tcp fallback table
+	fallbacks fallbackTable
+)
+
+// fallbackKey identifies a connection by the network and transport flows in
+// client to server direction
+type fallbackKey struct {
+	net, trans gopacket.Flow
+}
+
+// fallbackEntry stores if the server set the SMC option in its SYN-ACK and if
+// a CLC message was seen on the connection
+type fallbackEntry struct {
+	synAck    bool
+	smcOption bool
+	clc       bool
+}
+
+// fallbackTable stores connections with SMC option in their SYN protected by
+// a mutex
+type fallbackTable struct {
+	lock sync.Mutex
+	fmap map[fallbackKey]*fallbackEntry
+}
+
+// init initializes the fallback table
+func (ft *fallbackTable) init() {
+	ft.lock.Lock()
+	if ft.fmap == nil {
+		ft.fmap = make(map[fallbackKey]*fallbackEntry)
+	}
+	ft.lock.Unlock()
+}
+
+// lookup returns the key and entry identified by the network flow net and
+// the transport flow trans in either direction, ft must be locked
+func (ft *fallbackTable) lookup(net, trans gopacket.Flow) (fallbackKey,
+	*fallbackEntry) {
+	key := fallbackKey{net, trans}
+	if e := ft.fmap[key]; e != nil {
+		return key, e
+	}
+	key = fallbackKey{net.Reverse(), trans.Reverse()}
+	return key, ft.fmap[key]
+}
+
+// addSYN adds the connection with SMC option in the SYN sent over the network
+// flow net and the transport flow trans to the fallback table, it returns
+// true if the connection is new and not a retransmission
+func (ft *fallbackTable) addSYN(net, trans gopacket.Flow) bool {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	key := fallbackKey{net, trans}
+	if ft.fmap == nil || ft.fmap[key] != nil {
+		return false
+	}
+	ft.fmap[key] = &fallbackEntry{}
+	return true
+}
+
+// addSYNACK adds the SYN-ACK sent over the network flow net and the transport
+// flow trans to the fallback table, smcOption indicates if the SMC option is
+// set in the SYN-ACK. It returns true if this is the first SYN-ACK of a
+// connection in the fallback table
+func (ft *fallbackTable) addSYNACK(net, trans gopacket.Flow,
+	smcOption bool) bool {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	e := ft.fmap[fallbackKey{net.Reverse(), trans.Reverse()}]
+	if e == nil {
+		return false
+	}
+	first := !e.synAck
+	e.synAck = true
+	e.smcOption = smcOption
+	return first
+}
+
+// addCLC marks the connection identified by the network flow net and the
+// transport flow trans as connection with CLC messages
+func (ft *fallbackTable) addCLC(net, trans gopacket.Flow) {
+	ft.lock.Lock()
+	if _, e := ft.lookup(net, trans); e != nil {
+		e.clc = true
+	}
+	ft.lock.Unlock()
+}
+
+// del removes the connection identified by the network flow net and the
+// transport flow trans from the fallback table. If no CLC message was seen
+// on the connection, it returns the connection's key, the fallback reason,
+// and true
+func (ft *fallbackTable) del(net, trans gopacket.Flow) (fallbackKey, string,
+	bool) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	key, e := ft.lookup(net, trans)
+	if e == nil {
+		return key, "", false
+	}
+	delete(ft.fmap, key)
+	switch {
+	case e.clc:
+		return key, "", false
+	case !e.synAck:
+		return key, fallbackNoSYNACK, true
+	case !e.smcOption:
+		return key, fallbackNoOption, true
+	default:
+		return key, fallbackNoMessage, true
+	}
+}
+
+// printFallback prints that the connection identified by key fell back to
+// tcp because of reason
+func printFallback(key fallbackKey, reason string) {
+	fallbackFmt := "%s%s -> %s: Fell back to TCP: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, fallbackFmt, t, hostString(key.net.Src(),
+		key.trans.Src()), hostString(key.net.Dst(), key.trans.Dst()),
+		reason)
+}
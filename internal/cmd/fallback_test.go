@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestFallbackTable(t *testing.T) {
+	var ft fallbackTable
+
+	// initialize fallback table and test flows
+	ft.init()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	rnet, rtrans := net.Reverse(), trans.Reverse()
+
+	// test connection without entry
+	if _, _, ok := ft.del(net, trans); ok {
+		t.Errorf("got = %t; want false", ok)
+	}
+
+	// test connections with fallback
+	for _, test := range []struct {
+		synAck    bool
+		smcOption bool
+		want      string
+	}{
+		{false, false, fallbackNoSYNACK},
+		{true, false, fallbackNoOption},
+		{true, true, fallbackNoMessage},
+	} {
+		ft.addSYN(net, trans)
+		if test.synAck {
+			ft.addSYNACK(rnet, rtrans, test.smcOption)
+		}
+		key, got, ok := ft.del(rnet, rtrans)
+		if !ok || got != test.want {
+			t.Errorf("got = %s; want %s", got, test.want)
+		}
+		if key.net != net || key.trans != trans {
+			t.Errorf("got = %v; want %v", key,
+				fallbackKey{net, trans})
+		}
+	}
+
+	// test connection with CLC message
+	ft.addSYN(net, trans)
+	ft.addSYNACK(rnet, rtrans, true)
+	ft.addCLC(rnet, rtrans)
+	if _, _, ok := ft.del(net, trans); ok {
+		t.Errorf("got = %t; want false", ok)
+	}
+	if len(ft.fmap) != 0 {
+		t.Errorf("len(ft.fmap) = %d; want 0", len(ft.fmap))
+	}
+}
@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/tcpassembly"
+)
+
+// flow states that select the reassembly flush age of a connection
+const (
+	flowStateNew = iota
+	flowStateHandshake
+	flowStateDone
+)
+
+var (
+	// flowStates stores the flow state table
+	flowStates flowStateTable
+)
+
+// flowStateKey identifies a connection by the network and transport flows in
+// the direction of its first packet
+type flowStateKey struct {
+	net, trans gopacket.Flow
+}
+
+// flowStateFIN is a FIN sent over the network flow net that closes a
+// direction of a connection in the tcp assembler
+type flowStateFIN struct {
+	net gopacket.Flow
+	tcp *layers.TCP
+}
+
+// flowStateEntry stores the state and the time of the last activity of a
+// connection and, for both directions, the FIN derived from the SYN of the
+// direction
+type flowStateEntry struct {
+	state    int
+	lastSeen time.Time
+	fins     [2]*flowStateFIN
+}
+
+// flowStateTable stores the states of connections protected by a mutex
+type flowStateTable struct {
+	lock sync.Mutex
+	fmap map[flowStateKey]*flowStateEntry
+}
+
+// init initializes the flow state table
+func (ft *flowStateTable) init() {
+	ft.lock.Lock()
+	if ft.fmap == nil {
+		ft.fmap = make(map[flowStateKey]*flowStateEntry)
+	}
+	ft.lock.Unlock()
+}
+
+// lookup returns the key and entry of the connection identified by the
+// network flow net and the transport flow trans and the direction, 0 for the
+// direction of the key or 1 for the reverse direction, ft must be locked
+func (ft *flowStateTable) lookup(net, trans gopacket.Flow) (flowStateKey,
+	*flowStateEntry, int) {
+	key := flowStateKey{net, trans}
+	if e := ft.fmap[key]; e != nil {
+		return key, e, 0
+	}
+	rkey := flowStateKey{net.Reverse(), trans.Reverse()}
+	if e := ft.fmap[rkey]; e != nil {
+		return rkey, e, 1
+	}
+	return key, nil, 0
+}
+
+// seen marks activity on the connection identified by the network flow net
+// and the transport flow trans at time now and, if tcp is a SYN, derives the
+// FIN of its direction
+func (ft *flowStateTable) seen(net, trans gopacket.Flow, tcp *layers.TCP,
+	now time.Time) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	if ft.fmap == nil {
+		return
+	}
+	key, e, dir := ft.lookup(net, trans)
+	if e == nil {
+		e = &flowStateEntry{}
+		ft.fmap[key] = e
+	}
+	e.lastSeen = now
+	if tcp.SYN {
+		fin := *tcp
+		fin.SYN, fin.ACK, fin.RST, fin.FIN = false, false, false, true
+		fin.Seq = tcp.Seq + 1
+		fin.Contents, fin.Payload, fin.Options = nil, nil, nil
+		e.fins[dir] = &flowStateFIN{net, &fin}
+	}
+}
+
+// set sets the state of the connection identified by the network flow net
+// and the transport flow trans to state at time now, the state of a
+// connection never goes back
+func (ft *flowStateTable) set(net, trans gopacket.Flow, state int,
+	now time.Time) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	_, e, _ := ft.lookup(net, trans)
+	if e == nil || e.state >= state {
+		return
+	}
+	e.state = state
+	e.lastSeen = now
+}
+
+// expire removes the connections without activity for the flush age of their
+// state in ages from the flow state table at time now and returns the FINs
+// that close them in the tcp assembler
+func (ft *flowStateTable) expire(now time.Time,
+	ages [3]time.Duration) []*flowStateFIN {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	var fins []*flowStateFIN
+	for key, e := range ft.fmap {
+		if now.Sub(e.lastSeen) < ages[e.state] {
+			continue
+		}
+		delete(ft.fmap, key)
+		for _, fin := range e.fins {
+			if fin != nil {
+				fins = append(fins, fin)
+			}
+		}
+	}
+	return fins
+}
+
+// evict removes the connection identified by the network flow net and the
+// transport flow trans in either direction from the flow state table and
+// returns the FINs that close it in the tcp assembler
+func (ft *flowStateTable) evict(net, trans gopacket.Flow) []*flowStateFIN {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	key, e, _ := ft.lookup(net, trans)
+	if e == nil {
+		return nil
+	}
+	delete(ft.fmap, key)
+	var fins []*flowStateFIN
+	for _, fin := range e.fins {
+		if fin != nil {
+			fins = append(fins, fin)
+		}
+	}
+	return fins
+}
+
+// del removes the connection identified by the network flow net and the
+// transport flow trans from the flow state table
+func (ft *flowStateTable) del(net, trans gopacket.Flow) {
+	ft.lock.Lock()
+	delete(ft.fmap, flowStateKey{net, trans})
+	delete(ft.fmap, flowStateKey{net.Reverse(), trans.Reverse()})
+	ft.lock.Unlock()
+}
+
+// flushAges returns the reassembly flush ages of the flow states
+func flushAges() [3]time.Duration {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return [3]time.Duration{*flushNew, *flushHandshake, *flushDone}
+}
+
+// maxFlushAge returns the maximum reassembly flush age of all flow states
+func maxFlushAge() time.Duration {
+	max := time.Duration(0)
+	for _, age := range flushAges() {
+		if age > max {
+			max = age
+		}
+	}
+	return max
+}
+
+// flushStates closes the connections in the tcp assembler a that exceeded
+// the flush age of their flow state at time now. Connections without a
+// captured SYN are left to the flush of all connections with the maximum
+// flush age
+func flushStates(a *tcpassembly.Assembler, now time.Time) {
+	for _, fin := range flowStates.expire(now, flushAges()) {
+		a.AssembleWithTimestamp(fin.net, fin.tcp, now)
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/tcpassembly"
+)
+
+// testFlowStream is a tcp assembler stream that records if it is complete
+type testFlowStream struct {
+	complete bool
+}
+
+func (s *testFlowStream) Reassembled([]tcpassembly.Reassembly) {}
+
+func (s *testFlowStream) ReassemblyComplete() {
+	s.complete = true
+}
+
+// testFlowStreamFactory creates test flow streams
+type testFlowStreamFactory struct {
+	streams []*testFlowStream
+}
+
+func (f *testFlowStreamFactory) New(_, _ gopacket.Flow) tcpassembly.Stream {
+	s := &testFlowStream{}
+	f.streams = append(f.streams, s)
+	return s
+}
+
+func TestFlowStateTable(t *testing.T) {
+	var ft flowStateTable
+
+	// prepare test flows and SYN
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	syn := &layers.TCP{SYN: true, Seq: 100}
+	ages := [3]time.Duration{10 * time.Second, time.Minute, 0}
+	start := time.Unix(0, 0)
+
+	// test new connection before and after its flush age
+	ft.init()
+	ft.seen(net, trans, syn, start)
+	ft.seen(net.Reverse(), trans.Reverse(), &layers.TCP{}, start)
+	if got := ft.expire(start.Add(5*time.Second), ages); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+	got := ft.expire(start.Add(10*time.Second), ages)
+	if len(got) != 1 || got[0].net != net || !got[0].tcp.FIN ||
+		got[0].tcp.SYN || got[0].tcp.Seq != 101 {
+		t.Errorf("got = %v; want FIN with seq 101", got)
+	}
+
+	// test connection in handshake and with finished handshake
+	ft.seen(net, trans, syn, start)
+	ft.set(net.Reverse(), trans.Reverse(), flowStateHandshake, start)
+	if got := ft.expire(start.Add(30*time.Second), ages); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+	ft.set(net, trans, flowStateDone, start.Add(30*time.Second))
+	ft.set(net, trans, flowStateHandshake, start.Add(30*time.Second))
+	if got := ft.expire(start.Add(30*time.Second), ages); len(got) != 1 {
+		t.Errorf("got = %v; want 1 FIN", got)
+	}
+	if len(ft.fmap) != 0 {
+		t.Errorf("len(ft.fmap) = %d; want 0", len(ft.fmap))
+	}
+}
+
+func TestFlushStates(t *testing.T) {
+	// prepare assembler and flow state table
+	factory := &testFlowStreamFactory{}
+	assembler := tcpassembly.NewAssembler(tcpassembly.NewStreamPool(
+		factory))
+	flowStates.init()
+	defer func() { flowStates.fmap = nil }()
+
+	// assemble SYN and SYN-ACK of demo session and finish handshake
+	now := time.Now()
+	for _, p := range demoSessions[0].packets()[:2] {
+		packet := gopacket.NewPacket(p, layers.LayerTypeEthernet,
+			gopacket.Default)
+		net := packet.NetworkLayer().NetworkFlow()
+		tcp := packet.TransportLayer().(*layers.TCP)
+		flowStates.seen(net, tcp.TransportFlow(), tcp, now)
+		assembler.AssembleWithTimestamp(net, tcp, now)
+	}
+	packet := gopacket.NewPacket(demoSessions[0].packets()[0],
+		layers.LayerTypeEthernet, gopacket.Default)
+	flowStates.set(packet.NetworkLayer().NetworkFlow(),
+		packet.TransportLayer().TransportFlow(), flowStateDone, now)
+
+	// test closing both directions
+	flushStates(assembler, now)
+	if len(factory.streams) != 2 {
+		t.Fatalf("got = %d; want 2", len(factory.streams))
+	}
+	for _, s := range factory.streams {
+		if !s.complete {
+			t.Errorf("got = false; want true")
+		}
+	}
+}
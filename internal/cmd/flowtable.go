@@ -1,63 +1,186 @@
 package cmd
 
 import (
+	"container/list"
+	"fmt"
+	"io"
+	"sort"
 	"sync"
 
 	"github.com/gopacket/gopacket"
 )
 
+// flow table overflow policies
+const (
+	flowOverflowReject = "reject-new"
+	flowOverflowEvict  = "evict-oldest"
+)
+
 var (
 	// flows stores the flow table
 	flows flowTable
 )
 
-// flowTable stores a flow table protected by a mutex
+// flowTableKey identifies an entry in the flow table by the network flow and
+// the transport flow
+type flowTableKey struct {
+	net, trans gopacket.Flow
+}
+
+// flowTable stores a flow table with the entries in insertion order, the
+// maximum number of entries, the overflow policy, and the number of rejected
+// and evicted entries protected by a mutex
 type flowTable struct {
-	lock sync.Mutex
-	fmap map[gopacket.Flow]map[gopacket.Flow]bool
+	lock     sync.Mutex
+	fmap     map[gopacket.Flow]map[gopacket.Flow]*list.Element
+	order    list.List
+	max      int
+	policy   string
+	rejected uint64
+	evicted  uint64
 }
 
 // init initializes the flow table
 func (ft *flowTable) init() {
 	ft.lock.Lock()
 	if ft.fmap == nil {
-		ft.fmap = make(map[gopacket.Flow]map[gopacket.Flow]bool)
+		ft.fmap = make(map[gopacket.Flow]map[gopacket.Flow]*list.Element)
 	}
 	ft.lock.Unlock()
 }
 
-// add adds an entry identified by the network flow net and the transport flow
-// trans  to the flow table
-func (ft *flowTable) add(net, trans gopacket.Flow) {
+// setLimit sets the maximum number of entries in the flow table, 0 disables
+// the limit, and the overflow policy: reject-new or evict-oldest
+func (ft *flowTable) setLimit(max int, policy string) error {
+	if policy != flowOverflowReject && policy != flowOverflowEvict {
+		return fmt.Errorf("invalid flow overflow policy %q", policy)
+	}
+
 	ft.lock.Lock()
+	ft.max, ft.policy = max, policy
+	ft.lock.Unlock()
+	return nil
+}
+
+// lookup returns the element of the entry identified by the network flow net
+// and the transport flow trans in the insertion order or nil if there is no
+// such entry, ft must be locked
+func (ft *flowTable) lookup(net, trans gopacket.Flow) *list.Element {
 	if ft.fmap[net] == nil {
-		ft.fmap[net] = make(map[gopacket.Flow]bool)
+		return nil
 	}
+	return ft.fmap[net][trans]
+}
 
-	ft.fmap[net][trans] = true
-	ft.lock.Unlock()
+// remove removes the entry identified by the network flow net and the
+// transport flow trans from the flow table, ft must be locked
+func (ft *flowTable) remove(net, trans gopacket.Flow) {
+	if e := ft.lookup(net, trans); e != nil {
+		ft.order.Remove(e)
+		delete(ft.fmap[net], trans)
+	}
+}
+
+// add adds an entry identified by the network flow net and the transport flow
+// trans to the flow table. If the flow table is full, it rejects the entry or
+// evicts the oldest entry and its reverse direction depending on the overflow
+// policy, the reverse direction of an entry is never rejected. It returns if
+// the entry is in the flow table and the evicted entry, if any
+func (ft *flowTable) add(net, trans gopacket.Flow) (bool, *flowTableKey) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	if ft.lookup(net, trans) != nil {
+		return true, nil
+	}
+	var evicted *flowTableKey
+	if ft.max > 0 && ft.order.Len() >= ft.max {
+		switch {
+		case ft.policy == flowOverflowEvict:
+			key := ft.order.Front().Value.(flowTableKey)
+			ft.remove(key.net, key.trans)
+			ft.remove(key.net.Reverse(), key.trans.Reverse())
+			ft.evicted++
+			evicted = &key
+		case ft.lookup(net.Reverse(), trans.Reverse()) == nil:
+			ft.rejected++
+			return false, nil
+		}
+	}
+	if ft.fmap[net] == nil {
+		ft.fmap[net] = make(map[gopacket.Flow]*list.Element)
+	}
+	ft.fmap[net][trans] = ft.order.PushBack(flowTableKey{net, trans})
+	return true, evicted
 }
 
 // del removes the entry identified by the network flow net and the tansport
 // flow trans from the flow table
 func (ft *flowTable) del(net, trans gopacket.Flow) {
 	ft.lock.Lock()
-	if ft.fmap[net] != nil {
-		delete(ft.fmap[net], trans)
-	}
+	ft.remove(net, trans)
 	ft.lock.Unlock()
 }
 
 // get returns the entry identified by the network flow net and the transport
 // flow trans from the flow table
 func (ft *flowTable) get(net, trans gopacket.Flow) bool {
-	check := false
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	return ft.lookup(net, trans) != nil
+}
 
+// overflows returns the number of entries rejected and evicted because the
+// flow table was full
+func (ft *flowTable) overflows() (rejected, evicted uint64) {
 	ft.lock.Lock()
-	if ft.fmap[net] != nil {
-		check = ft.fmap[net][trans]
+	defer ft.lock.Unlock()
+	return ft.rejected, ft.evicted
+}
+
+// list returns the entries in the flow table as sorted strings
+func (ft *flowTable) list() []string {
+	flows := []string{}
+
+	ft.lock.Lock()
+	for net, tmap := range ft.fmap {
+		for trans := range tmap {
+			flows = append(flows, fmt.Sprintf("%s:%s -> %s:%s",
+				net.Src(), trans.Src(), net.Dst(), trans.Dst()))
+		}
 	}
 	ft.lock.Unlock()
 
-	return check
+	sort.Strings(flows)
+	return flows
+}
+
+// writeMetrics writes the size of the flow table and the number of rejected
+// and evicted entries in prometheus text format to w
+func (ft *flowTable) writeMetrics(w io.Writer) {
+	ft.lock.Lock()
+	size := ft.order.Len()
+	ft.lock.Unlock()
+	rejected, evicted := ft.overflows()
+
+	fmt.Fprintln(w, "# HELP smc_clc_flows Number of tracked flows.")
+	fmt.Fprintln(w, "# TYPE smc_clc_flows gauge")
+	fmt.Fprintf(w, "smc_clc_flows %d\n", size)
+	fmt.Fprintln(w, "# HELP smc_clc_flow_overflows_total Number of "+
+		"flows rejected or evicted because the flow table was full.")
+	fmt.Fprintln(w, "# TYPE smc_clc_flow_overflows_total counter")
+	fmt.Fprintf(w, "smc_clc_flow_overflows_total{action=\"rejected\"} "+
+		"%d\n", rejected)
+	fmt.Fprintf(w, "smc_clc_flow_overflows_total{action=\"evicted\"} "+
+		"%d\n", evicted)
+}
+
+// printOverflow prints that the flow identified by the network flow net and
+// the transport flow trans was rejected or evicted, as given by action,
+// because the flow table was full
+func printOverflow(net, trans gopacket.Flow, action string) {
+	overflowFmt := "%s%s -> %s: Flow Table Full: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, overflowFmt, t, hostString(net.Src(), trans.Src()),
+		hostString(net.Dst(), trans.Dst()), action)
 }
@@ -43,3 +43,62 @@ func TestFlowTable(t *testing.T) {
 		t.Errorf("ft.get() = %t; want %t", got, want)
 	}
 }
+
+func TestFlowTableLimit(t *testing.T) {
+	var ft flowTable
+
+	// create test flows
+	newFlows := func(port uint16) (gopacket.Flow, gopacket.Flow) {
+		n, _ := gopacket.FlowFromEndpoints(
+			layers.NewIPEndpoint(net.IPv4(1, 2, 3, 4)),
+			layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+		tr, _ := gopacket.FlowFromEndpoints(
+			layers.NewTCPPortEndpoint(layers.TCPPort(port)),
+			layers.NewTCPPortEndpoint(456))
+		return n, tr
+	}
+	net1, trans1 := newFlows(1)
+	net2, trans2 := newFlows(2)
+	net3, trans3 := newFlows(3)
+
+	// test invalid policy
+	if err := ft.setLimit(2, "invalid"); err == nil {
+		t.Errorf("err = nil; want error")
+	}
+
+	// test reject new flows, but not reverse direction of flows
+	ft.init()
+	if err := ft.setLimit(2, flowOverflowReject); err != nil {
+		t.Fatal(err)
+	}
+	ft.add(net1, trans1)
+	ft.add(net2, trans2)
+	if ok, evicted := ft.add(net3, trans3); ok || evicted != nil {
+		t.Errorf("got = %t, %v; want false, nil", ok, evicted)
+	}
+	if ok, _ := ft.add(net1, trans1); !ok {
+		t.Errorf("got = %t; want true", ok)
+	}
+	if ok, _ := ft.add(net1.Reverse(), trans1.Reverse()); !ok {
+		t.Errorf("got = %t; want true", ok)
+	}
+
+	// test evict oldest flow and its reverse direction
+	if err := ft.setLimit(3, flowOverflowEvict); err != nil {
+		t.Fatal(err)
+	}
+	ok, evicted := ft.add(net3, trans3)
+	if !ok || evicted == nil || *evicted != (flowTableKey{net1, trans1}) {
+		t.Errorf("got = %t, %v; want true, %v", ok, evicted,
+			flowTableKey{net1, trans1})
+	}
+	if ft.get(net1, trans1) || ft.get(net1.Reverse(), trans1.Reverse()) {
+		t.Errorf("evicted flow still in flow table")
+	}
+	if !ft.get(net2, trans2) || !ft.get(net3, trans3) {
+		t.Errorf("flows missing in flow table")
+	}
+	if rejected, evicted := ft.overflows(); rejected != 1 || evicted != 1 {
+		t.Errorf("got = %d, %d; want 1, 1", rejected, evicted)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"net"
+	"strings"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// RoCE GID types
+const (
+	gidTypeRoCEv1 = "RoCEv1"
+	gidTypeRoCEv2 = "RoCEv2"
+)
+
+// messageGID returns the SMC-R GID in the CLC message msg or nil if there is
+// none
+func messageGID(msg clc.Message) net.IP {
+	var gid net.IP
+	switch m := msg.(type) {
+	case *clc.Proposal:
+		gid = m.IBGID
+	case *clc.ProposalV2:
+		gid = m.IBGID
+	case *clc.AcceptSMCR:
+		gid = m.IBGID
+	case *clc.ConfirmSMCR:
+		gid = m.IBGID
+	}
+	if gid == nil || gid.IsUnspecified() {
+		return nil
+	}
+	return gid
+}
+
+// roceV1Prefix is the link-local prefix of RoCEv1 GIDs derived from the MAC
+// address
+var roceV1Prefix = net.IPNet{
+	IP:   net.ParseIP("fe80::"),
+	Mask: net.CIDRMask(64, 128),
+}
+
+// gidType returns the RoCE GID type of the SMC-R GID gid in a message with
+// SMC version. RoCEv1 GIDs are used with SMC-Rv1 and have the link-local
+// prefix, RoCEv2 GIDs are IP based and contain an IPv4-mapped or global IPv6
+// address or are used with SMC-Rv2
+func gidType(gid net.IP, version uint8) string {
+	if gid.To4() != nil || version == clc.SMCv2 ||
+		!roceV1Prefix.Contains(gid) {
+		return gidTypeRoCEv2
+	}
+	return gidTypeRoCEv1
+}
+
+// annotateGID adds the RoCE GID type of the SMC-R GID in the CLC message msg
+// to the message string s
+func annotateGID(msg clc.Message, s string) string {
+	gid := messageGID(msg)
+	if gid == nil {
+		return s
+	}
+	version := messageHeader(msg).Version
+	field := "SMC-R GID: " + gid.String()
+	return strings.Replace(s, field, field+" ("+gidType(gid, version)+")",
+		1)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotateGID(t *testing.T) {
+	var want, got string
+
+	// prepare proposal with RoCEv1 GID
+	proposal := "e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9"
+	msg := testHandshakeMessage(proposal)
+	want = "SMC-R GID: fe80::9a03:9bff:feab:cdef (RoCEv1), "
+	got = annotateGID(msg, msg.String())
+	if !strings.Contains(got, want) {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// prepare proposal with RoCEv2 GID containing an IPv4 address
+	proposal = "e2d4c3d901003410b1a098039babcdef" +
+		"00000000000000000000ffff0a000001" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9"
+	msg = testHandshakeMessage(proposal)
+	want = "SMC-R GID: 10.0.0.1 (RoCEv2), "
+	got = annotateGID(msg, msg.String())
+	if !strings.Contains(got, want) {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// prepare proposal with RoCEv2 GID containing a global IPv6 address
+	proposal = "e2d4c3d901003410b1a098039babcdef" +
+		"20010db8000000000000000000000001" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9"
+	msg = testHandshakeMessage(proposal)
+	want = "SMC-R GID: 2001:db8::1 (RoCEv2), "
+	got = annotateGID(msg, msg.String())
+	if !strings.Contains(got, want) {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test message without SMC-R GID
+	decline := "e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9"
+	msg = testHandshakeMessage(decline)
+	want = msg.String()
+	got = annotateGID(msg, msg.String())
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	// grpcSubscribePath is the path of the Subscribe method of the
+	// Events service
+	grpcSubscribePath = "/smcclc.Events/Subscribe"
+
+	// grpcQueueLen is the number of events queued per subscriber, events
+	// are dropped for subscribers with full queues
+	grpcQueueLen = 1024
+
+	// grpcMaxRequestSize is the maximum size of a request message, the
+	// default maximum receive size of gRPC
+	grpcMaxRequestSize = 4 << 20
+
+	// gRPC status codes
+	grpcOK                = 0
+	grpcCanceled          = 1
+	grpcInvalid           = 3
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcUnavailable       = 14
+)
+
+var (
+	// grpcEvents is the gRPC sink
+	grpcEvents grpcSink
+)
+
+// grpcFilter is the server-side filter of a subscriber: event types and peer
+// addresses or subnets matching the source or destination, empty filters
+// match all events
+type grpcFilter struct {
+	types   map[string]bool
+	peers   []net.IP
+	subnets []*net.IPNet
+}
+
+// parseGRPCFilter parses the SubscribeRequest in buf to a filter, unknown
+// fields are skipped
+func parseGRPCFilter(buf []byte) (*grpcFilter, error) {
+	f := &grpcFilter{types: make(map[string]bool)}
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid subscribe request")
+		}
+		buf = buf[n:]
+
+		// skip fields that are not length-delimited, all known
+		// fields are strings
+		skip := 0
+		switch tag & 7 {
+		case protoBytes:
+		case protoVarint:
+			if _, skip = binary.Uvarint(buf); skip <= 0 {
+				skip = len(buf) + 1
+			}
+		case protoFixed64:
+			skip = 8
+		case protoFixed32:
+			skip = 4
+		default:
+			return nil, fmt.Errorf("invalid subscribe request")
+		}
+		if len(buf) < skip {
+			return nil, fmt.Errorf("invalid subscribe request")
+		}
+		if skip > 0 {
+			buf = buf[skip:]
+			continue
+		}
+
+		l, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < l {
+			return nil, fmt.Errorf("invalid subscribe request")
+		}
+		value := string(buf[n : n+int(l)])
+		buf = buf[n+int(l):]
+
+		switch tag >> 3 {
+		case 1:
+			if value != eventMessage && value != eventHandshake {
+				return nil, fmt.Errorf("unknown event type %q",
+					value)
+			}
+			f.types[value] = true
+		case 2:
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid peer %q", value)
+			}
+			f.peers = append(f.peers, ip)
+		case 3:
+			_, subnet, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subnet %q",
+					value)
+			}
+			f.subnets = append(f.subnets, subnet)
+		}
+	}
+	return f, nil
+}
+
+// matchIP checks if the ip matches the peers or subnets of the filter
+func (f *grpcFilter) matchIP(ip net.IP) bool {
+	for _, p := range f.peers {
+		if p.Equal(ip) {
+			return true
+		}
+	}
+	for _, s := range f.subnets {
+		if s.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks if the event of type typ of the network flow net matches the
+// filter
+func (f *grpcFilter) match(typ string, net gopacket.Flow) bool {
+	if len(f.types) > 0 && !f.types[typ] {
+		return false
+	}
+	if len(f.peers) == 0 && len(f.subnets) == 0 {
+		return true
+	}
+	return f.matchIP(net.Src().Raw()) || f.matchIP(net.Dst().Raw())
+}
+
+// grpcSubscriber is a subscriber of the Events service with its filter and
+// queue of protobuf events
+type grpcSubscriber struct {
+	filter  *grpcFilter
+	events  chan []byte
+	dropped uint64
+}
+
+// grpcSink renders message and handshake events as protobuf Events to the
+// subscribers of the gRPC server protected by a mutex
+type grpcSink struct {
+	lock        sync.Mutex
+	subscribers map[*grpcSubscriber]bool
+}
+
+// subscribe adds a subscriber with filter f to the gRPC sink
+func (g *grpcSink) subscribe(f *grpcFilter) *grpcSubscriber {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.subscribers == nil {
+		g.subscribers = make(map[*grpcSubscriber]bool)
+	}
+	s := &grpcSubscriber{
+		filter: f,
+		events: make(chan []byte, grpcQueueLen),
+	}
+	g.subscribers[s] = true
+	return s
+}
+
+// unsubscribe removes the subscriber s from the gRPC sink
+func (g *grpcSink) unsubscribe(s *grpcSubscriber) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if s.dropped > 0 {
+		log.Printf("gRPC subscriber dropped %d events", s.dropped)
+	}
+	if g.subscribers[s] {
+		delete(g.subscribers, s)
+		close(s.events)
+	}
+}
+
+// close removes all subscribers from the gRPC sink, this ends their streams
+func (g *grpcSink) close() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for s := range g.subscribers {
+		delete(g.subscribers, s)
+		close(s.events)
+	}
+}
+
+// accepts checks if the gRPC sink renders events of type typ
+func (g *grpcSink) accepts(typ string) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.subscribers) == 0 {
+		return false
+	}
+	return typ == eventMessage || typ == eventHandshake
+}
+
+// render renders the event e as protobuf Event and queues it for all
+// subscribers with matching filters
+func (g *grpcSink) render(e *event) {
+	var b []byte
+	net := e.net
+	switch e.typ {
+	case eventMessage:
+		b = protoMessageEvent(e.time, e.net, e.trans, e.msg, e.session,
+			e.warnings)
+	case eventHandshake:
+		b = protoHandshakeEvent(e.time, e.result)
+		net = e.result.key.net
+	default:
+		return
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for s := range g.subscribers {
+		if !s.filter.match(e.typ, net) {
+			continue
+		}
+		select {
+		case s.events <- b:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// grpcFrame returns the protobuf message b as length-prefixed gRPC message
+func grpcFrame(b []byte) []byte {
+	frame := make([]byte, 5, 5+len(b))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+	return append(frame, b...)
+}
+
+// writeGRPCStatus writes the gRPC status code and message of a call without
+// response messages
+func writeGRPCStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", fmt.Sprint(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", msg)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGRPC handles gRPC calls of the Subscribe method of the Events
+// service, it streams the matching events to the subscriber
+func handleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != grpcSubscribePath {
+		writeGRPCStatus(w, grpcUnimplemented, "unknown method")
+		return
+	}
+
+	// read SubscribeRequest
+	var prefix [5]byte
+	if _, err := io.ReadFull(r.Body, prefix[:]); err != nil ||
+		prefix[0] != 0 {
+		writeGRPCStatus(w, grpcInvalid, "invalid request")
+		return
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > grpcMaxRequestSize {
+		writeGRPCStatus(w, grpcResourceExhausted, "request too large")
+		return
+	}
+	req := make([]byte, size)
+	if _, err := io.ReadFull(r.Body, req); err != nil {
+		writeGRPCStatus(w, grpcInvalid, "invalid request")
+		return
+	}
+	filter, err := parseGRPCFilter(req)
+	if err != nil {
+		writeGRPCStatus(w, grpcInvalid, err.Error())
+		return
+	}
+
+	// stream events until the subscriber or the server ends the call,
+	// the status is sent as trailer
+	s := grpcEvents.subscribe(filter)
+	defer grpcEvents.unsubscribe(s)
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status")
+	w.WriteHeader(http.StatusOK)
+	status := grpcOK
+	defer func() {
+		w.Header().Set("Grpc-Status", fmt.Sprint(status))
+	}()
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		status = grpcUnavailable
+		return
+	}
+	for {
+		select {
+		case b, ok := <-s.events:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(grpcFrame(b)); err != nil {
+				status = grpcUnavailable
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				status = grpcUnavailable
+				return
+			}
+		case <-r.Context().Done():
+			status = grpcCanceled
+			return
+		}
+	}
+}
+
+// startGRPCServer starts the gRPC server with the Events service listening
+// on address, the returned function ends all streams and stops the server
+func startGRPCServer(address string) func() {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return serveGRPC(l)
+}
+
+// serveGRPC serves the Events service on listener l, the returned function
+// ends all streams and stops the server
+func serveGRPC(l net.Listener) func() {
+	server := &http.Server{
+		Handler: h2c.NewHandler(http.HandlerFunc(handleGRPC),
+			&http2.Server{}),
+	}
+	go func() {
+		if err := server.Serve(l); err != http.ErrServerClosed {
+			log.Println("Error serving gRPC:", err)
+		}
+	}()
+	return func() {
+		grpcEvents.close()
+		ctx, cancel := context.WithTimeout(context.Background(),
+			time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("Error stopping gRPC server:", err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"golang.org/x/net/http2"
+)
+
+func TestGRPCFilter(t *testing.T) {
+	// test valid subscribe request
+	req := protoAppendString(nil, 1, eventHandshake)
+	req = protoAppendString(req, 2, "1.2.3.4")
+	req = protoAppendString(req, 3, "10.0.0.0/8")
+	f, err := parseGRPCFilter(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// test unknown fields are skipped
+	unknown := protoAppendUint(nil, 15, 1)
+	unknown = protoAppendString(unknown, 16, "unknown")
+	if _, err := parseGRPCFilter(append(unknown, req...)); err != nil {
+		t.Errorf("unknown fields: %v", err)
+	}
+
+	// test matching events
+	flow := func(src, dst string) gopacket.Flow {
+		f, _ := gopacket.FlowFromEndpoints(
+			layers.NewIPEndpoint(net.ParseIP(src).To4()),
+			layers.NewIPEndpoint(net.ParseIP(dst).To4()))
+		return f
+	}
+	for _, test := range []struct {
+		typ  string
+		net  gopacket.Flow
+		want bool
+	}{
+		{eventHandshake, flow("1.2.3.4", "5.6.7.8"), true},
+		{eventHandshake, flow("5.6.7.8", "10.1.2.3"), true},
+		{eventHandshake, flow("5.6.7.8", "11.1.2.3"), false},
+		{eventMessage, flow("1.2.3.4", "5.6.7.8"), false},
+	} {
+		if got := f.match(test.typ, test.net); got != test.want {
+			t.Errorf("match(%s, %s) = %t; want %t", test.typ,
+				test.net, got, test.want)
+		}
+	}
+
+	// test invalid subscribe requests
+	for _, req := range [][]byte{
+		protoAppendString(nil, 1, "unknown"),
+		protoAppendString(nil, 2, "x"),
+		protoAppendString(nil, 3, "1.2.3.4"),
+		{0x0b},
+		{0x10},
+	} {
+		if _, err := parseGRPCFilter(req); err == nil {
+			t.Errorf("parseGRPCFilter(%x) succeeded", req)
+		}
+	}
+}
+
+func TestGRPCServer(t *testing.T) {
+	// start server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	stop := serveGRPC(l)
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string,
+			_ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	// requests larger than the maximum size are rejected
+	body := []byte{0, 0xff, 0xff, 0xff, 0xff}
+	resp, err := client.Post("http://"+l.Addr().String()+
+		grpcSubscribePath, "application/grpc", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Grpc-Status"); got != "8" {
+		t.Errorf("grpc-status = %q; want 8", got)
+	}
+
+	// subscribe to handshake events
+	body = grpcFrame(protoAppendString(nil, 1, eventHandshake))
+	resp, err = client.Post("http://"+l.Addr().String()+
+		grpcSubscribePath, "application/grpc", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	for !grpcEvents.accepts(eventHandshake) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// emit message and handshake events
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	emit(&event{typ: eventMessage, net: net, trans: trans,
+		msg: testHandshakeMessage("e2d4c3d904001c10252525252525" +
+			"25000303000000000000e2d4c3d9")})
+	emit(&event{typ: eventHandshake, result: &handshakeResult{
+		id:  1,
+		key: handshakeKey{net, trans},
+	}})
+
+	// check streamed handshake event
+	var prefix [5]byte
+	if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		t.Fatal(err)
+	}
+	event := protoTestFields(t, b)
+	if _, ok := event[3]; !ok {
+		t.Errorf("event = %v; want handshake", event)
+	}
+
+	// stop server and check end of stream
+	stop()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("grpc-status = %q; want 0", got)
+	}
+}
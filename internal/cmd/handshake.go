@@ -0,0 +1,533 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+const (
+	// maxRMBESize is the maximum compressed SMC-R RMBE size (512 KB)
+	maxRMBESize = 5
+
+	// maxDMBESize is the maximum compressed SMC-D DMBE size (1 MB)
+	maxDMBESize = 6
+)
+
+var (
+	// handshakes stores the handshake table
+	handshakes handshakeTable
+)
+
+// handshakeKey identifies a handshake by the network and transport flows in
+// client to server direction
+type handshakeKey struct {
+	net, trans gopacket.Flow
+}
+
+// flowCounts stores the number of CLC messages and bytes seen in a direction
+// of a handshake
+type flowCounts struct {
+	messages uint64
+	bytes    uint64
+}
+
+// String converts the flow counts to a string
+func (c flowCounts) String() string {
+	return fmt.Sprintf("%d (%d bytes)", c.messages, c.bytes)
+}
+
+// handshake stores the proposal and accept messages of a handshake, their
+// capture timestamps, and the message counts of client and server
+type handshake struct {
+	id           uint64
+	key          handshakeKey
+	proposal     clc.Message
+	proposalSeen time.Time
+	accept       clc.Message
+	acceptSeen   time.Time
+	counts       [2]flowCounts
+}
+
+// count counts the CLC message with header hdr sent over the network flow
+// net and the transport flow trans in the message counts of the client or
+// the server
+func (h *handshake) count(net, trans gopacket.Flow, hdr *clc.Header) {
+	dir := 0
+	if net != h.key.net || trans != h.key.trans {
+		dir = 1
+	}
+	h.counts[dir].messages++
+	h.counts[dir].bytes += uint64(hdr.Length)
+}
+
+// handshakeResult stores the result and latencies of a finished handshake
+type handshakeResult struct {
+	id             uint64
+	key            handshakeKey
+	proposalAccept time.Duration
+	acceptConfirm  time.Duration
+	total          time.Duration
+	accepted       bool
+	confirmed      bool
+	path           clc.Path
+	version        uint8
+	proposalVer    uint8
+	offeredBoth    bool
+	release        int
+	firstContact   uint8
+	diagnosis      string
+	buffers        bool
+	serverBuffer   clc.RMBESize
+	clientBuffer   clc.RMBESize
+	smcdLink       bool
+	serverGID      uint64
+	clientGID      uint64
+	linkID         uint32
+	vchid          uint16
+	qps            bool
+	serverQP       smcrQP
+	clientQP       smcrQP
+	client         flowCounts
+	server         flowCounts
+}
+
+// latencies converts the handshake latencies to a string
+func (r *handshakeResult) latencies() string {
+	s := ""
+	if r.accepted {
+		s += fmt.Sprintf("Proposal/Accept: %s, ", r.proposalAccept)
+	}
+	if r.confirmed {
+		s += fmt.Sprintf("Accept/Confirm: %s, ", r.acceptConfirm)
+	}
+	s += fmt.Sprintf("Total: %s", r.total)
+	if !r.confirmed {
+		s += " (declined)"
+	}
+	return s
+}
+
+// versionMismatch checks if the proposal version differs from the version
+// of the accept, confirm, or decline message
+func (r *handshakeResult) versionMismatch() bool {
+	return r.proposalVer != r.version
+}
+
+// versionString converts the handshake version to a string, including the
+// proposal version if it differs
+func (r *handshakeResult) versionString() string {
+	if r.versionMismatch() {
+		return fmt.Sprintf("%d (Mismatch: Proposal Version %d)",
+			r.version, r.proposalVer)
+	}
+	return fmt.Sprint(r.version)
+}
+
+// summary converts the handshake result to a one line summary
+func (r *handshakeResult) summary() string {
+	messages := fmt.Sprintf("Messages: Client %s, Server %s, ", r.client,
+		r.server)
+	if !r.confirmed {
+		return fmt.Sprintf("Path: TCP (fallback), Version: %s, "+
+			"Decline: %s, %sDuration: %s", r.versionString(),
+			r.diagnosis, messages, r.total)
+	}
+	qps := ""
+	if r.qps {
+		qps = fmt.Sprintf("QPs: Server %d (PSN %d), Client %d "+
+			"(PSN %d), ", r.serverQP.qpn, r.serverQP.psn,
+			r.clientQP.qpn, r.clientQP.psn)
+	}
+	return fmt.Sprintf("Path: %s, Version: %s, First Contact: %d, "+
+		"%s%sDuration: %s", r.path, r.versionString(), r.firstContact,
+		qps, messages, r.total)
+}
+
+// result returns the result of the handshake that finished with the confirm
+// or decline message msg captured at time seen
+func (h *handshake) result(msg clc.Message, seen time.Time) *handshakeResult {
+	hdr := messageHeader(msg)
+	r := &handshakeResult{
+		id:        h.id,
+		key:       h.key,
+		total:     seen.Sub(h.proposalSeen),
+		confirmed: hdr.Type == clc.TypeConfirm,
+		version:   hdr.Version,
+		release:   messageRelease(msg),
+		client:    h.counts[0],
+		server:    h.counts[1],
+	}
+	if p := messageHeader(h.proposal); p != nil {
+		r.proposalVer = p.Version
+	}
+	if h.accept != nil {
+		acc := messageHeader(h.accept)
+		r.accepted = true
+		r.proposalAccept = h.acceptSeen.Sub(h.proposalSeen)
+		r.path = acc.Path
+		r.version = acc.Version
+		r.firstContact = acc.Flag
+		r.offeredBoth = offersPath(h.proposal, acc.Version,
+			clc.SMCTypeR) && offersPath(h.proposal, acc.Version,
+			clc.SMCTypeD)
+		if release := messageRelease(h.accept); release >= 0 {
+			r.release = release
+		}
+		if r.confirmed {
+			r.acceptConfirm = seen.Sub(h.acceptSeen)
+			server, ok1 := messageBufferSize(h.accept)
+			client, ok2 := messageBufferSize(msg)
+			r.buffers = ok1 && ok2
+			r.serverBuffer, r.clientBuffer = server, client
+
+			sgid, link, vchid, ok1 := messageSMCDLink(h.accept)
+			cgid, _, _, ok2 := messageSMCDLink(msg)
+			r.smcdLink = ok1 && ok2
+			r.serverGID, r.clientGID = sgid, cgid
+			r.linkID, r.vchid = link, vchid
+
+			sqp, ok1 := messageQP(h.accept)
+			cqp, ok2 := messageQP(msg)
+			r.qps = ok1 && ok2
+			r.serverQP, r.clientQP = sqp, cqp
+		}
+	}
+	switch m := msg.(type) {
+	case *clc.Decline:
+		r.diagnosis = m.PeerDiagnosis.String()
+	case *clc.DeclineV2:
+		r.diagnosis = m.PeerDiagnosis.String()
+	}
+	return r
+}
+
+// handshakeTable stores handshakes, the one-sided handshakes by the stream
+// of the sender of their missing message, and the last assigned session ID
+// protected by a mutex
+type handshakeTable struct {
+	lock    sync.Mutex
+	hmap    map[handshakeKey]*handshake
+	missing map[handshakeKey]*oneSidedHandshake
+	last    uint64
+}
+
+// init initializes the handshake table
+func (ht *handshakeTable) init() {
+	ht.lock.Lock()
+	if ht.hmap == nil {
+		ht.hmap = make(map[handshakeKey]*handshake)
+		ht.missing = make(map[handshakeKey]*oneSidedHandshake)
+	}
+	ht.lock.Unlock()
+}
+
+// lookup returns the key and handshake identified by the network flow net and
+// the transport flow trans in either direction, ht must be locked
+func (ht *handshakeTable) lookup(net, trans gopacket.Flow) (handshakeKey,
+	*handshake) {
+	key := handshakeKey{net, trans}
+	if h := ht.hmap[key]; h != nil {
+		return key, h
+	}
+	key = handshakeKey{net.Reverse(), trans.Reverse()}
+	return key, ht.hmap[key]
+}
+
+// del removes the handshake identified by the network flow net and the
+// transport flow trans in either direction from the handshake table
+func (ht *handshakeTable) del(net, trans gopacket.Flow) {
+	ht.lock.Lock()
+	delete(ht.hmap, handshakeKey{net, trans})
+	delete(ht.hmap, handshakeKey{net.Reverse(), trans.Reverse()})
+	ht.lock.Unlock()
+}
+
+// session returns the session ID of the handshake identified by the network
+// flow net and the transport flow trans in either direction or 0 if there is
+// no such handshake
+func (ht *handshakeTable) session(net, trans gopacket.Flow) uint64 {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+
+	if _, h := ht.lookup(net, trans); h != nil {
+		return h.id
+	}
+	return 0
+}
+
+// add adds the CLC message msg sent over the network flow net and the
+// transport flow trans and captured at time seen to the handshake table. It
+// checks msg against the previous messages of the handshake and returns the
+// inconsistencies found and, if the handshake finished, its result
+func (ht *handshakeTable) add(net, trans gopacket.Flow, msg clc.Message,
+	seen time.Time) ([]string, *handshakeResult) {
+	hdr := messageHeader(msg)
+	if hdr == nil {
+		return nil, nil
+	}
+
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+
+	switch hdr.Type {
+	case clc.TypeProposal:
+		key := handshakeKey{net, trans}
+		ht.last++
+		ht.hmap[key] = &handshake{
+			id:           ht.last,
+			key:          key,
+			proposal:     msg,
+			proposalSeen: seen,
+		}
+		ht.hmap[key].count(net, trans, hdr)
+	case clc.TypeAccept:
+		_, h := ht.lookup(net, trans)
+		if h == nil {
+			return nil, nil
+		}
+		h.accept = msg
+		h.acceptSeen = seen
+		h.count(net, trans, hdr)
+		ht.expectConfirm(h)
+		return checkAccept(h.proposal, msg), nil
+	case clc.TypeConfirm:
+		key, h := ht.lookup(net, trans)
+		if h == nil {
+			return nil, nil
+		}
+		delete(ht.hmap, key)
+		delete(ht.missing, key)
+		h.count(net, trans, hdr)
+		if h.accept == nil {
+			ht.missAccept(h)
+		}
+		return checkConfirm(h.proposal, h.accept, msg),
+			h.result(msg, seen)
+	case clc.TypeDecline:
+		key, h := ht.lookup(net, trans)
+		if h == nil {
+			return nil, nil
+		}
+		delete(ht.hmap, key)
+		delete(ht.missing, key)
+		h.count(net, trans, hdr)
+		return nil, h.result(msg, seen)
+	}
+	return nil, nil
+}
+
+// messageHeader returns the CLC header of the CLC message msg
+func messageHeader(msg clc.Message) *clc.Header {
+	switch m := msg.(type) {
+	case *clc.Proposal:
+		return &m.Header
+	case *clc.ProposalV2:
+		return &m.Header
+	case *clc.AcceptSMCR:
+		return &m.Header
+	case *clc.AcceptSMCD:
+		return &m.Header
+	case *clc.AcceptSMCDv2:
+		return &m.Header
+	case *clc.ConfirmSMCR:
+		return &m.Header
+	case *clc.ConfirmSMCD:
+		return &m.Header
+	case *clc.ConfirmSMCDv2:
+		return &m.Header
+	case *clc.Decline:
+		return &m.Header
+	case *clc.DeclineV2:
+		return &m.Header
+	default:
+		return nil
+	}
+}
+
+// offersPath checks if the proposal offers the path with SMC version
+func offersPath(proposal clc.Message, version uint8, path clc.Path) bool {
+	offers := func(offered clc.Path) bool {
+		return offered == path || offered == clc.SMCTypeB
+	}
+	switch p := proposal.(type) {
+	case *clc.Proposal:
+		return version == clc.SMCv1 && offers(p.Path)
+	case *clc.ProposalV2:
+		if version == clc.SMCv2 {
+			return offers(p.Pathv2)
+		}
+		return offers(p.Path)
+	}
+	return false
+}
+
+// checkBuffers checks the buffer parameters of the accept or confirm message
+// msg
+func checkBuffers(msg clc.Message) []string {
+	var errs []string
+	hdr := messageHeader(msg)
+	switch m := msg.(type) {
+	case *clc.AcceptSMCR:
+		if m.QPMTU < 1 || m.QPMTU > 5 {
+			errs = append(errs, fmt.Sprintf("%s QP MTU %s invalid",
+				hdr.Type, m.QPMTU))
+		}
+		if m.RMBESize > maxRMBESize {
+			errs = append(errs, fmt.Sprintf("%s RMBE Size %s "+
+				"too big", hdr.Type, m.RMBESize))
+		}
+	case *clc.ConfirmSMCR:
+		if m.QPMTU < 1 || m.QPMTU > 5 {
+			errs = append(errs, fmt.Sprintf("%s QP MTU %s invalid",
+				hdr.Type, m.QPMTU))
+		}
+		if m.RMBESize > maxRMBESize {
+			errs = append(errs, fmt.Sprintf("%s RMBE Size %s "+
+				"too big", hdr.Type, m.RMBESize))
+		}
+	case *clc.AcceptSMCD:
+		if m.DMBESize > maxDMBESize {
+			errs = append(errs, fmt.Sprintf("%s DMBE Size %s "+
+				"too big", hdr.Type, m.DMBESize))
+		}
+	case *clc.ConfirmSMCD:
+		if m.DMBESize > maxDMBESize {
+			errs = append(errs, fmt.Sprintf("%s DMBE Size %s "+
+				"too big", hdr.Type, m.DMBESize))
+		}
+	case *clc.AcceptSMCDv2:
+		if m.DMBESize > maxDMBESize {
+			errs = append(errs, fmt.Sprintf("%s DMBE Size %s "+
+				"too big", hdr.Type, m.DMBESize))
+		}
+	case *clc.ConfirmSMCDv2:
+		if m.DMBESize > maxDMBESize {
+			errs = append(errs, fmt.Sprintf("%s DMBE Size %s "+
+				"too big", hdr.Type, m.DMBESize))
+		}
+	}
+	return errs
+}
+
+// checkAccept checks the accept message against the proposal message
+func checkAccept(proposal, accept clc.Message) []string {
+	var errs []string
+	p := messageHeader(proposal)
+	a := messageHeader(accept)
+
+	if a.Version > p.Version {
+		errs = append(errs, fmt.Sprintf("Accept Version %d higher "+
+			"than Proposal Version %d", a.Version, p.Version))
+	} else if !offersPath(proposal, a.Version, a.Path) {
+		errs = append(errs, fmt.Sprintf("Accept Path %s not offered "+
+			"in Proposal", a.Path))
+	}
+
+	return append(errs, checkBuffers(accept)...)
+}
+
+// checkConfirm checks the confirm message against the proposal and accept
+// messages
+func checkConfirm(proposal, accept, confirm clc.Message) []string {
+	var errs []string
+	c := messageHeader(confirm)
+
+	// compare confirm with accept
+	if accept != nil {
+		a := messageHeader(accept)
+		if c.Version != a.Version {
+			errs = append(errs, fmt.Sprintf("Confirm Version %d "+
+				"differs from Accept Version %d", c.Version,
+				a.Version))
+		}
+		if c.Path != a.Path {
+			errs = append(errs, fmt.Sprintf("Confirm Path %s "+
+				"differs from Accept Path %s", c.Path, a.Path))
+		}
+	}
+
+	// compare confirm with proposal
+	switch m := confirm.(type) {
+	case *clc.ConfirmSMCR:
+		var peerID clc.PeerID
+		var gid string
+		switch p := proposal.(type) {
+		case *clc.Proposal:
+			peerID, gid = p.SenderPeerID, p.IBGID.String()
+		case *clc.ProposalV2:
+			peerID, gid = p.SenderPeerID, p.IBGID.String()
+		}
+		if m.SenderPeerID != peerID {
+			errs = append(errs, fmt.Sprintf("Confirm Peer ID %s "+
+				"differs from Proposal Peer ID %s",
+				m.SenderPeerID, peerID))
+		}
+		if m.IBGID.String() != gid {
+			errs = append(errs, fmt.Sprintf("Confirm SMC-R GID %s "+
+				"differs from Proposal SMC-R GID %s", m.IBGID,
+				gid))
+		}
+	case *clc.ConfirmSMCD:
+		if p, ok := proposal.(*clc.Proposal); ok &&
+			m.GID != p.SMCDGID {
+			errs = append(errs, fmt.Sprintf("Confirm SMC-D GID %d "+
+				"differs from Proposal SMC-D GID %d", m.GID,
+				p.SMCDGID))
+		}
+	case *clc.ConfirmSMCDv2:
+		if p, ok := proposal.(*clc.ProposalV2); ok &&
+			!proposesGID(p, m.GID) {
+			errs = append(errs, fmt.Sprintf("Confirm SMC-D GID %d "+
+				"not offered in Proposal", m.GID))
+		}
+	}
+
+	return append(errs, checkBuffers(confirm)...)
+}
+
+// proposesGID checks if the SMCv2 proposal contains the SMC-D GID
+func proposesGID(p *clc.ProposalV2, gid uint64) bool {
+	if p.SMCDGID == gid {
+		return true
+	}
+	for i, entry := range p.GIDArea {
+		if i >= int(p.GIDNumber) {
+			break
+		}
+		if entry.GID == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// printCheck prints an inconsistency found in the handshake of the network
+// flow net and the transport flow trans
+func printCheck(net, transport gopacket.Flow, check string) {
+	checkFmt := "%s%s:%s -> %s:%s: Check: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, checkFmt, t, net.Src(), transport.Src(),
+		net.Dst(), transport.Dst(), check)
+}
+
+// printLatencies prints the latencies of a finished handshake
+func printLatencies(r *handshakeResult) {
+	latFmt := "%s%s%s:%s -> %s:%s: Latency: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, latFmt, t, sessionString(r.id), r.key.net.Src(),
+		r.key.trans.Src(), r.key.net.Dst(), r.key.trans.Dst(),
+		r.latencies())
+}
+
+// printSummary prints the one line summary of a finished handshake
+func printSummary(r *handshakeResult) {
+	sumFmt := "%s%s%s -> %s: Summary: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, sumFmt, t, sessionString(r.id),
+		hostString(r.key.net.Src(), r.key.trans.Src()),
+		hostString(r.key.net.Dst(), r.key.trans.Dst()), r.summary())
+}
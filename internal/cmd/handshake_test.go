@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"log"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// testHandshakeMessage creates a parsed CLC message from hex string msg
+func testHandshakeMessage(msg string) clc.Message {
+	buf, err := hex.DecodeString(msg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	clcMsg, _ := clc.NewMessage(buf)
+	clcMsg.Parse(buf)
+	return clcMsg
+}
+
+func TestHandshakeTable(t *testing.T) {
+	var ht handshakeTable
+	var want, got []string
+
+	// prepare test flows
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+
+	// prepare handshake messages
+	proposal := "e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9"
+	accept := "e2d4c3d902004418b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e40000157d010000" +
+		"0005230000000000f0a600000072f5fe" +
+		"e2d4c3d9"
+	confirm := "e2d4c3d903004410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e50000187f010000" +
+		"0006230000000000f0a40000000d89a4" +
+		"e2d4c3d9"
+
+	// test consistent handshake
+	ht.init()
+	for _, msg := range []string{proposal, accept, confirm} {
+		n, tr := net, trans
+		if msg == accept {
+			n, tr = net.Reverse(), trans.Reverse()
+		}
+		got, _ = ht.add(n, tr, testHandshakeMessage(msg), time.Time{})
+		if got != nil {
+			t.Errorf("got = %v; want nil", got)
+		}
+	}
+	if len(ht.hmap) != 0 {
+		t.Errorf("len(ht.hmap) = %d; want 0", len(ht.hmap))
+	}
+
+	// test latencies of confirmed handshake
+	start := time.Unix(0, 0)
+	ht.add(net, trans, testHandshakeMessage(proposal), start)
+	ht.add(net.Reverse(), trans.Reverse(), testHandshakeMessage(accept),
+		start.Add(2*time.Millisecond))
+	_, result := ht.add(net, trans, testHandshakeMessage(confirm),
+		start.Add(3*time.Millisecond))
+	wantLatencies := "Proposal/Accept: 2ms, Accept/Confirm: 1ms, " +
+		"Total: 3ms"
+	if result == nil || result.latencies() != wantLatencies {
+		t.Fatalf("got = %v; want %s", result, wantLatencies)
+	}
+	wantSummary := "Path: SMC-R, Version: 1, First Contact: 1, " +
+		"QPs: Server 228 (PSN 7534078), Client 229 (PSN 887204), " +
+		"Messages: Client 2 (120 bytes), Server 1 (68 bytes), " +
+		"Duration: 3ms"
+	if result.summary() != wantSummary {
+		t.Errorf("got = %s; want %s", result.summary(), wantSummary)
+	}
+
+	// test latencies of declined handshake
+	ht.add(net, trans, testHandshakeMessage(proposal), start)
+	_, result = ht.add(net.Reverse(), trans.Reverse(),
+		testHandshakeMessage("e2d4c3d904001c102525252525252500"+
+			"0303000000000000e2d4c3d9"),
+		start.Add(time.Millisecond))
+	wantLatencies = "Total: 1ms (declined)"
+	if result == nil || result.latencies() != wantLatencies {
+		t.Fatalf("got = %v; want %s", result, wantLatencies)
+	}
+	wantSummary = "Path: TCP (fallback), Version: 1, Decline: " +
+		"0x3030000 (no SMC device found (R or D)), Messages: " +
+		"Client 1 (52 bytes), Server 1 (28 bytes), Duration: 1ms"
+	if result.summary() != wantSummary {
+		t.Errorf("got = %s; want %s", result.summary(), wantSummary)
+	}
+
+	// test accept with path not offered in proposal
+	ht.add(net, trans, testHandshakeMessage(proposal), time.Time{})
+	got, _ = ht.add(net.Reverse(), trans.Reverse(),
+		testHandshakeMessage(accept[:14]+"19"+accept[16:]), time.Time{})
+	want = []string{"Accept Path SMC-D not offered in Proposal"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test confirm with different peer ID and invalid QP MTU
+	got, _ = ht.add(net, trans, testHandshakeMessage(
+		confirm[:16]+"0000"+confirm[20:101]+"0"+confirm[102:]),
+		time.Time{})
+	want = []string{
+		"Confirm Path SMC-R differs from Accept Path SMC-D",
+		"Confirm Peer ID 0@98:03:9b:ab:cd:ef differs from " +
+			"Proposal Peer ID 45472@98:03:9b:ab:cd:ef",
+		"Confirm QP MTU 0 (reserved) invalid",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test confirm with too big RMBE size
+	ht.add(net, trans, testHandshakeMessage(proposal), time.Time{})
+	ht.add(net.Reverse(), trans.Reverse(), testHandshakeMessage(accept),
+		time.Time{})
+	got, _ = ht.add(net, trans, testHandshakeMessage(
+		confirm[:100]+"f"+confirm[101:]), time.Time{})
+	want = []string{"Confirm RMBE Size 15 (536870912) too big"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test decline removes handshake
+	ht.add(net, trans, testHandshakeMessage(proposal), time.Time{})
+	ht.add(net.Reverse(), trans.Reverse(), testHandshakeMessage(
+		"e2d4c3d904001c102525252525252500"+
+			"0303000000000000e2d4c3d9"), time.Time{})
+	if len(ht.hmap) != 0 {
+		t.Errorf("len(ht.hmap) = %d; want 0", len(ht.hmap))
+	}
+}
+
+func TestHandshakeResultVersion(t *testing.T) {
+	// test matching versions
+	r := &handshakeResult{confirmed: true, version: 2, proposalVer: 2}
+	want := "Path: SMC-R, Version: 2, First Contact: 0, Messages: " +
+		"Client 0 (0 bytes), Server 0 (0 bytes), Duration: 0s"
+	if got := r.summary(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test v2 proposal with v1 accept
+	r = &handshakeResult{confirmed: true, version: 1, proposalVer: 2}
+	want = "Path: SMC-R, Version: 1 (Mismatch: Proposal Version 2), " +
+		"First Contact: 0, Messages: Client 0 (0 bytes), Server 0 " +
+		"(0 bytes), Duration: 0s"
+	if got := r.summary(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
+
+func TestHandshakeTableSession(t *testing.T) {
+	var ht handshakeTable
+
+	// prepare test flows and messages
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+
+	// test unknown handshake
+	ht.init()
+	if got := ht.session(net, trans); got != 0 {
+		t.Errorf("got = %d; want 0", got)
+	}
+
+	// test session IDs of consecutive handshakes in both directions
+	for want := uint64(1); want <= 3; want++ {
+		ht.add(net, trans, proposal, time.Time{})
+		got := ht.session(net.Reverse(), trans.Reverse())
+		if got != want {
+			t.Errorf("got = %d; want %d", got, want)
+		}
+		_, result := ht.add(net.Reverse(), trans.Reverse(), decline,
+			time.Time{})
+		if result == nil || result.id != want {
+			t.Errorf("got = %v; want session %d", result, want)
+		}
+		if got := ht.session(net, trans); got != 0 {
+			t.Errorf("got = %d; want 0", got)
+		}
+	}
+}
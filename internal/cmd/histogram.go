@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// durations stores the handshake duration histogram
+	durations durationHistogram
+)
+
+// durationHistogram stores the number of handshakes with durations in
+// buckets with upper bounds protected by a mutex, the last bucket has no
+// upper bound
+type durationHistogram struct {
+	lock   sync.Mutex
+	bounds []time.Duration
+	counts []uint64
+	sum    time.Duration
+	count  uint64
+}
+
+// parseBuckets parses the comma-separated list of bucket upper bounds in spec
+func parseBuckets(spec string) ([]time.Duration, error) {
+	var bounds []time.Duration
+	for _, s := range strings.Split(spec, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket %q", s)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q", s)
+		}
+		bounds = append(bounds, d)
+	}
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i] < bounds[j]
+	})
+	return bounds, nil
+}
+
+// init initializes the histogram with the bucket upper bounds in spec
+func (dh *durationHistogram) init(spec string) error {
+	bounds, err := parseBuckets(spec)
+	if err != nil {
+		return err
+	}
+
+	dh.lock.Lock()
+	dh.bounds = bounds
+	dh.counts = make([]uint64, len(bounds)+1)
+	dh.sum = 0
+	dh.count = 0
+	dh.lock.Unlock()
+	return nil
+}
+
+// add adds the handshake duration d to the histogram
+func (dh *durationHistogram) add(d time.Duration) {
+	dh.lock.Lock()
+	defer dh.lock.Unlock()
+
+	if dh.counts == nil {
+		return
+	}
+	i := sort.Search(len(dh.bounds), func(i int) bool {
+		return d <= dh.bounds[i]
+	})
+	dh.counts[i]++
+	dh.sum += d
+	dh.count++
+}
+
+// lines returns the histogram with one line per bucket
+func (dh *durationHistogram) lines() []string {
+	dh.lock.Lock()
+	defer dh.lock.Unlock()
+
+	var lines []string
+	for i, n := range dh.counts {
+		if i < len(dh.bounds) {
+			lines = append(lines, fmt.Sprintf("<= %s: %d",
+				dh.bounds[i], n))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("> %s: %d",
+			dh.bounds[len(dh.bounds)-1], n))
+	}
+	return lines
+}
+
+// writeMetrics writes the histogram in prometheus text format to w
+func (dh *durationHistogram) writeMetrics(w io.Writer) {
+	dh.lock.Lock()
+	defer dh.lock.Unlock()
+
+	if dh.counts == nil {
+		return
+	}
+	fmt.Fprintln(w, "# HELP smc_clc_handshake_duration_seconds Duration "+
+		"of finished handshakes.")
+	fmt.Fprintln(w, "# TYPE smc_clc_handshake_duration_seconds histogram")
+	var cumulative uint64
+	for i, n := range dh.counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(dh.bounds) {
+			le = fmt.Sprint(dh.bounds[i].Seconds())
+		}
+		fmt.Fprintf(w, "smc_clc_handshake_duration_seconds_bucket"+
+			"{le=%q} %d\n", le, cumulative)
+	}
+	fmt.Fprintf(w, "smc_clc_handshake_duration_seconds_sum %g\n",
+		dh.sum.Seconds())
+	fmt.Fprintf(w, "smc_clc_handshake_duration_seconds_count %d\n",
+		dh.count)
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationHistogram(t *testing.T) {
+	var dh durationHistogram
+
+	// test invalid buckets
+	for _, spec := range []string{"", "1ms,x", "0s"} {
+		if err := dh.init(spec); err == nil {
+			t.Errorf("got = nil; want error for %q", spec)
+		}
+	}
+
+	// test histogram with unsorted buckets
+	if err := dh.init("10ms, 1ms"); err != nil {
+		log.Fatal(err)
+	}
+	for _, d := range []time.Duration{1, 2, 5, 20} {
+		dh.add(d * time.Millisecond)
+	}
+	want := []string{"<= 1ms: 1", "<= 10ms: 2", "> 10ms: 1"}
+	if got := dh.lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test metrics
+	var buf bytes.Buffer
+	dh.writeMetrics(&buf)
+	for _, want := range []string{
+		"smc_clc_handshake_duration_seconds_bucket{le=\"0.001\"} 1\n",
+		"smc_clc_handshake_duration_seconds_bucket{le=\"0.01\"} 3\n",
+		"smc_clc_handshake_duration_seconds_bucket{le=\"+Inf\"} 4\n",
+		"smc_clc_handshake_duration_seconds_sum 0.028\n",
+		"smc_clc_handshake_duration_seconds_count 4\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got = %s; want %s", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// hostnames stores the peer hostname table
+	hostnames hostnameTable
+)
+
+// hostnameTable stores the peer hostnames of ip addresses protected by a
+// mutex
+type hostnameTable struct {
+	lock sync.Mutex
+	hmap map[gopacket.Endpoint]string
+}
+
+// init initializes the hostname table
+func (ht *hostnameTable) init() {
+	ht.lock.Lock()
+	if ht.hmap == nil {
+		ht.hmap = make(map[gopacket.Endpoint]string)
+	}
+	ht.lock.Unlock()
+}
+
+// add adds the hostname of the ip address in the network endpoint ip to the
+// hostname table
+func (ht *hostnameTable) add(ip gopacket.Endpoint, hostname string) {
+	ht.lock.Lock()
+	if ht.hmap != nil {
+		ht.hmap[ip] = hostname
+	}
+	ht.lock.Unlock()
+}
+
+// get returns the hostname of the ip address in the network endpoint ip from
+// the hostname table
+func (ht *hostnameTable) get(ip gopacket.Endpoint) string {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	return ht.hmap[ip]
+}
+
+// firstContactExt returns the SMCv2 accept or confirm CLC message msg if it
+// contains a first contact extension or nil otherwise
+func firstContactExt(msg clc.Message) *clc.AcceptSMCDv2 {
+	var ac *clc.AcceptSMCDv2
+	switch m := msg.(type) {
+	case *clc.AcceptSMCDv2:
+		ac = m
+	case *clc.ConfirmSMCDv2:
+		ac = &m.AcceptSMCDv2
+	default:
+		return nil
+	}
+	if ac.Length < clc.AcceptSMCDv2FCELen {
+		return nil
+	}
+	return ac
+}
+
+// peerHostname returns the hostname in the first contact extension of the CLC
+// message msg or an empty string if there is none
+func peerHostname(msg clc.Message) string {
+	ac := firstContactExt(msg)
+	if ac == nil {
+		return ""
+	}
+	return ac.Hostname.String()
+}
+
+// messageRelease returns the SMCv2 release in the first contact extension of
+// the CLC message msg or -1 if there is none
+func messageRelease(msg clc.Message) int {
+	ac := firstContactExt(msg)
+	if ac == nil {
+		return -1
+	}
+	return int(ac.Release)
+}
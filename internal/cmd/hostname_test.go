@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestHostnames(t *testing.T) {
+	var want, got string
+
+	// prepare test flows
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+
+	// prepare SMC-Dv2 accept message with first contact extension
+	accept := testHandshakeMessage("e2d4c3c4" + "02" + "0072" + "2" +
+		"9" + "0123456789abcdef" + "0123456789abcdef" + "ff" + "1" +
+		"0" + "0000" + "ffffffff" + "0123" +
+		"546869734973534d4376324549443031" +
+		"00000000000000000000000000000000" +
+		"0000000000000000" +
+		"00" + "2" + "0" + "0000" +
+		"546869734973486f73746e616d653031" +
+		"00000000000000000000000000000000" +
+		"e2d4c3c4")
+
+	// test hostname in first contact extension
+	want = "ThisIsHostname01"
+	got = peerHostname(accept)
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test message without first contact extension
+	want = ""
+	got = peerHostname(testHandshakeMessage(
+		"e2d4c3d904001c102525252525252500" +
+			"0303000000000000e2d4c3d9"))
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test output with known hostname
+	var buf bytes.Buffer
+	stdout = &buf
+	*showTimestamps = false
+	*showReserved = false
+	*showDumps = false
+	hostnames.init()
+	hostnames.add(net.Src(), peerHostname(accept))
+	printCLC(net, trans, accept, 0, nil)
+	want = "1.2.3.4:123 (ThisIsHostname01) -> 5.6.7.8:456: Accept: "
+	got = buf.String()
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("got = %s; want prefix %s", got, want)
+	}
+	hostnames.hmap = nil
+}
@@ -1,12 +1,283 @@
 package cmd
 
 import (
-	"github.com/hwipl/smc-go/pkg/http"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-// setHTTPOutput sets the standard output to http and starts a http server
-func setHTTPOutput() {
-	h := http.StartServer(*httpListen)
-	stdout = &h.Buffer
-	stderr = &h.Buffer
+var (
+	// httpOutput is the text output buffer of the http server
+	httpOutput httpBuffer
+
+	// httpControlMux serves the control apis, it is the default mux
+	// unless the control apis have a separate listener
+	httpControlMux = http.DefaultServeMux
+)
+
+// httpBuffer is a text output buffer bounded by bytes and lines protected by
+// a mutex, if it exceeds a limit, the oldest lines are discarded. Readers
+// track their position in the output with a cursor, the byte offset in the
+// output since the start
+type httpBuffer struct {
+	lock     sync.Mutex
+	data     []byte
+	offset   uint64
+	lines    int
+	maxBytes int
+	maxLines int
+}
+
+// init initializes the buffer with maxBytes and maxLines, 0 disables a limit
+func (hb *httpBuffer) init(maxBytes, maxLines int) {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+	hb.data = nil
+	hb.offset = 0
+	hb.lines = 0
+	hb.maxBytes = maxBytes
+	hb.maxLines = maxLines
+}
+
+// discard removes the oldest lines until the buffer is within its limits,
+// hb must be locked
+func (hb *httpBuffer) discard() {
+	cut := 0
+	lines := hb.lines
+	for (hb.maxBytes > 0 && len(hb.data)-cut > hb.maxBytes) ||
+		(hb.maxLines > 0 && lines > hb.maxLines) {
+		i := bytes.IndexByte(hb.data[cut:], '\n')
+		if i < 0 {
+			// partial line without newline exceeds the limit
+			cut = len(hb.data)
+			break
+		}
+		cut += i + 1
+		lines--
+	}
+
+	// appending reallocates the data without the discarded lines
+	hb.data = hb.data[cut:]
+	hb.offset += uint64(cut)
+	hb.lines = lines
+}
+
+// Write writes p to the buffer and discards the oldest lines if the buffer
+// exceeds its limits
+func (hb *httpBuffer) Write(p []byte) (int, error) {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+	hb.data = append(hb.data, p...)
+	hb.lines += bytes.Count(p, []byte{'\n'})
+	hb.discard()
+	return len(p), nil
+}
+
+// read returns a copy of the buffer content after the cursor and the cursor
+// of the end of the content. If the content after the cursor is already
+// discarded, it returns all content
+func (hb *httpBuffer) read(cursor uint64) ([]byte, uint64) {
+	hb.lock.Lock()
+	defer hb.lock.Unlock()
+	end := hb.offset + uint64(len(hb.data))
+	cursor = max(cursor, hb.offset)
+	cursor = min(cursor, end)
+	return append([]byte(nil), hb.data[cursor-hb.offset:]...), end
+}
+
+// handleOutput handles http requests for the text output after the cursor in
+// the query parameter cursor, the header X-Cursor contains the cursor for the
+// next request
+func handleOutput(w http.ResponseWriter, r *http.Request) {
+	cursor, err := parseMessageUint(r.URL.Query(), "cursor")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, next := httpOutput.read(cursor)
+	w.Header().Set("X-Cursor", strconv.FormatUint(next, 10))
+	if _, err := w.Write(b); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// httpBase serves the handler h under the base path, requests outside of it
+// are not found
+func httpBase(base string, h http.Handler) http.Handler {
+	base = "/" + strings.Trim(base, "/")
+	if base == "/" {
+		return h
+	}
+	strip := http.StripPrefix(base, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == base {
+			http.Redirect(w, r, base+"/",
+				http.StatusMovedPermanently)
+			return
+		}
+		strip.ServeHTTP(w, r)
+	})
+}
+
+// httpCORSHandler adds CORS headers for requests from the comma-separated
+// origins, * allows all origins, to the responses of the handler h and
+// answers preflight requests
+func httpCORSHandler(origins string, h http.Handler) http.Handler {
+	if origins == "" {
+		return h
+	}
+	allowed := make(map[string]bool)
+	for _, o := range strings.Split(origins, ",") {
+		allowed[strings.TrimSpace(o)] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || (!allowed["*"] && !allowed[origin]) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		hdr := w.Header()
+		if allowed["*"] {
+			hdr.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			hdr.Set("Access-Control-Allow-Origin", origin)
+			hdr.Add("Vary", "Origin")
+		}
+		hdr.Set("Access-Control-Expose-Headers", "X-Cursor")
+		if r.Method == http.MethodOptions &&
+			r.Header.Get("Access-Control-Request-Method") != "" {
+			hdr.Set("Access-Control-Allow-Methods",
+				"GET, POST, PUT")
+			hdr.Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serveHTTP serves the http apis in handler h on listener l under the base
+// path with CORS headers for origins, the returned function shuts the
+// server down
+func serveHTTP(l net.Listener, h http.Handler, base,
+	origins string) func() {
+	server := &http.Server{
+		Handler: httpCORSHandler(origins, httpBase(base, h)),
+	}
+	go func() {
+		if err := server.Serve(l); err != http.ErrServerClosed {
+			// log to the original stderr, the output is not
+			// reachable without the server
+			log.New(os.Stderr, "", log.LstdFlags).Fatalln(
+				"Error serving http:", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(),
+			time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "Error stopping http server:",
+				err)
+		}
+	}
+}
+
+// listenHTTP listens on the tcp address or, with prefix unix:, the unix
+// domain socket path in address. A stale socket of a previous run without
+// listener is removed
+func listenHTTP(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix:")
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+	if fi, err := os.Stat(path); err == nil &&
+		fi.Mode()&os.ModeSocket != 0 {
+		if c, err := net.Dial("unix", path); err == nil {
+			c.Close()
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// handleShutdown handles http requests to stop the capture and exit
+func handleShutdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	go interruptCapture()
+}
+
+// setHTTPOutput sets the standard output to the bounded http output buffer
+// and starts a http server with the text output, html dashboard, metrics,
+// statistics, messages, pcap download, decline summary, latency heatmap, and
+// the control apis: runtime settings, annotation, debug state, and
+// (optional) profiling. If set, a separate http server serves the control
+// apis and the shutdown api. The returned function shuts the servers down
+func setHTTPOutput() func() {
+	if *httpListen == "" {
+		return func() {}
+	}
+	listener, err := listenHTTP(*httpListen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var control net.Listener
+	if *httpControl != "" {
+		control, err = listenHTTP(*httpControl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		httpControlMux = http.NewServeMux()
+		httpControlMux.HandleFunc("/api/v1/shutdown", handleShutdown)
+	}
+	httpOutput.init(*httpBufferSize, *httpBufferLines)
+	stdout = &httpOutput
+	stderr = &httpOutput
+	http.HandleFunc("/", handleOutput)
+	registerUI()
+	registerSettingsAPI()
+	registerMetricsAPI()
+	registerStatsAPI()
+	registerMessageAPI()
+	registerPcapDownloadAPI()
+	registerDeclineAPI()
+	registerPeerIDAPI()
+	registerInventoryAPI()
+	registerLatencyAPI()
+	registerAnnotationAPI()
+	registerStateAPI()
+	if *httpPprof {
+		registerProfileAPI()
+	}
+	var handler http.Handler = http.DefaultServeMux
+	if !*httpPprof || control != nil {
+		handler = httpHideProfile(handler)
+	}
+	stop := serveHTTP(listener, handler, *httpBasePath, *httpCORS)
+	if control == nil {
+		return stop
+	}
+	stopControl := serveHTTP(control, httpControlMux, *httpBasePath,
+		*httpCORS)
+	return func() {
+		stopControl()
+		stop()
+	}
 }
@@ -0,0 +1,320 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHTTPBuffer(t *testing.T) {
+	for _, test := range []struct {
+		maxBytes, maxLines int
+		writes             []string
+		want               string
+	}{
+		// no limits
+		{0, 0, []string{"a\n", "b\n", "c"}, "a\nb\nc"},
+
+		// byte limit discards oldest lines
+		{5, 0, []string{"aa\n", "bb\n", "cc\n"}, "cc\n"},
+		{6, 0, []string{"aa\n", "bb\n", "cc\n"}, "bb\ncc\n"},
+		{6, 0, []string{"aa\nbb\ncc\ndd\n"}, "cc\ndd\n"},
+
+		// partial line exceeding the byte limit is discarded
+		{4, 0, []string{"aa\n", "bbbbbb"}, ""},
+
+		// line limit discards oldest lines, partial lines do not count
+		{0, 2, []string{"a\n", "b\n", "c\n", "d"}, "b\nc\nd"},
+		{0, 1, []string{"a\nb\nc\n"}, "c\n"},
+
+		// both limits
+		{4, 3, []string{"a\n", "b\n", "c\n", "d\n"}, "c\nd\n"},
+		{100, 3, []string{"a\n", "b\n", "c\n", "d\n"}, "b\nc\nd\n"},
+	} {
+		var hb httpBuffer
+		hb.init(test.maxBytes, test.maxLines)
+		for _, w := range test.writes {
+			if n, err := hb.Write([]byte(w)); n != len(w) ||
+				err != nil {
+				t.Errorf("Write() = %d, %v; want %d, nil", n,
+					err, len(w))
+			}
+		}
+		if got, _ := hb.read(0); string(got) != test.want {
+			t.Errorf("%d/%d %q: got %q; want %q", test.maxBytes,
+				test.maxLines, test.writes, got, test.want)
+		}
+	}
+}
+
+func TestHTTPBufferLong(t *testing.T) {
+	// buffer stays within its limit with many writes
+	var hb httpBuffer
+	hb.init(1000, 0)
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&hb, "line %d\n", i)
+		if len(hb.data) > 1000 {
+			t.Fatalf("got %d bytes; want at most 1000",
+				len(hb.data))
+		}
+	}
+	if hb.lines != 1000/len("line 9999\n") {
+		t.Errorf("got %d lines; want %d", hb.lines,
+			1000/len("line 9999\n"))
+	}
+}
+
+func TestHTTPBufferRead(t *testing.T) {
+	var hb httpBuffer
+	hb.init(6, 0)
+	for _, test := range []struct {
+		write  string
+		cursor uint64
+		want   string
+		next   uint64
+	}{
+		{"aa\n", 0, "aa\n", 3},
+		{"bb\n", 3, "bb\n", 6},
+		{"", 6, "", 6},
+		{"", 100, "", 6},
+		{"", 0, "aa\nbb\n", 6},
+
+		// discarded content after cursor returns all content
+		{"cc\n", 0, "bb\ncc\n", 9},
+		{"dd\n", 4, "cc\ndd\n", 12},
+		{"", 10, "d\n", 12},
+	} {
+		hb.Write([]byte(test.write))
+		got, next := hb.read(test.cursor)
+		if string(got) != test.want || next != test.next {
+			t.Errorf("%d: got %q, %d; want %q, %d", test.cursor,
+				got, next, test.want, test.next)
+		}
+	}
+}
+
+func TestHandleOutput(t *testing.T) {
+	httpOutput.init(0, 0)
+	defer httpOutput.init(0, 0)
+	fmt.Fprintln(&httpOutput, "hello world")
+
+	// independent readers get output after their cursors
+	for _, test := range []struct {
+		query, want, next string
+		code              int
+	}{
+		{"/", "hello world\n", "12", http.StatusOK},
+		{"/?cursor=0", "hello world\n", "12", http.StatusOK},
+		{"/?cursor=6", "world\n", "12", http.StatusOK},
+		{"/?cursor=12", "", "12", http.StatusOK},
+		{"/?cursor=x", "invalid cursor \"x\"\n", "",
+			http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodGet, test.query, nil)
+		w := httptest.NewRecorder()
+		handleOutput(w, r)
+		if got := w.Body.String(); got != test.want ||
+			w.Code != test.code {
+			t.Errorf("%s: got %d %q; want %d %q", test.query,
+				w.Code, got, test.code, test.want)
+		}
+		if got := w.Header().Get("X-Cursor"); got != test.next {
+			t.Errorf("%s: got cursor %q; want %q", test.query, got,
+				test.next)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	// start server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	stop := serveHTTP(l, http.DefaultServeMux, "", "")
+
+	// server is reachable while running
+	url := "http://" + l.Addr().String() + "/test"
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// server is not reachable after shutdown
+	stop()
+	if resp, err := http.Get(url); err == nil {
+		resp.Body.Close()
+		t.Error("server reachable after shutdown")
+	}
+}
+
+func TestHTTPBase(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	})
+	for _, test := range []struct {
+		base, path, want string
+		code             int
+	}{
+		{"", "/ui", "/ui", http.StatusOK},
+		{"/", "/ui", "/ui", http.StatusOK},
+		{"/smc-clc", "/smc-clc/ui", "/ui", http.StatusOK},
+		{"smc-clc/", "/smc-clc/api/v1/messages", "/api/v1/messages",
+			http.StatusOK},
+		{"/smc-clc", "/smc-clc/", "/", http.StatusOK},
+		{"/smc-clc", "/smc-clc", "", http.StatusMovedPermanently},
+		{"/smc-clc", "/ui", "404 page not found\n",
+			http.StatusNotFound},
+	} {
+		r := httptest.NewRequest(http.MethodGet, test.path, nil)
+		w := httptest.NewRecorder()
+		httpBase(test.base, h).ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s: got %d; want %d", test.base, test.path,
+				w.Code, test.code)
+		}
+		if got := w.Body.String(); test.want != "" &&
+			got != test.want {
+			t.Errorf("%s %s: got %q; want %q", test.base,
+				test.path, got, test.want)
+		}
+	}
+}
+
+func TestHTTPCORSHandler(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	for _, test := range []struct {
+		origins, origin, method, want string
+		code                          int
+	}{
+		// disabled
+		{"", "https://a.example", http.MethodGet, "", http.StatusOK},
+
+		// allowed and not allowed origins
+		{"*", "https://a.example", http.MethodGet, "*", http.StatusOK},
+		{"https://a.example, https://b.example", "https://b.example",
+			http.MethodGet, "https://b.example", http.StatusOK},
+		{"https://a.example", "https://c.example", http.MethodGet, "",
+			http.StatusOK},
+		{"https://a.example", "", http.MethodGet, "", http.StatusOK},
+
+		// preflight
+		{"*", "https://a.example", http.MethodOptions, "*",
+			http.StatusNoContent},
+		{"https://a.example", "https://c.example", http.MethodOptions,
+			"", http.StatusOK},
+	} {
+		r := httptest.NewRequest(test.method, "/api/v1/settings", nil)
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+		if test.method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method",
+				http.MethodPut)
+		}
+		w := httptest.NewRecorder()
+		httpCORSHandler(test.origins, h).ServeHTTP(w, r)
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if got != test.want || w.Code != test.code {
+			t.Errorf("%q %q %s: got %d %q; want %d %q",
+				test.origins, test.origin, test.method, w.Code,
+				got, test.code, test.want)
+		}
+		if test.code == http.StatusNoContent && w.Header().Get(
+			"Access-Control-Allow-Methods") == "" {
+			t.Error("preflight without allowed methods")
+		}
+	}
+}
+
+func TestListenHTTPUnix(t *testing.T) {
+	// start server on unix domain socket
+	path := filepath.Join(t.TempDir(), "smc-clc.sock")
+	l, err := listenHTTP("unix:" + path)
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	stop := serveHTTP(l, http.DefaultServeMux, "", "")
+
+	// socket in use
+	if _, err := listenHTTP("unix:" + path); err == nil {
+		t.Error("listen on socket in use succeeded")
+	}
+
+	// server is reachable over socket
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn,
+			error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://smc-clc/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// socket is removed after shutdown
+	stop()
+	if _, err := os.Stat(path); err == nil {
+		t.Error("socket exists after shutdown")
+	}
+
+	// stale socket is replaced
+	ul, err := net.ListenUnix("unix", &net.UnixAddr{Name: path,
+		Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul.SetUnlinkOnClose(false)
+	ul.Close()
+	l, err = listenHTTP("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// other files are not removed
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenHTTP("unix:" + file); err == nil {
+		t.Error("listen on regular file succeeded")
+	}
+}
+
+func TestHandleShutdown(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		code   int
+	}{
+		{http.MethodGet, http.StatusMethodNotAllowed},
+		{http.MethodPost, http.StatusAccepted},
+	} {
+		r := httptest.NewRequest(test.method, "/api/v1/shutdown", nil)
+		w := httptest.NewRecorder()
+		handleShutdown(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: got %d; want %d", test.method, w.Code,
+				test.code)
+		}
+	}
+	for i := 0; i < 100 && !interrupted.Load(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !interrupted.Load() {
+		t.Error("capture not interrupted")
+	}
+	interrupted.Store(false)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+// interfaceList is a list of network interfaces set with repeated or
+// comma-separated command line arguments
+type interfaceList []string
+
+// interfaceFlag defines the interface list command line argument name with
+// usage and returns the interface list
+func interfaceFlag(name, usage string) *interfaceList {
+	il := &interfaceList{}
+	flag.Var(il, name, usage)
+	return il
+}
+
+// String converts the interface list to a comma-separated string
+func (il *interfaceList) String() string {
+	return strings.Join(*il, ",")
+}
+
+// Set adds the comma-separated interfaces in value to the interface list
+func (il *interfaceList) Set(value string) error {
+	for _, i := range strings.Split(value, ",") {
+		i = strings.TrimSpace(i)
+		if i == "" {
+			return errors.New("empty interface name")
+		}
+		*il = append(*il, i)
+	}
+	return nil
+}
+
+// syncHandler serializes the packets and timer events of multiple pcap
+// listeners to the handler h, so they share its assembler and tables
+type syncHandler struct {
+	lock sync.Mutex
+	h    *handler
+}
+
+// HandlePacket handles a packet with the handler
+func (s *syncHandler) HandlePacket(packet gopacket.Packet) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.h.HandlePacket(packet)
+}
+
+// HandleTimer handles a timer event with the handler
+func (s *syncHandler) HandleTimer() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.h.HandleTimer()
+}
+
+// listenDevices reads packets from the network interfaces in devices with
+// one pcap listener per interface and handles them with handler until all
+// listeners stopped. Only the first listener drives the timer
+func listenDevices(handler *handler, devices []string) {
+	sh := &syncHandler{h: handler}
+	var listeners []*pcap.Listener
+	for i, device := range devices {
+		var timer time.Duration
+		if i == 0 {
+			timer = time.Minute
+		}
+		listener := &pcap.Listener{
+			PacketHandler: sh,
+			TimerHandler:  sh,
+			Timer:         timer,
+			Device:        device,
+			Promisc:       devicePromisc(device),
+			Snaplen:       *pcapSnaplen,
+			Timeout: time.Duration(*pcapTimeout) *
+				time.Millisecond,
+			Filter:  *getSettings().Filter,
+			MaxPkts: *pcapMaxPkts,
+			MaxTime: time.Duration(*pcapMaxTime) * time.Second,
+		}
+		prepareListener(listener)
+		listeners = append(listeners, listener)
+	}
+
+	// start listen loops
+	setListeners(listeners...)
+	if interrupted.Load() {
+		stopListener()
+	}
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Loop()
+		}()
+	}
+	wg.Wait()
+	setListeners()
+
+	// restart the live capture with the raised snaplen
+	if snaplenRaised.Swap(false) && !interrupted.Load() {
+		listenDevices(handler, devices)
+	}
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterfaceList(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want interfaceList
+		ok   bool
+	}{
+		{nil, interfaceList{}, true},
+		{[]string{"-i", "eth0"}, interfaceList{"eth0"}, true},
+		{[]string{"-i", "eth0,ib0"}, interfaceList{"eth0", "ib0"},
+			true},
+		{[]string{"-i", "eth0, ib0", "-i", "eth1"},
+			interfaceList{"eth0", "ib0", "eth1"}, true},
+		{[]string{"-i", "eth0,"}, nil, false},
+		{[]string{"-i", ""}, nil, false},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		il := interfaceList{}
+		fs.Var(&il, "i", "")
+		err := fs.Parse(test.args)
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v; want ok %t", test.args, err,
+				test.ok)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		if !reflect.DeepEqual(il, test.want) {
+			t.Errorf("%q: got %v; want %v", test.args, il,
+				test.want)
+		}
+		if got, want := il.String(), strings.Join(test.want,
+			","); got != want {
+			t.Errorf("%q: got %q; want %q", test.args, got, want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// invalidMessage stores a CLC message that failed validation
+type invalidMessage struct {
+	raw    []byte
+	header clc.Header
+	reason string
+}
+
+// newInvalidMessage creates a new invalid message with the error reason
+func newInvalidMessage(reason string) *invalidMessage {
+	return &invalidMessage{reason: reason}
+}
+
+// Parse parses the CLC header of the invalid message in buf
+func (m *invalidMessage) Parse(buf []byte) {
+	m.raw = buf
+	m.header.Parse(buf)
+}
+
+// String converts the invalid message to a string
+func (m *invalidMessage) String() string {
+	return fmt.Sprintf("%s, Error: %s", m.header.String(), m.reason)
+}
+
+// Reserved converts the invalid message to a string including reserved
+// message fields
+func (m *invalidMessage) Reserved() string {
+	return fmt.Sprintf("%s, Error: %s", m.header.Reserved(), m.reason)
+}
+
+// Dump returns the raw bytes of the invalid message as hex dump string
+// annotated with the message parts
+func (m *invalidMessage) Dump() string {
+	dumpFmt := "%s (offset %d, length %d):\n%s"
+	dump := fmt.Sprintf(dumpFmt, "Header", 0, clc.HeaderLen,
+		hex.Dump(m.raw[:clc.HeaderLen]))
+	if len(m.raw) < clc.HeaderLen+clc.TrailerLen {
+		if len(m.raw) > clc.HeaderLen {
+			dump += fmt.Sprintf(dumpFmt, "Payload", clc.HeaderLen,
+				len(m.raw)-clc.HeaderLen,
+				hex.Dump(m.raw[clc.HeaderLen:]))
+		}
+		return dump
+	}
+
+	end := len(m.raw) - clc.TrailerLen
+	if end > clc.HeaderLen {
+		dump += fmt.Sprintf(dumpFmt, "Payload", clc.HeaderLen,
+			end-clc.HeaderLen, hex.Dump(m.raw[clc.HeaderLen:end]))
+	}
+	dump += fmt.Sprintf(dumpFmt, "Trailer", end, clc.TrailerLen,
+		hex.Dump(m.raw[end:]))
+	return dump
+}
+
+// minMessageLen returns the minimum length of the CLC message msg
+func minMessageLen(msg clc.Message) int {
+	switch msg.(type) {
+	case *clc.Proposal:
+		return clc.ProposalLen
+	case *clc.ProposalV2:
+		return clc.ProposalV2Len
+	case *clc.AcceptSMCR, *clc.ConfirmSMCR:
+		return clc.AcceptSMCRLen
+	case *clc.AcceptSMCD, *clc.ConfirmSMCD:
+		return clc.AcceptSMCDLen
+	case *clc.AcceptSMCDv2, *clc.ConfirmSMCDv2:
+		return clc.AcceptSMCDv2Len
+	case *clc.Decline, *clc.DeclineV2:
+		return clc.DeclineLen
+	default:
+		return clc.HeaderLen + clc.TrailerLen
+	}
+}
+
+// validateMessage checks the CLC message msg in buf before it is parsed and
+// returns the reason if it is invalid
+func validateMessage(msg clc.Message, buf []byte) string {
+	if len(buf) < minMessageLen(msg) {
+		return "message too short"
+	}
+	if !clc.HasEyecatcher(buf[len(buf)-clc.TrailerLen:]) {
+		return "invalid trailer"
+	}
+	return ""
+}
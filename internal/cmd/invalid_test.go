@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"testing"
+)
+
+func TestInvalidMessage(t *testing.T) {
+	var want, got string
+
+	// prepare decline message that is too short
+	declineMsg := "e2d4c3d9040014102525252525252500" +
+		"e2d4c3d9"
+	msg, err := hex.DecodeString(declineMsg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// test decoder with invalid messages disabled
+	d := newDecoder(bytes.NewReader(msg))
+	clcMsg, err := d.next()
+	if err != nil {
+		t.Fatalf("d.next() error = %v; want nil", err)
+	}
+	if _, ok := clcMsg.(*invalidMessage); ok {
+		t.Errorf("got invalid message; want parsed message")
+	}
+
+	// test decoder with invalid messages enabled
+	d = newDecoder(bytes.NewReader(msg))
+	d.invalid = true
+	clcMsg, err = d.next()
+	if err != nil {
+		t.Fatalf("d.next() error = %v; want nil", err)
+	}
+	want = "Decline: Eyecatcher: SMC-R, Type: 4 (Decline), " +
+		"Length: 20, Version: 1, Out of Sync: 0, Path: SMC-R, " +
+		"Error: message too short"
+	got = clcMsg.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	want = "Header (offset 0, length 8):\n" +
+		"00000000  e2 d4 c3 d9 04 00 14 10                           " +
+		"|........|\n" +
+		"Payload (offset 8, length 8):\n" +
+		"00000000  25 25 25 25 25 25 25 00                           " +
+		"|%%%%%%%.|\n" +
+		"Trailer (offset 16, length 4):\n" +
+		"00000000  e2 d4 c3 d9                                       " +
+		"|....|\n"
+	got = clcMsg.Dump()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test decoder with message that is too big
+	msg[5] = 0xff
+	d = newDecoder(bytes.NewReader(msg))
+	d.invalid = true
+	clcMsg, err = d.next()
+	if err != nil {
+		t.Fatalf("d.next() error = %v; want nil", err)
+	}
+	want = "Decline: Eyecatcher: SMC-R, Type: 4 (Decline), " +
+		"Length: 65300, Version: 1, Out of Sync: 0, Path: SMC-R, " +
+		"Error: message too big"
+	got = clcMsg.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	if _, err := d.next(); err != errInvalidMessage {
+		t.Errorf("d.next() error = %v; want %v", err,
+			errInvalidMessage)
+	}
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// inventory stores the GID and RoCE MAC inventory
+	inventory inventoryTable
+)
+
+// inventoryEntry stores the distinct SMC-R GIDs including their RoCE GID
+// types and the distinct RoCE MACs of a host
+type inventoryEntry struct {
+	gids map[string]bool
+	macs map[string]bool
+}
+
+// inventoryTable stores the SMC-R GIDs and RoCE MACs seen per host ip
+// address protected by a mutex
+type inventoryTable struct {
+	lock  sync.Mutex
+	hosts map[gopacket.Endpoint]*inventoryEntry
+}
+
+// init initializes the inventory table
+func (it *inventoryTable) init() {
+	it.lock.Lock()
+	if it.hosts == nil {
+		it.hosts = make(map[gopacket.Endpoint]*inventoryEntry)
+	}
+	it.lock.Unlock()
+}
+
+// add adds the SMC-R GID and RoCE MAC in the CLC message msg sent over the
+// network flow net to the inventory of the source host
+func (it *inventoryTable) add(net gopacket.Flow, msg clc.Message) {
+	gid := messageGID(msg)
+	_, mac, _ := messagePeerID(msg)
+	if len(mac) == 0 || isZeroMAC(mac) {
+		mac = nil
+	}
+	if gid == nil && mac == nil {
+		return
+	}
+
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	if it.hosts == nil {
+		return
+	}
+	e := it.hosts[net.Src()]
+	if e == nil {
+		e = &inventoryEntry{
+			gids: make(map[string]bool),
+			macs: make(map[string]bool),
+		}
+		it.hosts[net.Src()] = e
+	}
+	if gid != nil {
+		version := messageHeader(msg).Version
+		e.gids[fmt.Sprintf("%s (%s)", gid, gidType(gid, version))] =
+			true
+	}
+	if mac != nil {
+		e.macs[mac.String()] = true
+	}
+}
+
+// sortedKeys returns the keys of the set m in sorted order
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lines returns the inventory with one line per host
+func (it *inventoryTable) lines() []string {
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	hosts := make([]gopacket.Endpoint, 0, len(it.hosts))
+	for host := range it.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].LessThan(hosts[j])
+	})
+
+	var lines []string
+	for _, host := range hosts {
+		e := it.hosts[host]
+		lines = append(lines, fmt.Sprintf("%s: GIDs: %s, MACs: %s",
+			host, strings.Join(sortedKeys(e.gids), ", "),
+			strings.Join(sortedKeys(e.macs), ", ")))
+	}
+	return lines
+}
+
+// writeInventory writes the GID and RoCE MAC inventory to w
+func writeInventory(w io.Writer) {
+	for _, line := range inventory.lines() {
+		fmt.Fprintf(w, "Inventory: %s\n", line)
+	}
+}
+
+// handleInventory handles http requests for the GID and RoCE MAC inventory
+func handleInventory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	writeInventory(w)
+}
+
+// registerInventoryAPI registers the inventory http api
+func registerInventoryAPI() {
+	http.HandleFunc("/api/v1/inventory", handleInventory)
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestInventoryTable(t *testing.T) {
+	var it inventoryTable
+
+	// initialize inventory table and test flows
+	it.init()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	proposal := "e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9"
+	accept := "e2d4c3d902004418b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e40000157d010000" +
+		"0005230000000000f0a600000072f5fe" +
+		"e2d4c3d9"
+	decline := "e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9"
+
+	// add messages of both hosts, the decline has no GID or MAC
+	it.add(net, testHandshakeMessage(proposal))
+	it.add(net, testHandshakeMessage(proposal))
+	it.add(net.Reverse(), testHandshakeMessage(accept))
+	it.add(net, testHandshakeMessage(decline))
+
+	// test inventory
+	want := []string{
+		"1.2.3.4: GIDs: fe80::9a03:9bff:feab:cdef (RoCEv1), " +
+			"MACs: 98:03:9b:ab:cd:ef",
+		"5.6.7.8: GIDs: fe80::9a03:9bff:feab:cdef (RoCEv1), " +
+			"MACs: 98:03:9b:ab:cd:ef",
+	}
+	got := it.lines()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
+
+func TestHandleInventory(t *testing.T) {
+	inventory.init()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	inventory.add(net, testHandshakeMessage(
+		"e2d4c3d901003410b1a098039babcdef"+
+			"fe800000000000009a039bfffeabcdef"+
+			"98039babcdef00007f00000008000000"+
+			"e2d4c3d9"))
+
+	// test http api
+	w := httptest.NewRecorder()
+	handleInventory(w, httptest.NewRequest("GET", "/api/v1/inventory",
+		nil))
+	var buf bytes.Buffer
+	writeInventory(&buf)
+	want := buf.String()
+	got := w.Body.String()
+	if got != want || got == "" {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	inventory.hosts = nil
+}
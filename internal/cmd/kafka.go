@@ -0,0 +1,719 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kafka output formats
+const (
+	kafkaJSON     = "json"
+	kafkaProtobuf = "protobuf"
+)
+
+// Kafka protocol api keys, versions, and settings
+const (
+	kafkaAPIProduce      = 0
+	kafkaAPIMetadata     = 3
+	kafkaProduceVersion  = 3
+	kafkaMetadataVersion = 4
+	kafkaClientID        = "smc-clc"
+	kafkaAcks            = 1
+	kafkaTimeout         = 10 * time.Second
+	kafkaLinger          = 100 * time.Millisecond
+	kafkaBatchSize       = 500
+	kafkaQueueLen        = 10000
+	kafkaMaxResponseSize = 64 << 20
+	kafkaRetries         = 3
+	kafkaRetryBackoff    = 100 * time.Millisecond
+
+	// leader and error code of partitions without leader
+	kafkaNoLeader          = -1
+	kafkaErrLeaderNotAvail = 5
+)
+
+var (
+	// kafkaEvents is the Kafka sink
+	kafkaEvents kafkaSink
+
+	// kafkaCRCTable is the CRC-32C table for record batches
+	kafkaCRCTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// kafkaAppendString appends the string s with int16 length to buf
+func kafkaAppendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// kafkaAppendBytes appends b with int32 length to buf
+func kafkaAppendBytes(buf []byte, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+// kafkaAppendVarBytes appends b with varint length to buf, nil is encoded as
+// null with length -1
+func kafkaAppendVarBytes(buf []byte, b []byte) []byte {
+	if b == nil {
+		return binary.AppendVarint(buf, -1)
+	}
+	buf = binary.AppendVarint(buf, int64(len(b)))
+	return append(buf, b...)
+}
+
+// kafkaDecoder decodes Kafka protocol responses, the first error is kept and
+// stops decoding
+type kafkaDecoder struct {
+	buf []byte
+	err error
+}
+
+// next returns the next n bytes of the response
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.buf) < n {
+		d.err = fmt.Errorf("short Kafka response")
+		d.buf = nil
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+// int8 decodes an int8 from the response
+func (d *kafkaDecoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+// int16 decodes an int16 from the response
+func (d *kafkaDecoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+// int32 decodes an int32 from the response
+func (d *kafkaDecoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+// int64 decodes an int64 from the response
+func (d *kafkaDecoder) int64() int64 {
+	if b := d.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// string decodes a nullable string from the response
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// kafkaRecord is a record of the Kafka output with its key, value, and time
+type kafkaRecord struct {
+	key   []byte
+	value []byte
+	time  time.Time
+}
+
+// kafkaRecordBatch returns the records as record batch (magic 2)
+func kafkaRecordBatch(records []kafkaRecord) []byte {
+	first, last := records[0].time.UnixMilli(), records[0].time.UnixMilli()
+	for _, r := range records {
+		first = min(first, r.time.UnixMilli())
+		last = max(last, r.time.UnixMilli())
+	}
+
+	// batch fields covered by the crc
+	b := binary.BigEndian.AppendUint16(nil, 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(records)-1))
+	b = binary.BigEndian.AppendUint64(b, uint64(first))
+	b = binary.BigEndian.AppendUint64(b, uint64(last))
+	b = binary.BigEndian.AppendUint64(b, ^uint64(0))
+	b = binary.BigEndian.AppendUint16(b, ^uint16(0))
+	b = binary.BigEndian.AppendUint32(b, ^uint32(0))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(records)))
+	for i, r := range records {
+		rec := []byte{0}
+		rec = binary.AppendVarint(rec, r.time.UnixMilli()-first)
+		rec = binary.AppendVarint(rec, int64(i))
+		rec = kafkaAppendVarBytes(rec, r.key)
+		rec = kafkaAppendVarBytes(rec, r.value)
+		rec = binary.AppendVarint(rec, 0)
+		b = binary.AppendVarint(b, int64(len(rec)))
+		b = append(b, rec...)
+	}
+
+	// batch header: base offset, batch length, partition leader epoch,
+	// magic, and crc
+	batch := binary.BigEndian.AppendUint64(nil, 0)
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(b)))
+	batch = binary.BigEndian.AppendUint32(batch, ^uint32(0))
+	batch = append(batch, 2)
+	batch = binary.BigEndian.AppendUint32(batch,
+		crc32.Checksum(b, kafkaCRCTable))
+	return append(batch, b...)
+}
+
+// kafkaConn is a connection to a Kafka broker
+type kafkaConn struct {
+	conn          net.Conn
+	correlationID int32
+}
+
+// dialKafka connects to the Kafka broker at address
+func dialKafka(address string) (*kafkaConn, error) {
+	conn, err := net.DialTimeout("tcp", address, kafkaTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaConn{conn: conn}, nil
+}
+
+// request sends the request body of the api key and version to the broker
+// and returns the body of its response
+func (c *kafkaConn) request(key, version int16, body []byte) ([]byte,
+	error) {
+	c.correlationID++
+	req := binary.BigEndian.AppendUint16(nil, uint16(key))
+	req = binary.BigEndian.AppendUint16(req, uint16(version))
+	req = binary.BigEndian.AppendUint32(req, uint32(c.correlationID))
+	req = kafkaAppendString(req, kafkaClientID)
+	req = append(req, body...)
+
+	c.conn.SetDeadline(time.Now().Add(kafkaTimeout))
+	if _, err := c.conn.Write(kafkaAppendBytes(nil, req)); err != nil {
+		return nil, err
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < 4 || n > kafkaMaxResponseSize {
+		return nil, fmt.Errorf("invalid Kafka response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.conn, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != c.correlationID {
+		return nil, fmt.Errorf("unexpected Kafka correlation ID %d",
+			id)
+	}
+	return resp[4:], nil
+}
+
+// close closes the connection to the broker
+func (c *kafkaConn) close() {
+	c.conn.Close()
+}
+
+// kafkaMetadata are the broker addresses by node ID and the partition
+// leaders of the topic
+type kafkaMetadata struct {
+	brokers map[int32]string
+	leaders []int32
+}
+
+// parseKafkaMetadata parses the metadata response resp for the topic
+func parseKafkaMetadata(resp []byte, topic string) (*kafkaMetadata, error) {
+	d := &kafkaDecoder{buf: resp}
+	m := &kafkaMetadata{brokers: make(map[int32]string)}
+	d.int32() // throttle time
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		m.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster ID
+	d.int32()  // controller ID
+
+	leaders := make(map[int32]int32)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		if name == topic && code != 0 {
+			return nil, fmt.Errorf("Kafka topic %q error code %d",
+				topic, code)
+		}
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			code := d.int16()
+			index := d.int32()
+			leader := d.int32()
+			for r := d.int32(); r > 0 && d.err == nil; r-- {
+				d.int32() // replica
+			}
+			for r := d.int32(); r > 0 && d.err == nil; r-- {
+				d.int32() // in-sync replica
+			}
+			if name != topic {
+				continue
+			}
+			if code != 0 && code != kafkaErrLeaderNotAvail {
+				return nil, fmt.Errorf("Kafka partition %d "+
+					"error code %d", index, code)
+			}
+			leaders[index] = leader
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if len(leaders) == 0 {
+		return nil, fmt.Errorf("Kafka topic %q not found", topic)
+	}
+	m.leaders = make([]int32, len(leaders))
+	for i := range m.leaders {
+		leader, ok := leaders[int32(i)]
+		if !ok || leader == kafkaNoLeader {
+			return nil, fmt.Errorf("Kafka partition %d has no "+
+				"leader", i)
+		}
+		m.leaders[i] = leader
+	}
+	return m, nil
+}
+
+// parseKafkaProduce parses the produce response resp and returns the
+// partitions with errors and the first partition error
+func parseKafkaProduce(resp []byte) ([]int32, error) {
+	var failed []int32
+	var err error
+	d := &kafkaDecoder{buf: resp}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string() // topic
+		for p := d.int32(); p > 0 && d.err == nil; p-- {
+			index := d.int32()
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if code == 0 {
+				continue
+			}
+			failed = append(failed, index)
+			if err == nil {
+				err = fmt.Errorf("Kafka partition %d error "+
+					"code %d", index, code)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return failed, err
+}
+
+// kafkaMurmur2 returns the murmur2 hash of the key b like the default
+// partitioner of the Kafka Java client
+func kafkaMurmur2(b []byte) uint32 {
+	const m = 0x5bd1e995
+	h := 0x9747b28c ^ uint32(len(b))
+	n := len(b) &^ 3
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(b[i:])
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+	}
+	switch len(b) & 3 {
+	case 3:
+		h ^= uint32(b[n+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(b[n+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(b[n])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// kafkaProducer produces records to the partitions of a topic, records are
+// partitioned by their keys and round robin without keys
+type kafkaProducer struct {
+	bootstrap  []string
+	topic      string
+	metadata   *kafkaMetadata
+	conns      map[int32]*kafkaConn
+	roundRobin int
+}
+
+// refresh fetches the metadata of the topic from the bootstrap brokers
+func (p *kafkaProducer) refresh() error {
+	req := binary.BigEndian.AppendUint32(nil, 1)
+	req = kafkaAppendString(req, p.topic)
+	req = append(req, 1) // allow auto topic creation
+
+	var err error
+	for _, address := range p.bootstrap {
+		var c *kafkaConn
+		c, err = dialKafka(address)
+		if err != nil {
+			continue
+		}
+		var resp []byte
+		resp, err = c.request(kafkaAPIMetadata, kafkaMetadataVersion,
+			req)
+		c.close()
+		if err != nil {
+			continue
+		}
+		var m *kafkaMetadata
+		m, err = parseKafkaMetadata(resp, p.topic)
+		if err != nil {
+			continue
+		}
+		p.metadata = m
+		return nil
+	}
+	return err
+}
+
+// partition returns the partition of the record r
+func (p *kafkaProducer) partition(r kafkaRecord) int32 {
+	n := len(p.metadata.leaders)
+	if r.key == nil {
+		p.roundRobin = (p.roundRobin + 1) % n
+		return int32(p.roundRobin)
+	}
+	return int32((kafkaMurmur2(r.key) & 0x7fffffff) % uint32(n))
+}
+
+// conn returns the connection to the broker with node ID id
+func (p *kafkaProducer) conn(id int32) (*kafkaConn, error) {
+	if c := p.conns[id]; c != nil {
+		return c, nil
+	}
+	address, ok := p.metadata.brokers[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown Kafka broker %d", id)
+	}
+	c, err := dialKafka(address)
+	if err != nil {
+		return nil, err
+	}
+	p.conns[id] = c
+	return c, nil
+}
+
+// produce sends the records to the leaders of their partitions, records of
+// failed partitions, e.g., after a leader change, are retried with refreshed
+// metadata
+func (p *kafkaProducer) produce(records []kafkaRecord) error {
+	var err error
+	for try := 0; len(records) > 0 && try <= kafkaRetries; try++ {
+		if try > 0 {
+			time.Sleep(kafkaRetryBackoff)
+		}
+		if p.metadata == nil {
+			if err = p.refresh(); err != nil {
+				continue
+			}
+		}
+		records, err = p.produceOnce(records)
+	}
+	return err
+}
+
+// produceOnce sends the records to the leaders of their partitions and
+// returns the records of failed partitions, after errors the connections are
+// closed and the metadata is refreshed before the next try
+func (p *kafkaProducer) produceOnce(records []kafkaRecord) ([]kafkaRecord,
+	error) {
+	// group records by leader and partition
+	leaders := make(map[int32]map[int32][]kafkaRecord)
+	for _, r := range records {
+		partition := p.partition(r)
+		leader := p.metadata.leaders[partition]
+		if leaders[leader] == nil {
+			leaders[leader] = make(map[int32][]kafkaRecord)
+		}
+		leaders[leader][partition] = append(
+			leaders[leader][partition], r)
+	}
+
+	// the other leaders still need the metadata to connect, so it is only
+	// cleared after all leaders
+	var failed []kafkaRecord
+	var err error
+	for leader, partitions := range leaders {
+		indexes, e := p.produceLeader(leader, partitions)
+		if e == nil {
+			continue
+		}
+		if c := p.conns[leader]; c != nil {
+			c.close()
+			delete(p.conns, leader)
+		}
+		err = e
+		for _, index := range indexes {
+			failed = append(failed, partitions[index]...)
+		}
+	}
+	if err != nil {
+		p.metadata = nil
+	}
+	return failed, err
+}
+
+// produceLeader sends the records of the partitions to their leader and
+// returns the failed partitions
+func (p *kafkaProducer) produceLeader(leader int32,
+	partitions map[int32][]kafkaRecord) ([]int32, error) {
+	indexes := make([]int32, 0, len(partitions))
+	for index := range partitions {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+	c, err := p.conn(leader)
+	if err != nil {
+		return indexes, err
+	}
+
+	req := binary.BigEndian.AppendUint16(nil, ^uint16(0)) // no txn ID
+	req = binary.BigEndian.AppendUint16(req, kafkaAcks)
+	req = binary.BigEndian.AppendUint32(req,
+		uint32(kafkaTimeout.Milliseconds()))
+	req = binary.BigEndian.AppendUint32(req, 1)
+	req = kafkaAppendString(req, p.topic)
+	req = binary.BigEndian.AppendUint32(req, uint32(len(indexes)))
+	for _, index := range indexes {
+		req = binary.BigEndian.AppendUint32(req, uint32(index))
+		req = kafkaAppendBytes(req,
+			kafkaRecordBatch(partitions[index]))
+	}
+	resp, err := c.request(kafkaAPIProduce, kafkaProduceVersion, req)
+	if err != nil {
+		return indexes, err
+	}
+	return parseKafkaProduce(resp)
+}
+
+// close closes all broker connections
+func (p *kafkaProducer) close() {
+	for id, c := range p.conns {
+		c.close()
+		delete(p.conns, id)
+	}
+}
+
+// run produces the queued records in batches until the queue is closed
+func (p *kafkaProducer) run(records <-chan kafkaRecord, done chan<- struct{}) {
+	defer close(done)
+	defer p.close()
+
+	ticker := time.NewTicker(kafkaLinger)
+	defer ticker.Stop()
+	var batch []kafkaRecord
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.produce(batch); err != nil {
+			log.Printf("Error producing %d records to Kafka: %v",
+				len(batch), err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= kafkaBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// kafkaPeerPair returns the peer pair of the event e as record key: the
+// addresses of both peers in sorted order, so both directions of a connection
+// share a partition, nil if the event has no peers
+func kafkaPeerPair(e *event) []byte {
+	var a, b string
+	switch e.typ {
+	case eventMessage, eventFallback, eventOverflow, eventError:
+		a, b = e.net.Src().String(), e.net.Dst().String()
+	case eventHandshake:
+		a, b = e.result.key.net.Src().String(),
+			e.result.key.net.Dst().String()
+	case eventAlert:
+		if e.reason == alertBudget {
+			return []byte(e.alert.client)
+		}
+		if endpointAddr(e.net.Src()) == "" {
+			return nil
+		}
+		a, b = e.net.Src().String(), e.net.Dst().String()
+	default:
+		return nil
+	}
+	if b < a {
+		a, b = b, a
+	}
+	return []byte(a + "-" + b)
+}
+
+// kafkaSink renders the event types selected on the command line as JSON or
+// protobuf records to a Kafka topic, records are queued and produced in
+// batches in the background and dropped if the queue is full
+type kafkaSink struct {
+	lock    sync.Mutex
+	format  string
+	records chan kafkaRecord
+	done    chan struct{}
+	dropped uint64
+}
+
+// init initializes the Kafka sink with the comma-separated bootstrap
+// brokers, the topic, and the format and starts the producer
+func (k *kafkaSink) init(brokers, topic, format string) error {
+	if format != kafkaJSON && format != kafkaProtobuf {
+		return fmt.Errorf("unknown Kafka format %q", format)
+	}
+	if topic == "" {
+		return fmt.Errorf("Kafka output requires a topic")
+	}
+	p := &kafkaProducer{
+		topic: topic,
+		conns: make(map[int32]*kafkaConn),
+	}
+	for _, b := range strings.Split(brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			p.bootstrap = append(p.bootstrap, b)
+		}
+	}
+	if len(p.bootstrap) == 0 {
+		return fmt.Errorf("Kafka output requires brokers")
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.format = format
+	k.records = make(chan kafkaRecord, kafkaQueueLen)
+	k.done = make(chan struct{})
+	go p.run(k.records, k.done)
+	return nil
+}
+
+// close produces the remaining records and stops the producer
+func (k *kafkaSink) close() {
+	k.lock.Lock()
+	records, done := k.records, k.done
+	k.records = nil
+	if k.dropped > 0 {
+		log.Printf("Kafka output dropped %d records", k.dropped)
+	}
+	k.lock.Unlock()
+
+	if records == nil {
+		return
+	}
+	close(records)
+	<-done
+}
+
+// accepts checks if the Kafka sink renders events of type typ
+func (k *kafkaSink) accepts(typ string) bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.records == nil || !jsonEvents.types[typ] {
+		return false
+	}
+	return k.format == kafkaJSON || typ == eventMessage ||
+		typ == eventHandshake
+}
+
+// render renders the event e as record and queues it for the producer
+func (k *kafkaSink) render(e *event) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.records == nil {
+		return
+	}
+
+	r := kafkaRecord{key: kafkaPeerPair(e), time: e.time}
+	switch {
+	case k.format == kafkaProtobuf && e.typ == eventMessage:
+		r.value = protoMessageEvent(e.time, e.net, e.trans, e.msg,
+			e.session, e.warnings)
+	case k.format == kafkaProtobuf && e.typ == eventHandshake:
+		r.value = protoHandshakeEvent(e.time, e.result)
+	case k.format == kafkaJSON:
+		v := jsonEvent(e)
+		if v == nil {
+			return
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			log.Println("Error encoding Kafka record:", err)
+			return
+		}
+		r.value = b
+	default:
+		return
+	}
+	select {
+	case k.records <- r:
+	default:
+		k.dropped++
+	}
+}
+
+// setKafkaOutput sets the Kafka output according to the Kafka command line
+// arguments, the returned function produces the remaining records and stops
+// the producer
+func setKafkaOutput() func() {
+	if *kafkaBrokers == "" {
+		return func() {}
+	}
+	err := kafkaEvents.init(*kafkaBrokers, *kafkaTopic, *kafkaFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return kafkaEvents.close
+}
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// kafkaTestRecords decodes the record batch b and returns the keys and values
+// of its records
+func kafkaTestRecords(t *testing.T, b []byte) (keys, values []string) {
+	d := &kafkaDecoder{buf: b}
+	d.int64() // base offset
+	if n := d.int32(); int(n) != len(d.buf) {
+		t.Fatalf("batch length = %d; want %d", n, len(d.buf))
+	}
+	d.int32() // partition leader epoch
+	if magic := d.int8(); magic != 2 {
+		t.Fatalf("magic = %d; want 2", magic)
+	}
+	crc := uint32(d.int32())
+	if c := crc32.Checksum(d.buf, kafkaCRCTable); c != crc {
+		t.Fatalf("crc = %#x; want %#x", crc, c)
+	}
+	d.next(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	varint := func() int64 {
+		v, n := binary.Varint(d.buf)
+		d.next(n)
+		return v
+	}
+	for n := d.int32(); n > 0; n-- {
+		varint() // length
+		d.int8() // attributes
+		varint() // timestamp delta
+		varint() // offset delta
+		keys = append(keys, string(d.next(int(max(varint(), 0)))))
+		values = append(values, string(d.next(int(varint()))))
+		varint() // headers
+	}
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	return keys, values
+}
+
+// kafkaTestMetadata returns the metadata response of a broker at host and
+// port with two partitions of topic
+func kafkaTestMetadata(host string, port int, topic string) []byte {
+	u16 := binary.BigEndian.AppendUint16
+	u32 := binary.BigEndian.AppendUint32
+	resp := u32(nil, 0)                  // throttle time
+	resp = u32(resp, 1)                  // brokers
+	resp = u32(resp, 1)                  // node ID
+	resp = kafkaAppendString(resp, host) // host
+	resp = u32(resp, uint32(port))       // port
+	resp = u16(resp, ^uint16(0))         // rack
+	resp = kafkaAppendString(resp, "c")  // cluster ID
+	resp = u32(resp, 1)                  // controller ID
+	resp = u32(resp, 1)                  // topics
+	resp = u16(resp, 0)                  // error code
+	resp = kafkaAppendString(resp, topic)
+	resp = append(resp, 0) // is internal
+	resp = u32(resp, 2)    // partitions
+	for i := 0; i < 2; i++ {
+		resp = u16(resp, 0)         // error code
+		resp = u32(resp, uint32(i)) // partition
+		resp = u32(resp, 1)         // leader
+		resp = u32(resp, 0)         // replicas
+		resp = u32(resp, 0)         // in-sync replicas
+	}
+	return resp
+}
+
+// kafkaTestProduce returns the produce response to the produce request in d
+// and sends the produced record batches to batches, while failures is
+// positive partitions fail without leader
+func kafkaTestProduce(d *kafkaDecoder, batches chan<- []byte,
+	failures *atomic.Int32) []byte {
+	u32 := binary.BigEndian.AppendUint32
+	d.string() // transactional ID
+	d.int16()  // acks
+	d.int32()  // timeout
+	d.int32()  // topics
+	topic := d.string()
+	n := d.int32()
+	resp := u32(nil, 1)
+	resp = kafkaAppendString(resp, topic)
+	resp = u32(resp, uint32(n))
+	for ; n > 0; n-- {
+		resp = u32(resp, uint32(d.int32()))
+		batch := d.next(int(d.int32()))
+		if failures.Add(-1) >= 0 {
+			resp = binary.BigEndian.AppendUint16(resp,
+				kafkaErrLeaderNotAvail)
+			resp = append(resp, make([]byte, 8+8)...)
+			continue
+		}
+		batches <- batch
+		resp = append(resp, make([]byte, 2+8+8)...)
+	}
+	return u32(resp, 0)
+}
+
+// kafkaTestServe serves metadata with two partitions of topic and produce
+// requests on the broker connection conn, the first failures partitions in
+// produce requests fail
+func kafkaTestServe(conn net.Conn, topic string, batches chan<- []byte,
+	failures *atomic.Int32) {
+	defer conn.Close()
+	host, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	p, _ := strconv.Atoi(port)
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &kafkaDecoder{buf: req}
+		key := d.int16()
+		d.int16() // version
+		resp := binary.BigEndian.AppendUint32(nil, uint32(d.int32()))
+		d.string() // client ID
+		switch key {
+		case kafkaAPIMetadata:
+			m := kafkaTestMetadata(host, p, topic)
+			resp = append(resp, m...)
+		case kafkaAPIProduce:
+			resp = append(resp, kafkaTestProduce(d, batches,
+				failures)...)
+		}
+		conn.Write(kafkaAppendBytes(nil, resp))
+	}
+}
+
+func TestKafkaRecordBatch(t *testing.T) {
+	ts := time.UnixMilli(1000)
+	batch := kafkaRecordBatch([]kafkaRecord{
+		{key: []byte("a"), value: []byte("first"), time: ts},
+		{value: []byte("second"), time: ts.Add(time.Second)},
+	})
+	keys, values := kafkaTestRecords(t, batch)
+	if strings.Join(keys, ",") != "a," ||
+		strings.Join(values, ",") != "first,second" {
+		t.Errorf("got = %q, %q; want [a ], [first second]", keys,
+			values)
+	}
+}
+
+func TestKafkaMurmur2(t *testing.T) {
+	// hashes of the Kafka Java client
+	for key, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		if got := int32(kafkaMurmur2([]byte(key))); got != want {
+			t.Errorf("kafkaMurmur2(%q) = %d; want %d", key, got,
+				want)
+		}
+	}
+}
+
+func TestKafkaProducerFailedBroker(t *testing.T) {
+	// broker 1 is unreachable, broker 2 serves produce requests
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	down.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+	batches := make(chan []byte, 10)
+	var failures atomic.Int32
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go kafkaTestServe(conn, "smc-clc", batches, &failures)
+		}
+	}()
+
+	// the order of the leaders is random, so produce several times
+	p := &kafkaProducer{
+		topic: "smc-clc",
+		conns: make(map[int32]*kafkaConn),
+	}
+	defer p.close()
+	for i := 0; i < 5; i++ {
+		p.metadata = &kafkaMetadata{
+			brokers: map[int32]string{
+				1: down.Addr().String(),
+				2: l.Addr().String(),
+			},
+			leaders: []int32{1, 2},
+		}
+		records := []kafkaRecord{
+			{value: []byte("a"), time: time.Now()},
+			{value: []byte("b"), time: time.Now()},
+		}
+		failed, err := p.produceOnce(records)
+		if err == nil || len(failed) != 1 {
+			t.Fatalf("got %d failed records, %v; want 1, error",
+				len(failed), err)
+		}
+		if p.metadata != nil {
+			t.Error("metadata not cleared after failure")
+		}
+		<-batches
+	}
+}
+
+func TestKafkaSink(t *testing.T) {
+	types := jsonEvents.types
+	jsonEvents.types = map[string]bool{eventHandshake: true}
+	defer func() { jsonEvents.types = types }()
+
+	// check invalid arguments
+	var k kafkaSink
+	if err := k.init("127.0.0.1:9092", "smc-clc", "xml"); err == nil {
+		t.Error("init() with unknown format succeeded")
+	}
+	if err := k.init(" ", "smc-clc", "json"); err == nil {
+		t.Error("init() without brokers succeeded")
+	}
+
+	// start broker and sink
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+	batches := make(chan []byte, 10)
+	var failures atomic.Int32
+	failures.Store(1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go kafkaTestServe(conn, "smc-clc", batches, &failures)
+		}
+	}()
+	if err := k.init(l.Addr().String(), "smc-clc", "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	// render handshake event and produce it
+	if k.accepts(eventMessage) {
+		t.Error("k.accepts(message) = true; want false")
+	}
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(5,
+		6, 7, 8)), layers.NewIPEndpoint(net.IPv4(1, 2, 3, 4)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	k.render(&event{typ: eventHandshake, time: time.Now(),
+		result: &handshakeResult{id: 1, key: handshakeKey{net, trans}}})
+	k.close()
+
+	// check record with peer pair key, produced again after the
+	// partition failed without leader
+	keys, values := kafkaTestRecords(t, <-batches)
+	if len(keys) != 1 || keys[0] != "1.2.3.4-5.6.7.8" ||
+		!strings.Contains(values[0], `"type":"handshake"`) {
+		t.Errorf("got = %q, %q; want handshake of 1.2.3.4-5.6.7.8",
+			keys, values)
+	}
+}
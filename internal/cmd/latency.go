@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyHeatmapSlots is the number of one minute time slots in the
+	// latency heatmap
+	latencyHeatmapSlots = 60
+)
+
+var (
+	// latencies stores the latency heatmap
+	latencies latencyHeatmap
+)
+
+// latencySlot stores the latency histograms of one minute
+type latencySlot struct {
+	min            int64
+	proposalAccept []uint64
+	total          []uint64
+}
+
+// latencyHeatmap stores the histograms of proposal to accept and total
+// handshake latencies in one minute time slots protected by a mutex
+type latencyHeatmap struct {
+	lock   sync.Mutex
+	bounds []time.Duration
+	slots  [latencyHeatmapSlots]latencySlot
+	last   int64
+}
+
+// init initializes the latency heatmap with the histogram bucket upper bounds
+// in spec
+func (lh *latencyHeatmap) init(spec string) error {
+	bounds, err := parseBuckets(spec)
+	if err != nil {
+		return err
+	}
+
+	lh.lock.Lock()
+	lh.bounds = bounds
+	lh.slots = [latencyHeatmapSlots]latencySlot{}
+	lh.last = 0
+	lh.lock.Unlock()
+	return nil
+}
+
+// bucket returns the index of the histogram bucket of latency d, lh must be
+// locked
+func (lh *latencyHeatmap) bucket(d time.Duration) int {
+	return sort.Search(len(lh.bounds), func(i int) bool {
+		return d <= lh.bounds[i]
+	})
+}
+
+// add adds the latencies of handshake r finished at time t to the latency
+// heatmap, a zero t is the current time
+func (lh *latencyHeatmap) add(t time.Time, r *handshakeResult) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	min := t.Unix() / 60
+
+	lh.lock.Lock()
+	defer lh.lock.Unlock()
+
+	if lh.bounds == nil || min < 0 {
+		return
+	}
+	s := &lh.slots[min%latencyHeatmapSlots]
+	if s.min != min || s.total == nil {
+		*s = latencySlot{
+			min:            min,
+			proposalAccept: make([]uint64, len(lh.bounds)+1),
+			total:          make([]uint64, len(lh.bounds)+1),
+		}
+	}
+	if min > lh.last {
+		lh.last = min
+	}
+	if r.accepted {
+		s.proposalAccept[lh.bucket(r.proposalAccept)]++
+	}
+	s.total[lh.bucket(r.total)]++
+}
+
+// apiLatencySlot is a time slot of the latency heatmap in the http api
+type apiLatencySlot struct {
+	Time           time.Time `json:"time"`
+	ProposalAccept []uint64  `json:"proposal_accept"`
+	Total          []uint64  `json:"total"`
+}
+
+// apiLatencies is the latency heatmap in the http api
+type apiLatencies struct {
+	Buckets []string         `json:"buckets"`
+	Slots   []apiLatencySlot `json:"slots"`
+}
+
+// get returns the latency heatmap of the last hour ordered by time
+func (lh *latencyHeatmap) get() *apiLatencies {
+	lh.lock.Lock()
+	defer lh.lock.Unlock()
+
+	l := &apiLatencies{Slots: []apiLatencySlot{}}
+	for _, b := range lh.bounds {
+		l.Buckets = append(l.Buckets, fmt.Sprint(b.Seconds()))
+	}
+	l.Buckets = append(l.Buckets, "+Inf")
+	for _, s := range lh.slots {
+		if s.total == nil || s.min <= lh.last-latencyHeatmapSlots {
+			continue
+		}
+		l.Slots = append(l.Slots, apiLatencySlot{
+			Time:           time.Unix(s.min*60, 0).UTC(),
+			ProposalAccept: append([]uint64{}, s.proposalAccept...),
+			Total:          append([]uint64{}, s.total...),
+		})
+	}
+	sort.Slice(l.Slots, func(i, j int) bool {
+		return l.Slots[i].Time.Before(l.Slots[j].Time)
+	})
+	return l
+}
+
+// handleLatencies handles http requests for the latency heatmap
+func handleLatencies(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(latencies.get()); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// registerLatencyAPI registers the latency heatmap http api
+func registerLatencyAPI() {
+	http.HandleFunc("/api/v1/latency", handleLatencies)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyHeatmap(t *testing.T) {
+	// add handshakes in two time slots and one expired time slot
+	if err := latencies.init("1ms,10ms"); err != nil {
+		log.Fatal(err)
+	}
+	start := time.Unix(3600, 0)
+	accepted := &handshakeResult{
+		accepted:       true,
+		proposalAccept: 2 * time.Millisecond,
+		total:          3 * time.Millisecond,
+	}
+	declined := &handshakeResult{total: time.Millisecond}
+	latencies.add(start.Add(-time.Hour), accepted)
+	latencies.add(start, accepted)
+	latencies.add(start.Add(30*time.Second), declined)
+	latencies.add(start.Add(time.Minute), accepted)
+
+	// test http api
+	w := httptest.NewRecorder()
+	handleLatencies(w, httptest.NewRequest("GET", "/api/v1/latency", nil))
+	var got apiLatencies
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		log.Fatal(err)
+	}
+	want := apiLatencies{
+		Buckets: []string{"0.001", "0.01", "+Inf"},
+		Slots: []apiLatencySlot{
+			{
+				Time:           start.UTC(),
+				ProposalAccept: []uint64{0, 1, 0},
+				Total:          []uint64{1, 1, 0},
+			},
+			{
+				Time:           start.Add(time.Minute).UTC(),
+				ProposalAccept: []uint64{0, 1, 0},
+				Total:          []uint64{0, 1, 0},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
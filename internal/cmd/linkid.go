@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// smcdLinks stores the SMC-D link ID table
+	smcdLinks smcdLinkTable
+)
+
+// smcdLinkKey identifies an SMC-D link by the ISM GID and the link ID
+type smcdLinkKey struct {
+	gid    uint64
+	linkID uint32
+}
+
+// smcdLinkParams are the parameters of an SMC-D link: the ISM GID of the
+// peer, the SMC version, and the ISMv2 VCHID
+type smcdLinkParams struct {
+	peer    uint64
+	version uint8
+	vchid   uint16
+}
+
+// String converts the SMC-D link parameters to a string
+func (p smcdLinkParams) String() string {
+	return fmt.Sprintf("Peer GID: %d, Version: %d, VCHID: %d", p.peer,
+		p.version, p.vchid)
+}
+
+// smcdLinkTable stores the parameters of the SMC-D link IDs seen per ISM
+// GID protected by a mutex
+type smcdLinkTable struct {
+	lock  sync.Mutex
+	links map[smcdLinkKey]smcdLinkParams
+}
+
+// init initializes the SMC-D link ID table
+func (lt *smcdLinkTable) init() {
+	lt.lock.Lock()
+	if lt.links == nil {
+		lt.links = make(map[smcdLinkKey]smcdLinkParams)
+	}
+	lt.lock.Unlock()
+}
+
+// add adds the SMC-D link of server and client of the finished handshake r
+// to the SMC-D link ID table and returns a warning for each side that reused
+// the link ID with different parameters
+func (lt *smcdLinkTable) add(r *handshakeResult) []string {
+	if !r.confirmed || !r.smcdLink {
+		return nil
+	}
+
+	lt.lock.Lock()
+	defer lt.lock.Unlock()
+
+	if lt.links == nil {
+		return nil
+	}
+	var warnings []string
+	for _, gids := range [][2]uint64{
+		{r.serverGID, r.clientGID},
+		{r.clientGID, r.serverGID},
+	} {
+		key := smcdLinkKey{gids[0], r.linkID}
+		params := smcdLinkParams{gids[1], r.version, r.vchid}
+		previous, ok := lt.links[key]
+		lt.links[key] = params
+		if !ok || previous == params {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("GID %d Link ID %d: "+
+			"%s instead of %s", key.gid, key.linkID, params,
+			previous))
+	}
+	return warnings
+}
+
+// messageSMCDLink returns the sender ISM GID, the link ID, and the ISMv2
+// VCHID of the SMC-D accept or confirm message msg and if msg is one
+func messageSMCDLink(msg clc.Message) (uint64, uint32, uint16, bool) {
+	switch m := msg.(type) {
+	case *clc.AcceptSMCD:
+		return m.GID, m.LinkID, 0, true
+	case *clc.ConfirmSMCD:
+		return m.GID, m.LinkID, 0, true
+	case *clc.AcceptSMCDv2:
+		return m.GID, m.LinkID, m.ISMv2VCHID, true
+	case *clc.ConfirmSMCDv2:
+		return m.GID, m.LinkID, m.ISMv2VCHID, true
+	}
+	return 0, 0, 0, false
+}
+
+// printLinkReuse prints the SMC-D link ID reuse warning of the finished
+// handshake of the network flow net and the transport flow trans
+func printLinkReuse(net, trans gopacket.Flow, warning string) {
+	reuseFmt := "%s%s -> %s: SMC-D Link ID Reuse: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, reuseFmt, t, hostString(net.Src(), trans.Src()),
+		hostString(net.Dst(), trans.Dst()), warning)
+}
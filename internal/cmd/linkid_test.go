@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSMCDLinkTable(t *testing.T) {
+	var lt smcdLinkTable
+
+	// test link of SMC-D accept message
+	accept := testHandshakeMessage("e2d4c3c402003011" +
+		"0000000000000001" + "0000000000000002" + "01000000" +
+		"00000005" + "000000000000000000000000" + "e2d4c3c4")
+	gid, link, vchid, ok := messageSMCDLink(accept)
+	if gid != 1 || link != 5 || vchid != 0 || !ok {
+		t.Errorf("got = %d, %d, %d, %t; want 1, 5, 0, true", gid, link,
+			vchid, ok)
+	}
+
+	// add handshakes with same and different parameters
+	lt.init()
+	r := &handshakeResult{confirmed: true, smcdLink: true, version: 1,
+		serverGID: 1, clientGID: 2, linkID: 5}
+	if got := lt.add(r); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+	if got := lt.add(r); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+	r.clientGID = 3
+	want := []string{
+		"GID 1 Link ID 5: Peer GID: 3, Version: 1, VCHID: 0 instead " +
+			"of Peer GID: 2, Version: 1, VCHID: 0",
+	}
+	if got := lt.add(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test declined handshake
+	if got := lt.add(&handshakeResult{smcdLink: true}); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+}
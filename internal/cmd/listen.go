@@ -6,19 +6,53 @@ import (
 	"time"
 
 	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/ip4defrag"
 	"github.com/gopacket/gopacket/layers"
 	"github.com/gopacket/gopacket/tcpassembly"
 
 	"github.com/hwipl/packet-go/pkg/pcap"
-	"github.com/hwipl/smc-go/pkg/clc"
 )
 
 type handler struct {
 	assembler *tcpassembly.Assembler
+	lastFlush time.Time
+
+	// timer drives the timer events from packet timestamps when
+	// replaying pcap files
+	timer *clockTicker
+
+	// defrag reassembles fragmented IPv4 packets
+	defrag *ip4defrag.IPv4Defragmenter
 }
 
 // handlePacket handles a packet
 func (h *handler) HandlePacket(packet gopacket.Packet) {
+	// skip duplicate loopback packets captured on the any pseudo-device
+	if cookedDuplicate(packet) {
+		return
+	}
+
+	runTotals.addPacket()
+	quality.addPacket(packet.Metadata(), time.Now())
+
+	// advance the clock to the packet when replaying pcap files and
+	// handle timer events that are due
+	clock.advance(packet.Metadata().Timestamp)
+	if h.timer != nil {
+		select {
+		case <-h.timer.C:
+			h.HandleTimer()
+		default:
+		}
+	}
+
+	// reassemble fragmented IPv4 packets, wait for missing fragments
+	if h.defrag != nil {
+		if packet = defragPacket(h.defrag, packet); packet == nil {
+			return
+		}
+	}
+
 	// only handle tcp packets (with valid network layer)
 	if packet.NetworkLayer() == nil ||
 		packet.TransportLayer() == nil ||
@@ -31,26 +65,235 @@ func (h *handler) HandlePacket(packet gopacket.Packet) {
 		log.Fatal("Error parsing TCP packet")
 	}
 
+	// skip duplicate packets of mirrored traffic
+	if dedups.duplicate(packet, tcp) {
+		return
+	}
+
 	// if smc option is set, try to parse tcp stream
 	nflow := packet.NetworkLayer().NetworkFlow()
 	tflow := packet.TransportLayer().TransportFlow()
-	if clc.CheckSMCOption(tcp) || flows.get(nflow, tflow) {
-		flows.add(nflow, tflow)
+	smcOption := checkSMCOption(tcp)
+
+	// in learning mode, handle all connections with experimental options
+	// and remember their ExIDs
+	learning := false
+	if *learnExIDs && tcp.SYN {
+		if ids := tcpExIDs(tcp); len(ids) > 0 {
+			exids.addPending(nflow, tflow, ids)
+			learning = true
+		}
+	}
+
+	// count smc connection attempts for churn detection
+	if *churnThreshold > 0 && smcOption && tcp.SYN && !tcp.ACK {
+		if churn.add(nflow, tflow, packet.Metadata().Timestamp) {
+			emit(churnAlert(nflow, tflow))
+		}
+	}
+
+	// count smc connection attempts for rate anomaly detection
+	if *anomalyFactor > 0 && smcOption && tcp.SYN && !tcp.ACK {
+		for _, a := range anomalies.add(nflow,
+			packet.Metadata().Timestamp) {
+			emit(&event{typ: eventAlert, reason: alertAnomaly,
+				text: a})
+		}
+	}
+
+	// count smc connection attempts for attempt budget alerts
+	if smcOption && tcp.SYN && !tcp.ACK && budgets.enabled() {
+		if a := budgets.add(nflow.Src(),
+			packet.Metadata().Timestamp); a != nil {
+			emit(&event{typ: eventAlert, reason: alertBudget,
+				alert: a})
+		}
+	}
+
+	// check if server set smc option in SYN-ACK for fallback detection
+	// and check its tcp options
+	if tcp.SYN && tcp.ACK && fallbacks.addSYNACK(nflow, tflow, smcOption) {
+		quality.addSYNACK()
+		emitSYNOptionWarnings(nflow, tflow, tcp, smcOption)
+	}
+
+	if (smcOption || learning || flows.get(nflow, tflow)) &&
+		sampled(nflow, tflow) && h.track(nflow, tflow) {
+		// count handshake attempts, track them for fallback
+		// detection, and check their tcp options
+		vlans.seen(nflow, tflow, packet)
+		if smcOption && tcp.SYN && !tcp.ACK &&
+			fallbacks.addSYN(nflow, tflow) {
+			stats.addAttempt()
+			vlans.addAttempt(nflow, tflow)
+			quality.addSYN()
+			emitSYNOptionWarnings(nflow, tflow, tcp, smcOption)
+		}
+		if extractMode {
+			extracts.write(packet, nflow, tflow,
+				tcp.SYN && !tcp.ACK)
+		}
+		checkTruncation(nflow, tflow, packet)
+		if *writeFile != "" {
+			pcapWrites.write(packet)
+		}
+		pcapDownloads.write(packet, nflow, tflow, tcp.SYN && !tcp.ACK)
+		flowStates.seen(nflow, tflow, tcp, clock.now())
 		h.assembler.AssembleWithTimestamp(nflow, tcp,
 			packet.Metadata().Timestamp)
 	}
+
+	// close connections that exceeded the flush age of their flow state,
+	// at most once per second
+	if now := clock.now(); now.Sub(h.lastFlush) >= time.Second {
+		flushStates(h.assembler, now)
+		h.lastFlush = now
+	}
+}
+
+// track adds the flow identified by the network flow net and the transport
+// flow trans to the flow table and returns if the flow is tracked. It closes
+// the connection of the flow evicted from the flow table, if any
+func (h *handler) track(net, trans gopacket.Flow) bool {
+	ok, evicted := flows.add(net, trans)
+	if !ok {
+		emit(&event{typ: eventOverflow, net: net, trans: trans,
+			reason: "rejected"})
+		return false
+	}
+	if evicted != nil {
+		now := clock.now()
+		for _, fin := range flowStates.evict(evicted.net,
+			evicted.trans) {
+			h.assembler.AssembleWithTimestamp(fin.net, fin.tcp, now)
+		}
+		emit(&event{typ: eventOverflow, net: evicted.net,
+			trans: evicted.trans, reason: "evicted"})
+	}
+	return true
 }
 
 // handleTimer handles a timer event
 func (h *handler) HandleTimer() {
 	flushedFmt := "Timer: flushed %d, closed %d connections\n"
 
-	// flush connections without activity in the past minute
-	flushed, closed := h.assembler.FlushOlderThan(time.Now().Add(
-		-time.Minute))
+	// close connections that exceeded the flush age of their flow state
+	// and flush connections without activity for the maximum flush age
+	now := clock.now()
+	flushStates(h.assembler, now)
+	h.lastFlush = now
+	flushed, closed := h.assembler.FlushOlderThan(now.Add(-maxFlushAge()))
 	if flushed > 0 {
 		fmt.Fprintf(stdout, flushedFmt, flushed, closed)
 	}
+
+	// warn about truncated packets of all monitored flows again
+	truncations.reset()
+
+	// discard incomplete fragmented IPv4 packets
+	if h.defrag != nil {
+		h.defrag.DiscardOlderThan(now.Add(-defragTimeout))
+	}
+
+	// print connection churn summary
+	if *churnThreshold > 0 {
+		emitChurnSummary()
+	}
+
+	// check for handshake rate anomalies without packets when capturing
+	// live on a network interface
+	if *anomalyFactor > 0 && len(*pcapFiles) == 0 && *pcapDir == "" {
+		for _, a := range anomalies.tick(time.Now()) {
+			emit(&event{typ: eventAlert, reason: alertAnomaly,
+				text: a})
+		}
+	}
+
+	// emit heartbeat with run totals
+	emit(&event{typ: eventHeartbeat, totals: runTotals.counts()})
+
+	// remove clients with ended attempt budget windows
+	budgets.expire(now)
+
+	// reload rules if rules file changed
+	rules.reload()
+
+	// write packets queued for comments to pcapng files
+	flushPcapExports()
+
+	// write buffered handshake records to Avro file
+	avroEvents.flush()
+
+	// update pcap drop statistics for capture quality and report new
+	// drops
+	updateDrops()
+	printDrops()
+}
+
+// listenFile reads packets from the pcap file, a passed file descriptor, a
+// remote host, or the network interface if file is empty and handles them
+// with handler. When replaying pcap files, the handler drives the timer from
+// packet timestamps
+func listenFile(handler *handler, file string) {
+	if file == "" && *pcapFD < 0 && *pcapUnix == "" &&
+		*remoteHost == "" {
+		switch {
+		case *captureXDP && len(*pcapDevices) == 0:
+			log.Fatal("AF_XDP capture requires a network " +
+				"interface (-i)")
+		case *captureXDP:
+			listenXDP(handler, *pcapDevices)
+			return
+		case len(*pcapDevices) > 1:
+			listenDevices(handler, *pcapDevices)
+			return
+		}
+	}
+	timer := time.Minute
+	if handler.timer != nil {
+		timer = 0
+	}
+	device := ""
+	if len(*pcapDevices) > 0 {
+		device = (*pcapDevices)[0]
+	}
+
+	// create listener
+	listener := pcap.Listener{
+		PacketHandler: handler,
+		TimerHandler:  handler,
+		Timer:         timer,
+		File:          file,
+		Device:        device,
+		Promisc:       devicePromisc(device),
+		Snaplen:       *pcapSnaplen,
+		Timeout:       time.Duration(*pcapTimeout) * time.Millisecond,
+		Filter:        *getSettings().Filter,
+		MaxPkts:       *pcapMaxPkts,
+		MaxTime:       time.Duration(*pcapMaxTime) * time.Second,
+	}
+
+	// start listen loop
+	switch {
+	case *pcapFD >= 0 || *pcapUnix != "":
+		prepareFD(&listener)
+	case file == "" && *remoteHost != "":
+		stopRemote := prepareRemote(&listener)
+		defer stopRemote()
+	default:
+		prepareListener(&listener)
+	}
+	setListeners(&listener)
+	if interrupted.Load() {
+		stopListener()
+	}
+	listener.Loop()
+	setListeners()
+
+	// restart the live capture with the raised snaplen
+	if snaplenRaised.Swap(false) && !interrupted.Load() {
+		listenFile(handler, file)
+	}
 }
 
 // listen listens on the network interface and parses packets
@@ -60,29 +303,222 @@ func listen() {
 	streamPool := tcpassembly.NewStreamPool(streamFactory)
 	assembler := tcpassembly.NewAssembler(streamPool)
 
-	// init flow table
+	// init flow, dedup, churn, anomaly, handshake, fallback, smart
+	// sampling, decline, consecutive declines, path selection, hostname,
+	// and ExID tables, the duration histogram, the latency heatmap, the
+	// extract table in extract mode, the research table in research mode,
+	// the event log table, the error corpus, and the report table in stats
+	// mode
 	flows.init()
+	if err := flows.setLimit(*maxFlows, *flowOverflow); err != nil {
+		log.Fatal(err)
+	}
+	dedups.init(*dedupWindow)
+	churn.init()
+	if err := budgets.init(*attemptBudgets); err != nil {
+		log.Fatal(err)
+	}
+	anomalies.init()
+	handshakes.init()
+	fallbacks.init()
+	smartSamples.init()
+	declines.init()
+	declineLoops.init()
+	pathSelections.init()
+	hostnames.init()
+	peerIDs.init()
+	inventory.init()
+	bufferSizes.init()
+	flowStates.init()
+	smcdLinks.init()
+	qps.init()
+	vlans.init()
+	if statsMode {
+		report.init()
+	}
+	if err := exids.init(*smcExIDs); err != nil {
+		log.Fatal(err)
+	}
+	if err := durations.init(*durationBuckets); err != nil {
+		log.Fatal(err)
+	}
+	if err := latencies.init(*durationBuckets); err != nil {
+		log.Fatal(err)
+	}
+	if extractMode {
+		if err := extracts.init(*extractFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *writeFile != "" {
+		err := pcapWrites.init(*writeFile,
+			int64(*writeFileSize)*1000000, *writeFileCount)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *researchFile != "" {
+		if err := research.init(*researchFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *eventLogFile != "" {
+		if err := eventLogs.init(*eventLogFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *errorCorpusDir != "" {
+		err := corpus.init(*errorCorpusDir, *errorCorpusSize)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// load rules
+	if *rulesFile != "" {
+		if err := rules.load(*rulesFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// use packet timestamps as clock when replaying pcap files
+	replay := !demoMode && !selftestMode && !replayMode &&
+		(len(*pcapFiles) > 0 || *pcapDir != "")
+	if err := clock.init(replay, *replaySpeed); err != nil {
+		log.Fatal(err)
+	}
 
 	// create handler
 	var handler handler
 	handler.assembler = assembler
+	if *ipDefrag {
+		handler.defrag = ip4defrag.NewIPv4Defragmenter()
+	}
+	if replay {
+		handler.timer = clock.newTicker(time.Minute)
+		defer clock.stopTicker(handler.timer)
+	}
 
-	// create listener
-	listener := pcap.Listener{
-		PacketHandler: &handler,
-		TimerHandler:  &handler,
-		Timer:         time.Minute,
-		File:          *pcapFile,
-		Device:        *pcapDevice,
-		Promisc:       *pcapPromisc,
-		Snaplen:       *pcapSnaplen,
-		Timeout:       time.Duration(*pcapTimeout) * time.Millisecond,
-		Filter:        *pcapFilter,
-		MaxPkts:       *pcapMaxPkts,
-		MaxTime:       time.Duration(*pcapMaxTime) * time.Second,
+	// show handshake statistics periodically
+	stopStats := func() {}
+	if *statsInterval > 0 {
+		stopStats = startStatsInterval(time.Duration(*statsInterval) *
+			time.Second)
 	}
 
-	// start listen loop
-	listener.Prepare()
-	listener.Loop()
+	// show header of table output
+	if *showTable && !*showSummary && textOutput {
+		printTableHeader()
+	}
+
+	// read packets from demo sessions, pcap directory, pcap files or
+	// network interface
+	switch {
+	case demoMode:
+		listenDemo(&handler)
+	case replayMode:
+		listenEventLog(replayFile)
+	case selftestMode:
+		listenSelftest(&handler)
+	case *pcapDir != "":
+		listenDir(&handler)
+	case len(*pcapFiles) > 0:
+		listenFiles(&handler, *pcapFiles)
+	default:
+		listenFile(&handler, "")
+	}
+	stopStats()
+
+	// finish all connections, so the summaries, reports, and outputs
+	// below include them
+	assembler.FlushAll()
+	streams.Wait()
+
+	// dump internal state for debugging
+	if *dumpState {
+		writeState(stdout)
+	}
+
+	// in stats mode, print the report
+	if statsMode {
+		writeReport(stdout)
+		if *baselineFile != "" {
+			err := writeBaselineComparison(stdout, *baselineFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *saveBaselineFile != "" {
+			if err := saveBaseline(*saveBaselineFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if extractMode {
+		extracts.close()
+	}
+	if *writeFile != "" {
+		n := pcapWrites.close()
+		log.Printf("Wrote %d packets to %s", n, *writeFile)
+	}
+	if *researchFile != "" {
+		research.close()
+	}
+	if *eventLogFile != "" {
+		n := eventLogs.close()
+		log.Printf("Wrote %d messages to %s", n, *eventLogFile)
+	}
+	if selftestMode {
+		checkSelftest()
+	}
+
+	// print remaining connection churn summary
+	if *churnThreshold > 0 {
+		emitChurnSummary()
+	}
+
+	// print handshake statistics
+	if *showStats {
+		printStats()
+	}
+
+	// print capture quality
+	if *showQuality {
+		printQuality()
+	}
+
+	// print decline summary
+	if *declineSummary {
+		writeDeclineSummary(stdout)
+	}
+
+	// print buffer size distribution
+	if *bufferSummary {
+		writeBufferSizes(stdout)
+	}
+
+	// print GID and RoCE MAC inventory
+	if *showInventory {
+		writeInventory(stdout)
+	}
+
+	// print path selection summary
+	if *pathSummary {
+		printPathSummary()
+	}
+
+	// print round-trip statistics
+	if *checkRoundTrip {
+		printRoundTripStats()
+	}
+
+	// print research summary
+	if *researchFile != "" {
+		printResearchSummary()
+	}
+
+	// print learned ExIDs
+	if *learnExIDs {
+		printExIDWhitelist()
+	}
 }
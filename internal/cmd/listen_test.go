@@ -7,6 +7,8 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/gopacket/gopacket"
@@ -139,7 +141,7 @@ func TestListenPcap(t *testing.T) {
 	tmpfile.Close()
 
 	// test listen() with pcap file
-	*pcapFile = tmpfile.Name()
+	*pcapFiles = pcapFileList{tmpfile.Name()}
 	listen()
 
 	// check results
@@ -188,3 +190,53 @@ func TestListenPcap(t *testing.T) {
 		t.Errorf("got = %s; want %s", got, want)
 	}
 }
+
+func TestListenFlush(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	log.SetOutput(&buf)
+	defer func(f pcapFileList, filter string, fb, s, o bool) {
+		*pcapFiles, *pcapFilter, *showFallbacks, *showStats = f,
+			filter, fb, s
+		textOutput = o
+		stats = handshakeStats{}
+	}(*pcapFiles, *pcapFilter, *showFallbacks, *showStats, textOutput)
+	stats = handshakeStats{}
+
+	// write packets of demo sessions to pcap file
+	file := filepath.Join(t.TempDir(), "demo.pcap")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := pcapgo.NewWriter(f)
+	w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+	for _, s := range demoSessions {
+		for _, p := range s.packets() {
+			w.WritePacket(gopacket.CaptureInfo{
+				CaptureLength: len(p),
+				Length:        len(p),
+			}, p)
+		}
+	}
+	f.Close()
+
+	// the fallback without SYN-ACK is only detected when the open
+	// connections are flushed at the end of the capture
+	*pcapFiles = pcapFileList{file}
+	*pcapFilter = ""
+	*showFallbacks = true
+	*showStats = true
+	textOutput = true
+	listen()
+
+	got := buf.String()
+	for _, want := range []string{
+		"Fell back to TCP: ",
+		"1 fell back (33.3%)",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %s; want %s", got, want)
+		}
+	}
+}
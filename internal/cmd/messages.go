@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// messageHistoryLen is the number of recent CLC messages in the
+	// message history of the http api
+	messageHistoryLen = 1000
+)
+
+var (
+	// messageHistory stores the recent CLC messages for the http api
+	messageHistory messageHistorySink
+
+	// messageFields are the columns of the CSV output included as
+	// structured fields in the messages of the http api
+	messageFields = append([]string{"version", "path", "flag", "length"},
+		tableFields...)
+)
+
+// jsonAPIMessage is a CLC message in the messages http api with its sequence
+// number, key fields, and raw bytes
+type jsonAPIMessage struct {
+	ID uint64 `json:"id"`
+	*jsonMessage
+	Fields map[string]string `json:"fields,omitempty"`
+	Raw    string            `json:"raw,omitempty"`
+}
+
+// jsonAPIMessages is the response of the messages http api with the selected
+// messages, the sequence number for the after parameter of the next request,
+// if there are more messages after them, and the sequence number of the
+// oldest stored message
+type jsonAPIMessages struct {
+	Messages  []*jsonAPIMessage `json:"messages"`
+	NextAfter uint64            `json:"next_after"`
+	More      bool              `json:"more"`
+	Oldest    uint64            `json:"oldest"`
+}
+
+// messageHistorySink stores the recent message events for the messages http
+// api protected by a mutex
+type messageHistorySink struct {
+	lock     sync.Mutex
+	enabled  bool
+	next     uint64
+	messages []*jsonAPIMessage
+}
+
+// init initializes and enables the message history
+func (mh *messageHistorySink) init() {
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+	mh.enabled = true
+	mh.next = 1
+	mh.messages = nil
+}
+
+// accepts checks if the message history stores events of type typ
+func (mh *messageHistorySink) accepts(typ string) bool {
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+	return mh.enabled && typ == eventMessage
+}
+
+// render stores the message event e in the message history, the oldest
+// message is removed if the history is full
+func (mh *messageHistorySink) render(e *event) {
+	m := &jsonAPIMessage{
+		jsonMessage: clcJSON(e.time, e.net, e.trans, e.msg, e.session,
+			e.warnings),
+		Raw: hex.EncodeToString(eventLogRaw(e.msg)),
+	}
+	row := csvMessageRow(e.time, e.net, e.trans, e.msg, e.session,
+		e.warnings)
+	for _, f := range messageFields {
+		if row[f] == "" {
+			continue
+		}
+		if m.Fields == nil {
+			m.Fields = make(map[string]string)
+		}
+		m.Fields[f] = row[f]
+	}
+
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+	m.ID = mh.next
+	mh.next++
+	if len(mh.messages) == messageHistoryLen {
+		mh.messages = mh.messages[1:]
+	}
+	mh.messages = append(mh.messages, m)
+}
+
+// messageQuery selects messages in the messages http api by sequence
+// number, message type, handshake session, peer ID, source and destination
+// host or address, and time, empty and zero values match all messages. Paged
+// queries with after parameter fetch messages incrementally
+type messageQuery struct {
+	after   uint64
+	paged   bool
+	typ     string
+	session uint64
+	peer    string
+	src     string
+	dst     string
+	since   time.Time
+	limit   int
+}
+
+// matchAddress checks if the address addr, i.e., host:port, matches the host
+// or address in filter
+func matchAddress(addr, filter string) bool {
+	if filter == "" || addr == filter {
+		return true
+	}
+	host, _, err := net.SplitHostPort(addr)
+	return err == nil && host == strings.Trim(filter, "[]")
+}
+
+// matches checks if the message m matches the query
+func (q *messageQuery) matches(m *jsonAPIMessage) bool {
+	return m.ID > q.after &&
+		(q.typ == "" || m.Type == q.typ) &&
+		(q.session == 0 || m.Session == q.session) &&
+		(q.peer == "" || m.Fields["peer_id"] == q.peer) &&
+		matchAddress(m.Src, q.src) && matchAddress(m.Dst, q.dst) &&
+		!m.Time.Before(q.since)
+}
+
+// get returns the stored messages matching the query q. With a limit, it
+// returns the oldest messages after the sequence number of the after
+// parameter for incremental fetches or, without after parameter, the newest
+// messages
+func (mh *messageHistorySink) get(q *messageQuery) *jsonAPIMessages {
+	mh.lock.Lock()
+	defer mh.lock.Unlock()
+
+	resp := &jsonAPIMessages{
+		Messages:  []*jsonAPIMessage{},
+		NextAfter: q.after,
+	}
+	if len(mh.messages) > 0 {
+		resp.Oldest = mh.messages[0].ID
+	}
+	for _, m := range mh.messages {
+		if q.matches(m) {
+			resp.Messages = append(resp.Messages, m)
+		}
+	}
+	if n := len(resp.Messages); q.limit > 0 && n > q.limit {
+		if q.paged {
+			resp.Messages = resp.Messages[:q.limit]
+			resp.More = true
+		} else {
+			resp.Messages = resp.Messages[n-q.limit:]
+		}
+	}
+	if n := len(resp.Messages); n > 0 {
+		resp.NextAfter = resp.Messages[n-1].ID
+	}
+	return resp
+}
+
+// parseMessageUint parses the unsigned integer query parameter name in
+// values, a missing parameter is 0
+func parseMessageUint(values url.Values, name string) (uint64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+// parseMessageSince parses the query parameter since in values relative to
+// the time now: an RFC 3339 time or a duration before now, e.g., 5m
+func parseMessageSince(values url.Values, now time.Time) (time.Time,
+	error) {
+	v := values.Get("since")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %q", v)
+}
+
+// parseMessageQuery parses the query parameters after, type, session, peer,
+// src, dst, since, and limit of the http request r
+func parseMessageQuery(r *http.Request) (*messageQuery, error) {
+	values := r.URL.Query()
+	q := &messageQuery{
+		typ:  values.Get("type"),
+		peer: values.Get("peer"),
+		src:  values.Get("src"),
+		dst:  values.Get("dst"),
+	}
+	var err error
+	if q.after, err = parseMessageUint(values, "after"); err != nil {
+		return nil, err
+	}
+	q.paged = values.Has("after")
+	if q.session, err = parseMessageUint(values, "session"); err != nil {
+		return nil, err
+	}
+	limit, err := parseMessageUint(values, "limit")
+	if err != nil {
+		return nil, err
+	}
+	q.limit = int(limit)
+	if q.since, err = parseMessageSince(values, time.Now()); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// handleMessages handles http requests for the recent CLC messages selected
+// by the query parameters
+func handleMessages(w http.ResponseWriter, r *http.Request) {
+	q, err := parseMessageQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(messageHistory.get(q))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// registerMessageAPI enables the message history and registers the messages
+// http api
+func registerMessageAPI() {
+	messageHistory.init()
+	http.HandleFunc("/api/v1/messages", handleMessages)
+}
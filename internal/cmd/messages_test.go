@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// messagesTestPage is a response of the messages http api with the ids of
+// the messages
+type messagesTestPage struct {
+	ids       []uint64
+	nextAfter uint64
+	more      bool
+	oldest    uint64
+}
+
+// messagesTestGet requests the messages http api with query and returns the
+// response with the ids of the messages
+func messagesTestGet(t *testing.T, query string) messagesTestPage {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/messages"+query,
+		nil)
+	w := httptest.NewRecorder()
+	handleMessages(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got = %d; want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		Messages []struct {
+			ID uint64 `json:"id"`
+		} `json:"messages"`
+		NextAfter uint64 `json:"next_after"`
+		More      bool   `json:"more"`
+		Oldest    uint64 `json:"oldest"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	page := messagesTestPage{
+		ids:       []uint64{},
+		nextAfter: resp.NextAfter,
+		more:      resp.More,
+		oldest:    resp.Oldest,
+	}
+	for _, m := range resp.Messages {
+		page.ids = append(page.ids, m.ID)
+	}
+	return page
+}
+
+func TestHandleMessages(t *testing.T) {
+	// disabled message history
+	messageHistory = messageHistorySink{}
+	if messageHistory.accepts(eventMessage) {
+		t.Error("accepts() = true; want false")
+	}
+
+	// store decline messages in two sessions
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	raw, _ := hex.DecodeString("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	msg, _ := clc.NewMessage(raw)
+	msg.Parse(raw)
+	messageHistory.init()
+	defer func() { messageHistory = messageHistorySink{} }()
+	if !messageHistory.accepts(eventMessage) ||
+		messageHistory.accepts(eventHandshake) {
+		t.Error("accepts() does not accept only messages")
+	}
+	for _, session := range []uint64{1, 2, 2} {
+		messageHistory.render(&event{typ: eventMessage,
+			time: time.Unix(1, 0), net: net, trans: trans, msg: msg,
+			session: session})
+	}
+
+	// test message content
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/messages?limit=1",
+		nil)
+	w := httptest.NewRecorder()
+	handleMessages(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q; want application/json", ct)
+	}
+	var resp struct {
+		Messages []map[string]any `json:"messages"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	m := resp.Messages[0]
+	fields := map[string]any{
+		"version":   "1",
+		"path":      "SMC-R",
+		"flag":      "0",
+		"length":    "28",
+		"peer_id":   "9509@25:25:25:25:25:00",
+		"diagnosis": "0x3030000 (no SMC device found (R or D))",
+	}
+	if m["id"] != 3.0 || m["session"] != 2.0 || m["type"] != "decline" ||
+		m["src"] != "1.2.3.4:123" || m["dst"] != "5.6.7.8:456" ||
+		m["raw"] != hex.EncodeToString(raw) ||
+		!reflect.DeepEqual(m["fields"], fields) {
+		t.Errorf("got %v", m)
+	}
+
+	// test selections and pagination
+	for _, test := range []struct {
+		query string
+		want  messagesTestPage
+	}{
+		{"", messagesTestPage{[]uint64{1, 2, 3}, 3, false, 1}},
+		{"?after=1", messagesTestPage{[]uint64{2, 3}, 3, false, 1}},
+		{"?after=3", messagesTestPage{[]uint64{}, 3, false, 1}},
+		{"?limit=2", messagesTestPage{[]uint64{2, 3}, 3, false, 1}},
+		{"?after=0&limit=2", messagesTestPage{[]uint64{1, 2}, 2, true,
+			1}},
+		{"?after=2&limit=2", messagesTestPage{[]uint64{3}, 3, false,
+			1}},
+		{"?session=2&limit=1", messagesTestPage{[]uint64{3}, 3, false,
+			1}},
+		{"?type=decline&session=1", messagesTestPage{[]uint64{1}, 1,
+			false, 1}},
+		{"?type=proposal", messagesTestPage{[]uint64{}, 0, false, 1}},
+	} {
+		got := messagesTestGet(t, test.query)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v; want %v", test.query, got,
+				test.want)
+		}
+	}
+
+	// test invalid query
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/messages?after=x",
+		nil)
+	w = httptest.NewRecorder()
+	handleMessages(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// test history length
+	for i := 0; i < messageHistoryLen; i++ {
+		messageHistory.render(&event{typ: eventMessage, net: net,
+			trans: trans, msg: msg})
+	}
+	page := messagesTestGet(t, "")
+	if len(page.ids) != messageHistoryLen || page.ids[0] != 4 ||
+		page.oldest != 4 {
+		t.Errorf("got %d messages from %d; want %d from 4",
+			len(page.ids), page.ids[0], messageHistoryLen)
+	}
+}
+
+func TestMessageQuery(t *testing.T) {
+	m := &jsonAPIMessage{
+		ID: 5,
+		jsonMessage: &jsonMessage{
+			Time:    time.Unix(100, 0),
+			Session: 2,
+			Src:     "[fd00::1]:123",
+			Dst:     "5.6.7.8:456",
+			Type:    "decline",
+		},
+		Fields: map[string]string{"peer_id": "9509@25:25:25:25:25:00"},
+	}
+	for _, test := range []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"?type=decline&session=2&after=4", true},
+		{"?after=5", false},
+		{"?type=accept", false},
+		{"?peer=9509@25:25:25:25:25:00", true},
+		{"?peer=1@25:25:25:25:25:00", false},
+		{"?src=fd00::1", true},
+		{"?src=[fd00::1]", true},
+		{"?src=[fd00::1]:123", true},
+		{"?src=[fd00::1]:124", false},
+		{"?src=5.6.7.8", false},
+		{"?dst=5.6.7.8", true},
+		{"?dst=5.6.7.8:456&src=fd00::1", true},
+		{"?since=1970-01-01T00:01:40Z", true},
+		{"?since=1970-01-01T00:01:41Z", false},
+	} {
+		r := httptest.NewRequest(http.MethodGet,
+			"/api/v1/messages"+test.query, nil)
+		q, err := parseMessageQuery(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := q.matches(m); got != test.want {
+			t.Errorf("%s: got %t; want %t", test.query, got,
+				test.want)
+		}
+	}
+
+	// test since as duration and invalid values
+	now := time.Unix(1000, 0)
+	values := url.Values{"since": {"5m"}}
+	if got, err := parseMessageSince(values, now); err != nil ||
+		!got.Equal(time.Unix(700, 0)) {
+		t.Errorf("got %v, %v; want %v", got, err, time.Unix(700, 0))
+	}
+	for _, v := range []string{"x", "-5m", "2026-10-15"} {
+		values := url.Values{"since": {v}}
+		if _, err := parseMessageSince(values, now); err == nil {
+			t.Errorf("%s: got nil error; want error", v)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// parseStatsBuckets is the number of one second buckets in the parse
+	// statistics, it limits the largest sliding window
+	parseStatsBuckets = 15 * 60
+)
+
+var (
+	// parseWindows are the sliding windows of the parse success ratio
+	parseWindows = []time.Duration{
+		time.Minute,
+		5 * time.Minute,
+		15 * time.Minute,
+	}
+
+	// parsing stores the parse statistics
+	parsing parseStats
+)
+
+// parseBucket stores the parse statistics of one second
+type parseBucket struct {
+	sec      int64
+	detected uint64
+	parsed   uint64
+}
+
+// parseStats stores the number of detected and successfully parsed CLC
+// messages protected by a mutex
+type parseStats struct {
+	lock     sync.Mutex
+	buckets  [parseStatsBuckets]parseBucket
+	detected uint64
+	parsed   uint64
+}
+
+// addAt adds a detected CLC message at time now to the parse statistics,
+// parsed indicates if the message was parsed successfully
+func (ps *parseStats) addAt(now time.Time, parsed bool) {
+	if ps == nil {
+		return
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	sec := now.Unix()
+	b := &ps.buckets[sec%parseStatsBuckets]
+	if b.sec != sec {
+		*b = parseBucket{sec: sec}
+	}
+	b.detected++
+	ps.detected++
+	if parsed {
+		b.parsed++
+		ps.parsed++
+	}
+}
+
+// add adds a detected CLC message to the parse statistics, parsed indicates
+// if the message was parsed successfully
+func (ps *parseStats) add(parsed bool) {
+	ps.addAt(time.Now(), parsed)
+}
+
+// ratio returns the ratio of successfully parsed to detected CLC messages in
+// the sliding window ending at time now. Without detected messages, the ratio
+// is 1
+func (ps *parseStats) ratio(now time.Time, window time.Duration) float64 {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	var detected, parsed uint64
+	sec := now.Unix()
+	start := sec - int64(window/time.Second)
+	for _, b := range ps.buckets {
+		if b.sec > start && b.sec <= sec {
+			detected += b.detected
+			parsed += b.parsed
+		}
+	}
+	if detected == 0 {
+		return 1
+	}
+	return float64(parsed) / float64(detected)
+}
+
+// totals returns the total number of detected and successfully parsed CLC
+// messages
+func (ps *parseStats) totals() (detected, parsed uint64) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	return ps.detected, ps.parsed
+}
+
+// writeMetrics writes the parse statistics at time now in prometheus text
+// format to w
+func (ps *parseStats) writeMetrics(w io.Writer, now time.Time) {
+	fmt.Fprintln(w, "# HELP smc_clc_parse_success_ratio Ratio of "+
+		"successfully parsed to detected CLC messages in window.")
+	fmt.Fprintln(w, "# TYPE smc_clc_parse_success_ratio gauge")
+	for _, window := range parseWindows {
+		fmt.Fprintf(w, "smc_clc_parse_success_ratio"+
+			"{window=\"%dm\"} %g\n", window/time.Minute,
+			ps.ratio(now, window))
+	}
+
+	detected, parsed := ps.totals()
+	fmt.Fprintln(w, "# HELP smc_clc_messages_detected_total Number of "+
+		"detected CLC messages.")
+	fmt.Fprintln(w, "# TYPE smc_clc_messages_detected_total counter")
+	fmt.Fprintf(w, "smc_clc_messages_detected_total %d\n", detected)
+	fmt.Fprintln(w, "# HELP smc_clc_messages_parsed_total Number of "+
+		"successfully parsed CLC messages.")
+	fmt.Fprintln(w, "# TYPE smc_clc_messages_parsed_total counter")
+	fmt.Fprintf(w, "smc_clc_messages_parsed_total %d\n", parsed)
+}
+
+// handleMetrics handles http requests for the metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	parsing.writeMetrics(w, time.Now())
+	stats.writeMetrics(w)
+	durations.writeMetrics(w)
+	flows.writeMetrics(w)
+	vlans.writeMetrics(w)
+	updateDrops()
+	quality.writeMetrics(w)
+}
+
+// registerMetricsAPI registers the metrics http api
+func registerMetricsAPI() {
+	http.HandleFunc("/metrics", handleMetrics)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestParseStats(t *testing.T) {
+	var ps parseStats
+	now := time.Unix(10000, 0)
+
+	// test empty statistics
+	if got := ps.ratio(now, time.Minute); got != 1 {
+		t.Errorf("ps.ratio() = %g; want 1", got)
+	}
+
+	// add messages: 3 parsed, 1 failed in last minute, 1 failed earlier
+	ps.addAt(now.Add(-10*time.Minute), false)
+	ps.addAt(now.Add(-30*time.Second), true)
+	ps.addAt(now.Add(-30*time.Second), false)
+	ps.addAt(now, true)
+	ps.addAt(now, true)
+
+	// test sliding windows
+	if got := ps.ratio(now, time.Minute); got != 0.75 {
+		t.Errorf("ps.ratio(1m) = %g; want 0.75", got)
+	}
+	if got := ps.ratio(now, 15*time.Minute); got != 0.6 {
+		t.Errorf("ps.ratio(15m) = %g; want 0.6", got)
+	}
+
+	// test metrics output
+	var buf bytes.Buffer
+	ps.writeMetrics(&buf, now)
+	want := "# HELP smc_clc_parse_success_ratio Ratio of successfully " +
+		"parsed to detected CLC messages in window.\n" +
+		"# TYPE smc_clc_parse_success_ratio gauge\n" +
+		"smc_clc_parse_success_ratio{window=\"1m\"} 0.75\n" +
+		"smc_clc_parse_success_ratio{window=\"5m\"} 0.75\n" +
+		"smc_clc_parse_success_ratio{window=\"15m\"} 0.6\n" +
+		"# HELP smc_clc_messages_detected_total Number of detected " +
+		"CLC messages.\n" +
+		"# TYPE smc_clc_messages_detected_total counter\n" +
+		"smc_clc_messages_detected_total 5\n" +
+		"# HELP smc_clc_messages_parsed_total Number of successfully " +
+		"parsed CLC messages.\n" +
+		"# TYPE smc_clc_messages_parsed_total counter\n" +
+		"smc_clc_messages_parsed_total 3\n"
+	got := buf.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttPubRec     = 5
+	mqttPubRel     = 6
+	mqttPubComp    = 7
+	mqttPingReq    = 12
+	mqttPingResp   = 13
+	mqttDisconnect = 14
+)
+
+// MQTT settings
+const (
+	mqttKeepAlive = time.Minute
+	mqttTimeout   = 10 * time.Second
+	mqttQueueLen  = 10000
+	mqttMaxQoS    = 2
+)
+
+var (
+	// mqttEvents is the MQTT sink
+	mqttEvents mqttSink
+)
+
+// mqttAppendString appends the string s with uint16 length to buf
+func mqttAppendString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(s)))
+	return append(buf, s...)
+}
+
+// mqttPacket returns the control packet of type typ with flags and body
+func mqttPacket(typ, flags byte, body []byte) []byte {
+	p := []byte{typ<<4 | flags}
+	p = binary.AppendUvarint(p, uint64(len(body)))
+	return append(p, body...)
+}
+
+// mqttClient is an MQTT 3.1.1 client that publishes messages to a broker
+type mqttClient struct {
+	address  string
+	clientID string
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+	lastSend time.Time
+}
+
+// send sends the control packet p to the broker
+func (c *mqttClient) send(p []byte) error {
+	c.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	if _, err := c.conn.Write(p); err != nil {
+		return err
+	}
+	c.lastSend = time.Now()
+	return nil
+}
+
+// receive receives a control packet from the broker and returns its type
+// and body
+func (c *mqttClient) receive() (byte, []byte, error) {
+	c.conn.SetDeadline(time.Now().Add(mqttTimeout))
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+// expect receives a control packet from the broker and checks its type typ
+// and, if not 0, its packet id
+func (c *mqttClient) expect(typ byte, id uint16) error {
+	t, body, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if t != typ {
+		return fmt.Errorf("unexpected MQTT packet type %d", t)
+	}
+	if id != 0 && (len(body) < 2 ||
+		binary.BigEndian.Uint16(body) != id) {
+		return fmt.Errorf("unexpected MQTT packet id")
+	}
+	return nil
+}
+
+// connect connects to the broker with a clean session
+func (c *mqttClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.address, mqttTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	body := mqttAppendString(nil, "MQTT")
+	body = append(body, 4, 0x02) // protocol level, clean session
+	body = binary.BigEndian.AppendUint16(body,
+		uint16(mqttKeepAlive.Seconds()))
+	body = mqttAppendString(body, c.clientID)
+	if err := c.send(mqttPacket(mqttConnect, 0, body)); err != nil {
+		c.close()
+		return err
+	}
+	t, ack, err := c.receive()
+	if err == nil && (t != mqttConnAck || len(ack) != 2) {
+		err = fmt.Errorf("unexpected MQTT packet type %d", t)
+	}
+	if err == nil && ack[1] != 0 {
+		err = fmt.Errorf("MQTT connection refused with code %d",
+			ack[1])
+	}
+	if err != nil {
+		c.close()
+	}
+	return err
+}
+
+// publish publishes the payload to topic with qos, it waits for the
+// acknowledgements of QoS 1 and 2
+func (c *mqttClient) publish(topic string, payload []byte, qos byte) error {
+	body := mqttAppendString(nil, topic)
+	var id uint16
+	if qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		id = c.packetID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if err := c.send(mqttPacket(mqttPublish, qos<<1, body)); err != nil {
+		return err
+	}
+
+	switch qos {
+	case 1:
+		return c.expect(mqttPubAck, id)
+	case 2:
+		if err := c.expect(mqttPubRec, id); err != nil {
+			return err
+		}
+		rel := mqttPacket(mqttPubRel, 0x02,
+			binary.BigEndian.AppendUint16(nil, id))
+		if err := c.send(rel); err != nil {
+			return err
+		}
+		return c.expect(mqttPubComp, id)
+	}
+	return nil
+}
+
+// ping sends a ping request to the broker and waits for its response
+func (c *mqttClient) ping() error {
+	if err := c.send(mqttPacket(mqttPingReq, 0, nil)); err != nil {
+		return err
+	}
+	return c.expect(mqttPingResp, 0)
+}
+
+// close closes the connection to the broker
+func (c *mqttClient) close() {
+	if c.conn == nil {
+		return
+	}
+	c.conn.Close()
+	c.conn = nil
+}
+
+// disconnect disconnects from the broker
+func (c *mqttClient) disconnect() {
+	if c.conn == nil {
+		return
+	}
+	c.send(mqttPacket(mqttDisconnect, 0, nil))
+	c.close()
+}
+
+// mqttRecord is a message of the MQTT output with its topic and payload
+type mqttRecord struct {
+	topic   string
+	payload []byte
+}
+
+// run publishes the queued messages with qos until the queue is closed,
+// after errors it reconnects with the next message
+func (c *mqttClient) run(records <-chan mqttRecord, qos byte,
+	done chan<- struct{}) {
+	defer close(done)
+	defer c.disconnect()
+
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case r, ok := <-records:
+			if !ok {
+				return
+			}
+			if c.conn == nil {
+				if err := c.connect(); err != nil {
+					log.Println("Error connecting to MQTT "+
+						"broker:", err)
+					continue
+				}
+			}
+			err := c.publish(r.topic, r.payload, qos)
+			if err != nil {
+				log.Println("Error publishing to MQTT:", err)
+				c.close()
+			}
+		case <-ticker.C:
+			if c.conn == nil ||
+				time.Since(c.lastSend) < mqttKeepAlive/2 {
+				continue
+			}
+			if err := c.ping(); err != nil {
+				log.Println("Error pinging MQTT broker:", err)
+				c.close()
+			}
+		}
+	}
+}
+
+// mqttSink renders the event types selected on the command line as JSON
+// messages to MQTT topics below a topic prefix, messages are queued and
+// published in the background and dropped if the queue is full
+type mqttSink struct {
+	lock    sync.Mutex
+	prefix  string
+	records chan mqttRecord
+	done    chan struct{}
+	dropped uint64
+}
+
+// init initializes the MQTT sink with the broker address, the topic prefix,
+// and the qos and starts the client
+func (m *mqttSink) init(address, prefix string, qos int) error {
+	if qos < 0 || qos > mqttMaxQoS {
+		return fmt.Errorf("invalid MQTT QoS %d", qos)
+	}
+	c := &mqttClient{
+		address:  address,
+		clientID: fmt.Sprintf("smc-clc-%d", os.Getpid()),
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.prefix = prefix
+	m.records = make(chan mqttRecord, mqttQueueLen)
+	m.done = make(chan struct{})
+	go c.run(m.records, byte(qos), m.done)
+	return nil
+}
+
+// close publishes the remaining messages and stops the client
+func (m *mqttSink) close() {
+	m.lock.Lock()
+	records, done := m.records, m.done
+	m.records = nil
+	if m.dropped > 0 {
+		log.Printf("MQTT output dropped %d messages", m.dropped)
+	}
+	m.lock.Unlock()
+
+	if records == nil {
+		return
+	}
+	close(records)
+	<-done
+}
+
+// accepts checks if the MQTT sink renders events of type typ
+func (m *mqttSink) accepts(typ string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.records != nil && jsonEvents.types[typ]
+}
+
+// render renders the event e as JSON message to the topic of its event type
+// and queues it for the client
+func (m *mqttSink) render(e *event) {
+	v := jsonEvent(e)
+	if v == nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error encoding MQTT message:", err)
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.records == nil {
+		return
+	}
+	select {
+	case m.records <- mqttRecord{m.prefix + "/" + e.typ, b}:
+	default:
+		m.dropped++
+	}
+}
+
+// setMQTTOutput sets the MQTT output according to the MQTT command line
+// arguments, the returned function publishes the remaining messages and stops
+// the client
+func setMQTTOutput() func() {
+	if *mqttBroker == "" {
+		return func() {}
+	}
+	if err := mqttEvents.init(*mqttBroker, *mqttTopic,
+		*mqttQoS); err != nil {
+		log.Fatal(err)
+	}
+	return mqttEvents.close
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// mqttTestPublish is a message published to the MQTT test broker
+type mqttTestPublish struct {
+	topic   string
+	qos     byte
+	payload string
+}
+
+// mqttTestServe accepts the connection of a client on conn and sends the
+// messages it publishes to published
+func mqttTestServe(conn net.Conn, published chan<- mqttTestPublish) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		n, _ := binary.ReadUvarint(r)
+		body := make([]byte, n)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return
+		}
+		switch header >> 4 {
+		case mqttConnect:
+			conn.Write(mqttPacket(mqttConnAck, 0, []byte{0, 0}))
+		case mqttPublish:
+			l := binary.BigEndian.Uint16(body)
+			p := mqttTestPublish{
+				topic: string(body[2 : 2+l]),
+				qos:   header >> 1 & 3,
+			}
+			body = body[2+l:]
+			id := []byte{}
+			if p.qos > 0 {
+				id, body = body[:2], body[2:]
+			}
+			p.payload = string(body)
+			switch p.qos {
+			case 1:
+				conn.Write(mqttPacket(mqttPubAck, 0, id))
+			case 2:
+				conn.Write(mqttPacket(mqttPubRec, 0, id))
+			}
+			published <- p
+		case mqttPubRel:
+			conn.Write(mqttPacket(mqttPubComp, 0, body))
+		case mqttPingReq:
+			conn.Write(mqttPacket(mqttPingResp, 0, nil))
+		}
+	}
+}
+
+func TestMQTTSink(t *testing.T) {
+	types := jsonEvents.types
+	jsonEvents.types = map[string]bool{eventAnnotation: true}
+	defer func() { jsonEvents.types = types }()
+
+	// start broker
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+	published := make(chan mqttTestPublish, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go mqttTestServe(conn, published)
+		}
+	}()
+
+	// check invalid qos
+	var m mqttSink
+	if err := m.init(l.Addr().String(), "lab", 3); err == nil {
+		t.Error("init() with invalid qos succeeded")
+	}
+
+	// publish annotations with all qos levels
+	for qos := 0; qos <= mqttMaxQoS; qos++ {
+		if err := m.init(l.Addr().String(), "lab", qos); err != nil {
+			t.Fatal(err)
+		}
+		if m.accepts(eventMessage) {
+			t.Error("m.accepts(message) = true; want false")
+		}
+		m.render(&event{typ: eventAnnotation, text: "test"})
+		m.close()
+
+		p := <-published
+		if p.topic != "lab/annotation" || p.qos != byte(qos) ||
+			!strings.Contains(p.payload, `"text":"test"`) {
+			t.Errorf("got = %+v; want annotation with qos %d", p,
+				qos)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gopacket/gopacket"
+)
+
+// oneSidedHandshake is a handshake with a missing message: the confirm of
+// the client after an accept or the accept of the server before a confirm
+type oneSidedHandshake struct {
+	key     handshakeKey
+	missing string
+	seen    string
+	sender  string
+}
+
+// check checks if the one-sided handshake is caused by capture loss or peer
+// misbehavior from the number of gaps in the reassembled stream of the
+// sender of the missing message and returns the result
+func (o *oneSidedHandshake) check(gaps uint64) string {
+	if gaps > 0 {
+		return fmt.Sprintf("%s without %s: capture loss, gaps in %s "+
+			"stream: %d", o.seen, o.missing, o.sender, gaps)
+	}
+	return fmt.Sprintf("%s without %s: peer misbehavior, %s stream "+
+		"complete", o.seen, o.missing, o.sender)
+}
+
+// expectConfirm remembers that the handshake h is waiting for the confirm of the
+// client after an accept, ht must be locked
+func (ht *handshakeTable) expectConfirm(h *handshake) {
+	ht.missing[h.key] = &oneSidedHandshake{
+		key:     h.key,
+		missing: "Confirm",
+		seen:    "Accept",
+		sender:  "client",
+	}
+}
+
+// missAccept remembers that the handshake h finished with a confirm but
+// without an accept of the server, ht must be locked
+func (ht *handshakeTable) missAccept(h *handshake) {
+	key := handshakeKey{h.key.net.Reverse(), h.key.trans.Reverse()}
+	ht.missing[key] = &oneSidedHandshake{
+		key:     h.key,
+		missing: "Accept",
+		seen:    "Confirm",
+		sender:  "server",
+	}
+}
+
+// oneSided removes and returns the one-sided handshake with a message missing
+// in the stream of the network flow net and the transport flow trans, if any
+func (ht *handshakeTable) oneSided(net, trans gopacket.Flow) (
+	*oneSidedHandshake, bool) {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+
+	key := handshakeKey{net, trans}
+	o, ok := ht.missing[key]
+	delete(ht.missing, key)
+	return o, ok
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestOneSidedHandshake(t *testing.T) {
+	var ht handshakeTable
+
+	// prepare test flows and messages
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	accept := testHandshakeMessage("e2d4c3d902004418b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e40000157d010000" +
+		"0005230000000000f0a600000072f5fe" +
+		"e2d4c3d9")
+	confirm := testHandshakeMessage("e2d4c3d903004410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e50000187f010000" +
+		"0006230000000000f0a40000000d89a4" +
+		"e2d4c3d9")
+	ht.init()
+
+	// test complete handshake
+	ht.add(net, trans, proposal, time.Time{})
+	ht.add(net.Reverse(), trans.Reverse(), accept, time.Time{})
+	ht.add(net, trans, confirm, time.Time{})
+	if o, ok := ht.oneSided(net, trans); ok {
+		t.Errorf("got = %v; want none", o)
+	}
+	if o, ok := ht.oneSided(net.Reverse(), trans.Reverse()); ok {
+		t.Errorf("got = %v; want none", o)
+	}
+
+	// test accept without confirm
+	ht.add(net, trans, proposal, time.Time{})
+	ht.add(net.Reverse(), trans.Reverse(), accept, time.Time{})
+	o, ok := ht.oneSided(net, trans)
+	if !ok {
+		t.Fatal("one-sided handshake not found")
+	}
+	want := "Accept without Confirm: peer misbehavior, client stream " +
+		"complete"
+	if got := o.check(0); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	want = "Accept without Confirm: capture loss, gaps in client stream: 2"
+	if got := o.check(2); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test confirm without accept
+	ht.add(net, trans, proposal, time.Time{})
+	ht.add(net, trans, confirm, time.Time{})
+	if o, ok := ht.oneSided(net, trans); ok {
+		t.Errorf("got = %v; want none", o)
+	}
+	o, ok = ht.oneSided(net.Reverse(), trans.Reverse())
+	if !ok {
+		t.Fatal("one-sided handshake not found")
+	}
+	want = "Confirm without Accept: capture loss, gaps in server stream: 1"
+	if got := o.check(1); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
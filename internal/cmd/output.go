@@ -0,0 +1,435 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// output formats
+const (
+	outputText      = "text"
+	outputJSON      = "json"
+	outputJSONL     = "jsonl"
+	outputTextJSON  = "text+json"
+	outputCSV       = "csv"
+	outputTextCSV   = "text+csv"
+	outputProto     = "protobuf"
+	outputTextProto = "text+protobuf"
+	outputCEF       = "cef"
+	outputTextCEF   = "text+cef"
+)
+
+var (
+	// textOutput indicates if human-readable text is written to stdout
+	textOutput = true
+
+	// jsonOutput is the writer of the JSON output, nil disables it
+	jsonOutput io.Writer
+
+	// jsonLock protects the JSON output
+	jsonLock sync.Mutex
+)
+
+// jsonMessage is a CLC message in the JSON output
+type jsonMessage struct {
+	Time     time.Time `json:"time"`
+	Session  uint64    `json:"session,omitempty"`
+	Src      string    `json:"src"`
+	Dst      string    `json:"dst"`
+	Type     string    `json:"type"`
+	Message  string    `json:"message"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+// jsonHandshake is a finished handshake in the JSON output
+type jsonHandshake struct {
+	Time      time.Time `json:"time"`
+	Session   uint64    `json:"session"`
+	Src       string    `json:"src"`
+	Dst       string    `json:"dst"`
+	Type      string    `json:"type"`
+	Result    string    `json:"result"`
+	Path      string    `json:"path,omitempty"`
+	Version   uint8     `json:"version"`
+	Diagnosis string    `json:"diagnosis,omitempty"`
+	Duration  float64   `json:"duration"`
+	QPs       *jsonQPs  `json:"qps,omitempty"`
+
+	ClientMessages uint64 `json:"client_messages"`
+	ClientBytes    uint64 `json:"client_bytes"`
+	ServerMessages uint64 `json:"server_messages"`
+	ServerBytes    uint64 `json:"server_bytes"`
+}
+
+// jsonQPs are the QP numbers and initial PSNs of the server and client of an
+// SMC-R handshake in the JSON output
+type jsonQPs struct {
+	ServerQPN int `json:"server_qpn"`
+	ServerPSN int `json:"server_psn"`
+	ClientQPN int `json:"client_qpn"`
+	ClientPSN int `json:"client_psn"`
+}
+
+// jsonFallback is a connection that fell back to tcp in the JSON output
+type jsonFallback struct {
+	Time   time.Time `json:"time"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst"`
+	Type   string    `json:"type"`
+	Reason string    `json:"reason"`
+}
+
+// jsonOverflow is a flow rejected or evicted because the flow table was full
+// in the JSON output
+type jsonOverflow struct {
+	Time   time.Time `json:"time"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst"`
+	Type   string    `json:"type"`
+	Action string    `json:"action"`
+}
+
+// jsonAlert is a client that exceeded its connection attempt budget in the
+// JSON output
+type jsonAlert struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Source   string    `json:"source"`
+	Client   string    `json:"client"`
+	Attempts int       `json:"attempts"`
+	Budget   int       `json:"budget"`
+	Window   string    `json:"window"`
+}
+
+// jsonPeerAlert is an alert about peers in the JSON output
+type jsonPeerAlert struct {
+	Time   time.Time `json:"time"`
+	Src    string    `json:"src,omitempty"`
+	Dst    string    `json:"dst,omitempty"`
+	Type   string    `json:"type"`
+	Source string    `json:"source"`
+	Alert  string    `json:"alert"`
+}
+
+// jsonError is an error found in the messages of a connection in the JSON
+// output
+type jsonError struct {
+	Time   time.Time `json:"time"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst"`
+	Type   string    `json:"type"`
+	Source string    `json:"source"`
+	Error  string    `json:"error"`
+}
+
+// jsonHeartbeat is a periodic heartbeat with the run totals in the JSON
+// output
+type jsonHeartbeat struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Packets  uint64    `json:"packets"`
+	Flows    uint64    `json:"flows"`
+	Messages uint64    `json:"messages"`
+}
+
+// jsonStats are the handshake statistics in the JSON output
+type jsonStats struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Interval  string    `json:"interval"`
+	Attempted uint64    `json:"attempted"`
+	Succeeded uint64    `json:"succeeded"`
+	Declined  uint64    `json:"declined"`
+	Fallbacks uint64    `json:"fallbacks"`
+}
+
+// parseOutput parses the output specification spec. It returns if text
+// output is enabled, the machine-readable output format, i.e., json, csv,
+// protobuf, or cef, and the file name of the machine-readable output, "-" is
+// stdout and an empty string disables machine-readable output
+func parseOutput(spec string) (bool, string, string, error) {
+	format, file, _ := strings.Cut(spec, ":")
+	switch format {
+	case outputText:
+		if file != "" {
+			return false, "", "", fmt.Errorf("invalid output %q",
+				spec)
+		}
+		return true, "", "", nil
+	case outputJSON, outputJSONL, outputCSV, outputProto, outputCEF:
+		if file == "" {
+			file = "-"
+		}
+		if format == outputJSONL {
+			format = outputJSON
+		}
+		return false, format, file, nil
+	case outputTextJSON, outputTextCSV, outputTextProto, outputTextCEF:
+		if file == "" || file == "-" {
+			return false, "", "", fmt.Errorf("output %q requires "+
+				"a file", format)
+		}
+		return true, strings.TrimPrefix(format, "text+"), file, nil
+	}
+	return false, "", "", fmt.Errorf("unknown output format %q", format)
+}
+
+// setOutput sets the output formats and files according to the output
+// command line argument, the returned function closes the output files
+func setOutput() func() {
+	text, format, file, err := parseOutput(*outputSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	types, err := parseEventTypes(*outputEvents)
+	if err != nil {
+		log.Fatal(err)
+	}
+	textOutput = text
+	jsonEvents.types = types
+	switch file {
+	case "":
+		return func() {}
+	case "-":
+		// keep the JSON lines, CSV rows, protobuf events, or CEF
+		// records on the standard output free of other text for
+		// consumers like jq and move the text to stderr
+		setFormatOutput(format, stdout)
+		stdout = stderr
+		return func() {}
+	}
+
+	// append JSON lines, protobuf events, or CEF records to the file,
+	// start CSV file and rotated CSV files with header row
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	var header []byte
+	if format == outputCSV {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		header = csvHeader()
+	}
+	f, err := openRotatingFile(file, flags, header, *outputRotateSize,
+		*outputRotateInterval, *outputRotateKeep)
+	if err != nil {
+		log.Fatal(err)
+	}
+	setFormatOutput(format, f)
+	return func() {
+		jsonLock.Lock()
+		jsonOutput = nil
+		jsonLock.Unlock()
+		csvEvents.setOutput(nil)
+		protoEvents.setOutput(nil)
+		cefEvents.setOutput(nil)
+		if err := f.Close(); err != nil {
+			log.Println("Error closing output:", err)
+		}
+	}
+}
+
+// setFormatOutput sets the output of the machine-readable output format to w
+func setFormatOutput(format string, w io.Writer) {
+	switch format {
+	case outputCSV:
+		csvEvents.setOutput(w)
+	case outputProto:
+		protoEvents.setOutput(w)
+	case outputCEF:
+		cefEvents.setOutput(w)
+	default:
+		jsonLock.Lock()
+		jsonOutput = w
+		jsonLock.Unlock()
+	}
+}
+
+// writeJSON writes v as JSON event
+func writeJSON(v any) {
+	jsonLock.Lock()
+	defer jsonLock.Unlock()
+	if jsonOutput == nil {
+		return
+	}
+	if err := json.NewEncoder(jsonOutput).Encode(v); err != nil {
+		log.Println("Error writing JSON output:", err)
+	}
+}
+
+// clcJSON returns the CLC message msg of the handshake session with parse
+// warnings sent over the network flow net and the transport flow trans at time
+// t as JSON event
+func clcJSON(t time.Time, net, trans gopacket.Flow, msg clc.Message,
+	session uint64, warnings parseWarnings) *jsonMessage {
+	m := &jsonMessage{
+		Time:     t,
+		Session:  session,
+		Src:      fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		Dst:      fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		Type:     "invalid",
+		Message:  msg.String(),
+		Warnings: warnings,
+	}
+	if hdr := messageHeader(msg); hdr != nil {
+		m.Type = strings.ToLower(hdr.Type.String())
+	}
+	return m
+}
+
+// handshakeJSON returns the handshake r finished at time t as JSON event
+func handshakeJSON(t time.Time, r *handshakeResult) *jsonHandshake {
+	h := &jsonHandshake{
+		Time:    t,
+		Session: r.id,
+		Src: fmt.Sprintf("%s:%s", r.key.net.Src(),
+			r.key.trans.Src()),
+		Dst: fmt.Sprintf("%s:%s", r.key.net.Dst(),
+			r.key.trans.Dst()),
+		Type:     eventHandshake,
+		Result:   "declined",
+		Version:  r.version,
+		Duration: r.total.Seconds(),
+
+		ClientMessages: r.client.messages,
+		ClientBytes:    r.client.bytes,
+		ServerMessages: r.server.messages,
+		ServerBytes:    r.server.bytes,
+	}
+	if r.confirmed {
+		h.Result = "confirmed"
+		h.Path = r.path.String()
+	} else {
+		h.Diagnosis = r.diagnosis
+	}
+	if r.qps {
+		h.QPs = &jsonQPs{
+			ServerQPN: r.serverQP.qpn,
+			ServerPSN: r.serverQP.psn,
+			ClientQPN: r.clientQP.qpn,
+			ClientPSN: r.clientQP.psn,
+		}
+	}
+	return h
+}
+
+// fallbackJSON returns the connection of the network flow net and the
+// transport flow trans that fell back to tcp because of reason at time t as
+// JSON event
+func fallbackJSON(t time.Time, net, trans gopacket.Flow,
+	reason string) *jsonFallback {
+	return &jsonFallback{
+		Time:   t,
+		Src:    fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		Dst:    fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		Type:   eventFallback,
+		Reason: reason,
+	}
+}
+
+// overflowJSON returns the flow of the network flow net and the transport
+// flow trans rejected or evicted, as given by action, because the flow table
+// was full at time t as JSON event
+func overflowJSON(t time.Time, net, trans gopacket.Flow,
+	action string) *jsonOverflow {
+	return &jsonOverflow{
+		Time:   t,
+		Src:    fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		Dst:    fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		Type:   eventOverflow,
+		Action: action,
+	}
+}
+
+// budgetAlertJSON returns the budget alert a raised at time t as JSON event
+func budgetAlertJSON(t time.Time, a *budgetAlert) *jsonAlert {
+	return &jsonAlert{
+		Time:     t,
+		Type:     eventAlert,
+		Source:   alertBudget,
+		Client:   a.client,
+		Attempts: a.attempts,
+		Budget:   a.budget.limit,
+		Window:   a.budget.window.String(),
+	}
+}
+
+// alertJSON returns the alert of source about the peers in the network flow
+// net and the transport flow trans, if set, raised at time t as JSON event
+func alertJSON(t time.Time, net, trans gopacket.Flow, source,
+	alert string) *jsonPeerAlert {
+	return &jsonPeerAlert{
+		Time:   t,
+		Src:    endpointString(net.Src(), trans.Src()),
+		Dst:    endpointString(net.Dst(), trans.Dst()),
+		Type:   eventAlert,
+		Source: source,
+		Alert:  alert,
+	}
+}
+
+// endpointString returns the address of the ip endpoint with the port
+// endpoint, if set, as string, empty if ip is not set
+func endpointString(ip, port gopacket.Endpoint) string {
+	if endpointAddr(port) == "" {
+		return endpointAddr(ip)
+	}
+	return fmt.Sprintf("%s:%s", ip, port)
+}
+
+// endpointAddr returns the address of the endpoint e as string, empty if e
+// is not set
+func endpointAddr(e gopacket.Endpoint) string {
+	if len(e.Raw()) == 0 {
+		return ""
+	}
+	return e.String()
+}
+
+// errorJSON returns the error err of source found at time t in the messages
+// of the network flow net and the transport flow trans as JSON event
+func errorJSON(t time.Time, net, trans gopacket.Flow, source,
+	err string) *jsonError {
+	return &jsonError{
+		Time:   t,
+		Src:    fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		Dst:    fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		Type:   eventError,
+		Source: source,
+		Error:  err,
+	}
+}
+
+// heartbeatJSON returns the heartbeat with the run totals c at time t as
+// JSON event
+func heartbeatJSON(t time.Time, c *runCounts) *jsonHeartbeat {
+	return &jsonHeartbeat{
+		Time:     t,
+		Type:     eventHeartbeat,
+		Packets:  c.packets,
+		Flows:    c.flows,
+		Messages: c.messages,
+	}
+}
+
+// statsJSON returns the numbers of attempted, succeeded, declined, and
+// fallen back handshakes in counts of the interval ending at time t as JSON
+// event
+func statsJSON(t time.Time, counts [4]uint64,
+	interval time.Duration) *jsonStats {
+	return &jsonStats{
+		Time:      t,
+		Type:      eventStats,
+		Interval:  interval.String(),
+		Attempted: counts[0],
+		Succeeded: counts[1],
+		Declined:  counts[2],
+		Fallbacks: counts[3],
+	}
+}
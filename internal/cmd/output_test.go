@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestParseOutput(t *testing.T) {
+	for _, test := range []struct {
+		spec   string
+		text   bool
+		format string
+		file   string
+		err    bool
+	}{
+		{"text", true, "", "", false},
+		{"json", false, "json", "-", false},
+		{"json:clc.jsonl", false, "json", "clc.jsonl", false},
+		{"jsonl", false, "json", "-", false},
+		{"jsonl:clc.jsonl", false, "json", "clc.jsonl", false},
+		{"text+json:clc.jsonl", true, "json", "clc.jsonl", false},
+		{"csv", false, "csv", "-", false},
+		{"csv:clc.csv", false, "csv", "clc.csv", false},
+		{"text+csv:clc.csv", true, "csv", "clc.csv", false},
+		{"protobuf:clc.pb", false, "protobuf", "clc.pb", false},
+		{"text+protobuf:clc.pb", true, "protobuf", "clc.pb", false},
+		{"cef", false, "cef", "-", false},
+		{"text+cef:clc.cef", true, "cef", "clc.cef", false},
+		{"text+json", false, "", "", true},
+		{"text+csv:-", false, "", "", true},
+		{"text:clc.txt", false, "", "", true},
+		{"xml", false, "", "", true},
+	} {
+		text, format, file, err := parseOutput(test.spec)
+		if text != test.text || format != test.format ||
+			file != test.file || (err != nil) != test.err {
+			t.Errorf("%s: got = %t, %s, %s, %v; want %t, %s, %s, %t",
+				test.spec, text, format, file, err, test.text,
+				test.format, test.file, test.err)
+		}
+	}
+}
+
+func TestWriteCLCJSON(t *testing.T) {
+	var buf bytes.Buffer
+	jsonOutput = &buf
+	defer func() { jsonOutput = nil }()
+
+	// write decline message
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	msg := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	writeJSON(clcJSON(time.Now(), net, trans, msg, 0, nil))
+
+	// check JSON output
+	var got jsonMessage
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Src != "1.2.3.4:123" || got.Dst != "5.6.7.8:456" ||
+		got.Type != "decline" || got.Message != msg.String() {
+		t.Errorf("got = %v; want decline from 1.2.3.4:123 to "+
+			"5.6.7.8:456", got)
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// pathSelections stores the path selection table
+	pathSelections pathSelectionTable
+)
+
+// pathSelection stores the number of accepts per path, the last selected
+// path, and the number of path switches of a server
+type pathSelection struct {
+	smcr, smcd uint64
+	last       clc.Path
+	switches   uint64
+}
+
+// pathSelectionTable stores the paths servers selected in handshakes with
+// proposals offering both SMC-R and SMC-D protected by a mutex
+type pathSelectionTable struct {
+	lock    sync.Mutex
+	servers map[gopacket.Endpoint]*pathSelection
+}
+
+// init initializes the path selection table
+func (pt *pathSelectionTable) init() {
+	pt.lock.Lock()
+	if pt.servers == nil {
+		pt.servers = make(map[gopacket.Endpoint]*pathSelection)
+	}
+	pt.lock.Unlock()
+}
+
+// add adds the path the server selected in the finished handshake r to the
+// path selection table if the proposal offered both SMC-R and SMC-D. It
+// returns the previous path and true if the server switched to another path
+func (pt *pathSelectionTable) add(r *handshakeResult) (clc.Path, bool) {
+	if !r.accepted || !r.offeredBoth {
+		return 0, false
+	}
+
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	if pt.servers == nil {
+		return 0, false
+	}
+	server := r.key.net.Dst()
+	s := pt.servers[server]
+	if s == nil {
+		s = &pathSelection{last: r.path}
+		pt.servers[server] = s
+	}
+	switch r.path {
+	case clc.SMCTypeR:
+		s.smcr++
+	case clc.SMCTypeD:
+		s.smcd++
+	}
+	previous := s.last
+	if previous == r.path {
+		return previous, false
+	}
+	s.switches++
+	s.last = r.path
+	return previous, true
+}
+
+// summary returns the path selection summary with one line per server
+func (pt *pathSelectionTable) summary() []string {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	servers := make([]gopacket.Endpoint, 0, len(pt.servers))
+	for server := range pt.servers {
+		servers = append(servers, server)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].LessThan(servers[j])
+	})
+
+	var lines []string
+	for _, server := range servers {
+		s := pt.servers[server]
+		selection := "consistent"
+		if s.switches > 0 {
+			selection = fmt.Sprintf("inconsistent, %d switches",
+				s.switches)
+		}
+		lines = append(lines, fmt.Sprintf("%s: SMC-R: %d, SMC-D: %d "+
+			"(%s)", server, s.smcr, s.smcd, selection))
+	}
+	return lines
+}
+
+// printPathSwitch prints that the server of the finished handshake r switched
+// from the previous path to another path
+func printPathSwitch(r *handshakeResult, previous clc.Path) {
+	switchFmt := "%s%s -> %s: Path Switch: server selected %s instead " +
+		"of %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, switchFmt, t, hostString(r.key.net.Src(),
+		r.key.trans.Src()), hostString(r.key.net.Dst(),
+		r.key.trans.Dst()), r.path, previous)
+}
+
+// printPathSummary prints the path selection summary
+func printPathSummary() {
+	for _, line := range pathSelections.summary() {
+		fmt.Fprintf(stdout, "Path Summary: %s\n", line)
+	}
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestPathSelectionTable(t *testing.T) {
+	var pt pathSelectionTable
+
+	// prepare handshake results of two servers
+	net1, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	net2, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 9)))
+	result := func(net gopacket.Flow, path clc.Path,
+		both bool) *handshakeResult {
+		return &handshakeResult{
+			key:         handshakeKey{net: net},
+			accepted:    true,
+			path:        path,
+			offeredBoth: both,
+		}
+	}
+
+	// test path switches
+	pt.init()
+	var got []bool
+	for _, r := range []*handshakeResult{
+		result(net1, clc.SMCTypeR, true),
+		result(net1, clc.SMCTypeR, true),
+		result(net1, clc.SMCTypeD, false),
+		result(net2, clc.SMCTypeD, true),
+		result(net2, clc.SMCTypeR, true),
+		result(net2, clc.SMCTypeD, true),
+	} {
+		_, switched := pt.add(r)
+		got = append(got, switched)
+	}
+	wantSwitches := []bool{false, false, false, false, true, true}
+	if !reflect.DeepEqual(got, wantSwitches) {
+		t.Errorf("got = %v; want %v", got, wantSwitches)
+	}
+
+	// test summary
+	want := []string{
+		"5.6.7.8: SMC-R: 2, SMC-D: 0 (consistent)",
+		"5.6.7.9: SMC-R: 1, SMC-D: 2 (inconsistent, 2 switches)",
+	}
+	if got := pt.summary(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
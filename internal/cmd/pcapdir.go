@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// pcapDirInterval is the interval for checking the pcap directory for
+	// new files
+	pcapDirInterval = time.Second
+)
+
+// sortPcapFiles returns the regular files in files sorted by modification
+// time and name
+func sortPcapFiles(files []string) []string {
+	// get modification times of regular files
+	type pcapFile struct {
+		name    string
+		modTime time.Time
+	}
+	var pfs []pcapFile
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			// file may have been removed in the meantime
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		pfs = append(pfs, pcapFile{f, info.ModTime()})
+	}
+
+	// sort files by modification time and name
+	sort.Slice(pfs, func(i, j int) bool {
+		if pfs[i].modTime.Equal(pfs[j].modTime) {
+			return pfs[i].name < pfs[j].name
+		}
+		return pfs[i].modTime.Before(pfs[j].modTime)
+	})
+	sorted := make([]string, 0, len(pfs))
+	for _, pf := range pfs {
+		sorted = append(sorted, pf.name)
+	}
+	return sorted
+}
+
+// completedPcapFiles returns the completed pcap files in directory dir that
+// match pattern and are not in done, sorted by modification time. The newest
+// matching file is considered incomplete because it may still be written
+func completedPcapFiles(dir, pattern string,
+	done map[string]bool) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	files := sortPcapFiles(matches)
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	// skip newest file
+	var completed []string
+	for _, f := range files[:len(files)-1] {
+		if !done[f] {
+			completed = append(completed, f)
+		}
+	}
+	return completed, nil
+}
+
+// finishPcapFile deletes or archives the processed pcap file if configured,
+// it returns true if the file was removed from the pcap directory
+func finishPcapFile(file string) bool {
+	if *pcapDirArchive != "" {
+		archived := filepath.Join(*pcapDirArchive, filepath.Base(file))
+		if err := os.Rename(file, archived); err != nil {
+			log.Println("Error archiving pcap file:", err)
+			return false
+		}
+		return true
+	}
+	if *pcapDirDelete {
+		if err := os.Remove(file); err != nil {
+			log.Println("Error deleting pcap file:", err)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// listenDir reads packets from completed pcap files in the pcap directory
+// and handles them with handler
+func listenDir(handler *handler) {
+	done := make(map[string]bool)
+	for !interrupted.Load() {
+		files, err := completedPcapFiles(*pcapDir, *pcapDirPattern,
+			done)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, file := range files {
+			if interrupted.Load() {
+				return
+			}
+			listenFile(handler, file)
+			if !finishPcapFile(file) {
+				done[file] = true
+			}
+		}
+		time.Sleep(pcapDirInterval)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompletedPcapFiles(t *testing.T) {
+	// create temporary pcap directory with files
+	dir, err := os.MkdirTemp("", "pcapdir")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"smc-2.pcap", "smc-1.pcap",
+		"smc-3.pcap", "other.pcap"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			log.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i) * time.Second)
+		if name == "smc-1.pcap" {
+			modTime = now.Add(-time.Second)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// test matching files, newest file is skipped
+	done := make(map[string]bool)
+	want := []string{
+		filepath.Join(dir, "smc-1.pcap"),
+		filepath.Join(dir, "smc-2.pcap"),
+	}
+	got, err := completedPcapFiles(dir, "smc-*.pcap", done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test with already processed file
+	done[filepath.Join(dir, "smc-1.pcap")] = true
+	want = want[1:]
+	got, _ = completedPcapFiles(dir, "smc-*.pcap", done)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test archiving processed file
+	archive, err := os.MkdirTemp("", "pcaparchive")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(archive)
+	*pcapDirArchive = archive
+	if !finishPcapFile(filepath.Join(dir, "smc-2.pcap")) {
+		t.Errorf("finishPcapFile() = false; want true")
+	}
+	*pcapDirArchive = ""
+	if _, err := os.Stat(filepath.Join(archive, "smc-2.pcap")); err != nil {
+		t.Errorf("archived file error = %v; want nil", err)
+	}
+}
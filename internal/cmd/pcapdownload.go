@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+const (
+	// pcapDownloadConns is the maximum number of connections with stored
+	// packets for the pcap download http api
+	pcapDownloadConns = 1000
+
+	// pcapDownloadPackets is the maximum number of stored packets per
+	// connection for the pcap download http api
+	pcapDownloadPackets = 100
+)
+
+var (
+	// pcapDownloads stores the pcap download table
+	pcapDownloads pcapDownloadTable
+)
+
+// pcapDownloadConn is a connection in the pcap download table with its
+// handshake session, if its handshake is finished, and its packets
+type pcapDownloadConn struct {
+	key     extractKey
+	session uint64
+	done    bool
+	packets []gopacket.Packet
+}
+
+// src returns the source address of the connection
+func (c *pcapDownloadConn) src() string {
+	return fmt.Sprintf("%s:%s", c.key.net.Src(), c.key.trans.Src())
+}
+
+// dst returns the destination address of the connection
+func (c *pcapDownloadConn) dst() string {
+	return fmt.Sprintf("%s:%s", c.key.net.Dst(), c.key.trans.Dst())
+}
+
+// matches checks if the connection matches the handshake session and the
+// source and destination host or address in either direction, empty and zero
+// values match all connections
+func (c *pcapDownloadConn) matches(session uint64, src, dst string) bool {
+	if session != 0 && c.session != session {
+		return false
+	}
+	return (matchAddress(c.src(), src) && matchAddress(c.dst(), dst)) ||
+		(matchAddress(c.dst(), src) && matchAddress(c.src(), dst))
+}
+
+// pcapDownloadTable stores the packets of recent SMC connections up to the
+// end of their handshakes for the pcap download http api protected by a
+// mutex. If it is full, the oldest connection is removed
+type pcapDownloadTable struct {
+	lock  sync.Mutex
+	conns map[extractKey]*pcapDownloadConn
+	order []*pcapDownloadConn
+}
+
+// init initializes and enables the pcap download table
+func (pd *pcapDownloadTable) init() {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+	pd.conns = make(map[extractKey]*pcapDownloadConn)
+	pd.order = nil
+}
+
+// lookup returns the connection identified by the network flow net and the
+// transport flow trans in either direction, pd must be locked
+func (pd *pcapDownloadTable) lookup(net,
+	trans gopacket.Flow) *pcapDownloadConn {
+	if c := pd.conns[extractKey{net, trans}]; c != nil {
+		return c
+	}
+	return pd.conns[extractKey{net.Reverse(), trans.Reverse()}]
+}
+
+// write stores the packet sent over the network flow net and the transport
+// flow trans if the handshake of its connection is not finished. A SYN
+// starts a new connection
+func (pd *pcapDownloadTable) write(packet gopacket.Packet, net,
+	trans gopacket.Flow, syn bool) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	if pd.conns == nil {
+		return
+	}
+	c := pd.lookup(net, trans)
+	if c != nil && c.done && !syn {
+		return
+	}
+	if c == nil || syn {
+		if c != nil {
+			delete(pd.conns, c.key)
+		}
+		if len(pd.order) == pcapDownloadConns {
+			if pd.conns[pd.order[0].key] == pd.order[0] {
+				delete(pd.conns, pd.order[0].key)
+			}
+			pd.order = pd.order[1:]
+		}
+		c = &pcapDownloadConn{key: extractKey{net, trans}}
+		pd.conns[c.key] = c
+		pd.order = append(pd.order, c)
+	}
+	if len(c.packets) < pcapDownloadPackets {
+		c.packets = append(c.packets, packet)
+	}
+}
+
+// setSession sets the handshake session of the connection identified by the
+// network flow net and the transport flow trans, session 0 is ignored
+func (pd *pcapDownloadTable) setSession(net, trans gopacket.Flow,
+	session uint64) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	if c := pd.lookup(net, trans); c != nil && session != 0 {
+		c.session = session
+	}
+}
+
+// finish marks the handshake of the connection identified by the network
+// flow net and the transport flow trans as finished
+func (pd *pcapDownloadTable) finish(net, trans gopacket.Flow) {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	if c := pd.lookup(net, trans); c != nil {
+		c.done = true
+	}
+}
+
+// get returns the packets of the connections matching the handshake session
+// and the source and destination host or address
+func (pd *pcapDownloadTable) get(session uint64,
+	src, dst string) []gopacket.Packet {
+	pd.lock.Lock()
+	defer pd.lock.Unlock()
+
+	var packets []gopacket.Packet
+	for _, c := range pd.order {
+		if pd.conns[c.key] != c || !c.matches(session, src, dst) {
+			continue
+		}
+		packets = append(packets, c.packets...)
+	}
+	return packets
+}
+
+// handlePcapDownload handles http requests for the packets of connections
+// selected by the query parameters session, src, and dst as pcap file
+func handlePcapDownload(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	session, err := parseMessageUint(values, "session")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	src, dst := values.Get("src"), values.Get("dst")
+	if session == 0 && src == "" && dst == "" {
+		http.Error(w, "missing session, src, or dst",
+			http.StatusBadRequest)
+		return
+	}
+	packets := pcapDownloads.get(session, src, dst)
+	if len(packets) == 0 {
+		http.Error(w, "no packets found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	var writer *pcapgo.Writer
+	for _, packet := range packets {
+		if err := writePcapPacket(&writer, &buf, packet); err != nil {
+			http.Error(w, err.Error(),
+				http.StatusInternalServerError)
+			return
+		}
+	}
+	name := "smc-clc.pcap"
+	if session != 0 {
+		name = fmt.Sprintf("smc-clc-session-%d.pcap", session)
+	}
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", name))
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// registerPcapDownloadAPI enables the pcap download table and registers the
+// pcap download http api
+func registerPcapDownloadAPI() {
+	pcapDownloads.init()
+	http.HandleFunc("/api/v1/pcap", handlePcapDownload)
+}
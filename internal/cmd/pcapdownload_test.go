@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+func TestPcapDownload(t *testing.T) {
+	// disabled table ignores packets
+	pcapDownloads = pcapDownloadTable{}
+	defer func() { pcapDownloads = pcapDownloadTable{} }()
+	packets := demoSessions[0].packets()
+	var net, trans gopacket.Flow
+	write := func(p []byte) {
+		packet := gopacket.NewPacket(p, layers.LayerTypeEthernet,
+			gopacket.Default)
+		tcp := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+		net = packet.NetworkLayer().NetworkFlow()
+		trans = tcp.TransportFlow()
+		pcapDownloads.write(packet, net, trans, tcp.SYN && !tcp.ACK)
+	}
+	write(packets[0])
+	if got := pcapDownloads.get(0, "", ""); len(got) != 0 {
+		t.Errorf("got %d packets; want 0", len(got))
+	}
+
+	// store packets of demo session, packets after the end of the
+	// handshake are ignored
+	pcapDownloads.init()
+	for _, p := range packets {
+		write(p)
+	}
+	pcapDownloads.setSession(net, trans, 1)
+	pcapDownloads.finish(net, trans)
+	write(packets[len(packets)-1])
+
+	for _, test := range []struct {
+		query string
+		code  int
+		name  string
+	}{
+		{"", http.StatusBadRequest, ""},
+		{"?session=x", http.StatusBadRequest, ""},
+		{"?session=2", http.StatusNotFound, ""},
+		{"?session=1", http.StatusOK, "smc-clc-session-1.pcap"},
+		{"?src=127.0.0.1", http.StatusOK, "smc-clc.pcap"},
+		{"?src=127.0.0.1:" + trans.Dst().String(), http.StatusOK,
+			"smc-clc.pcap"},
+		{"?src=127.0.0.2", http.StatusNotFound, ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/pcap"+
+			test.query, nil)
+		w := httptest.NewRecorder()
+		handlePcapDownload(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: got %d; want %d", test.query, w.Code,
+				test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		want := `attachment; filename="` + test.name + `"`
+		if cd := w.Header().Get("Content-Disposition"); cd != want {
+			t.Errorf("%s: got %q; want %q", test.query, cd, want)
+		}
+
+		// test downloaded packets
+		r2, err := pcapgo.NewReader(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, want := range packets {
+			got, _, err := r2.ReadPacketData()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("packet %d: got %x; want %x", i, got,
+					want)
+			}
+		}
+		if _, _, err := r2.ReadPacketData(); err == nil {
+			t.Errorf("%s: got more packets; want end of file",
+				test.query)
+		}
+	}
+}
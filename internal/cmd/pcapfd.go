@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	gopcap "github.com/gopacket/gopacket/pcap"
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+// pcapFDFile returns the file with the pcap stream in the inherited file
+// descriptor or in the file descriptor received over the unix socket
+func pcapFDFile() (*os.File, error) {
+	if *pcapUnix != "" {
+		return receiveFD(*pcapUnix)
+	}
+	name := fmt.Sprintf("file descriptor %d", *pcapFD)
+	f := os.NewFile(uintptr(*pcapFD), name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid %s", name)
+	}
+	return f, nil
+}
+
+// prepareFD prepares the listener for reading packets from the pcap stream
+// in a passed file descriptor instead of opening a pcap file or network
+// interface itself, so capturing can be done by a privileged helper
+func prepareFD(listener *pcap.Listener) {
+	f, err := pcapFDFile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	handle, err := gopcap.OpenOfflineFile(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listener.PcapHandle = handle
+	setListenerFilter(listener)
+	log.Printf("Reading packets from %s:\n", f.Name())
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"errors"
+	"os"
+)
+
+// receiveFD is not supported on this platform
+func receiveFD(path string) (*os.File, error) {
+	return nil, errors.New("receiving file descriptors is not supported")
+}
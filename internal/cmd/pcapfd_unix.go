@@ -0,0 +1,46 @@
+//go:build unix
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// receiveFD connects to the unix socket at path and receives a file
+// descriptor
+func receiveFD(path string) (*os.File, error) {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{
+		Name: path,
+		Net:  "unix",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		fds, err := syscall.ParseUnixRights(&msg)
+		if err != nil || len(fds) == 0 {
+			continue
+		}
+		for _, fd := range fds[1:] {
+			syscall.Close(fd)
+		}
+		name := fmt.Sprintf("file descriptor received on %s", path)
+		return os.NewFile(uintptr(fds[0]), name), nil
+	}
+	return nil, fmt.Errorf("no file descriptor received on %s", path)
+}
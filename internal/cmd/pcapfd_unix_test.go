@@ -0,0 +1,67 @@
+//go:build unix
+
+package cmd
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestReceiveFD(t *testing.T) {
+	// create test file and unix socket
+	dir, err := os.MkdirTemp("", "smc-clc-fd")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.pcap")
+	if err := os.WriteFile(file, []byte("test"), 0600); err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(dir, "socket")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+
+	// pass file descriptor of test file to client
+	go func() {
+		conn, err := l.AcceptUnix()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		oob := syscall.UnixRights(int(f.Fd()))
+		if _, _, err := conn.WriteMsgUnix([]byte{0}, oob,
+			nil); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// receive file descriptor and read test file
+	f, err := receiveFD(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "test"
+	got := string(b)
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// pcapFileList is a list of pcap files or glob patterns of pcap files set
+// with repeated command line arguments
+type pcapFileList []string
+
+// pcapFileFlag defines the pcap file list command line argument name with
+// usage and returns the pcap file list
+func pcapFileFlag(name, usage string) *pcapFileList {
+	pl := &pcapFileList{}
+	flag.Var(pl, name, usage)
+	return pl
+}
+
+// String converts the pcap file list to a comma-separated string
+func (pl *pcapFileList) String() string {
+	return strings.Join(*pl, ",")
+}
+
+// Set adds the pcap file or glob pattern in value to the pcap file list
+func (pl *pcapFileList) Set(value string) error {
+	if value == "" {
+		return errors.New("empty pcap file name")
+	}
+	*pl = append(*pl, value)
+	return nil
+}
+
+// expandPcapFiles returns the pcap files in the pcap file list with glob
+// patterns expanded. The files matching a pattern are sorted by modification
+// time and name, so rotated capture files are read in the order they were
+// written, e.g., by tcpdump -C or -G
+func expandPcapFiles(pl pcapFileList) ([]string, error) {
+	var files []string
+	for _, p := range pl {
+		if !strings.ContainsAny(p, "*?[") {
+			files = append(files, p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pcap file "+
+				"pattern %q: %w", p, err)
+		}
+		matches = sortPcapFiles(matches)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no pcap files match pattern %q",
+				p)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// listenFiles reads packets from the pcap files in the pcap file list one
+// after the other and handles them with handler
+func listenFiles(handler *handler, pl pcapFileList) {
+	files, err := expandPcapFiles(pl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range files {
+		if interrupted.Load() {
+			return
+		}
+		listenFile(handler, file)
+	}
+}
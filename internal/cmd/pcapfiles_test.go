@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPcapFileList(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	pl := pcapFileList{}
+	fs.Var(&pl, "f", "")
+	err := fs.Parse([]string{"-f", "a.pcap", "-f", "b*.pcap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pcapFileList{"a.pcap", "b*.pcap"}
+	if !reflect.DeepEqual(pl, want) {
+		t.Errorf("got = %v; want %v", pl, want)
+	}
+	if err := fs.Parse([]string{"-f", ""}); err == nil {
+		t.Errorf("got nil; want error")
+	}
+}
+
+func TestExpandPcapFiles(t *testing.T) {
+	// create temporary directory with rotated pcap files
+	dir, err := os.MkdirTemp("", "pcapfiles")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"dump.pcap", "dump.pcap1",
+		"dump.pcap2", "dump.pcap10"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, nil, 0600); err != nil {
+			log.Fatal(err)
+		}
+		modTime := now.Add(time.Duration(i) * time.Second)
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// test files and glob pattern, matches are sorted by modification
+	// time and files are kept as is
+	other := filepath.Join(dir, "other.pcap")
+	got, err := expandPcapFiles(pcapFileList{other,
+		filepath.Join(dir, "dump.pcap*")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		other,
+		filepath.Join(dir, "dump.pcap"),
+		filepath.Join(dir, "dump.pcap1"),
+		filepath.Join(dir, "dump.pcap2"),
+		filepath.Join(dir, "dump.pcap10"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test glob patterns without matches and invalid patterns
+	for _, p := range []string{"smc-*.pcap", "[.pcap"} {
+		_, err := expandPcapFiles(pcapFileList{filepath.Join(dir, p)})
+		if err == nil {
+			t.Errorf("%s: got nil; want error", p)
+		}
+	}
+}
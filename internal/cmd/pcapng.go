@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/pcapgo"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// pcapng block types and options
+const (
+	pcapngSectionHeader    = 0x0a0d0d0a
+	pcapngInterface        = 1
+	pcapngEnhancedPacket   = 6
+	pcapngByteOrderMagic   = 0x1a2b3c4d
+	pcapngOptEnd           = 0
+	pcapngOptComment       = 1
+	pcapngOptTSResol       = 9
+	pcapngTSResolNanosecs  = 9
+	pcapngCommentDelay     = time.Second
+	pcapngMaxPendingPacket = 10000
+)
+
+// pcapngOption appends the option with code and value padded to 32 bits to
+// buf
+func pcapngOption(buf []byte, code uint16, value []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, code)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	buf = append(buf, value...)
+	return append(buf, make([]byte, (4-len(value)%4)%4)...)
+}
+
+// pcapngBlock returns the block of type typ with body padded to 32 bits
+func pcapngBlock(typ uint32, body []byte) []byte {
+	body = append(body, make([]byte, (4-len(body)%4)%4)...)
+	n := uint32(12 + len(body))
+	b := binary.LittleEndian.AppendUint32(nil, typ)
+	b = binary.LittleEndian.AppendUint32(b, n)
+	b = append(b, body...)
+	return binary.LittleEndian.AppendUint32(b, n)
+}
+
+// pcapngHeader returns the section header block and the interface
+// description block with nanosecond timestamps of the link type
+func pcapngHeader(linkType uint16) []byte {
+	shb := binary.LittleEndian.AppendUint32(nil, pcapngByteOrderMagic)
+	shb = binary.LittleEndian.AppendUint16(shb, 1)
+	shb = binary.LittleEndian.AppendUint16(shb, 0)
+	shb = binary.LittleEndian.AppendUint64(shb, ^uint64(0))
+
+	idb := binary.LittleEndian.AppendUint16(nil, linkType)
+	idb = binary.LittleEndian.AppendUint16(idb, 0)
+	idb = binary.LittleEndian.AppendUint32(idb, extractSnaplen)
+	idb = pcapngOption(idb, pcapngOptTSResol,
+		[]byte{pcapngTSResolNanosecs})
+	idb = pcapngOption(idb, pcapngOptEnd, nil)
+
+	return append(pcapngBlock(pcapngSectionHeader, shb),
+		pcapngBlock(pcapngInterface, idb)...)
+}
+
+// pcapFileHeader returns the file header of a pcap file or, if ng is set, of
+// a pcapng file with the link type of the capture
+func pcapFileHeader(ng bool) ([]byte, error) {
+	if ng {
+		return pcapngHeader(uint16(captureLinkType())), nil
+	}
+	var b bytes.Buffer
+	err := pcapgo.NewWriter(&b).WriteFileHeader(extractSnaplen,
+		captureLinkType())
+	return b.Bytes(), err
+}
+
+// pcapngPacket returns the enhanced packet block of the packet data with
+// capture info ci and comments
+func pcapngPacket(ci gopacket.CaptureInfo, data []byte,
+	comments []string) []byte {
+	ts := uint64(ci.Timestamp.UnixNano())
+	epb := binary.LittleEndian.AppendUint32(nil, 0)
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts>>32))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ts))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(len(data)))
+	epb = binary.LittleEndian.AppendUint32(epb, uint32(ci.Length))
+	epb = append(epb, data...)
+	epb = append(epb, make([]byte, (4-len(data)%4)%4)...)
+	if len(comments) > 0 {
+		for _, c := range comments {
+			epb = pcapngOption(epb, pcapngOptComment, []byte(c))
+		}
+		epb = pcapngOption(epb, pcapngOptEnd, nil)
+	}
+	return pcapngBlock(pcapngEnhancedPacket, epb)
+}
+
+// pcapPending is a packet of a pcapng export waiting for comments with its
+// network and transport flows and the time it was queued
+type pcapPending struct {
+	ci         gopacket.CaptureInfo
+	data       []byte
+	net, trans gopacket.Flow
+	payload    bool
+	queued     time.Time
+	comments   []string
+}
+
+// pcapExport writes packets to a pcap file or, if the file name ends with
+// .pcapng, to a pcapng file with the decoded CLC messages as packet
+// comments. CLC messages are decoded after their packets are handled, so
+// pcapng packets are queued for a short time to attach the comments. Each
+// packet is written to the file at once, so rotating files do not split it
+type pcapExport struct {
+	file    io.WriteCloser
+	ng      bool
+	writer  *pcapgo.Writer
+	buf     bytes.Buffer
+	header  bool
+	pending []*pcapPending
+}
+
+// newPcapExport creates the pcap or pcapng file
+func newPcapExport(file string) (*pcapExport, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	return &pcapExport{
+		file: f,
+		ng:   strings.HasSuffix(file, ".pcapng"),
+	}, nil
+}
+
+// write writes the packet to the pcap file or queues it for the pcapng file
+func (pe *pcapExport) write(packet gopacket.Packet) error {
+	if !pe.ng {
+		pe.buf.Reset()
+		err := writePcapPacket(&pe.writer, &pe.buf, packet)
+		if err != nil {
+			return err
+		}
+		_, err = pe.file.Write(pe.buf.Bytes())
+		return err
+	}
+
+	// generated packets, e.g., of demo sessions, have no capture info
+	ci := packet.Metadata().CaptureInfo
+	if ci.CaptureLength == 0 {
+		ci.CaptureLength = len(packet.Data())
+		ci.Length = ci.CaptureLength
+	}
+	p := &pcapPending{
+		ci:     ci,
+		data:   packet.Data(),
+		queued: time.Now(),
+	}
+	if packet.NetworkLayer() != nil && packet.TransportLayer() != nil {
+		p.net = packet.NetworkLayer().NetworkFlow()
+		p.trans = packet.TransportLayer().TransportFlow()
+		p.payload = len(packet.TransportLayer().LayerPayload()) > 0
+	}
+	pe.pending = append(pe.pending, p)
+	return pe.flush(false)
+}
+
+// annotate attaches the comment to the queued packet of the network flow net
+// and the transport flow trans captured at time seen, or the last queued
+// packet of the flows with payload. Comments of written packets are dropped
+func (pe *pcapExport) annotate(net, trans gopacket.Flow, seen time.Time,
+	comment string) {
+	var last *pcapPending
+	for i := len(pe.pending) - 1; i >= 0; i-- {
+		p := pe.pending[i]
+		if p.net != net || p.trans != trans || !p.payload {
+			continue
+		}
+		if p.ci.Timestamp.Equal(seen) {
+			last = p
+			break
+		}
+		if last == nil {
+			last = p
+		}
+	}
+	if last != nil {
+		last.comments = append(last.comments, comment)
+	}
+}
+
+// flush writes the queued packets to the pcapng file, all packets or only
+// the packets queued for longer than the comment delay
+func (pe *pcapExport) flush(all bool) error {
+	if !pe.header && len(pe.pending) > 0 {
+		header := pcapngHeader(uint16(captureLinkType()))
+		if _, err := pe.file.Write(header); err != nil {
+			return err
+		}
+		pe.header = true
+	}
+	n := 0
+	for _, p := range pe.pending {
+		if !all && len(pe.pending)-n <= pcapngMaxPendingPacket &&
+			time.Since(p.queued) < pcapngCommentDelay {
+			break
+		}
+		b := pcapngPacket(p.ci, p.data, p.comments)
+		if _, err := pe.file.Write(b); err != nil {
+			return err
+		}
+		n++
+	}
+	pe.pending = pe.pending[n:]
+	return nil
+}
+
+// close writes the queued packets and closes the file
+func (pe *pcapExport) close() error {
+	err := pe.flush(true)
+	if e := pe.file.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// pcapComment returns the CLC message msg with its parse warnings as packet
+// comment
+func pcapComment(msg clc.Message, warnings parseWarnings) string {
+	return "smc-clc: " + msg.String() + warnings.String()
+}
+
+// annotatePcapExports attaches the CLC message msg with its parse warnings
+// sent over the network flow net and the transport flow trans and seen at
+// time seen as comment to the packet in the pcapng exports
+func annotatePcapExports(net, trans gopacket.Flow, seen time.Time,
+	msg clc.Message, warnings parseWarnings) {
+	comment := pcapComment(msg, warnings)
+	extracts.annotate(net, trans, seen, comment)
+	pcapWrites.annotate(net, trans, seen, comment)
+}
+
+// flushPcapExports writes the packets queued for longer than the comment
+// delay in the pcapng exports
+func flushPcapExports() {
+	extracts.flush()
+	pcapWrites.flush()
+}
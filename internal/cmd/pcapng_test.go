@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+// pcapngTestComments returns the comments of the enhanced packet blocks in the
+// pcapng file data
+func pcapngTestComments(t *testing.T, data []byte) [][]string {
+	var comments [][]string
+	for len(data) > 0 {
+		typ := binary.LittleEndian.Uint32(data)
+		n := binary.LittleEndian.Uint32(data[4:])
+		if n < 12 || int(n) > len(data) {
+			t.Fatalf("invalid block length %d", n)
+		}
+		if typ == pcapngEnhancedPacket {
+			body := data[8 : n-4]
+			capLen := int(binary.LittleEndian.Uint32(body[12:]))
+			opts := body[20+capLen+(4-capLen%4)%4:]
+			var c []string
+			for len(opts) >= 4 {
+				code := binary.LittleEndian.Uint16(opts)
+				l := int(binary.LittleEndian.Uint16(opts[2:]))
+				if code == pcapngOptComment {
+					c = append(c, string(opts[4:4+l]))
+				}
+				opts = opts[4+l+(4-l%4)%4:]
+			}
+			comments = append(comments, c)
+		}
+		data = data[n:]
+	}
+	return comments
+}
+
+// seenAtIndex returns the capture timestamp of the i-th test packet
+func seenAtIndex(start time.Time, i int) time.Time {
+	return start.Add(time.Duration(i) * time.Millisecond)
+}
+
+func TestPcapExportPcapng(t *testing.T) {
+	// write packets of demo session to pcapng file
+	file := filepath.Join(t.TempDir(), "smc.pcapng")
+	pe, err := newPcapExport(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := demoSessions[0].packets()
+	payload := -1
+	start := time.Unix(1700000000, 0)
+	for i, p := range packets {
+		packet := gopacket.NewPacket(p, layers.LayerTypeEthernet,
+			gopacket.Default)
+		packet.Metadata().Timestamp = seenAtIndex(start, i)
+		packet.Metadata().CaptureLength = len(p)
+		packet.Metadata().Length = len(p)
+		if err := pe.write(packet); err != nil {
+			t.Fatal(err)
+		}
+		if payload == -1 && packet.TransportLayer() != nil &&
+			len(packet.TransportLayer().LayerPayload()) > 0 {
+			payload = i
+		}
+	}
+
+	// annotate first packet with payload by its timestamp, the reply
+	// without matching timestamp, and close file
+	packet := gopacket.NewPacket(packets[payload],
+		layers.LayerTypeEthernet, gopacket.Default)
+	net := packet.NetworkLayer().NetworkFlow()
+	trans := packet.TransportLayer().TransportFlow()
+	pe.annotate(net, trans, seenAtIndex(start, payload), "first")
+	pe.annotate(net.Reverse(), trans.Reverse(), time.Time{}, "reply")
+	if err := pe.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// test packets
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range packets {
+		got, _, err := r.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("packet %d: got = %x; want %x", i, got, want)
+		}
+	}
+	if _, _, err := r.ReadPacketData(); err == nil {
+		t.Error("got more packets; want end of file")
+	}
+
+	// test comments
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comments := pcapngTestComments(t, data)
+	if len(comments) != len(packets) {
+		t.Fatalf("got %d packet blocks; want %d", len(comments),
+			len(packets))
+	}
+	n := 0
+	for i, c := range comments {
+		n += len(c)
+		if i == payload && !reflect.DeepEqual(c, []string{"first"}) {
+			t.Errorf("packet %d: got comments %q; want first", i, c)
+		}
+	}
+	if n != 2 {
+		t.Errorf("got %d comments; want 2", n)
+	}
+}
+
+func TestPcapExportPcap(t *testing.T) {
+	// pcap files have no comments
+	file := filepath.Join(t.TempDir(), "smc.pcap")
+	pe, err := newPcapExport(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(demoSessions[0].packets()[0],
+		layers.LayerTypeEthernet, gopacket.Default)
+	if err := pe.write(packet); err != nil {
+		t.Fatal(err)
+	}
+	pe.annotate(packet.NetworkLayer().NetworkFlow(),
+		packet.TransportLayer().TransportFlow(), time.Time{}, "ignored")
+	if err := pe.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := r.ReadPacketData(); err != nil ||
+		string(got) != string(packet.Data()) {
+		t.Errorf("got = %x, %v; want %x", got, err, packet.Data())
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	gopcap "github.com/gopacket/gopacket/pcap"
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+// pcapTuned checks if pcap tuning settings are set on the command line
+func pcapTuned() bool {
+	return *pcapBufferSize > 0 || *pcapImmediate ||
+		*pcapTimestampSource != ""
+}
+
+// timestampSources returns the names of the timestamp sources supported by
+// the inactive pcap handle
+func timestampSources(inactive *gopcap.InactiveHandle) string {
+	var sources []string
+	for _, s := range inactive.SupportedTimestamps() {
+		sources = append(sources, s.String())
+	}
+	if len(sources) == 0 {
+		return "none"
+	}
+	return strings.Join(sources, ", ")
+}
+
+// openTuned opens a live pcap handle on the network interface device with
+// the snaplen, promiscuous mode, and timeout of the listener l and the pcap
+// tuning settings
+func openTuned(l *pcap.Listener, device string) (*gopcap.Handle, error) {
+	inactive, err := gopcap.NewInactiveHandle(device)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	timeout := gopcap.BlockForever
+	if l.Timeout > 0 {
+		timeout = l.Timeout
+	}
+	if err := inactive.SetSnapLen(l.Snaplen); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetPromisc(l.Promisc); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetTimeout(timeout); err != nil {
+		return nil, err
+	}
+	if *pcapBufferSize > 0 {
+		err := inactive.SetBufferSize(*pcapBufferSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if *pcapImmediate {
+		if err := inactive.SetImmediateMode(true); err != nil {
+			return nil, err
+		}
+	}
+	if *pcapTimestampSource != "" {
+		source, err := gopcap.TimestampSourceFromString(
+			*pcapTimestampSource)
+		if err == nil {
+			err = inactive.SetTimestampSource(source)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("timestamp source %s not "+
+				"supported on %s (supported: %s)",
+				*pcapTimestampSource, device,
+				timestampSources(inactive))
+		}
+	}
+	return inactive.Activate()
+}
+
+// setListenerFilter sets the capture filter of the packet filter in the
+// listener l on its pcap handle. The capture filter depends on the link type
+// of the handle, so it is set after opening the handle
+func setListenerFilter(l *pcap.Listener) {
+	filter := captureFilter(l.Filter, l.PcapHandle.LinkType())
+	if filter == "" {
+		return
+	}
+	if err := l.PcapHandle.SetBPFFilter(filter); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// prepareListener prepares the pcap listener l. Live captures on network
+// interfaces are opened with the pcap tuning settings, if set
+func prepareListener(l *pcap.Listener) {
+	if l.File != "" || !pcapTuned() {
+		filter := l.Filter
+		l.Filter = ""
+		l.Prepare()
+		l.Filter = filter
+		setListenerFilter(l)
+		return
+	}
+
+	// use the first network interface like the listener
+	device := l.Device
+	if device == "" {
+		ifs, err := gopcap.FindAllDevs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ifs) == 0 {
+			log.Fatal("No network interface found")
+		}
+		device = ifs[0].Name
+		l.Device = device
+	}
+
+	handle, err := openTuned(l, device)
+	if err != nil {
+		log.Fatal(err)
+	}
+	l.PcapHandle = handle
+	setListenerFilter(l)
+	log.Printf("Listening on interface %s:\n", device)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+func TestPcapTuned(t *testing.T) {
+	defer func(b int, i bool, s string) {
+		*pcapBufferSize, *pcapImmediate, *pcapTimestampSource = b, i, s
+	}(*pcapBufferSize, *pcapImmediate, *pcapTimestampSource)
+
+	*pcapBufferSize, *pcapImmediate, *pcapTimestampSource = 0, false, ""
+	if pcapTuned() {
+		t.Error("got tuned; want not tuned")
+	}
+	for _, set := range []func(){
+		func() { *pcapBufferSize = 8 << 20 },
+		func() { *pcapImmediate = true },
+		func() { *pcapTimestampSource = "adapter" },
+	} {
+		*pcapBufferSize, *pcapImmediate = 0, false
+		*pcapTimestampSource = ""
+		set()
+		if !pcapTuned() {
+			t.Error("got not tuned; want tuned")
+		}
+	}
+}
+
+func TestOpenTuned(t *testing.T) {
+	defer func(b int) { *pcapBufferSize = b }(*pcapBufferSize)
+	*pcapBufferSize = 8 << 20
+
+	l := &pcap.Listener{Snaplen: 2048}
+	if h, err := openTuned(l, "does-not-exist0"); err == nil {
+		h.Close()
+		t.Error("got no error for unknown interface")
+	}
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+var (
+	// pcapWrites stores the pcap write table
+	pcapWrites pcapWriteTable
+)
+
+// pcapWriteTable writes all packets of monitored SMC connections to a pcap
+// or pcapng file protected by a mutex. Like tcpdump, the file is rotated when
+// it reaches the maximum size, optionally with a bounded number of files
+// that are overwritten in a ring
+type pcapWriteTable struct {
+	lock    sync.Mutex
+	file    *rotatingFile
+	export  *pcapExport
+	packets uint64
+}
+
+// init initializes the pcap write table and creates the pcap or pcapng file.
+// If size is greater than 0, the file is rotated before it exceeds size
+// bytes. If files is greater than 0, at most files files are written
+func (pw *pcapWriteTable) init(file string, size int64, files int) error {
+	if files > 0 && size <= 0 {
+		return errors.New("limiting the number of pcap files " +
+			"requires a file size")
+	}
+
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	pw.packets = 0
+	f, err := openNumberedFile(file, size, files)
+	if err != nil {
+		return err
+	}
+	pw.file = f
+	pw.export = &pcapExport{
+		file: f,
+		ng:   strings.HasSuffix(file, ".pcapng"),
+	}
+	return nil
+}
+
+// write writes the packet to the pcap file
+func (pw *pcapWriteTable) write(packet gopacket.Packet) {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	if pw.export == nil {
+		return
+	}
+	if pw.packets == 0 {
+		// the link type is known after the capture started
+		header, err := pcapFileHeader(pw.export.ng)
+		if err != nil {
+			log.Println("Error writing pcap file:", err)
+			return
+		}
+		pw.file.setHeader(header)
+	}
+	if err := pw.export.write(packet); err != nil {
+		log.Println("Error writing pcap file:", err)
+		return
+	}
+	pw.packets++
+}
+
+// annotate attaches the comment to the packet sent over the network flow net
+// and the transport flow trans at time seen in the pcapng file
+func (pw *pcapWriteTable) annotate(net, trans gopacket.Flow, seen time.Time,
+	comment string) {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	if pw.export == nil {
+		return
+	}
+	pw.export.annotate(net, trans, seen, comment)
+}
+
+// flush writes the packets queued for comments to the pcapng file
+func (pw *pcapWriteTable) flush() {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	if pw.export == nil {
+		return
+	}
+	if err := pw.export.flush(false); err != nil {
+		log.Println("Error writing pcap file:", err)
+	}
+}
+
+// close writes the queued packets, closes the pcap or pcapng file, and
+// returns the number of written packets
+func (pw *pcapWriteTable) close() uint64 {
+	pw.lock.Lock()
+	defer pw.lock.Unlock()
+
+	if pw.export == nil {
+		return 0
+	}
+	if err := pw.export.close(); err != nil {
+		log.Println("Error closing pcap file:", err)
+	}
+	pw.export = nil
+	pw.file = nil
+	return pw.packets
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcapgo"
+)
+
+func TestPcapWriteTable(t *testing.T) {
+	var pw pcapWriteTable
+
+	// write packets of demo session to pcap file
+	file := filepath.Join(t.TempDir(), "smc.pcap")
+	if err := pw.init(file, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	packets := demoSessions[0].packets()
+	for _, p := range packets {
+		pw.write(gopacket.NewPacket(p, layers.LayerTypeEthernet,
+			gopacket.Default))
+	}
+	if n := pw.close(); n != uint64(len(packets)) {
+		t.Errorf("close() = %d; want %d", n, len(packets))
+	}
+
+	// writing after close is ignored
+	pw.write(gopacket.NewPacket(packets[0], layers.LayerTypeEthernet,
+		gopacket.Default))
+
+	// test written packets
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range packets {
+		got, _, err := r.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("packet %d: got = %x; want %x", i, got, want)
+		}
+	}
+	if _, _, err := r.ReadPacketData(); err == nil {
+		t.Error("got more packets; want end of file")
+	}
+}
+
+func TestPcapWriteTableRotate(t *testing.T) {
+	var pw pcapWriteTable
+	dir := t.TempDir()
+	file := filepath.Join(dir, "smc.pcap")
+
+	// number of files requires file size
+	if err := pw.init(file, 0, 3); err == nil {
+		t.Error("got no error for number of files without size")
+	}
+
+	// rotate after each packet in 3 files
+	if err := pw.init(file, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	packets := demoSessions[0].packets()
+	for _, p := range packets {
+		pw.write(gopacket.NewPacket(p, layers.LayerTypeEthernet,
+			gopacket.Default))
+	}
+	if n := pw.close(); n != uint64(len(packets)) {
+		t.Errorf("close() = %d; want %d", n, len(packets))
+	}
+
+	// each file contains one of the last packets, the current file the
+	// last packet
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	want := []string{"smc.pcap0", "smc.pcap1", "smc.pcap2"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("got %v; want %v", names, want)
+	}
+	last := packets[len(packets)-1]
+	current := (len(packets) - 1) % 3
+	for i, name := range want {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		r, err := pcapgo.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _, err := r.ReadPacketData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == current && string(got) != string(last) {
+			t.Errorf("%s: got %x; want %x", name, got, last)
+		}
+		if _, _, err := r.ReadPacketData(); err == nil {
+			t.Errorf("%s: got more packets; want end of file",
+				name)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// peerIDs stores the peer ID table
+	peerIDs peerIDTable
+)
+
+// peerIDEntry stores the ip addresses and RoCE MACs a peer ID was observed
+// from
+type peerIDEntry struct {
+	ips  map[gopacket.Endpoint]bool
+	macs map[string]bool
+}
+
+// peerIDTable stores the ip addresses and RoCE MACs of peer IDs protected by
+// a mutex
+type peerIDTable struct {
+	lock sync.Mutex
+	pmap map[clc.PeerID]*peerIDEntry
+}
+
+// init initializes the peer ID table
+func (pt *peerIDTable) init() {
+	pt.lock.Lock()
+	if pt.pmap == nil {
+		pt.pmap = make(map[clc.PeerID]*peerIDEntry)
+	}
+	pt.lock.Unlock()
+}
+
+// add adds the sender peer ID of the CLC message msg sent over the network
+// flow net with the source ip address and the RoCE MAC in msg to the peer ID
+// table
+func (pt *peerIDTable) add(net gopacket.Flow, msg clc.Message) {
+	peerID, mac, ok := messagePeerID(msg)
+	if !ok {
+		return
+	}
+
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	if pt.pmap == nil {
+		return
+	}
+	e := pt.pmap[peerID]
+	if e == nil {
+		e = &peerIDEntry{
+			ips:  make(map[gopacket.Endpoint]bool),
+			macs: make(map[string]bool),
+		}
+		pt.pmap[peerID] = e
+	}
+	e.ips[net.Src()] = true
+	if len(mac) > 0 && !isZeroMAC(mac) {
+		e.macs[mac.String()] = true
+	}
+}
+
+// summary returns the peer ID table with one line per peer ID
+func (pt *peerIDTable) summary() []string {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	ids := make([]clc.PeerID, 0, len(pt.pmap))
+	for id := range pt.pmap {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	var lines []string
+	for _, id := range ids {
+		e := pt.pmap[id]
+		ips := make([]gopacket.Endpoint, 0, len(e.ips))
+		for ip := range e.ips {
+			ips = append(ips, ip)
+		}
+		sort.Slice(ips, func(i, j int) bool {
+			return ips[i].LessThan(ips[j])
+		})
+		ipStrings := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			ipStrings = append(ipStrings, ip.String())
+		}
+		line := fmt.Sprintf("%s: IPs: %s", id,
+			strings.Join(ipStrings, ", "))
+
+		if len(e.macs) > 0 {
+			line += fmt.Sprintf(", MACs: %s",
+				strings.Join(sortedKeys(e.macs), ", "))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// messagePeerID returns the sender peer ID and the RoCE MAC of the CLC
+// message msg and if msg contains a peer ID
+func messagePeerID(msg clc.Message) (clc.PeerID, net.HardwareAddr, bool) {
+	switch m := msg.(type) {
+	case *clc.Proposal:
+		return m.SenderPeerID, m.IBMAC, true
+	case *clc.ProposalV2:
+		return m.SenderPeerID, m.IBMAC, true
+	case *clc.AcceptSMCR:
+		return m.SenderPeerID, m.IBMAC, true
+	case *clc.ConfirmSMCR:
+		return m.SenderPeerID, m.IBMAC, true
+	case *clc.Decline:
+		return m.SenderPeerID, nil, true
+	case *clc.DeclineV2:
+		return m.SenderPeerID, nil, true
+	}
+	return clc.PeerID{}, nil, false
+}
+
+// isZeroMAC checks if all bytes of the MAC address mac are zero
+func isZeroMAC(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writePeerIDs writes the peer ID table to w
+func writePeerIDs(w io.Writer) {
+	for _, line := range peerIDs.summary() {
+		fmt.Fprintf(w, "Peer ID: %s\n", line)
+	}
+}
+
+// handlePeerIDs handles http requests for the peer ID table
+func handlePeerIDs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	writePeerIDs(w)
+}
+
+// registerPeerIDAPI registers the peer ID table http api
+func registerPeerIDAPI() {
+	http.HandleFunc("/api/v1/peers", handlePeerIDs)
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestPeerIDTable(t *testing.T) {
+	var pt peerIDTable
+
+	// initialize peer ID table and test flows
+	pt.init()
+	net1, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	net2, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 5)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+
+	// add proposals of same peer ID from two ips and decline
+	pt.add(net1, proposal)
+	pt.add(net2, proposal)
+	pt.add(net1.Reverse(), decline)
+
+	// test summary
+	want := []string{
+		"45472@98:03:9b:ab:cd:ef: IPs: 1.2.3.4, 1.2.3.5, " +
+			"MACs: 98:03:9b:ab:cd:ef",
+		"9509@25:25:25:25:25:00: IPs: 5.6.7.8",
+	}
+	got := pt.summary()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
+
+func TestHandlePeerIDs(t *testing.T) {
+	peerIDs.init()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	peerIDs.add(net, testHandshakeMessage(
+		"e2d4c3d904001c102525252525252500"+
+			"0303000000000000e2d4c3d9"))
+
+	// test http api
+	w := httptest.NewRecorder()
+	handlePeerIDs(w, httptest.NewRequest("GET", "/api/v1/peers", nil))
+	var buf bytes.Buffer
+	writePeerIDs(&buf)
+	want := buf.String()
+	got := w.Body.String()
+	if got != want || got == "" {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	peerIDs.pmap = nil
+}
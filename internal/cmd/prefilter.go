@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+const (
+	// prefilterOptionsStart and prefilterOptionsEnd are the offsets of
+	// the first byte and the end of the tcp options in a tcp header with
+	// maximum length
+	prefilterOptionsStart = 20
+	prefilterOptionsEnd   = 60
+)
+
+// prefilterExID returns the pcap filter expression that matches tcp headers
+// with an experimental option starting with exid at any offset in the tcp
+// options. Options 253 and 254 only differ in the last bit
+func prefilterExID(exid []byte) string {
+	var matches []string
+	for i := prefilterOptionsStart; i+2+len(exid) <=
+		prefilterOptionsEnd; i++ {
+		matches = append(matches, fmt.Sprintf(
+			"(tcp[%d] & 0xfe = 0xfc and tcp[%d:%d] = 0x%x)",
+			i, i+2, len(exid), exid))
+	}
+	return strings.Join(matches, " or ")
+}
+
+// prefilterExpression returns the pcap filter expression of the prefilter.
+// It only passes IPv4 tcp segments that are SYNs with the SMC option or an
+// ExID in the ExID whitelist, SYN-ACKs for fallback detection, FINs and RSTs
+// for closing flows, and segments that start with a CLC message. In ExID
+// learning mode, it passes all SYNs. IPv6 tcp segments are passed because
+// pcap filters cannot access their tcp headers. If IPv4 defragmentation is
+// enabled, all IPv4 fragments are passed because only the first fragment
+// contains the tcp header
+func prefilterExpression() string {
+	syn := "tcp[tcpflags] & tcp-syn != 0"
+	if !*learnExIDs {
+		options := []string{"tcp[tcpflags] & tcp-ack != 0",
+			prefilterExID(clc.SMCOption)}
+		for _, exid := range exids.ids() {
+			options = append(options, prefilterExID(exid))
+		}
+		syn = fmt.Sprintf("(%s and (%s))", syn,
+			strings.Join(options, " or "))
+	}
+	// loading bytes beyond the end of a packet rejects the packet, so
+	// the matches that load tcp options and payload are last
+	payload := "tcp[((tcp[12:1] & 0xf0) >> 2):4]"
+	fragments := ""
+	if *ipDefrag {
+		fragments = "(ip and ip[6:2] & 0x3fff != 0) or "
+	}
+	return fmt.Sprintf("(ip6 and tcp) or %s(ip and tcp and ("+
+		"tcp[tcpflags] & (tcp-fin|tcp-rst) != 0 or %s or "+
+		"%s = 0x%x or %s = 0x%x))", fragments, syn, payload,
+		clc.SMCREyecatcher, payload, clc.SMCDEyecatcher)
+}
+
+// captureFilter returns the pcap filter for capturing packets of the link
+// type with the packet filter filter. The generated pcap filter and the
+// prefilter are extended to packets with VLAN tags on Ethernet. If the
+// prefilter is enabled, it is combined with filter, so the kernel drops most
+// packets that are not relevant for SMC handshakes before they are copied to
+// user space
+func captureFilter(filter string, linkType layers.LinkType) string {
+	auto := filter != "" && filter == autoPcapFilter
+	if !*pcapPrefilter {
+		if auto {
+			return vlanFilter(filter, linkType)
+		}
+		return filter
+	}
+
+	// the first vlan match changes the offsets for the rest of the
+	// expression, so the VLAN variant is last
+	pre := prefilterExpression()
+	switch {
+	case filter == "":
+		return vlanFilter(pre, linkType)
+	case auto:
+		pre = fmt.Sprintf("(%s) and (%s)", pre, filter)
+		return vlanFilter(pre, linkType)
+	}
+	return fmt.Sprintf("(%s) and (%s)", filter, vlanFilter(pre, linkType))
+}
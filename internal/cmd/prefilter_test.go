@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket/layers"
+	"github.com/gopacket/gopacket/pcap"
+)
+
+func TestPrefilterExID(t *testing.T) {
+	got := prefilterExID([]byte{0xe2, 0xd4, 0xc3, 0xd9})
+	matches := strings.Split(got, " or ")
+	if len(matches) != 35 {
+		t.Errorf("got %d matches; want 35", len(matches))
+	}
+	for i, want := range map[int]string{
+		0:  "(tcp[20] & 0xfe = 0xfc and tcp[22:4] = 0xe2d4c3d9)",
+		34: "(tcp[54] & 0xfe = 0xfc and tcp[56:4] = 0xe2d4c3d9)",
+	} {
+		if matches[i] != want {
+			t.Errorf("got %s; want %s", matches[i], want)
+		}
+	}
+
+	// test 2 byte ExID
+	matches = strings.Split(prefilterExID([]byte{0x12, 0x34}), " or ")
+	want := "(tcp[56] & 0xfe = 0xfc and tcp[58:2] = 0x1234)"
+	if len(matches) != 37 || matches[36] != want {
+		t.Errorf("got %s; want %s", matches[len(matches)-1], want)
+	}
+}
+
+func TestCaptureFilter(t *testing.T) {
+	defer func(p, l, d bool) {
+		*pcapPrefilter, *learnExIDs, *ipDefrag = p, l, d
+		exids.init("")
+	}(*pcapPrefilter, *learnExIDs, *ipDefrag)
+	ether := layers.LinkTypeEthernet
+
+	// test without prefilter
+	*pcapPrefilter = false
+	if got := captureFilter("port 12345", ether); got != "port 12345" {
+		t.Errorf("got %s; want port 12345", got)
+	}
+
+	// test prefilter with ExID whitelist
+	*pcapPrefilter = true
+	*ipDefrag = false
+	if err := exids.init("12345678"); err != nil {
+		t.Fatal(err)
+	}
+	pre := prefilterExpression()
+	for _, want := range []string{
+		"(ip6 and tcp) or (ip and tcp and (",
+		"tcp[22:4] = 0xe2d4c3d9",
+		"tcp[22:4] = 0x12345678",
+		"tcp[((tcp[12:1] & 0xf0) >> 2):4] = 0xe2d4c3d9",
+		"tcp[((tcp[12:1] & 0xf0) >> 2):4] = 0xe2d4c3c4",
+	} {
+		if !strings.Contains(pre, want) {
+			t.Errorf("prefilter does not contain %s", want)
+		}
+	}
+
+	// test prefilter with and without VLAN tags, the VLAN variant is last
+	vlan := "(" + pre + ") or (vlan and (" + pre + "))"
+	for _, test := range []struct {
+		filter   string
+		linkType layers.LinkType
+		want     string
+	}{
+		{"", ether, vlan},
+		{"", layers.LinkTypeLinuxSLL, pre},
+		{"port 12345", ether, "(port 12345) and (" + vlan + ")"},
+		{"port 12345", layers.LinkTypeRaw,
+			"(port 12345) and (" + pre + ")"},
+	} {
+		got := captureFilter(test.filter, test.linkType)
+		if got != test.want {
+			t.Errorf("%q, %s: got %s; want %s", test.filter,
+				test.linkType, got, test.want)
+		}
+	}
+
+	// test prefilter with generated filter, combined before the VLAN
+	// variant
+	defer func(f string) { autoPcapFilter = f }(autoPcapFilter)
+	autoPcapFilter = "tcp"
+	both := "(" + pre + ") and (tcp)"
+	want := "(" + both + ") or (vlan and (" + both + "))"
+	if got := captureFilter("tcp", ether); got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	if got := captureFilter("tcp", layers.LinkTypeRaw); got != both {
+		t.Errorf("got %s; want %s", got, both)
+	}
+
+	// test prefilter with IPv4 defragmentation
+	*ipDefrag = true
+	want = "(ip6 and tcp) or (ip and ip[6:2] & 0x3fff != 0) or " +
+		"(ip and tcp and ("
+	if got := prefilterExpression(); !strings.HasPrefix(got, want) {
+		t.Errorf("got %s; want prefix %s", got, want)
+	}
+
+	// test prefilter in learning mode
+	*learnExIDs = true
+	pre = prefilterExpression()
+	if !strings.Contains(pre, "(tcp-fin|tcp-rst) != 0 or "+
+		"tcp[tcpflags] & tcp-syn != 0 or ") ||
+		strings.Contains(pre, "tcp[22:4]") {
+		t.Errorf("got %s; want prefilter with all SYNs", pre)
+	}
+}
+
+func TestPrefilterLinkTypes(t *testing.T) {
+	defer func(f string, p bool) {
+		autoPcapFilter, *pcapPrefilter = f, p
+	}(autoPcapFilter, *pcapPrefilter)
+	*pcapPrefilter = true
+	autoPcapFilter = "tcp"
+
+	// the prefilter compiles for all link types, alone and combined
+	// with generated and user filters
+	for _, linkType := range []layers.LinkType{
+		layers.LinkTypeEthernet,
+		layers.LinkTypeLinuxSLL,
+		layers.LinkTypeRaw,
+	} {
+		for _, filter := range []string{"", "tcp", "port 1"} {
+			f := captureFilter(filter, linkType)
+			if _, err := pcap.CompileBPFFilter(linkType, 262144,
+				f); err != nil {
+				t.Errorf("%s: %s: %v", linkType, f, err)
+			}
+		}
+	}
+}
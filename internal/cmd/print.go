@@ -2,28 +2,86 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/gopacket/gopacket"
 	"github.com/hwipl/smc-go/pkg/clc"
 )
 
-// printCLC prints the CLC message
-func printCLC(net, transport gopacket.Flow, clc clc.Message) {
-	clcFmt := "%s%s:%s -> %s:%s: %s\n"
-	t := ""
+// timestamp returns the current time as string for the output or an empty
+// string if timestamps are disabled
+func timestamp() string {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
 
-	if *showTimestamps {
-		t = time.Now().Format("15:04:05.000000 ")
+	if !*showTimestamps {
+		return ""
 	}
-	if *showReserved {
-		fmt.Fprintf(stdout, clcFmt, t, net.Src(), transport.Src(),
-			net.Dst(), transport.Dst(), clc.Reserved())
-	} else {
-		fmt.Fprintf(stdout, clcFmt, t, net.Src(), transport.Src(),
-			net.Dst(), transport.Dst(), clc)
+	return time.Now().Format(*timestampFormat) + " "
+}
+
+// sessionString returns the handshake session ID as string for the output or
+// an empty string if session IDs are disabled or there is no session
+func sessionString(session uint64) string {
+	if !*showSessions || session == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Session %d: ", session)
+}
+
+// hostString returns the network endpoint ip and the transport endpoint port
+// as string, including the peer hostname of ip if it is known
+func hostString(ip, port gopacket.Endpoint) string {
+	if *showHostnames {
+		if hostname := hostnames.get(ip); hostname != "" {
+			return fmt.Sprintf("%s:%s (%s)", ip, port, hostname)
+		}
+	}
+	return fmt.Sprintf("%s:%s", ip, port)
+}
+
+// printCLC prints the CLC message of the handshake session with its parse
+// warnings
+func printCLC(net, transport gopacket.Flow, clc clc.Message, session uint64,
+	warnings parseWarnings) {
+	settingsLock.RLock()
+	dumps := *showDumps
+	settingsLock.RUnlock()
+
+	writeCLC(stdout, net, transport, clc, session, warnings, dumps)
+}
+
+// writeCLC writes the CLC message of the handshake session with its parse
+// warnings to w, dumps indicates if the hex dump of the message is written
+func writeCLC(w io.Writer, net, transport gopacket.Flow, clc clc.Message,
+	session uint64, warnings parseWarnings, dumps bool) {
+	if *showTable {
+		writeCLCRow(w, net, transport, clc, session, warnings)
+		if _, ok := clc.(*invalidMessage); ok || dumps {
+			fmt.Fprintf(w, "%s", clc.Dump())
+		}
+		return
+	}
+	clcFmt := "%s%s%s -> %s: %s%s\n"
+	t := timestamp()
+	src := hostString(net.Src(), transport.Src())
+	dst := hostString(net.Dst(), transport.Dst())
+
+	settingsLock.RLock()
+	reserved := *showReserved
+	settingsLock.RUnlock()
+
+	msg := clc.String()
+	if reserved {
+		msg = clc.Reserved()
+	}
+	if *showGIDTypes {
+		msg = annotateGID(clc, msg)
 	}
-	if *showDumps {
-		fmt.Fprintf(stdout, "%s", clc.Dump())
+	fmt.Fprintf(w, clcFmt, t, sessionString(session), src, dst, msg,
+		warnings)
+	if _, ok := clc.(*invalidMessage); ok || dumps {
+		fmt.Fprintf(w, "%s", clc.Dump())
 	}
 }
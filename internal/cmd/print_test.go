@@ -41,7 +41,7 @@ func TestPrintCLC(t *testing.T) {
 	*showDumps = false
 
 	buf.Reset()
-	printCLC(net, trans, clcMsg)
+	printCLC(net, trans, clcMsg, 0, nil)
 	want = "1.2.3.4:123 -> 5.6.7.8:456: Decline: Eyecatcher: SMC-R, " +
 		"Type: 4 (Decline), Length: 28, Version: 1, Out of Sync: 0, " +
 		"Path: SMC-R, Peer ID: 9509@25:25:25:25:25:00, " +
@@ -52,13 +52,24 @@ func TestPrintCLC(t *testing.T) {
 		t.Errorf("got = %s; want %s", got, want)
 	}
 
+	// test output with session IDs
+	*showSessions = true
+	buf.Reset()
+	printCLC(net, trans, clcMsg, 42, nil)
+	want = "Session 42: " + want
+	got = buf.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+	*showSessions = false
+
 	// test output without timestamps, without reserved, with dumps
 	*showTimestamps = false
 	*showReserved = false
 	*showDumps = true
 
 	buf.Reset()
-	printCLC(net, trans, clcMsg)
+	printCLC(net, trans, clcMsg, 0, nil)
 	want = "1.2.3.4:123 -> 5.6.7.8:456: Decline: Eyecatcher: SMC-R, " +
 		"Type: 4 (Decline), Length: 28, Version: 1, Out of Sync: 0, " +
 		"Path: SMC-R, Peer ID: 9509@25:25:25:25:25:00, " +
@@ -79,7 +90,7 @@ func TestPrintCLC(t *testing.T) {
 	*showDumps = false
 
 	buf.Reset()
-	printCLC(net, trans, clcMsg)
+	printCLC(net, trans, clcMsg, 0, nil)
 	want = "1.2.3.4:123 -> 5.6.7.8:456: Decline: Eyecatcher: SMC-R, " +
 		"Type: 4 (Decline), Length: 28, Version: 1, Out of Sync: 0, " +
 		"Reserved: 0x0, Path: SMC-R, " +
@@ -97,7 +108,7 @@ func TestPrintCLC(t *testing.T) {
 	*showDumps = true
 
 	buf.Reset()
-	printCLC(net, trans, clcMsg)
+	printCLC(net, trans, clcMsg, 0, nil)
 	want = "1.2.3.4:123 -> 5.6.7.8:456: Decline: Eyecatcher: SMC-R, " +
 		"Type: 4 (Decline), Length: 28, Version: 1, Out of Sync: 0, " +
 		"Reserved: 0x0, Path: SMC-R, " +
@@ -119,7 +130,7 @@ func TestPrintCLC(t *testing.T) {
 	*showDumps = true
 
 	buf.Reset()
-	printCLC(net, trans, clcMsg)
+	printCLC(net, trans, clcMsg, 0, nil)
 	want = "1.2.3.4:123 -> 5.6.7.8:456: Decline: Eyecatcher: SMC-R, " +
 		"Type: 4 (Decline), Length: 28, Version: 1, Out of Sync: 0, " +
 		"Reserved: 0x0, Path: SMC-R, " +
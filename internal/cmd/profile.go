@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	netpprof "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+)
+
+// startCPUProfile starts writing a cpu profile to the cpu profile file, the
+// returned function stops profiling
+func startCPUProfile() func() {
+	if *cpuProfile == "" {
+		return func() {}
+	}
+	f, err := os.Create(*cpuProfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		log.Fatal(err)
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		if err := f.Close(); err != nil {
+			log.Println("Error writing cpu profile:", err)
+		}
+	}
+}
+
+// writeMemProfile writes a memory profile to the memory profile file
+func writeMemProfile() {
+	if *memProfile == "" {
+		return
+	}
+	f, err := os.Create(*memProfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		log.Println("Error writing memory profile:", err)
+	}
+}
+
+// registerProfileAPI registers the profiling http api of net/http/pprof,
+// compatible with go tool pprof, with the control apis. Importing
+// net/http/pprof already registers it on the default mux
+func registerProfileAPI() {
+	if httpControlMux == http.DefaultServeMux {
+		return
+	}
+	httpControlMux.HandleFunc("/debug/pprof/", netpprof.Index)
+	httpControlMux.HandleFunc("/debug/pprof/cmdline", netpprof.Cmdline)
+	httpControlMux.HandleFunc("/debug/pprof/profile", netpprof.Profile)
+	httpControlMux.HandleFunc("/debug/pprof/symbol", netpprof.Symbol)
+	httpControlMux.HandleFunc("/debug/pprof/trace", netpprof.Trace)
+}
+
+// httpHideProfile hides the profiling api that importing net/http/pprof
+// registers on the default mux in the handler h
+func httpHideProfile(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
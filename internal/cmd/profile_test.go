@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegisterProfileAPI(t *testing.T) {
+	defer func(m *http.ServeMux) { httpControlMux = m }(httpControlMux)
+	httpControlMux = http.NewServeMux()
+	registerProfileAPI()
+
+	// test profile index
+	r := httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil)
+	w := httptest.NewRecorder()
+	httpControlMux.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("got = %s; want goroutine profile", w.Body.String())
+	}
+
+	// test named profile
+	r = httptest.NewRequest(http.MethodGet, "/debug/pprof/heap", nil)
+	w = httptest.NewRecorder()
+	httpControlMux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("got = %d, %d bytes; want %d, heap profile", w.Code,
+			w.Body.Len(), http.StatusOK)
+	}
+
+	// test unknown profile
+	r = httptest.NewRequest(http.MethodGet, "/debug/pprof/unknown", nil)
+	w = httptest.NewRecorder()
+	httpControlMux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestHTTPHideProfile(t *testing.T) {
+	h := httpHideProfile(http.DefaultServeMux)
+
+	// test hidden profiling api
+	r := httptest.NewRequest(http.MethodGet, "/debug/pprof/heap", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	// test other apis
+	r = httptest.NewRequest(http.MethodGet, "/other", nil)
+	w = httptest.NewRecorder()
+	httpHideProfile(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})).ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusTeapot)
+	}
+}
+
+func TestWriteMemProfile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "memprofile")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	*memProfile = filepath.Join(dir, "mem.prof")
+	writeMemProfile()
+	*memProfile = ""
+
+	info, err := os.Stat(filepath.Join(dir, "mem.prof"))
+	if err != nil || info.Size() == 0 {
+		t.Errorf("memory profile error = %v; want profile", err)
+	}
+}
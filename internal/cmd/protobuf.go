@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+var (
+	// protoEvents is the protobuf sink
+	protoEvents protoSink
+)
+
+// protoAppendTag appends the tag of field number num with wire type typ to
+// buf
+func protoAppendTag(buf []byte, num, typ int) []byte {
+	return binary.AppendUvarint(buf, uint64(num<<3|typ))
+}
+
+// protoAppendUint appends field number num with varint v to buf, zero values
+// are omitted
+func protoAppendUint(buf []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = protoAppendTag(buf, num, protoVarint)
+	return binary.AppendUvarint(buf, v)
+}
+
+// protoAppendBool appends field number num with bool v to buf
+func protoAppendBool(buf []byte, num int, v bool) []byte {
+	if !v {
+		return buf
+	}
+	return protoAppendUint(buf, num, 1)
+}
+
+// protoAppendDouble appends field number num with double v to buf
+func protoAppendDouble(buf []byte, num int, v float64) []byte {
+	if v == 0 {
+		return buf
+	}
+	buf = protoAppendTag(buf, num, protoFixed64)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+// protoAppendBytes appends field number num with bytes b to buf
+func protoAppendBytes(buf []byte, num int, b []byte) []byte {
+	if len(b) == 0 {
+		return buf
+	}
+	buf = protoAppendTag(buf, num, protoBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// protoAppendString appends field number num with string s to buf
+func protoAppendString(buf []byte, num int, s string) []byte {
+	return protoAppendBytes(buf, num, []byte(s))
+}
+
+// protoEvent returns the Event with the time t and the payload in field
+// number num
+func protoEvent(t time.Time, num int, payload []byte) []byte {
+	buf := protoAppendUint(nil, 1, uint64(t.UnixNano()))
+	buf = protoAppendTag(buf, num, protoBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+// protoMessageEvent returns the CLC message msg of the handshake session with
+// parse warnings sent over the network flow net and the transport flow trans
+// at time t as Event
+func protoMessageEvent(t time.Time, net, trans gopacket.Flow, msg clc.Message,
+	session uint64, warnings parseWarnings) []byte {
+	typ := "invalid"
+	var version uint8
+	if hdr := messageHeader(msg); hdr != nil {
+		typ = strings.ToLower(hdr.Type.String())
+		version = hdr.Version
+	}
+	m := protoAppendUint(nil, 1, session)
+	m = protoAppendString(m, 2, fmt.Sprintf("%s:%s", net.Src(),
+		trans.Src()))
+	m = protoAppendString(m, 3, fmt.Sprintf("%s:%s", net.Dst(),
+		trans.Dst()))
+	m = protoAppendString(m, 4, typ)
+	m = protoAppendUint(m, 5, uint64(version))
+	m = protoAppendString(m, 6, msg.String())
+	for _, w := range warnings {
+		m = protoAppendString(m, 7, w)
+	}
+	m = protoAppendBytes(m, 8, messageRaw(msg))
+	return protoEvent(t, 2, m)
+}
+
+// protoHandshakeEvent returns the handshake r finished at time t as Event
+func protoHandshakeEvent(t time.Time, r *handshakeResult) []byte {
+	net, trans := r.key.net, r.key.trans
+	h := protoAppendUint(nil, 1, r.id)
+	h = protoAppendString(h, 2, fmt.Sprintf("%s:%s", net.Src(),
+		trans.Src()))
+	h = protoAppendString(h, 3, fmt.Sprintf("%s:%s", net.Dst(),
+		trans.Dst()))
+	h = protoAppendBool(h, 4, r.confirmed)
+	if r.confirmed {
+		h = protoAppendString(h, 5, r.path.String())
+	}
+	h = protoAppendUint(h, 6, uint64(r.version))
+	if !r.confirmed {
+		h = protoAppendString(h, 7, r.diagnosis)
+	}
+	h = protoAppendDouble(h, 8, r.total.Seconds())
+	h = protoAppendUint(h, 9, r.client.messages)
+	h = protoAppendUint(h, 10, r.client.bytes)
+	h = protoAppendUint(h, 11, r.server.messages)
+	h = protoAppendUint(h, 12, r.server.bytes)
+	return protoEvent(t, 3, h)
+}
+
+// protoSink renders message and handshake events as length-delimited
+// protobuf Events to the protobuf output
+type protoSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// setOutput sets the protobuf output to w, nil disables the protobuf output
+func (p *protoSink) setOutput(w io.Writer) {
+	p.lock.Lock()
+	p.w = w
+	p.lock.Unlock()
+}
+
+// accepts checks if the protobuf sink renders events of type typ
+func (p *protoSink) accepts(typ string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.w == nil {
+		return false
+	}
+	return typ == eventMessage || typ == eventHandshake
+}
+
+// render renders the event e as length-delimited protobuf Event
+func (p *protoSink) render(e *event) {
+	var b []byte
+	switch e.typ {
+	case eventMessage:
+		b = protoMessageEvent(e.time, e.net, e.trans, e.msg, e.session,
+			e.warnings)
+	case eventHandshake:
+		b = protoHandshakeEvent(e.time, e.result)
+	default:
+		return
+	}
+	buf := binary.AppendUvarint(nil, uint64(len(b)))
+	buf = append(buf, b...)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.w == nil {
+		return
+	}
+	if _, err := p.w.Write(buf); err != nil {
+		log.Println("Error writing protobuf output:", err)
+	}
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+// protoTestFields decodes the fields of the protobuf message b to a map from
+// field number to the varint, fixed64, or bytes values of the field
+func protoTestFields(t *testing.T, b []byte) map[int][]any {
+	fields := make(map[int][]any)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		b = b[n:]
+		num, typ := int(tag>>3), int(tag&7)
+		switch typ {
+		case protoVarint:
+			v, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[num] = append(fields[num], v)
+		case protoFixed64:
+			fields[num] = append(fields[num],
+				binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case protoBytes:
+			l, n := binary.Uvarint(b)
+			b = b[n:]
+			fields[num] = append(fields[num], b[:l])
+			b = b[l:]
+		default:
+			t.Fatalf("unknown wire type %d", typ)
+		}
+	}
+	return fields
+}
+
+func TestProtoSink(t *testing.T) {
+	var buf bytes.Buffer
+	var p protoSink
+
+	// check disabled protobuf sink
+	if p.accepts(eventHandshake) {
+		t.Error("p.accepts() = true; want false")
+	}
+
+	// render handshake event
+	p.setOutput(&buf)
+	defer p.setOutput(nil)
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	ts := time.Unix(1, 500)
+	e := &event{typ: eventHandshake, time: ts, result: &handshakeResult{
+		id:        7,
+		key:       handshakeKey{net, trans},
+		version:   1,
+		diagnosis: "0x3030000",
+		total:     time.Second / 2,
+		client:    flowCounts{1, 52},
+	}}
+	if !p.accepts(e.typ) {
+		t.Fatal("p.accepts() = false; want true")
+	}
+	p.render(e)
+
+	// check length prefix and event
+	b := buf.Bytes()
+	l, n := binary.Uvarint(b)
+	if int(l) != len(b)-n {
+		t.Fatalf("length = %d; want %d", l, len(b)-n)
+	}
+	event := protoTestFields(t, b[n:])
+	if got := event[1][0].(uint64); got != uint64(ts.UnixNano()) {
+		t.Errorf("time = %d; want %d", got, ts.UnixNano())
+	}
+
+	// check handshake
+	h := protoTestFields(t, event[3][0].([]byte))
+	if got := h[1][0].(uint64); got != 7 {
+		t.Errorf("session = %d; want 7", got)
+	}
+	if got := string(h[2][0].([]byte)); got != "1.2.3.4:123" {
+		t.Errorf("src = %s; want 1.2.3.4:123", got)
+	}
+	if _, ok := h[4]; ok {
+		t.Error("confirmed is set; want omitted")
+	}
+	if got := string(h[7][0].([]byte)); got != "0x3030000" {
+		t.Errorf("diagnosis = %s; want 0x3030000", got)
+	}
+	if got := math.Float64frombits(h[8][0].(uint64)); got != 0.5 {
+		t.Errorf("duration = %f; want 0.5", got)
+	}
+	if got := h[10][0].(uint64); got != 52 {
+		t.Errorf("client bytes = %d; want 52", got)
+	}
+}
+
+func TestProtoMessageEvent(t *testing.T) {
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	msg := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	event := protoTestFields(t, protoMessageEvent(time.Unix(0, 1), net,
+		trans, msg, 0, parseWarnings{"a", "b"}))
+	m := protoTestFields(t, event[2][0].([]byte))
+	if got := string(m[4][0].([]byte)); got != "decline" {
+		t.Errorf("type = %s; want decline", got)
+	}
+	if got := len(m[7]); got != 2 {
+		t.Errorf("len(warnings) = %d; want 2", got)
+	}
+	if got := len(m[8][0].([]byte)); got != 28 {
+		t.Errorf("len(raw) = %d; want 28", got)
+	}
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+const (
+	// minQPN is the lowest QP number of a regular queue pair, QP 0 and 1
+	// are reserved for subnet and general management
+	minQPN = 2
+)
+
+var (
+	// qps stores the SMC-R QP table
+	qps qpTable
+)
+
+// smcrQP is the queue pair of an SMC-R link endpoint: the RoCE GID, the QP
+// number, and the initial packet sequence number
+type smcrQP struct {
+	gid string
+	qpn int
+	psn int
+}
+
+// qpKey identifies an SMC-R queue pair by the RoCE GID and the QP number
+type qpKey struct {
+	gid string
+	qpn int
+}
+
+// qpTable stores the initial packet sequence numbers of the SMC-R queue
+// pairs seen in successful handshakes protected by a mutex
+type qpTable struct {
+	lock sync.Mutex
+	psns map[qpKey]int
+}
+
+// init initializes the SMC-R QP table
+func (qt *qpTable) init() {
+	qt.lock.Lock()
+	if qt.psns == nil {
+		qt.psns = make(map[qpKey]int)
+	}
+	qt.lock.Unlock()
+}
+
+// add adds the queue pairs of server and client of the finished handshake r
+// to the SMC-R QP table and returns a warning for each implausible QP number
+// or PSN
+func (qt *qpTable) add(r *handshakeResult) []string {
+	if !r.confirmed || !r.qps {
+		return nil
+	}
+
+	qt.lock.Lock()
+	defer qt.lock.Unlock()
+
+	if qt.psns == nil {
+		return nil
+	}
+	var warnings []string
+	if r.firstContact != 0 && r.serverQP.psn == r.clientQP.psn {
+		warnings = append(warnings, fmt.Sprintf("Server and Client "+
+			"PSN %d equal", r.serverQP.psn))
+	}
+	for _, side := range []struct {
+		name string
+		qp   smcrQP
+	}{
+		{"Server", r.serverQP},
+		{"Client", r.clientQP},
+	} {
+		if side.qp.qpn < minQPN {
+			warnings = append(warnings, fmt.Sprintf("%s QP Number "+
+				"%d reserved", side.name, side.qp.qpn))
+			continue
+		}
+
+		// a new link must not reuse the PSN of a previous link on the
+		// same QP, a reused link keeps its PSN
+		key := qpKey{side.qp.gid, side.qp.qpn}
+		previous, ok := qt.psns[key]
+		qt.psns[key] = side.qp.psn
+		switch {
+		case !ok:
+		case r.firstContact != 0 && previous == side.qp.psn:
+			warnings = append(warnings, fmt.Sprintf("%s QP %d "+
+				"reuses PSN %d of previous link", side.name,
+				side.qp.qpn, previous))
+		case r.firstContact == 0 && previous != side.qp.psn:
+			warnings = append(warnings, fmt.Sprintf("%s QP %d PSN "+
+				"%d differs from PSN %d of reused link",
+				side.name, side.qp.qpn, side.qp.psn, previous))
+		}
+	}
+	return warnings
+}
+
+// messageQP returns the queue pair of the sender of the SMC-R accept or
+// confirm message msg and if msg is one
+func messageQP(msg clc.Message) (smcrQP, bool) {
+	switch m := msg.(type) {
+	case *clc.AcceptSMCR:
+		return smcrQP{m.IBGID.String(), m.QPN, m.PSN}, true
+	case *clc.ConfirmSMCR:
+		return smcrQP{m.IBGID.String(), m.QPN, m.PSN}, true
+	}
+	return smcrQP{}, false
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestQPTable(t *testing.T) {
+	var qt qpTable
+
+	// test queue pairs of SMC-R accept and confirm messages
+	accept := testHandshakeMessage("e2d4c3d902004418b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e40000157d010000" +
+		"0005230000000000f0a600000072f5fe" +
+		"e2d4c3d9")
+	confirm := testHandshakeMessage("e2d4c3d903004410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e50000187f010000" +
+		"0006230000000000f0a40000000d89a4" +
+		"e2d4c3d9")
+	for _, test := range []struct {
+		msg  string
+		got  clc.Message
+		want smcrQP
+	}{
+		{"accept", accept, smcrQP{"fe80::9a03:9bff:feab:cdef", 228,
+			7534078}},
+		{"confirm", confirm, smcrQP{"fe80::9a03:9bff:feab:cdef", 229,
+			887204}},
+	} {
+		got, ok := messageQP(test.got)
+		if got != test.want || !ok {
+			t.Errorf("%s: got = %v, %t; want %v, true", test.msg,
+				got, ok, test.want)
+		}
+	}
+
+	// add new link with equal PSNs and reserved QP number
+	qt.init()
+	r := &handshakeResult{confirmed: true, qps: true, firstContact: 1,
+		serverQP: smcrQP{"fe80::1", 1, 100},
+		clientQP: smcrQP{"fe80::2", 7, 100}}
+	want := []string{
+		"Server and Client PSN 100 equal",
+		"Server QP Number 1 reserved",
+	}
+	if got := qt.add(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// reuse link with same and different PSN
+	r = &handshakeResult{confirmed: true, qps: true,
+		serverQP: smcrQP{"fe80::1", 8, 200},
+		clientQP: smcrQP{"fe80::2", 7, 100}}
+	if got := qt.add(r); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+	r.clientQP.psn = 101
+	want = []string{"Client QP 7 PSN 101 differs from PSN 100 of " +
+		"reused link"}
+	if got := qt.add(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// new link on QP with PSN of previous link
+	r.firstContact = 1
+	r.clientQP.psn = 102
+	want = []string{"Server QP 8 reuses PSN 200 of previous link"}
+	if got := qt.add(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test declined handshake
+	if got := qt.add(&handshakeResult{qps: true}); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+// capture quality ratings
+const (
+	qualityGood = "good"
+	qualityFair = "fair"
+	qualityPoor = "poor"
+)
+
+const (
+	// qualityMinCoverage is the minimum ratio of SMC connection attempts
+	// seen in both directions of a good capture
+	qualityMinCoverage = 0.9
+
+	// qualityMaxDropRatio is the maximum ratio of dropped packets of a fair
+	// capture
+	qualityMaxDropRatio = 0.01
+
+	// qualityMaxClockSkew is the maximum time packet timestamps may be in
+	// the future
+	qualityMaxClockSkew = time.Minute
+)
+
+var (
+	// quality stores the capture quality
+	quality captureQuality
+)
+
+// captureQuality stores indicators of the capture quality protected by a
+// mutex
+type captureQuality struct {
+	lock sync.Mutex
+
+	// packets and truncated packets
+	packets   uint64
+	truncated uint64
+
+	// packet timestamps
+	lastSeen  time.Time
+	backwards uint64
+	zero      uint64
+	future    uint64
+
+	// SYNs with SMC option and matching SYN-ACKs
+	syns    uint64
+	synAcks uint64
+
+	// gaps in reassembled streams
+	gaps uint64
+
+	// pcap statistics and the drops at the last report
+	stats     bool
+	received  int
+	dropped   int
+	ifDropped int
+	reported  int
+}
+
+// addPacket adds a packet with metadata md captured before time now to the
+// capture quality
+func (cq *captureQuality) addPacket(md *gopacket.PacketMetadata,
+	now time.Time) {
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	cq.packets++
+	if md.CaptureLength < md.Length {
+		cq.truncated++
+	}
+	switch {
+	case md.Timestamp.IsZero() || md.Timestamp.Unix() == 0:
+		cq.zero++
+	case md.Timestamp.After(now.Add(qualityMaxClockSkew)):
+		cq.future++
+	case md.Timestamp.Before(cq.lastSeen):
+		cq.backwards++
+	}
+	if md.Timestamp.After(cq.lastSeen) {
+		cq.lastSeen = md.Timestamp
+	}
+}
+
+// addSYN adds a SYN with SMC option to the capture quality
+func (cq *captureQuality) addSYN() {
+	cq.lock.Lock()
+	cq.syns++
+	cq.lock.Unlock()
+}
+
+// addSYNACK adds a SYN-ACK of a SYN with SMC option to the capture quality
+func (cq *captureQuality) addSYNACK() {
+	cq.lock.Lock()
+	cq.synAcks++
+	cq.lock.Unlock()
+}
+
+// addGap adds a gap in a reassembled stream to the capture quality
+func (cq *captureQuality) addGap() {
+	cq.lock.Lock()
+	cq.gaps++
+	cq.lock.Unlock()
+}
+
+// setDrops sets the number of received packets, packets dropped by pcap, and
+// packets dropped by the network interface reported by pcap
+func (cq *captureQuality) setDrops(received, dropped, ifDropped int) {
+	cq.lock.Lock()
+	cq.stats = true
+	cq.received = received
+	cq.dropped = dropped
+	cq.ifDropped = ifDropped
+	cq.lock.Unlock()
+}
+
+// dropsString returns the pcap statistics as string, cq must be locked
+func (cq *captureQuality) dropsString() string {
+	return fmt.Sprintf("received %d, dropped %d, dropped by interface "+
+		"%d", cq.received, cq.dropped, cq.ifDropped)
+}
+
+// drops returns the pcap statistics as string and whether they are
+// available
+func (cq *captureQuality) drops() (string, bool) {
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+	return cq.dropsString(), cq.stats
+}
+
+// newDrops returns the pcap statistics as string and the number of packets
+// dropped since the last call
+func (cq *captureQuality) newDrops() (string, int) {
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	drops := cq.dropped + cq.ifDropped
+	n := drops - cq.reported
+	cq.reported = drops
+	return cq.dropsString(), n
+}
+
+// writeMetrics writes the pcap statistics in prometheus text format to w
+func (cq *captureQuality) writeMetrics(w io.Writer) {
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	if !cq.stats {
+		return
+	}
+	for _, m := range []struct {
+		name, help string
+		value      int
+	}{
+		{"smc_clc_capture_received_packets_total",
+			"Number of packets received by the capture.",
+			cq.received},
+		{"smc_clc_capture_dropped_packets_total",
+			"Number of packets dropped by the capture.",
+			cq.dropped},
+		{"smc_clc_capture_interface_dropped_packets_total",
+			"Number of packets dropped by the network interface.",
+			cq.ifDropped},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s counter\n", m.name)
+		fmt.Fprintf(w, "%s %d\n", m.name, m.value)
+	}
+}
+
+// report returns the rating of the capture quality and the issues found with
+// advice how to fix them
+func (cq *captureQuality) report() (string, []string) {
+	cq.lock.Lock()
+	defer cq.lock.Unlock()
+
+	rating := qualityGood
+	var issues []string
+	issue := func(severe bool, format string, a ...any) {
+		if severe {
+			rating = qualityPoor
+		} else if rating == qualityGood {
+			rating = qualityFair
+		}
+		issues = append(issues, fmt.Sprintf(format, a...))
+	}
+
+	// bidirectional coverage
+	if cq.syns > 0 {
+		coverage := float64(cq.synAcks) / float64(cq.syns)
+		if coverage < qualityMinCoverage {
+			issue(coverage < 0.5, "only %d of %d SMC connection "+
+				"attempts seen in both directions; capture "+
+				"where both directions of the traffic are "+
+				"visible", cq.synAcks, cq.syns)
+		}
+	}
+
+	// truncation
+	if cq.truncated > 0 {
+		issue(false, "%d of %d packets truncated; increase the "+
+			"snaplen, e.g., with -pcap-snaplen or tcpdump -s 0",
+			cq.truncated, cq.packets)
+	}
+
+	// drops
+	if dropped := cq.dropped + cq.ifDropped; dropped > 0 {
+		total := cq.received + dropped
+		dropRatio := float64(dropped) / float64(total)
+		issue(dropRatio > qualityMaxDropRatio, "%d of %d packets "+
+			"dropped by pcap; reduce the captured traffic with a "+
+			"pcap filter, e.g., -pcap-filter", dropped, total)
+	}
+
+	// reassembly gaps
+	if cq.gaps > 0 {
+		issue(true, "%d gaps in reassembled SMC connections; "+
+			"recapture without packet loss, e.g., with a larger "+
+			"capture buffer or on a less loaded host", cq.gaps)
+	}
+
+	// clock sanity
+	if cq.zero > 0 || cq.future > 0 || cq.backwards > 0 {
+		issue(false, "%d packets with zero, %d with future, and %d "+
+			"with backwards timestamps; check the clock of the "+
+			"capture host and merge captures chronologically, "+
+			"e.g., with mergecap", cq.zero, cq.future,
+			cq.backwards)
+	}
+	return rating, issues
+}
+
+// updateDrops updates the number of received and dropped packets in the
+// capture quality from the current pcap listeners and AF_XDP capture
+func updateDrops() {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	received, dropped, ifDropped, ok := 0, 0, 0, false
+	for _, l := range currentListeners {
+		if l.PcapHandle == nil {
+			continue
+		}
+		s, err := l.PcapHandle.Stats()
+		if err != nil {
+			continue
+		}
+		received += s.PacketsReceived
+		dropped += s.PacketsDropped
+		ifDropped += s.PacketsIfDropped
+		ok = true
+	}
+	if currentXDP != nil {
+		r, d, xdpOK := currentXDP.drops()
+		received, dropped, ok = received+r, dropped+d, ok || xdpOK
+	}
+	if ok {
+		quality.setDrops(received, dropped, ifDropped)
+	}
+}
+
+// printDrops prints the pcap statistics if packets were dropped since the
+// last call
+func printDrops() {
+	drops, n := quality.newDrops()
+	if n <= 0 {
+		return
+	}
+	fmt.Fprintf(stdout, "%sCapture Drops: %s (%d new)\n", timestamp(),
+		drops, n)
+}
+
+// printCaptureStats prints the pcap statistics as handshake statistics with
+// timestamp t, if available
+func printCaptureStats(t string) {
+	if drops, ok := quality.drops(); ok {
+		fmt.Fprintf(stdout, "%sHandshake Stats: Capture: %s\n", t,
+			drops)
+	}
+}
+
+// printQuality prints the capture quality
+func printQuality() {
+	rating, issues := quality.report()
+	fmt.Fprintf(stdout, "Capture Quality: %s\n", rating)
+	for _, i := range issues {
+		fmt.Fprintf(stdout, "Capture Quality: %s\n", i)
+	}
+}
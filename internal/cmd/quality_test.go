@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+)
+
+func TestCaptureQuality(t *testing.T) {
+	var cq captureQuality
+	now := time.Unix(10000, 0)
+
+	// test good capture
+	md := &gopacket.PacketMetadata{}
+	md.Timestamp = now
+	md.CaptureLength = 100
+	md.Length = 100
+	cq.addPacket(md, now)
+	cq.addSYN()
+	cq.addSYNACK()
+	rating, issues := cq.report()
+	if rating != qualityGood || issues != nil {
+		t.Errorf("got = %s, %v; want %s, nil", rating, issues,
+			qualityGood)
+	}
+
+	// test fair capture: truncated packet and backwards timestamp
+	md.Timestamp = now.Add(-time.Second)
+	md.CaptureLength = 50
+	cq.addPacket(md, now)
+	rating, issues = cq.report()
+	want := []string{
+		"1 of 2 packets truncated; increase the snaplen, e.g., " +
+			"with -pcap-snaplen or tcpdump -s 0",
+		"0 packets with zero, 0 with future, and 1 with backwards " +
+			"timestamps; check the clock of the capture host and " +
+			"merge captures chronologically, e.g., with mergecap",
+	}
+	if rating != qualityFair || !reflect.DeepEqual(issues, want) {
+		t.Errorf("got = %s, %v; want %s, %v", rating, issues,
+			qualityFair, want)
+	}
+
+	// test poor capture: one-sided SMC connections, drops, and gaps
+	cq.addSYN()
+	cq.addSYN()
+	cq.setDrops(90, 8, 2)
+	cq.addGap()
+	rating, issues = cq.report()
+	want = []string{
+		"only 1 of 3 SMC connection attempts seen in both " +
+			"directions; capture where both directions of the " +
+			"traffic are visible",
+		want[0],
+		"10 of 100 packets dropped by pcap; reduce the captured " +
+			"traffic with a pcap filter, e.g., -pcap-filter",
+		"1 gaps in reassembled SMC connections; recapture without " +
+			"packet loss, e.g., with a larger capture buffer or " +
+			"on a less loaded host",
+		want[1],
+	}
+	if rating != qualityPoor || !reflect.DeepEqual(issues, want) {
+		t.Errorf("got = %s, %v; want %s, %v", rating, issues,
+			qualityPoor, want)
+	}
+}
+
+func TestCaptureDrops(t *testing.T) {
+	var cq captureQuality
+
+	// no statistics
+	if _, ok := cq.drops(); ok {
+		t.Error("got statistics; want none")
+	}
+	var buf bytes.Buffer
+	cq.writeMetrics(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("got %q; want no metrics", buf.String())
+	}
+
+	// new drops since last call
+	cq.setDrops(100, 8, 2)
+	want := "received 100, dropped 8, dropped by interface 2"
+	if got, n := cq.newDrops(); got != want || n != 10 {
+		t.Errorf("got %s, %d; want %s, 10", got, n, want)
+	}
+	if _, n := cq.newDrops(); n != 0 {
+		t.Errorf("got %d; want 0", n)
+	}
+	cq.setDrops(200, 9, 2)
+	if _, n := cq.newDrops(); n != 1 {
+		t.Errorf("got %d; want 1", n)
+	}
+
+	// metrics
+	cq.writeMetrics(&buf)
+	for _, want := range []string{
+		"smc_clc_capture_received_packets_total 200\n",
+		"smc_clc_capture_dropped_packets_total 9\n",
+		"smc_clc_capture_interface_dropped_packets_total 2\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gopacket/gopacket/layers"
+	gopcap "github.com/gopacket/gopacket/pcap"
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+// shellQuote quotes s for the remote shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteFilter returns the pcap filter for the remote capture in the remote
+// shell. It extends filter to exclude the packets of the ssh connection
+// itself, so streaming captured packets does not capture more packets. The
+// remote shell must set its arguments to the ssh connection first
+func remoteFilter(filter string) string {
+	exclude := shellQuote("not (host ") + `"$1"` +
+		shellQuote(" and tcp port ") + `"$2"` + shellQuote(")")
+	if filter == "" {
+		return exclude
+	}
+	return shellQuote("("+filter+") and ") + exclude
+}
+
+// remoteCommand returns the shell command that runs the capture command on
+// the remote host and writes the captured packets in pcap format to stdout.
+// The capture command is tcpdump or dumpcap, optionally prefixed, e.g., with
+// sudo
+func remoteCommand(command, device string, promisc bool, snaplen int,
+	filter string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		fields = []string{"tcpdump"}
+	}
+	args := []string{"-s", strconv.Itoa(snaplen), "-w", "-"}
+	if device != "" {
+		args = append(args, "-i", shellQuote(device))
+	}
+	if !promisc {
+		args = append(args, "-p")
+	}
+	if path.Base(fields[len(fields)-1]) == "dumpcap" {
+		// write pcap instead of pcapng format, quietly
+		args = append(args, "-P", "-q", "-f", remoteFilter(filter))
+	} else {
+		// write packets immediately instead of buffering them
+		args = append(args, "-U", remoteFilter(filter))
+	}
+	return fmt.Sprintf("set -- $SSH_CONNECTION; exec %s %s",
+		strings.Join(fields, " "), strings.Join(args, " "))
+}
+
+// sshArgs returns the arguments of the ssh command that runs command on the
+// remote host. Hosts starting with - are rejected, so they cannot inject ssh
+// options
+func sshArgs(host, command string) ([]string, error) {
+	if host == "" || strings.HasPrefix(host, "-") {
+		return nil, fmt.Errorf("invalid remote host %q", host)
+	}
+	return []string{"--", host, command}, nil
+}
+
+// prepareRemote prepares the listener for reading packets from a capture
+// command started on the remote host over ssh, so smc-clc does not need to
+// be installed on the remote host. It returns a function that stops the ssh
+// process
+func prepareRemote(listener *pcap.Listener) func() {
+	r, w, err := os.Pipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the link type of the remote capture is unknown, the any device
+	// captures without Ethernet headers
+	linkType := layers.LinkTypeEthernet
+	if listener.Device == "any" {
+		linkType = layers.LinkTypeLinuxSLL
+	}
+	command := remoteCommand(*remoteCapture, listener.Device,
+		listener.Promisc, listener.Snaplen,
+		captureFilter(listener.Filter, linkType))
+	args, err := sshArgs(*remoteHost, command)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ssh := exec.Command("ssh", args...)
+	ssh.Stdout = w
+	ssh.Stderr = stderr
+	if err := ssh.Start(); err != nil {
+		log.Fatal(err)
+	}
+	w.Close()
+
+	handle, err := gopcap.OpenOfflineFile(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	listener.PcapHandle = handle
+	log.Printf("Reading packets from %s on %s:\n", *remoteCapture,
+		*remoteHost)
+	return func() {
+		r.Close()
+		ssh.Process.Kill()
+		ssh.Wait()
+	}
+}
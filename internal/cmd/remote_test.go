@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, test := range []struct {
+		s, want string
+	}{
+		{"", "''"},
+		{"eth0", "'eth0'"},
+		{"it's", `'it'\''s'`},
+	} {
+		if got := shellQuote(test.s); got != test.want {
+			t.Errorf("%q: got %s; want %s", test.s, got, test.want)
+		}
+	}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	exclude := `'not (host '"$1"' and tcp port '"$2"')'`
+	for _, test := range []struct {
+		command string
+		device  string
+		promisc bool
+		filter  string
+		want    string
+	}{
+		{"tcpdump", "", true, "",
+			"set -- $SSH_CONNECTION; exec tcpdump -s 2048 -w - " +
+				"-U " + exclude},
+		{"", "eth0", false, "tcp",
+			"set -- $SSH_CONNECTION; exec tcpdump -s 2048 -w - " +
+				"-i 'eth0' -p -U '(tcp) and '" + exclude},
+		{"sudo /usr/bin/dumpcap", "any", true, "port 12345",
+			"set -- $SSH_CONNECTION; exec sudo /usr/bin/dumpcap " +
+				"-s 2048 -w - -i 'any' -P -q -f " +
+				"'(port 12345) and '" + exclude},
+	} {
+		got := remoteCommand(test.command, test.device, test.promisc,
+			2048, test.filter)
+		if got != test.want {
+			t.Errorf("%q: got %s; want %s", test.command, got,
+				test.want)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	// test valid host
+	got, err := sshArgs("user@host", "true")
+	want := []string{"--", "user@host", "true"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %q, %v; want %q, nil", got, err, want)
+	}
+
+	// test hosts with ssh options
+	for _, host := range []string{"", "-oProxyCommand=sh", "-V"} {
+		if _, err := sshArgs(host, "true"); err == nil {
+			t.Errorf("%q: got nil; want error", host)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// statsMode indicates if an aggregate report is printed instead of
+	// every message
+	statsMode bool
+
+	// report stores the aggregate report of the stats subcommand
+	report reportTable
+)
+
+// reportPeers identifies a pair of peers by the sender and receiver ips
+type reportPeers struct {
+	sender, receiver gopacket.Endpoint
+}
+
+// reportTable stores the message counts by type and by peers and the
+// handshake durations protected by a mutex
+type reportTable struct {
+	lock      sync.Mutex
+	types     map[string]uint64
+	peers     map[reportPeers]uint64
+	durations []time.Duration
+}
+
+// init initializes the report table
+func (rt *reportTable) init() {
+	rt.lock.Lock()
+	if rt.types == nil {
+		rt.types = make(map[string]uint64)
+		rt.peers = make(map[reportPeers]uint64)
+	}
+	rt.lock.Unlock()
+}
+
+// addMessage adds the CLC message msg sent over the network flow net to the
+// report table
+func (rt *reportTable) addMessage(net gopacket.Flow, msg clc.Message) {
+	typ := "Invalid"
+	if hdr := messageHeader(msg); hdr != nil {
+		typ = hdr.Type.String()
+	}
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	if rt.types == nil {
+		return
+	}
+	rt.types[typ]++
+	rt.peers[reportPeers{net.Src(), net.Dst()}]++
+}
+
+// addHandshake adds the duration of the finished handshake r to the report
+// table
+func (rt *reportTable) addHandshake(r *handshakeResult) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	if rt.types == nil {
+		return
+	}
+	rt.durations = append(rt.durations, r.total)
+}
+
+// messages returns the message counts ordered by message type
+func (rt *reportTable) messages() string {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	return messageCounts(rt.types)
+}
+
+// peerCounts returns the message counts of the peers ordered by number of
+// messages
+func (rt *reportTable) peerCounts() []string {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	keys := make([]reportPeers, 0, len(rt.peers))
+	for key := range rt.peers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if rt.peers[keys[i]] != rt.peers[keys[j]] {
+			return rt.peers[keys[i]] > rt.peers[keys[j]]
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%s -> %s: %d messages",
+			key.sender, key.receiver, rt.peers[key]))
+	}
+	return lines
+}
+
+// sortedDurations returns the durations of the finished handshakes in
+// ascending order
+func (rt *reportTable) sortedDurations() []time.Duration {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	durations := make([]time.Duration, len(rt.durations))
+	copy(durations, rt.durations)
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	return durations
+}
+
+// handshakeDurations returns the number and the minimum, median, average,
+// and maximum durations of the finished handshakes
+func (rt *reportTable) handshakeDurations() string {
+	durations := rt.sortedDurations()
+	n := len(durations)
+	if n == 0 {
+		return "0 handshakes"
+	}
+	var sum time.Duration
+	for _, d := range durations {
+		sum += d
+	}
+	return fmt.Sprintf("%d handshakes, min %s, median %s, avg %s, max %s",
+		n, durations[0], durations[n/2], sum/time.Duration(n),
+		durations[n-1])
+}
+
+// writeReport writes the aggregate report to w
+func writeReport(w io.Writer) {
+	reportFmt := "Report: %s: %s\n"
+	fmt.Fprintf(w, reportFmt, "Messages", report.messages())
+	fmt.Fprintf(w, reportFmt, "Handshakes", &stats)
+	fmt.Fprintf(w, reportFmt, "Link Groups", stats.linkGroupString())
+	fmt.Fprintf(w, reportFmt, "Handshake Durations",
+		report.handshakeDurations())
+	for _, line := range durations.lines() {
+		fmt.Fprintf(w, reportFmt, "Handshake Duration Histogram", line)
+	}
+	for _, line := range bufferSizes.lines() {
+		fmt.Fprintf(w, reportFmt, "Buffer Sizes", line)
+	}
+	for _, line := range report.peerCounts() {
+		fmt.Fprintf(w, reportFmt, "Peers", line)
+	}
+	for _, line := range declines.summary() {
+		fmt.Fprintf(w, reportFmt, "Declines", line)
+	}
+	for _, line := range peerIDs.summary() {
+		fmt.Fprintf(w, reportFmt, "Peer IDs", line)
+	}
+	for _, line := range inventory.lines() {
+		fmt.Fprintf(w, reportFmt, "Inventory", line)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestReportTable(t *testing.T) {
+	var rt reportTable
+
+	// test report table without init
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	rt.addMessage(net, proposal)
+	if got := rt.messages(); got != "0" {
+		t.Errorf("got = %s; want 0", got)
+	}
+
+	// test messages
+	rt.init()
+	rt.addMessage(net, proposal)
+	rt.addMessage(net, proposal)
+	rt.addMessage(net.Reverse(), decline)
+	want := "3 (Proposal: 2, Decline: 1)"
+	if got := rt.messages(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test peers
+	wantPeers := []string{
+		"1.2.3.4 -> 5.6.7.8: 2 messages",
+		"5.6.7.8 -> 1.2.3.4: 1 messages",
+	}
+	if got := rt.peerCounts(); !reflect.DeepEqual(got, wantPeers) {
+		t.Errorf("got = %v; want %v", got, wantPeers)
+	}
+
+	// test handshake durations
+	for _, d := range []time.Duration{4, 1, 2, 1} {
+		rt.addHandshake(&handshakeResult{total: d * time.Millisecond})
+	}
+	want = "4 handshakes, min 1ms, median 2ms, avg 2ms, max 4ms"
+	if got := rt.handshakeDurations(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
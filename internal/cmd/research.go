@@ -0,0 +1,297 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// research stores the research table
+	research researchTable
+)
+
+// reservedArea is a reserved byte region of a CLC message at offset with
+// length bytes, a mask other than 0xff marks the reserved bits of a single
+// byte shared with other fields
+type reservedArea struct {
+	offset int
+	length int
+	mask   byte
+}
+
+// reservedHeaderArea returns the reserved area of the CLC header hdr, SMCv2
+// proposals use it for the SMCv2 path
+func reservedHeaderArea(hdr *clc.Header) []reservedArea {
+	if hdr.Type == clc.TypeProposal && hdr.Version == clc.SMCv2 {
+		return nil
+	}
+	return []reservedArea{{7, 1, 0b00000100}}
+}
+
+// reservedProposalAreas returns the reserved areas of the CLC proposal p
+func reservedProposalAreas(p *clc.Proposal) []reservedArea {
+	var areas []reservedArea
+	if p.IPAreaOffset == clc.SMCDIPAreaOffset {
+		areas = append(areas, reservedArea{48, 32, 0xff})
+	}
+	ip := clc.HeaderLen + clc.PeerIDLen + 16 + 6 + 2 + int(p.IPAreaOffset)
+	return append(areas, reservedArea{ip + 5, 2, 0xff})
+}
+
+// reservedProposalV2Areas returns the reserved areas of the SMCv2 CLC
+// proposal p including its optional extensions
+func reservedProposalV2Areas(p *clc.ProposalV2) []reservedArea {
+	areas := []reservedArea{{52, 28, 0xff}}
+	skip := 80
+	if p.Path != clc.SMCTypeN {
+		areas = append(areas, reservedArea{skip + 5, 2, 0xff})
+		skip += 8 + int(p.IPv6PrefixesCnt)*clc.IPv6PrefixLen
+	}
+	if p.Pathv2 != clc.SMCTypeN {
+		areas = append(areas,
+			reservedArea{skip + 2, 1, 0xff},
+			reservedArea{skip + 3, 1, 0b00001110},
+			reservedArea{skip + 4, 2, 0xff},
+			reservedArea{skip + 8, 32, 0xff})
+		skip += 40 + int(p.EIDNumber)*clc.EIDLen
+	}
+	if p.Pathv2 == clc.SMCTypeD || p.Pathv2 == clc.SMCTypeB {
+		areas = append(areas, reservedArea{skip + 32, 16, 0xff})
+	}
+	return areas
+}
+
+// reservedAcceptSMCDv2Areas returns the reserved areas of the SMCv2 CLC SMC-D
+// accept or confirm message m including its first contact extension
+func reservedAcceptSMCDv2Areas(m *clc.AcceptSMCDv2) []reservedArea {
+	areas := []reservedArea{{25, 1, 0b00001111}, {26, 2, 0xff},
+		{66, 8, 0xff}}
+	if m.Length == clc.AcceptSMCDv2FCELen {
+		areas = append(areas, reservedArea{74, 1, 0xff},
+			reservedArea{76, 2, 0xff})
+	}
+	return areas
+}
+
+// reservedAreas returns the reserved areas of the CLC message msg including
+// its header, and if the message type is supported
+func reservedAreas(msg clc.Message) ([]reservedArea, bool) {
+	hdr := messageHeader(msg)
+	if hdr == nil {
+		return nil, false
+	}
+	areas := reservedHeaderArea(hdr)
+	switch m := msg.(type) {
+	case *clc.Proposal:
+		areas = append(areas, reservedProposalAreas(m)...)
+	case *clc.ProposalV2:
+		areas = append(areas, reservedProposalV2Areas(m)...)
+	case *clc.AcceptSMCR, *clc.ConfirmSMCR:
+		areas = append(areas, reservedArea{51, 1, 0xff},
+			reservedArea{60, 1, 0xff})
+	case *clc.AcceptSMCD, *clc.ConfirmSMCD:
+		areas = append(areas, reservedArea{33, 1, 0b00001111},
+			reservedArea{34, 2, 0xff}, reservedArea{40, 12, 0xff})
+	case *clc.AcceptSMCDv2:
+		areas = append(areas, reservedAcceptSMCDv2Areas(m)...)
+	case *clc.ConfirmSMCDv2:
+		areas = append(areas,
+			reservedAcceptSMCDv2Areas(&m.AcceptSMCDv2)...)
+	case *clc.Decline:
+		areas = append(areas, reservedArea{20, 4, 0xff})
+	case *clc.DeclineV2:
+		areas = append(areas, reservedArea{20, 1, 0b00001111},
+			reservedArea{21, 3, 0xff})
+	default:
+		return nil, false
+	}
+	return areas, true
+}
+
+// messageRaw returns the raw bytes of the CLC message msg
+func messageRaw(msg clc.Message) []byte {
+	switch m := msg.(type) {
+	case *clc.Proposal:
+		return m.Raw
+	case *clc.ProposalV2:
+		return m.Raw
+	case *clc.AcceptSMCR:
+		return m.Raw
+	case *clc.ConfirmSMCR:
+		return m.Raw
+	case *clc.AcceptSMCD:
+		return m.Raw
+	case *clc.ConfirmSMCD:
+		return m.Raw
+	case *clc.AcceptSMCDv2:
+		return m.Raw
+	case *clc.ConfirmSMCDv2:
+		return m.Raw
+	case *clc.Decline:
+		return m.Raw
+	case *clc.DeclineV2:
+		return m.Raw
+	}
+	return nil
+}
+
+// jsonReservedArea is a reserved area of a CLC message in the research output
+type jsonReservedArea struct {
+	Offset int    `json:"offset"`
+	Mask   string `json:"mask"`
+	Data   string `json:"data"`
+}
+
+// jsonResearch is the record of a CLC message in the research output
+type jsonResearch struct {
+	Time    time.Time          `json:"time"`
+	Src     string             `json:"src"`
+	Dst     string             `json:"dst"`
+	Key     string             `json:"key"`
+	NonZero bool               `json:"nonzero"`
+	Areas   []jsonReservedArea `json:"areas"`
+}
+
+// researchCounts are the number of messages and the number of messages with
+// non-zero reserved areas of a message type and version
+type researchCounts struct {
+	messages uint64
+	nonZero  uint64
+}
+
+// researchTable writes the reserved areas of CLC messages to the research
+// file and counts them per message type and version protected by a mutex
+type researchTable struct {
+	lock   sync.Mutex
+	file   *os.File
+	counts map[string]*researchCounts
+}
+
+// init initializes the research table and creates the research file
+func (rt *researchTable) init(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	rt.lock.Lock()
+	rt.file = f
+	rt.counts = make(map[string]*researchCounts)
+	rt.lock.Unlock()
+	return nil
+}
+
+// researchKey returns the message type and version of the CLC header hdr as
+// key of the research table, e.g., "proposal/v2"
+func researchKey(hdr *clc.Header) string {
+	return fmt.Sprintf("%s/v%d", strings.ToLower(hdr.Type.String()),
+		hdr.Version)
+}
+
+// add writes the reserved areas of the CLC message msg sent over the network
+// flow net and the transport flow trans to the research file
+func (rt *researchTable) add(net, trans gopacket.Flow, msg clc.Message) {
+	areas, ok := reservedAreas(msg)
+	if !ok {
+		return
+	}
+	raw := messageRaw(msg)
+	r := &jsonResearch{
+		Time: time.Now(),
+		Src:  fmt.Sprintf("%s:%s", net.Src(), trans.Src()),
+		Dst:  fmt.Sprintf("%s:%s", net.Dst(), trans.Dst()),
+		Key:  researchKey(messageHeader(msg)),
+	}
+	for _, a := range areas {
+		// skip areas beyond the message, e.g., after parse errors
+		if a.offset+a.length > len(raw)-clc.TrailerLen {
+			continue
+		}
+		data := make([]byte, a.length)
+		for i := range data {
+			data[i] = raw[a.offset+i] & a.mask
+			if data[i] != 0 {
+				r.NonZero = true
+			}
+		}
+		r.Areas = append(r.Areas, jsonReservedArea{
+			Offset: a.offset,
+			Mask:   fmt.Sprintf("%#02x", a.mask),
+			Data:   hex.EncodeToString(data),
+		})
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		log.Println("Error encoding research record:", err)
+		return
+	}
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	if rt.file == nil {
+		return
+	}
+	c := rt.counts[r.Key]
+	if c == nil {
+		c = &researchCounts{}
+		rt.counts[r.Key] = c
+	}
+	c.messages++
+	if r.NonZero {
+		c.nonZero++
+	}
+	if _, err := rt.file.Write(append(b, '\n')); err != nil {
+		log.Println("Error writing research file:", err)
+	}
+}
+
+// summary returns a line for each message type and version with the number
+// of messages and the number of messages with non-zero reserved areas
+func (rt *researchTable) summary() []string {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	keys := make([]string, 0, len(rt.counts))
+	for k := range rt.counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var lines []string
+	for _, k := range keys {
+		c := rt.counts[k]
+		lines = append(lines, fmt.Sprintf("%s: %d messages, %d with "+
+			"non-zero reserved areas", k, c.messages, c.nonZero))
+	}
+	return lines
+}
+
+// close closes the research file
+func (rt *researchTable) close() {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+
+	if rt.file == nil {
+		return
+	}
+	if err := rt.file.Close(); err != nil {
+		log.Println("Error closing research file:", err)
+	}
+	rt.file = nil
+}
+
+// printResearchSummary prints the research summary
+func printResearchSummary() {
+	for _, line := range research.summary() {
+		fmt.Fprintf(stdout, "Research: %s\n", line)
+	}
+}
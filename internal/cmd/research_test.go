@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestReservedAreas(t *testing.T) {
+	// test decline message
+	msg := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	areas, ok := reservedAreas(msg)
+	if !ok {
+		t.Fatal("reservedAreas() not supported")
+	}
+	want := []reservedArea{{7, 1, 0b00000100}, {20, 4, 0xff}}
+	if len(areas) != len(want) {
+		t.Fatalf("len(areas) = %d; want %d", len(areas), len(want))
+	}
+	for i := range want {
+		if areas[i] != want[i] {
+			t.Errorf("areas[%d] = %v; want %v", i, areas[i], want[i])
+		}
+	}
+}
+
+func TestResearchTable(t *testing.T) {
+	var rt researchTable
+
+	// initialize research table and test flows
+	file := filepath.Join(t.TempDir(), "research.jsonl")
+	if err := rt.init(file); err != nil {
+		t.Fatal(err)
+	}
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+
+	// add decline messages without and with reserved header bit and
+	// reserved bytes set
+	rt.add(net, trans, testHandshakeMessage("e2d4c3d904001c10252525252525"+
+		"25000303000000000000e2d4c3d9"))
+	rt.add(net, trans, testHandshakeMessage("e2d4c3d904001c14252525252525"+
+		"25000303000000000001e2d4c3d9"))
+	rt.close()
+
+	// check research file
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("len(lines) = %d; want 2", len(lines))
+	}
+	var got jsonResearch
+	if err := json.Unmarshal([]byte(lines[1]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Key != "decline/v1" || !got.NonZero || len(got.Areas) != 2 ||
+		got.Areas[0].Data != "04" || got.Areas[1].Data != "00000001" {
+		t.Errorf("got = %v; want decline/v1 with non-zero areas", got)
+	}
+
+	// check summary
+	summary := rt.summary()
+	want := "decline/v1: 2 messages, 1 with non-zero reserved areas"
+	if len(summary) != 1 || summary[0] != want {
+		t.Errorf("got = %v; want %s", summary, want)
+	}
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rotatingFile is an output file that is rotated when it exceeds a maximum
+// size or age. Rotation renames the file to file.1 after renaming older
+// rotated files file.N to file.N+1 and removes rotated files beyond the
+// number of kept files. Numbered files are not renamed, rotation continues
+// in a new file with the next number appended to the name like tcpdump. New
+// files start with a header, e.g., the CSV header row. Writes are not split
+// across files, so a write should contain whole records
+type rotatingFile struct {
+	lock     sync.Mutex
+	name     string
+	flags    int
+	header   []byte
+	maxSize  int64
+	maxAge   time.Duration
+	keep     int
+	numbered bool
+	index    int
+	file     *os.File
+	size     int64
+	opened   time.Time
+}
+
+// openRotatingFile opens the output file name with flags that is rotated
+// after maxSize bytes or maxAge, keeps keep rotated files, and writes header
+// to new files after rotations. Zero maxSize and maxAge disable rotation
+func openRotatingFile(name string, flags int, header []byte, maxSize int64,
+	maxAge time.Duration, keep int) (*rotatingFile, error) {
+	if maxSize < 0 || maxAge < 0 || keep < 0 {
+		return nil, fmt.Errorf("invalid output rotation settings")
+	}
+	f, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rotatingFile{
+		name:    name,
+		flags:   flags,
+		header:  header,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		keep:    keep,
+		file:    f,
+		size:    info.Size(),
+		opened:  time.Now(),
+	}, nil
+}
+
+// openNumberedFile creates the numbered output file name that is rotated
+// after maxSize bytes. If files is greater than 0, the files are numbered
+// from 0 to files-1 and overwritten in a ring, otherwise the first file has
+// no number. Zero maxSize disables rotation
+func openNumberedFile(name string, maxSize int64,
+	files int) (*rotatingFile, error) {
+	if maxSize < 0 || files < 0 {
+		return nil, fmt.Errorf("invalid output rotation settings")
+	}
+	r := &rotatingFile{
+		name:     name,
+		flags:    os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+		maxSize:  maxSize,
+		keep:     files,
+		numbered: true,
+		opened:   time.Now(),
+	}
+	f, err := os.OpenFile(r.currentName(), r.flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r.file = f
+	return r, nil
+}
+
+// currentName returns the name of the current file. Numbered files have the
+// index appended with the digits of the last index if the number of files is
+// limited
+func (r *rotatingFile) currentName() string {
+	switch {
+	case !r.numbered:
+		return r.name
+	case r.keep > 0:
+		digits := len(strconv.Itoa(r.keep - 1))
+		return fmt.Sprintf("%s%0*d", r.name, digits, r.index)
+	case r.index > 0:
+		return fmt.Sprintf("%s%d", r.name, r.index)
+	}
+	return r.name
+}
+
+// setHeader sets the header written to new files after rotations
+func (r *rotatingFile) setHeader(header []byte) {
+	r.lock.Lock()
+	r.header = header
+	r.lock.Unlock()
+}
+
+// rotatedName returns the name of the i-th rotated file
+func (r *rotatingFile) rotatedName(i int) string {
+	return fmt.Sprintf("%s.%d", r.name, i)
+}
+
+// due checks if the file must be rotated before writing n bytes, r must be
+// locked
+func (r *rotatingFile) due(n int) bool {
+	if r.maxSize > 0 && r.size > int64(len(r.header)) &&
+		r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && time.Since(r.opened) >= r.maxAge
+}
+
+// rotate rotates the file and opens a new file with the header, r must be
+// locked
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	switch {
+	case r.numbered:
+		r.index++
+		if r.keep > 0 {
+			r.index %= r.keep
+		}
+	case r.keep > 0:
+		os.Remove(r.rotatedName(r.keep))
+		for i := r.keep - 1; i > 0; i-- {
+			os.Rename(r.rotatedName(i), r.rotatedName(i+1))
+		}
+		if err := os.Rename(r.name, r.rotatedName(1)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(r.currentName(), r.flags|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.size = 0
+	r.opened = time.Now()
+	if len(r.header) > 0 {
+		n, err := f.Write(r.header)
+		r.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes p to the file and rotates the file before if necessary
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.due(len(p)) {
+		if err := r.rotate(); err != nil {
+			r.file = nil
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close closes the file
+func (r *rotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rotateTestRead returns the content of file or "missing"
+func rotateTestRead(t *testing.T, file string) string {
+	b, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "missing"
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.csv")
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	r, err := openRotatingFile(file, flags, []byte("h\n"), 6, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// header written by caller to the first file is not rotated alone,
+	// each following record exceeds the maximum size
+	for _, s := range []string{"h\n", "aaa\n", "bbb\n", "ccc\n", "ddd\n"} {
+		if _, err := r.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		file:         "h\nddd\n",
+		file + ".1":  "h\nccc\n",
+		file + ".2":  "h\nbbb\n",
+		file + ".3":  "missing",
+		file + ".10": "missing",
+	} {
+		if got := rotateTestRead(t, name); got != want {
+			t.Errorf("%s: got %q; want %q", name, got, want)
+		}
+	}
+
+	// writing after close fails
+	if _, err := r.Write([]byte("eee\n")); err == nil {
+		t.Error("got nil error; want error")
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.jsonl")
+	if err := os.WriteFile(file, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// existing file is appended until it is older than maximum age
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	r, err := openRotatingFile(file, flags, nil, 0, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("a\n"))
+	r.opened = r.opened.Add(-time.Hour)
+	r.Write([]byte("b\n"))
+	r.Close()
+
+	if got := rotateTestRead(t, file); got != "b\n" {
+		t.Errorf("got %q; want %q", got, "b\n")
+	}
+	if got := rotateTestRead(t, file+".1"); got != "old\na\n" {
+		t.Errorf("got %q; want %q", got, "old\na\n")
+	}
+}
+
+func TestRotatingFileKeepNone(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out.cef")
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	r, err := openRotatingFile(file, flags, nil, 3, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("a\n"))
+	r.Write([]byte("b\n"))
+	r.Close()
+
+	if got := rotateTestRead(t, file); got != "b\n" {
+		t.Errorf("got %q; want %q", got, "b\n")
+	}
+	if got := rotateTestRead(t, file+".1"); got != "missing" {
+		t.Errorf("got %q; want missing", got)
+	}
+}
+
+func TestRotatingFileNumbered(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out")
+
+	// without limit, the first file has no number
+	r, err := openNumberedFile(file, 6, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.setHeader([]byte("h\n"))
+	for _, s := range []string{"h\naaa\n", "bbb\n", "ccc\n"} {
+		r.Write([]byte(s))
+	}
+	r.Close()
+
+	for name, want := range map[string]string{
+		file:       "h\naaa\n",
+		file + "1": "h\nbbb\n",
+		file + "2": "h\nccc\n",
+		file + "3": "missing",
+	} {
+		if got := rotateTestRead(t, name); got != want {
+			t.Errorf("%s: got %q; want %q", name, got, want)
+		}
+	}
+
+	// with limit, the files are overwritten in a ring
+	file = filepath.Join(dir, "ring")
+	r, err = openNumberedFile(file, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"a\n", "b\n", "c\n"} {
+		r.Write([]byte(s))
+	}
+	r.Close()
+
+	for name, want := range map[string]string{
+		file:       "missing",
+		file + "0": "c\n",
+		file + "1": "b\n",
+		file + "2": "missing",
+	} {
+		if got := rotateTestRead(t, name); got != want {
+			t.Errorf("%s: got %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestRotatingFileCurrentName(t *testing.T) {
+	for _, test := range []struct {
+		keep, index int
+		want        string
+	}{
+		{0, 0, "smc.pcap"},
+		{0, 2, "smc.pcap2"},
+		{3, 0, "smc.pcap0"},
+		{3, 2, "smc.pcap2"},
+		{12, 3, "smc.pcap03"},
+	} {
+		r := rotatingFile{name: "smc.pcap", keep: test.keep,
+			numbered: true, index: test.index}
+		if got := r.currentName(); got != test.want {
+			t.Errorf("%d, %d: got %s; want %s", test.keep,
+				test.index, got, test.want)
+		}
+	}
+}
+
+func TestRotatingFileInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "out")
+	if _, err := openRotatingFile(file, os.O_WRONLY|os.O_CREATE, nil,
+		-1, 0, 0); err == nil {
+		t.Error("got nil error; want error")
+	}
+	if _, err := openNumberedFile(file, 0, -1); err == nil {
+		t.Error("got nil error; want error")
+	}
+}
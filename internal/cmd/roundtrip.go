@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// roundTrips stores the round-trip statistics
+	roundTrips roundTripStats
+)
+
+// roundTripStats stores the number of re-serialized CLC messages, of
+// messages that differ from their original bytes, and of messages with
+// unsupported types protected by a mutex
+type roundTripStats struct {
+	lock        sync.Mutex
+	checked     uint64
+	diverged    uint64
+	unsupported uint64
+}
+
+// check re-serializes the valid CLC message msg and compares it with its
+// original bytes. It returns the divergence, if any
+func (rs *roundTripStats) check(msg clc.Message) string {
+	serialized, original, ok := serializeMessage(msg)
+	divergence := ""
+	if ok {
+		divergence = compareBytes(serialized, original)
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	switch {
+	case !ok:
+		rs.unsupported++
+	case divergence != "":
+		rs.checked++
+		rs.diverged++
+	default:
+		rs.checked++
+	}
+	return divergence
+}
+
+// String converts the round-trip statistics to a string
+func (rs *roundTripStats) String() string {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	return fmt.Sprintf("%d checked, %d diverged, %d unsupported",
+		rs.checked, rs.diverged, rs.unsupported)
+}
+
+// compareBytes compares the serialized message with the original message
+// bytes and returns the differences or an empty string if they are equal
+func compareBytes(serialized, original []byte) string {
+	if len(serialized) != len(original) {
+		return fmt.Sprintf("serialized %d bytes instead of %d",
+			len(serialized), len(original))
+	}
+	n, first := 0, -1
+	for i := range serialized {
+		if serialized[i] == original[i] {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d bytes differ, first at offset %d: %#02x "+
+		"instead of %#02x", n, first, serialized[first],
+		original[first])
+}
+
+// printRoundTrip prints the divergence of the re-serialized CLC message sent
+// over the network flow net and the transport flow trans
+func printRoundTrip(net, trans gopacket.Flow, divergence string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%s%s -> %s: Round-Trip: %s\n", t,
+		hostString(net.Src(), trans.Src()),
+		hostString(net.Dst(), trans.Dst()), divergence)
+}
+
+// printRoundTripStats prints the round-trip statistics
+func printRoundTripStats() {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sRound-Trip Stats: %s\n", t, &roundTrips)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestRoundTripStats(t *testing.T) {
+	var rs roundTripStats
+
+	// test messages that survive the round trip
+	for _, msg := range []string{
+		// smc-r accept
+		"e2d4c3d902004418b1a098039babcdef" +
+			"fe800000000000009a039bfffeabcdef" +
+			"98039babcdef0000e40000157d010000" +
+			"0005230000000000f0a600000072f5fe" +
+			"e2d4c3d9",
+		// smc-d accept
+		"e2d4c3c402003011" + "0000000000000001" +
+			"0000000000000002" + "01000000" + "00000005" +
+			"000000000000000000000000" + "e2d4c3c4",
+		// decline
+		"e2d4c3d904001c102525252525252500" +
+			"0303000000000000e2d4c3d9",
+	} {
+		if got := rs.check(testHandshakeMessage(msg)); got != "" {
+			t.Errorf("got = %s; want no divergence", got)
+		}
+	}
+
+	// test decline with reserved bytes set
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000001e2d4c3d9")
+	want := "1 bytes differ, first at offset 23: 0x00 instead of 0x01"
+	if got := rs.check(decline); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test unsupported proposal
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	if got := rs.check(proposal); got != "" {
+		t.Errorf("got = %s; want no divergence", got)
+	}
+
+	want = "4 checked, 1 diverged, 1 unsupported"
+	if got := rs.String(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
+
+func TestCompareBytes(t *testing.T) {
+	want := "serialized 2 bytes instead of 3"
+	if got := compareBytes([]byte{1, 2}, []byte{1, 2, 3}); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// rule actions
+const (
+	ruleActionTag    = "tag"
+	ruleActionAlert  = "alert"
+	ruleActionDrop   = "drop"
+	ruleActionSample = "sample"
+)
+
+var (
+	// rules stores the rules loaded from the rules file
+	rules ruleSet
+)
+
+// ruleCond is a match condition of a rule
+type ruleCond struct {
+	key   string
+	value string
+	ipnet *net.IPNet
+}
+
+// rule consists of match conditions and an action with an argument
+type rule struct {
+	conds  []ruleCond
+	action string
+	arg    string
+	rate   uint64
+	count  uint64
+}
+
+// ruleResult is the result of applying the rules to a CLC message
+type ruleResult struct {
+	drop   bool
+	tags   []string
+	alerts []string
+}
+
+// ruleSet stores the rules and the rules file they are loaded from protected
+// by a mutex
+type ruleSet struct {
+	lock    sync.Mutex
+	file    string
+	modTime time.Time
+	rules   []*rule
+}
+
+// parseRuleCond parses the match condition s
+func parseRuleCond(s string) (ruleCond, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || value == "" {
+		return ruleCond{}, fmt.Errorf("invalid condition %q", s)
+	}
+	c := ruleCond{key: key, value: value}
+	switch key {
+	case "type", "path", "version":
+	case "port":
+		if _, err := strconv.ParseUint(value, 10, 16); err != nil {
+			return c, fmt.Errorf("invalid port %q", value)
+		}
+	case "diagnosis":
+		if _, err := strconv.ParseUint(value, 0, 32); err != nil {
+			return c, fmt.Errorf("invalid diagnosis %q", value)
+		}
+	case "src", "dst", "host":
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil {
+				bits := 8 * len(ip)
+				if ip.To4() != nil {
+					ip = ip.To4()
+					bits = 32
+				}
+				value = fmt.Sprintf("%s/%d", ip, bits)
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return c, fmt.Errorf("invalid address %q", c.value)
+		}
+		c.ipnet = ipnet
+	default:
+		return c, fmt.Errorf("unknown condition %q", key)
+	}
+	return c, nil
+}
+
+// parseRule parses the rule in line
+func parseRule(line string) (*rule, error) {
+	conds, action, ok := strings.Cut(line, "=>")
+	if !ok {
+		return nil, fmt.Errorf("missing \"=>\"")
+	}
+
+	r := &rule{}
+	for _, s := range strings.Fields(conds) {
+		c, err := parseRuleCond(s)
+		if err != nil {
+			return nil, err
+		}
+		r.conds = append(r.conds, c)
+	}
+
+	fields := strings.Fields(action)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("missing action")
+	}
+	r.action = fields[0]
+	r.arg = strings.Join(fields[1:], " ")
+	switch r.action {
+	case ruleActionTag, ruleActionAlert:
+		if r.arg == "" {
+			return nil, fmt.Errorf("missing %s argument", r.action)
+		}
+	case ruleActionDrop:
+		if r.arg != "" {
+			return nil, fmt.Errorf("unexpected drop argument")
+		}
+	case ruleActionSample:
+		rate, err := strconv.ParseUint(r.arg, 10, 64)
+		if err != nil || rate == 0 {
+			return nil, fmt.Errorf("invalid sample rate %q", r.arg)
+		}
+		r.rate = rate
+	default:
+		return nil, fmt.Errorf("unknown action %q", r.action)
+	}
+	return r, nil
+}
+
+// parseRules parses the rules in r, one rule per line. Empty lines and lines
+// starting with # are ignored
+func parseRules(r io.Reader) ([]*rule, error) {
+	var list []*rule
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		list = append(list, rule)
+	}
+	return list, scanner.Err()
+}
+
+// load loads the rules from the rules file
+func (rs *ruleSet) load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	list, err := parseRules(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	rs.lock.Lock()
+	rs.file = file
+	rs.modTime = info.ModTime()
+	rs.rules = list
+	rs.lock.Unlock()
+	return nil
+}
+
+// reload reloads the rules if the rules file changed. If the new rules are
+// invalid, the current rules are kept
+func (rs *ruleSet) reload() {
+	rs.lock.Lock()
+	file, modTime := rs.file, rs.modTime
+	rs.lock.Unlock()
+
+	if file == "" {
+		return
+	}
+	info, err := os.Stat(file)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	if err := rs.load(file); err != nil {
+		log.Println("Error reloading rules:", err)
+		return
+	}
+	fmt.Fprintf(stdout, "Reloaded rules from %s\n", file)
+}
+
+// match checks if the CLC message msg sent over the network flow net and the
+// transport flow trans matches the condition
+func (c *ruleCond) match(net, trans gopacket.Flow, msg clc.Message) bool {
+	switch c.key {
+	case "src":
+		return c.ipnet.Contains(net.Src().Raw())
+	case "dst":
+		return c.ipnet.Contains(net.Dst().Raw())
+	case "host":
+		return c.ipnet.Contains(net.Src().Raw()) ||
+			c.ipnet.Contains(net.Dst().Raw())
+	case "port":
+		return trans.Src().String() == c.value ||
+			trans.Dst().String() == c.value
+	}
+
+	hdr := messageHeader(msg)
+	if hdr == nil {
+		return c.key == "type" && c.value == "invalid"
+	}
+	switch c.key {
+	case "type":
+		return strings.EqualFold(hdr.Type.String(), c.value)
+	case "path":
+		return strings.EqualFold(hdr.Path.String(), c.value)
+	case "version":
+		return strconv.Itoa(int(hdr.Version)) == c.value
+	case "diagnosis":
+		code, _ := strconv.ParseUint(c.value, 0, 32)
+		switch m := msg.(type) {
+		case *clc.Decline:
+			return uint64(m.PeerDiagnosis) == code
+		case *clc.DeclineV2:
+			return uint64(m.PeerDiagnosis) == code
+		}
+	}
+	return false
+}
+
+// apply applies the rules to the CLC message msg sent over the network flow
+// net and the transport flow trans
+func (rs *ruleSet) apply(net, trans gopacket.Flow,
+	msg clc.Message) *ruleResult {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	res := &ruleResult{}
+	for _, r := range rs.rules {
+		matched := true
+		for i := range r.conds {
+			if !r.conds[i].match(net, trans, msg) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		switch r.action {
+		case ruleActionTag:
+			res.tags = append(res.tags, r.arg)
+		case ruleActionAlert:
+			res.alerts = append(res.alerts, r.arg)
+		case ruleActionDrop:
+			res.drop = true
+		case ruleActionSample:
+			if r.count%r.rate != 0 {
+				res.drop = true
+			}
+			r.count++
+		}
+	}
+	return res
+}
+
+// emitRuleResult emits the tags and alerts in the rule result res of a CLC
+// message sent over the network flow net and the transport flow trans as
+// alert events
+func emitRuleResult(net, trans gopacket.Flow, res *ruleResult) {
+	if len(res.tags) > 0 {
+		emit(&event{typ: eventAlert, reason: alertRuleTags, net: net,
+			trans: trans, text: strings.Join(res.tags, ", ")})
+	}
+	for _, alert := range res.alerts {
+		emit(&event{typ: eventAlert, reason: alertRule, net: net,
+			trans: trans, text: alert})
+	}
+}
+
+// printRuleAlert prints the rule alert or tags, as given by kind, of a CLC
+// message sent over the network flow net and the transport flow trans
+func printRuleAlert(net, trans gopacket.Flow, kind, alert string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%s%s:%s -> %s:%s: %s: %s\n", t, net.Src(),
+		trans.Src(), net.Dst(), trans.Dst(), kind, alert)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestParseRules(t *testing.T) {
+	// test valid rules
+	list, err := parseRules(strings.NewReader(`
+# comment
+type=decline src=1.2.3.0/24 => alert decline from test network
+path=SMC-R => tag smc-r
+=> sample 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("len(list) = %d; want 3", len(list))
+	}
+	want := "decline from test network"
+	if list[0].arg != want {
+		t.Errorf("got = %s; want %s", list[0].arg, want)
+	}
+
+	// test invalid rules
+	for _, s := range []string{
+		"type=decline",
+		"foo=bar => drop",
+		"src=1.2.3 => drop",
+		"port=abc => drop",
+		"=> drop now",
+		"=> tag",
+		"=> sample 0",
+		"=> explode",
+	} {
+		if _, err := parseRules(strings.NewReader(s)); err == nil {
+			t.Errorf("%s: got = nil; want error", s)
+		}
+	}
+}
+
+func TestRuleSet(t *testing.T) {
+	// prepare test flows and messages
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+
+	// write rules file
+	dir, err := os.MkdirTemp("", "smc-clc-rules")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rules")
+	err = os.WriteFile(file, []byte(
+		"type=decline diagnosis=0x3030000 => alert no device\n"+
+			"host=5.6.7.8 port=456 => tag server\n"+
+			"src=5.6.7.8 => drop\n"+
+			"type=proposal => drop\n"), 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// test rules
+	var rs ruleSet
+	if err := rs.load(file); err != nil {
+		t.Fatal(err)
+	}
+	got := rs.apply(net, trans, decline)
+	want := &ruleResult{
+		tags:   []string{"server"},
+		alerts: []string{"no device"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+	got = rs.apply(net.Reverse(), trans.Reverse(), decline)
+	if !got.drop {
+		t.Errorf("got = %t; want true", got.drop)
+	}
+
+	// test reload with sample rule
+	err = os.WriteFile(file, []byte("=> sample 2\n"), 0600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, future, future); err != nil {
+		log.Fatal(err)
+	}
+	rs.reload()
+	for i, want := range []bool{false, true, false, true} {
+		got := rs.apply(net, trans, decline)
+		if got.drop != want {
+			t.Errorf("%d: got = %t; want %t", i, got.drop, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+const (
+	// selftestDevice is the default network interface of the live self
+	// test
+	selftestDevice = "lo"
+
+	// selftestDuration is the capture duration of the live self test
+	selftestDuration = 3 * time.Second
+
+	// selftestPayload is the payload the prober sends to the responder
+	selftestPayload = "smc-clc selftest"
+)
+
+var (
+	// selftestMode indicates if a live SMC handshake over the loopback
+	// interface is captured and checked instead of reading packets from a
+	// pcap file or network interface
+	selftestMode bool
+)
+
+// selftestPort returns a free tcp port on the loopback interface
+func selftestPort() (int, error) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// listenSelftest captures an SMC handshake between the responder and the
+// prober over the loopback interface and handles its packets with handler
+func listenSelftest(handler *handler) {
+	port, err := selftestPort()
+	if err != nil {
+		log.Fatal(err)
+	}
+	device := selftestDevice
+	if len(*pcapDevices) > 0 {
+		device = (*pcapDevices)[0]
+	}
+
+	// start capture before the handshake
+	listener := pcap.Listener{
+		PacketHandler: handler,
+		TimerHandler:  handler,
+		Timer:         time.Minute,
+		Device:        device,
+		Snaplen:       *pcapSnaplen,
+		Timeout:       100 * time.Millisecond,
+		Filter:        fmt.Sprintf("tcp port %d", port),
+		MaxTime:       selftestDuration,
+	}
+	prepareListener(&listener)
+	setListeners(&listener)
+
+	go func() {
+		if err := selftestHandshake(port); err != nil {
+			log.Fatal("Selftest: ", err)
+		}
+	}()
+	listener.Loop()
+	setListeners()
+}
+
+// selftestResult returns the result of the live self test with the numbers
+// of attempted, succeeded, declined, and fallen back handshakes and if it
+// passed: the SMC connection attempt must be seen and finish with a
+// handshake or a fallback to tcp
+func selftestResult(attempted, succeeded, declined,
+	fallbacks uint64) (string, bool) {
+	counts := countsString(attempted, succeeded, declined, fallbacks)
+	if attempted == 0 {
+		return "failed: no SMC connection attempt seen (" + counts +
+			")", false
+	}
+	if succeeded+declined+fallbacks == 0 {
+		return "failed: no handshake or fallback seen (" + counts +
+			")", false
+	}
+	return "passed (" + counts + ")", true
+}
+
+// checkSelftest prints the result of the live self test and exits with an
+// error if it failed
+func checkSelftest() {
+	result, ok := selftestResult(stats.counts())
+	if !ok {
+		log.Fatal("Selftest: ", result)
+	}
+	fmt.Fprintf(stdout, "Selftest: %s\n", result)
+}
@@ -0,0 +1,94 @@
+//go:build linux
+
+package cmd
+
+import (
+	"fmt"
+	"syscall"
+)
+
+const (
+	// afSMC is the SMC socket address family
+	afSMC = 43
+
+	// smcProtoIPv4 is the SMC socket protocol for IPv4
+	smcProtoIPv4 = 0
+)
+
+// selftestAddr returns the loopback socket address with port
+func selftestAddr(port int) *syscall.SockaddrInet4 {
+	return &syscall.SockaddrInet4{Port: port, Addr: [4]byte{127, 0, 0, 1}}
+}
+
+// selftestResponder creates an SMC socket listening on the loopback port and
+// returns a function that accepts one connection and reads until its end
+func selftestResponder(port int) (func() error, error) {
+	fd, err := syscall.Socket(afSMC, syscall.SOCK_STREAM, smcProtoIPv4)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create SMC socket, is the "+
+			"smc kernel module loaded? %w", err)
+	}
+	err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET,
+		syscall.SO_REUSEADDR, 1)
+	if err == nil {
+		err = syscall.Bind(fd, selftestAddr(port))
+	}
+	if err == nil {
+		err = syscall.Listen(fd, 1)
+	}
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return func() error {
+		defer syscall.Close(fd)
+		nfd, _, err := syscall.Accept(fd)
+		if err != nil {
+			return err
+		}
+		defer syscall.Close(nfd)
+		buf := make([]byte, 1024)
+		for {
+			n, err := syscall.Read(nfd, buf)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+		}
+	}, nil
+}
+
+// selftestProber connects an SMC socket to the loopback port, sends the self
+// test payload, and closes the connection
+func selftestProber(port int) error {
+	fd, err := syscall.Socket(afSMC, syscall.SOCK_STREAM, smcProtoIPv4)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Connect(fd, selftestAddr(port)); err != nil {
+		return err
+	}
+	_, err = syscall.Write(fd, []byte(selftestPayload))
+	return err
+}
+
+// selftestHandshake runs an SMC handshake between the responder and the
+// prober over the loopback port
+func selftestHandshake(port int) error {
+	accept, err := selftestResponder(port)
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- accept()
+	}()
+	if err := selftestProber(port); err != nil {
+		return err
+	}
+	return <-done
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package cmd
+
+import "errors"
+
+// selftestHandshake is not supported on this platform
+func selftestHandshake(port int) error {
+	return errors.New("SMC sockets are only supported on linux")
+}
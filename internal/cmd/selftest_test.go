@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelftestResult(t *testing.T) {
+	// test passed self tests with handshake and fallback
+	for _, counts := range [][4]uint64{{1, 1, 0, 0}, {1, 0, 1, 0},
+		{1, 0, 0, 1}} {
+		got, ok := selftestResult(counts[0], counts[1], counts[2],
+			counts[3])
+		if !ok || !strings.HasPrefix(got, "passed") {
+			t.Errorf("got = %s, %t; want passed, true", got, ok)
+		}
+	}
+
+	// test failed self tests
+	for _, counts := range [][4]uint64{{0, 0, 0, 0}, {1, 0, 0, 0}} {
+		got, ok := selftestResult(counts[0], counts[1], counts[2],
+			counts[3])
+		if ok || !strings.HasPrefix(got, "failed") {
+			t.Errorf("got = %s, %t; want failed, false", got, ok)
+		}
+	}
+}
+
+func TestSelftestPort(t *testing.T) {
+	port, err := selftestPort()
+	if err != nil || port <= 0 {
+		t.Errorf("got = %d, %v; want port, nil", port, err)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"encoding/binary"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// appendHeader appends the CLC header hdr to buf, the reserved bit is always
+// 0 because it is not exported by the parser
+func appendHeader(buf []byte, hdr *clc.Header) []byte {
+	buf = append(buf, hdr.Eyecatcher[:]...)
+	buf = append(buf, byte(hdr.Type))
+	buf = binary.BigEndian.AppendUint16(buf, hdr.Length)
+	return append(buf, hdr.Version<<4|hdr.Flag<<3|byte(hdr.Path))
+}
+
+// appendUint24 appends the lowest 3 bytes of v to buf in big endian order
+func appendUint24(buf []byte, v int) []byte {
+	return append(buf, byte(v>>16), byte(v>>8), byte(v))
+}
+
+// serializeAcceptSMCR serializes the SMC-R accept or confirm message m
+func serializeAcceptSMCR(m *clc.AcceptSMCR) []byte {
+	buf := make([]byte, 0, clc.AcceptSMCRLen)
+	buf = appendHeader(buf, &m.Header)
+	buf = append(buf, m.SenderPeerID[:]...)
+	buf = append(buf, m.IBGID.To16()...)
+	buf = append(buf, m.IBMAC...)
+	buf = appendUint24(buf, m.QPN)
+	buf = binary.BigEndian.AppendUint32(buf, m.RMBRKey)
+	buf = append(buf, m.RMBEIdx)
+	buf = binary.BigEndian.AppendUint32(buf, m.RMBEAlertToken)
+	buf = append(buf, byte(m.RMBESize)<<4|byte(m.QPMTU))
+	buf = append(buf, 0) // reserved
+	buf = binary.BigEndian.AppendUint64(buf, m.RMBDMAAddr)
+	buf = append(buf, 0) // reserved
+	buf = appendUint24(buf, m.PSN)
+	return append(buf, m.Trailer[:]...)
+}
+
+// serializeAcceptSMCD serializes the SMC-D accept or confirm message m
+func serializeAcceptSMCD(m *clc.AcceptSMCD) []byte {
+	buf := make([]byte, 0, clc.AcceptSMCDLen)
+	buf = appendHeader(buf, &m.Header)
+	buf = binary.BigEndian.AppendUint64(buf, m.GID)
+	buf = binary.BigEndian.AppendUint64(buf, m.Token)
+	buf = append(buf, m.DMBEIdx)
+	buf = append(buf, byte(m.DMBESize)<<4)
+	buf = append(buf, 0, 0) // reserved
+	buf = binary.BigEndian.AppendUint32(buf, m.LinkID)
+	buf = append(buf, make([]byte, 12)...) // reserved
+	return append(buf, m.Trailer[:]...)
+}
+
+// serializeDecline serializes the decline message with the header hdr, the
+// sender peer ID id, the peer diagnosis diag, the OS type os, and the
+// trailer t
+func serializeDecline(hdr *clc.Header, id clc.PeerID,
+	diag clc.PeerDiagnosis, os clc.OSType, t clc.Trailer) []byte {
+	buf := make([]byte, 0, clc.DeclineLen)
+	buf = appendHeader(buf, hdr)
+	buf = append(buf, id[:]...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(diag))
+	buf = append(buf, byte(os)<<4, 0, 0, 0) // os type and reserved
+	return append(buf, t[:]...)
+}
+
+// serializeMessage serializes the CLC message msg from its parsed fields and
+// returns the serialized message, the original message bytes, and if the
+// message type is supported
+func serializeMessage(msg clc.Message) ([]byte, []byte, bool) {
+	switch m := msg.(type) {
+	case *clc.AcceptSMCR:
+		return serializeAcceptSMCR(m), m.Raw, true
+	case *clc.ConfirmSMCR:
+		return serializeAcceptSMCR(&m.AcceptSMCR), m.Raw, true
+	case *clc.AcceptSMCD:
+		return serializeAcceptSMCD(m), m.Raw, true
+	case *clc.ConfirmSMCD:
+		return serializeAcceptSMCD(&m.AcceptSMCD), m.Raw, true
+	case *clc.Decline:
+		return serializeDecline(&m.Header, m.SenderPeerID,
+			m.PeerDiagnosis, 0, m.Trailer), m.Raw, true
+	case *clc.DeclineV2:
+		return serializeDecline(&m.Header, m.SenderPeerID,
+			m.PeerDiagnosis, m.OSType, m.Trailer), m.Raw, true
+	}
+	return nil, nil, false
+}
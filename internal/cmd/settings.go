@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	gopcap "github.com/gopacket/gopacket/pcap"
+	"github.com/hwipl/packet-go/pkg/pcap"
+)
+
+var (
+	// settingsLock protects the settings that can be changed at runtime
+	// via the http api and the current pcap listeners
+	settingsLock sync.RWMutex
+
+	// currentListeners are the currently active pcap listeners, one per
+	// network interface
+	currentListeners []*pcap.Listener
+
+	// currentXDP is the currently active AF_XDP capture
+	currentXDP *xdpCapture
+
+	// outputPaused indicates if the text output is paused via the http api
+	outputPaused bool
+)
+
+// apiSettings stores the runtime settings in the http api
+type apiSettings struct {
+	ShowReserved    *bool   `json:"show_reserved,omitempty"`
+	ShowDumps       *bool   `json:"show_dumps,omitempty"`
+	ShowTimestamps  *bool   `json:"show_timestamps,omitempty"`
+	TimestampFormat *string `json:"timestamp_format,omitempty"`
+	Filter          *string `json:"filter,omitempty"`
+	SampleRate      *int    `json:"sample_rate,omitempty"`
+	FlushNew        *string `json:"flush_new,omitempty"`
+	FlushHandshake  *string `json:"flush_handshake,omitempty"`
+	FlushDone       *string `json:"flush_done,omitempty"`
+	Paused          *bool   `json:"paused,omitempty"`
+}
+
+// getSettings returns the current runtime settings
+func getSettings() *apiSettings {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	reserved, dumps := *showReserved, *showDumps
+	timestamps, format := *showTimestamps, *timestampFormat
+	filter, sampleRate := *pcapFilter, *pcapSampleRate
+	flushNewAge := flushNew.String()
+	flushHandshakeAge := flushHandshake.String()
+	flushDoneAge := flushDone.String()
+	paused := outputPaused
+	return &apiSettings{
+		ShowReserved:    &reserved,
+		ShowDumps:       &dumps,
+		ShowTimestamps:  &timestamps,
+		TimestampFormat: &format,
+		Filter:          &filter,
+		SampleRate:      &sampleRate,
+		FlushNew:        &flushNewAge,
+		FlushHandshake:  &flushHandshakeAge,
+		FlushDone:       &flushDoneAge,
+		Paused:          &paused,
+	}
+}
+
+// setSettings sets the runtime settings in s, unset fields in s are ignored
+func setSettings(s *apiSettings) error {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+
+	// check new settings
+	if s.SampleRate != nil && *s.SampleRate < 1 {
+		return fmt.Errorf("invalid sample rate %d", *s.SampleRate)
+	}
+	var ages [3]*time.Duration
+	for i, age := range []*string{s.FlushNew, s.FlushHandshake,
+		s.FlushDone} {
+		if age == nil {
+			continue
+		}
+		d, err := time.ParseDuration(*age)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid flush age %q", *age)
+		}
+		ages[i] = &d
+	}
+	if s.Filter != nil {
+		err := setCaptureFilter(*s.Filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	// set new settings
+	if s.ShowReserved != nil {
+		*showReserved = *s.ShowReserved
+	}
+	if s.ShowDumps != nil {
+		*showDumps = *s.ShowDumps
+	}
+	if s.ShowTimestamps != nil {
+		*showTimestamps = *s.ShowTimestamps
+	}
+	if s.TimestampFormat != nil {
+		*timestampFormat = *s.TimestampFormat
+	}
+	if s.Filter != nil {
+		*pcapFilter = *s.Filter
+	}
+	if s.SampleRate != nil {
+		*pcapSampleRate = *s.SampleRate
+	}
+	for i, age := range []*time.Duration{flushNew, flushHandshake,
+		flushDone} {
+		if ages[i] != nil {
+			*age = *ages[i]
+		}
+	}
+	if s.Paused != nil {
+		outputPaused = *s.Paused
+	}
+	return nil
+}
+
+// setCaptureFilter sets the capture filter of the packet filter on the
+// current pcap listeners and the current AF_XDP capture. The capture filter
+// depends on the link type of each of them and is compiled for all of them
+// first, so an invalid filter does not change any of them
+func setCaptureFilter(filter string) error {
+	for _, l := range currentListeners {
+		if l.PcapHandle == nil {
+			continue
+		}
+		f := captureFilter(filter, l.PcapHandle.LinkType())
+		if _, err := l.PcapHandle.CompileBPFFilter(f); err != nil {
+			return err
+		}
+	}
+	xdpFilter := captureFilter(filter, layers.LinkTypeEthernet)
+	if currentXDP != nil && xdpFilter != "" {
+		_, err := gopcap.NewBPF(layers.LinkTypeEthernet, *pcapSnaplen,
+			xdpFilter)
+		if err != nil {
+			return err
+		}
+	}
+
+	// set filter, restore the old filter if setting it fails anyway
+	for i, l := range currentListeners {
+		if l.PcapHandle == nil {
+			continue
+		}
+		f := captureFilter(filter, l.PcapHandle.LinkType())
+		if err := l.PcapHandle.SetBPFFilter(f); err != nil {
+			for _, l := range currentListeners[:i] {
+				if l.PcapHandle == nil {
+					continue
+				}
+				old := captureFilter(*pcapFilter,
+					l.PcapHandle.LinkType())
+				l.PcapHandle.SetBPFFilter(old)
+			}
+			return err
+		}
+	}
+	if currentXDP != nil {
+		return currentXDP.setFilter(xdpFilter)
+	}
+	return nil
+}
+
+// textOutputPaused checks if the text output is paused
+func textOutputPaused() bool {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	return outputPaused
+}
+
+// setListeners sets the currently active pcap listeners, no listeners
+// remove them
+func setListeners(listeners ...*pcap.Listener) {
+	settingsLock.Lock()
+	currentListeners = listeners
+	settingsLock.Unlock()
+}
+
+// setXDPCapture sets the currently active AF_XDP capture, nil removes it
+func setXDPCapture(c *xdpCapture) {
+	settingsLock.Lock()
+	currentXDP = c
+	settingsLock.Unlock()
+}
+
+// stopListener stops the current pcap listeners, if any, by closing their
+// pcap handles and the current AF_XDP capture, if any
+func stopListener() {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	for _, l := range currentListeners {
+		if l.PcapHandle != nil {
+			l.PcapHandle.Close()
+		}
+	}
+	if currentXDP != nil {
+		currentXDP.stop()
+	}
+}
+
+// captureSource returns the network interfaces or the pcap file of the
+// current pcap listeners, multiple interfaces are comma-separated
+func captureSource() string {
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+
+	switch {
+	case demoMode:
+		return "demo"
+	case currentXDP != nil:
+		return strings.Join(currentXDP.devices, ",")
+	case len(currentListeners) == 0:
+		return "unknown"
+	case currentListeners[0].File != "":
+		return currentListeners[0].File
+	}
+	devices := make([]string, 0, len(currentListeners))
+	for _, l := range currentListeners {
+		devices = append(devices, l.Device)
+	}
+	return strings.Join(devices, ",")
+}
+
+// sampled checks if the connection identified by the network flow net and
+// the transport flow trans is sampled with the current sample rate
+func sampled(net, trans gopacket.Flow) bool {
+	settingsLock.RLock()
+	rate := *pcapSampleRate
+	settingsLock.RUnlock()
+
+	if rate <= 1 {
+		return true
+	}
+
+	// flow hashes are symmetric, so both directions of a connection are
+	// either sampled or not
+	return (net.FastHash()^trans.FastHash())%uint64(rate) == 0
+}
+
+// handleSettings handles http requests for the runtime settings
+func handleSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var s apiSettings
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := setSettings(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed",
+			http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(getSettings()); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// registerSettingsAPI registers the runtime settings http api
+func registerSettingsAPI() {
+	httpControlMux.HandleFunc("/api/v1/settings", handleSettings)
+}
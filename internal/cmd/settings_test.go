@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleSettings(t *testing.T) {
+	var want, got string
+
+	// set default settings
+	*showReserved = false
+	*showDumps = false
+	*showTimestamps = true
+	*timestampFormat = "15:04:05.000000"
+	*pcapFilter = ""
+	*pcapSampleRate = 1
+
+	// test getting settings
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/settings", nil)
+	w := httptest.NewRecorder()
+	handleSettings(w, r)
+	want = `{"show_reserved":false,"show_dumps":false,` +
+		`"show_timestamps":true,"timestamp_format":"15:04:05.000000",` +
+		`"filter":"","sample_rate":1,"flush_new":"10s",` +
+		`"flush_handshake":"1m0s","flush_done":"0s","paused":false}` +
+		"\n"
+	got = w.Body.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test changing settings
+	r = httptest.NewRequest(http.MethodPut, "/api/v1/settings",
+		strings.NewReader(`{"show_dumps":true,"sample_rate":4,`+
+			`"flush_done":"5s","paused":true}`))
+	w = httptest.NewRecorder()
+	handleSettings(w, r)
+	want = `{"show_reserved":false,"show_dumps":true,` +
+		`"show_timestamps":true,"timestamp_format":"15:04:05.000000",` +
+		`"filter":"","sample_rate":4,"flush_new":"10s",` +
+		`"flush_handshake":"1m0s","flush_done":"5s","paused":true}` +
+		"\n"
+	got = w.Body.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test paused text output
+	if !textOutputPaused() || (textSink{}).accepts(eventError) {
+		t.Error("text output not paused")
+	}
+
+	// test invalid settings
+	r = httptest.NewRequest(http.MethodPut, "/api/v1/settings",
+		strings.NewReader(`{"sample_rate":0}`))
+	w = httptest.NewRecorder()
+	handleSettings(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	r = httptest.NewRequest(http.MethodPut, "/api/v1/settings",
+		strings.NewReader(`{"flush_new":"-1s"}`))
+	w = httptest.NewRecorder()
+	handleSettings(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// test invalid method
+	r = httptest.NewRequest(http.MethodPost, "/api/v1/settings", nil)
+	w = httptest.NewRecorder()
+	handleSettings(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got = %d; want %d", w.Code,
+			http.StatusMethodNotAllowed)
+	}
+
+	// restore default settings
+	*showDumps = false
+	*pcapSampleRate = 1
+	*flushDone = 0
+	outputPaused = false
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// smartSamples stores the smart sampling table
+	smartSamples smartSampleTable
+)
+
+// smartSampleKey identifies a connection by the network and transport flows
+// of its first CLC message
+type smartSampleKey struct {
+	net, trans gopacket.Flow
+}
+
+// smartSampleEntry stores the buffered output of a handshake and if the
+// handshake is anomalous
+type smartSampleEntry struct {
+	output    bytes.Buffer
+	anomalous bool
+}
+
+// smartSampleTable stores the buffered output of handshakes until their
+// outcome is known protected by a mutex
+type smartSampleTable struct {
+	lock      sync.Mutex
+	smap      map[smartSampleKey]*smartSampleEntry
+	succeeded uint64
+}
+
+// init initializes the smart sampling table
+func (st *smartSampleTable) init() {
+	st.lock.Lock()
+	if st.smap == nil {
+		st.smap = make(map[smartSampleKey]*smartSampleEntry)
+	}
+	st.lock.Unlock()
+}
+
+// lookup returns the key and entry identified by the network flow net and
+// the transport flow trans in either direction, st must be locked
+func (st *smartSampleTable) lookup(net, trans gopacket.Flow) (smartSampleKey,
+	*smartSampleEntry) {
+	key := smartSampleKey{net, trans}
+	if e := st.smap[key]; e != nil {
+		return key, e
+	}
+	key = smartSampleKey{net.Reverse(), trans.Reverse()}
+	return key, st.smap[key]
+}
+
+// add buffers the CLC message msg of the handshake session with parse
+// warnings sent over the network flow net and the transport flow trans
+// including its hex dump, invalid messages and messages with parse warnings
+// mark the handshake as anomalous
+func (st *smartSampleTable) add(net, trans gopacket.Flow, msg clc.Message,
+	session uint64, warnings parseWarnings) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if st.smap == nil {
+		return
+	}
+	key, e := st.lookup(net, trans)
+	if e == nil {
+		key = smartSampleKey{net, trans}
+		e = &smartSampleEntry{}
+		st.smap[key] = e
+	}
+	writeCLC(&e.output, net, trans, msg, session, warnings, true)
+	if _, ok := msg.(*invalidMessage); ok || len(warnings) > 0 {
+		e.anomalous = true
+	}
+}
+
+// markAnomalous marks the handshake identified by the network flow net and
+// the transport flow trans as anomalous
+func (st *smartSampleTable) markAnomalous(net, trans gopacket.Flow) {
+	st.lock.Lock()
+	if _, e := st.lookup(net, trans); e != nil {
+		e.anomalous = true
+	}
+	st.lock.Unlock()
+}
+
+// finish removes the handshake identified by the network flow net and the
+// transport flow trans with result r from the smart sampling table. It
+// returns the buffered output if the handshake is sampled, i.e., it is
+// declined, anomalous, or 1 of rate successful handshakes
+func (st *smartSampleTable) finish(net, trans gopacket.Flow,
+	r *handshakeResult, rate int) string {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	key, e := st.lookup(net, trans)
+	if e == nil {
+		return ""
+	}
+	delete(st.smap, key)
+	if !r.confirmed || e.anomalous {
+		return e.output.String()
+	}
+	st.succeeded++
+	if rate > 1 && (st.succeeded-1)%uint64(rate) != 0 {
+		return ""
+	}
+	return e.output.String()
+}
+
+// del removes the incomplete handshake identified by the network flow net
+// and the transport flow trans from the smart sampling table and returns its
+// buffered output
+func (st *smartSampleTable) del(net, trans gopacket.Flow) string {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	key, e := st.lookup(net, trans)
+	if e == nil {
+		return ""
+	}
+	delete(st.smap, key)
+	return e.output.String()
+}
+
+// printSmartSample prints the buffered output of a sampled handshake, if
+// any
+func printSmartSample(output string) {
+	if output == "" {
+		return
+	}
+	fmt.Fprint(stdout, output)
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestSmartSampleTable(t *testing.T) {
+	var st smartSampleTable
+
+	// initialize smart sampling table, test flows, and messages
+	st.init()
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	rnet, rtrans := net.Reverse(), trans.Reverse()
+	proposal := testHandshakeMessage("e2d4c3d901003410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef00007f00000008000000" +
+		"e2d4c3d9")
+	confirmed := &handshakeResult{confirmed: true}
+	declined := &handshakeResult{}
+
+	// test successful handshakes, only 1 of 2 is sampled
+	var got []bool
+	for i := 0; i < 4; i++ {
+		st.add(net, trans, proposal, 0, nil)
+		got = append(got, st.finish(rnet, rtrans, confirmed, 2) != "")
+	}
+	want := []bool{true, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got = %v; want %v", got, want)
+			break
+		}
+	}
+
+	// test declined and anomalous handshakes are always sampled
+	st.add(net, trans, proposal, 0, nil)
+	if out := st.finish(rnet, rtrans, declined, 2); out == "" {
+		t.Errorf("got = %q; want output", out)
+	}
+	for i := 0; i < 2; i++ {
+		st.add(net, trans, proposal, 0, nil)
+		st.markAnomalous(rnet, rtrans)
+		if out := st.finish(net, trans, confirmed, 2); out == "" {
+			t.Errorf("got = %q; want output", out)
+		}
+	}
+
+	// test incomplete handshake contains hex dump
+	st.add(net, trans, proposal, 0, nil)
+	out := st.del(rnet, rtrans)
+	wantOut := "1.2.3.4:123 -> 5.6.7.8:456: Proposal"
+	if !strings.Contains(out, wantOut) ||
+		!strings.Contains(out, "00000000  e2 d4 c3 d9") {
+		t.Errorf("got = %s; want %s with hex dump", out, wantOut)
+	}
+	if len(st.smap) != 0 {
+		t.Errorf("len(st.smap) = %d; want 0", len(st.smap))
+	}
+}
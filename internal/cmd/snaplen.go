@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gopacket/gopacket"
+)
+
+const (
+	// snaplenMax is the maximum snaplen the snaplen is raised to
+	snaplenMax = 262144
+)
+
+var (
+	// truncations stores the monitored flows with truncated packets
+	truncations truncationTable
+
+	// snaplenRaised indicates that the snaplen was raised and the live
+	// capture must be restarted
+	snaplenRaised atomic.Bool
+)
+
+// truncationTable stores the monitored flows that were warned about
+// truncated packets protected by a mutex
+type truncationTable struct {
+	lock   sync.Mutex
+	warned map[flowTableKey]bool
+}
+
+// add adds a truncated packet of the monitored flow identified by the
+// network flow net and the transport flow trans and returns whether it is
+// the first since the last reset
+func (tt *truncationTable) add(net, trans gopacket.Flow) bool {
+	tt.lock.Lock()
+	defer tt.lock.Unlock()
+
+	if tt.warned == nil {
+		tt.warned = make(map[flowTableKey]bool)
+	}
+	key := flowTableKey{net, trans}
+	if tt.warned[key] {
+		return false
+	}
+	tt.warned[key] = true
+	return true
+}
+
+// reset forgets all flows, so they are warned again about truncated packets
+func (tt *truncationTable) reset() {
+	tt.lock.Lock()
+	tt.warned = nil
+	tt.lock.Unlock()
+}
+
+// liveCapture checks if packets are captured with libpcap on network
+// interfaces, so the capture can be restarted with a different snaplen
+func liveCapture() bool {
+	return !demoMode && !selftestMode && !replayMode &&
+		len(*pcapFiles) == 0 && *pcapDir == "" && *pcapFD < 0 &&
+		*pcapUnix == "" && *remoteHost == "" && !*captureXDP
+}
+
+// nextSnaplen returns the snaplen raised from snaplen to fit packets with
+// length bytes, limited to snaplenMax
+func nextSnaplen(snaplen, length int) int {
+	for snaplen < length && snaplen < snaplenMax {
+		snaplen *= 2
+	}
+	return min(snaplen, snaplenMax)
+}
+
+// raiseSnaplen raises the snaplen of the live capture to fit the packet with
+// capture info ci and stops the capture, so it is restarted with the new
+// snaplen. It returns the new snaplen or 0 if it was not raised
+func raiseSnaplen(ci gopacket.CaptureInfo) int {
+	// packets captured with a smaller snaplen before the restart do not
+	// raise it again
+	if !*snaplenAuto || !liveCapture() || *pcapSnaplen <= 0 ||
+		ci.CaptureLength < *pcapSnaplen {
+		return 0
+	}
+	snaplen := nextSnaplen(*pcapSnaplen, ci.Length)
+	if snaplen == *pcapSnaplen {
+		return 0
+	}
+	*pcapSnaplen = snaplen
+	snaplenRaised.Store(true)
+	stopListener()
+	return snaplen
+}
+
+// checkTruncation checks if the packet of the monitored flow identified by
+// the network flow net and the transport flow trans is truncated, warns about
+// possibly incomplete CLC messages, and raises the snaplen if enabled
+func checkTruncation(net, trans gopacket.Flow, packet gopacket.Packet) {
+	ci := packet.Metadata().CaptureInfo
+	if ci.CaptureLength >= ci.Length {
+		return
+	}
+	snaplen := raiseSnaplen(ci)
+	if snaplen > 0 {
+		log.Printf("Raising snaplen to %d bytes and restarting "+
+			"capture\n", snaplen)
+	}
+	if !truncations.add(net, trans) {
+		return
+	}
+	emit(&event{typ: eventError, reason: errorSnaplen, net: net,
+		trans: trans, text: fmt.Sprintf("packet truncated to %d of "+
+			"%d bytes, CLC messages may be incomplete; increase "+
+			"the snaplen, e.g., with -pcap-snaplen or "+
+			"-pcap-snaplen-auto", ci.CaptureLength, ci.Length)})
+}
+
+// printSnaplenWarning prints the warning about a truncated packet of the
+// monitored flow identified by the network flow net and the transport flow
+// trans
+func printSnaplenWarning(net, trans gopacket.Flow, warning string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%s%s -> %s: Snaplen Warning: %s\n", t,
+		hostString(net.Src(), trans.Src()),
+		hostString(net.Dst(), trans.Dst()), warning)
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestNextSnaplen(t *testing.T) {
+	for _, test := range []struct {
+		snaplen, length, want int
+	}{
+		{2048, 3000, 4096},
+		{2048, 9000, 16384},
+		{100, 100, 100},
+		{131072, 300000, snaplenMax},
+		{snaplenMax, 300000, snaplenMax},
+	} {
+		got := nextSnaplen(test.snaplen, test.length)
+		if got != test.want {
+			t.Errorf("%d, %d: got %d; want %d", test.snaplen,
+				test.length, got, test.want)
+		}
+	}
+}
+
+func TestRaiseSnaplen(t *testing.T) {
+	defer func(a bool, s int, f pcapFileList, d, x bool) {
+		*snaplenAuto, *pcapSnaplen = a, s
+		*pcapFiles, demoMode, *captureXDP = f, d, x
+		snaplenRaised.Store(false)
+	}(*snaplenAuto, *pcapSnaplen, *pcapFiles, demoMode, *captureXDP)
+	*pcapFiles, demoMode, *captureXDP = nil, false, false
+	if !liveCapture() {
+		t.Fatal("test requires live capture settings")
+	}
+
+	// disabled
+	*snaplenAuto = false
+	*pcapSnaplen = 2048
+	ci := gopacket.CaptureInfo{CaptureLength: 2048, Length: 3000}
+	if got := raiseSnaplen(ci); got != 0 || *pcapSnaplen != 2048 {
+		t.Errorf("got %d, %d; want 0, 2048", got, *pcapSnaplen)
+	}
+
+	// enabled
+	*snaplenAuto = true
+	if got := raiseSnaplen(ci); got != 4096 || *pcapSnaplen != 4096 ||
+		!snaplenRaised.Load() {
+		t.Errorf("got %d, %d; want 4096, 4096", got, *pcapSnaplen)
+	}
+
+	// packet captured before the restart
+	if got := raiseSnaplen(ci); got != 0 || *pcapSnaplen != 4096 {
+		t.Errorf("got %d, %d; want 0, 4096", got, *pcapSnaplen)
+	}
+}
+
+func TestCheckTruncation(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(o io.Writer, ts bool) {
+		stdout, *showTimestamps = o, ts
+		truncations.reset()
+	}(stdout, *showTimestamps)
+	stdout = &buf
+	*showTimestamps = false
+
+	net := layers.NewIPEndpoint([]byte{127, 0, 0, 1})
+	nflow, _ := gopacket.FlowFromEndpoints(net, net)
+	tflow, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(1),
+		layers.NewTCPPortEndpoint(2))
+
+	packet := gopacket.NewPacket(nil, layers.LayerTypeEthernet,
+		gopacket.Default)
+	packet.Metadata().CaptureLength = 100
+	packet.Metadata().Length = 200
+
+	// warn only once per flow
+	checkTruncation(nflow, tflow, packet)
+	checkTruncation(nflow, tflow, packet)
+	want := "127.0.0.1:1 -> 127.0.0.1:2: Snaplen Warning: packet " +
+		"truncated to 100 of 200 bytes"
+	if got := buf.String(); strings.Count(got, want) != 1 {
+		t.Errorf("got %q; want one %q", got, want)
+	}
+
+	// warn again after reset
+	truncations.reset()
+	checkTruncation(nflow, tflow, packet)
+	if got := buf.String(); strings.Count(got, want) != 2 {
+		t.Errorf("got %q; want two %q", got, want)
+	}
+
+	// complete packets
+	buf.Reset()
+	packet.Metadata().CaptureLength = 200
+	checkTruncation(nflow, tflow, packet)
+	if buf.Len() != 0 {
+		t.Errorf("got %q; want no warning", buf.String())
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+var (
+	// liveStreams stores the smc streams known to the tcp assembler
+	liveStreams streamTable
+)
+
+// streamTable stores the running smc streams and the number of created and
+// completed streams protected by a mutex
+type streamTable struct {
+	lock      sync.Mutex
+	smap      map[*smcStream]bool
+	created   uint64
+	completed uint64
+}
+
+// add adds the new smc stream s to the stream table
+func (st *streamTable) add(s *smcStream) {
+	st.lock.Lock()
+	if st.smap == nil {
+		st.smap = make(map[*smcStream]bool)
+	}
+	st.smap[s] = true
+	st.created++
+	st.lock.Unlock()
+}
+
+// complete counts the smc stream s as completed by the tcp assembler
+func (st *streamTable) complete(s *smcStream) {
+	st.lock.Lock()
+	st.completed++
+	st.lock.Unlock()
+}
+
+// del removes the smc stream s from the stream table after its parser
+// finished
+func (st *streamTable) del(s *smcStream) {
+	st.lock.Lock()
+	delete(st.smap, s)
+	st.lock.Unlock()
+}
+
+// list returns the running smc streams and the number of created and
+// completed streams
+func (st *streamTable) list() ([]*smcStream, uint64, uint64) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	streams := make([]*smcStream, 0, len(st.smap))
+	for s := range st.smap {
+		streams = append(streams, s)
+	}
+	return streams, st.created, st.completed
+}
+
+// stateStream is the state of a smc stream in the debug state
+type stateStream struct {
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	Received int64  `json:"received"`
+	Parsed   int64  `json:"parsed"`
+	Messages uint64 `json:"messages"`
+}
+
+// stateAssembler is the state of the tcp assembler in the debug state
+type stateAssembler struct {
+	Created   uint64 `json:"created"`
+	Completed uint64 `json:"completed"`
+	Active    uint64 `json:"active"`
+}
+
+// debugState is the internal state of flow table, smc streams, and tcp
+// assembler for debugging
+type debugState struct {
+	Flows     []string       `json:"flows"`
+	Streams   []stateStream  `json:"streams"`
+	Assembler stateAssembler `json:"assembler"`
+}
+
+// getState returns the current debug state
+func getState() *debugState {
+	state := &debugState{
+		Flows:   flows.list(),
+		Streams: []stateStream{},
+	}
+	streams, created, completed := liveStreams.list()
+	for _, s := range streams {
+		received, parsed, messages := s.positions()
+		state.Streams = append(state.Streams, stateStream{
+			Src: fmt.Sprintf("%s:%s", s.net.Src(),
+				s.transport.Src()),
+			Dst: fmt.Sprintf("%s:%s", s.net.Dst(),
+				s.transport.Dst()),
+			Received: received,
+			Parsed:   parsed,
+			Messages: messages,
+		})
+	}
+	sort.Slice(state.Streams, func(i, j int) bool {
+		a, b := state.Streams[i], state.Streams[j]
+		if a.Src != b.Src {
+			return a.Src < b.Src
+		}
+		return a.Dst < b.Dst
+	})
+	state.Assembler = stateAssembler{
+		Created:   created,
+		Completed: completed,
+		Active:    created - completed,
+	}
+	return state
+}
+
+// writeState writes the current debug state as JSON to w
+func writeState(w io.Writer) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(getState()); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// handleState handles http requests for the debug state
+func handleState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeState(w)
+}
+
+// registerStateAPI registers the debug state http api
+func registerStateAPI() {
+	httpControlMux.HandleFunc("/debug/state", handleState)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestWriteState(t *testing.T) {
+	// prepare flow table and stream
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	flows.init()
+	flows.add(net, trans)
+	defer flows.del(net, trans)
+	s := &smcStream{net: net, transport: trans, received: 100}
+	s.setParsed(52)
+	liveStreams.add(s)
+	liveStreams.complete(s)
+	defer liveStreams.del(s)
+
+	// test state
+	var buf bytes.Buffer
+	writeState(&buf)
+	var got debugState
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		log.Fatal(err)
+	}
+	want := []string{"1.2.3.4:123 -> 5.6.7.8:456"}
+	if !reflect.DeepEqual(got.Flows, want) {
+		t.Errorf("got = %v; want %v", got.Flows, want)
+	}
+	wantStream := stateStream{
+		Src:      "1.2.3.4:123",
+		Dst:      "5.6.7.8:456",
+		Received: 100,
+		Parsed:   52,
+		Messages: 1,
+	}
+	if len(got.Streams) != 1 || got.Streams[0] != wantStream {
+		t.Errorf("got = %v; want %v", got.Streams, wantStream)
+	}
+	if got.Assembler.Active != got.Assembler.Created-
+		got.Assembler.Completed {
+		t.Errorf("got = %v; want consistent counts", got.Assembler)
+	}
+}
@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// stats stores the handshake statistics
+	stats handshakeStats
+)
+
+// negotiatedKey identifies completed handshakes by capture interface, peers,
+// and negotiated SMC path, version, and release
+type negotiatedKey struct {
+	iface          string
+	client, server string
+	path           string
+	version        uint8
+	release        int
+}
+
+// String converts the negotiated key to a string
+func (k negotiatedKey) String() string {
+	s := fmt.Sprintf("%s: %s -> %s: %s v%d", k.iface, k.client,
+		k.server, k.path, k.version)
+	if k.version >= 2 && k.release >= 0 {
+		s += fmt.Sprintf(" release %d", k.release)
+	}
+	return s
+}
+
+// handshakeStats stores the number of attempted, succeeded, declined, and
+// fallen back handshakes and of completed handshakes with first contact and
+// with link group reuse protected by a mutex
+type handshakeStats struct {
+	lock          sync.Mutex
+	attempted     uint64
+	succeeded     uint64
+	declined      uint64
+	fallbacks     uint64
+	firstContacts uint64
+	reuses        uint64
+	negotiated    map[negotiatedKey]uint64
+}
+
+// addAttempt adds a handshake attempt, i.e., a SYN with SMC option, to the
+// handshake statistics
+func (hs *handshakeStats) addAttempt() {
+	hs.lock.Lock()
+	hs.attempted++
+	hs.lock.Unlock()
+}
+
+// addMessage adds the CLC message msg to the handshake statistics if it
+// finishes a handshake, i.e., it is a confirm or decline message
+func (hs *handshakeStats) addMessage(msg clc.Message) {
+	hdr := messageHeader(msg)
+	if hdr == nil {
+		return
+	}
+
+	hs.lock.Lock()
+	switch hdr.Type {
+	case clc.TypeConfirm:
+		hs.succeeded++
+	case clc.TypeDecline:
+		hs.declined++
+	}
+	hs.lock.Unlock()
+}
+
+// addFallback adds a handshake that fell back to tcp to the handshake
+// statistics
+func (hs *handshakeStats) addFallback() {
+	hs.lock.Lock()
+	hs.fallbacks++
+	hs.lock.Unlock()
+}
+
+// addNegotiated adds the completed handshake r captured on interface iface to
+// the negotiated SMC paths and, depending on the first contact flag of its
+// accept message, to the first contacts or link group reuses in the handshake
+// statistics
+func (hs *handshakeStats) addNegotiated(iface string, r *handshakeResult) {
+	key := negotiatedKey{
+		iface:   iface,
+		client:  r.key.net.Src().String(),
+		server:  r.key.net.Dst().String(),
+		path:    r.path.String(),
+		version: r.version,
+		release: r.release,
+	}
+
+	hs.lock.Lock()
+	if hs.negotiated == nil {
+		hs.negotiated = make(map[negotiatedKey]uint64)
+	}
+	hs.negotiated[key]++
+	if r.firstContact != 0 {
+		hs.firstContacts++
+	} else {
+		hs.reuses++
+	}
+	hs.lock.Unlock()
+}
+
+// negotiatedCounts returns the sorted keys and the numbers of completed
+// handshakes by negotiated SMC path
+func (hs *handshakeStats) negotiatedCounts() ([]negotiatedKey,
+	map[negotiatedKey]uint64) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+
+	keys := make([]negotiatedKey, 0, len(hs.negotiated))
+	counts := make(map[negotiatedKey]uint64, len(hs.negotiated))
+	for k, n := range hs.negotiated {
+		keys = append(keys, k)
+		counts[k] = n
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys, counts
+}
+
+// counts returns the number of attempted, succeeded, declined, and fallen
+// back handshakes
+func (hs *handshakeStats) counts() (attempted, succeeded, declined,
+	fallbacks uint64) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+	return hs.attempted, hs.succeeded, hs.declined, hs.fallbacks
+}
+
+// linkGroups returns the number of completed handshakes with first contact,
+// i.e., a new link group, and with reuse of an existing link group
+func (hs *handshakeStats) linkGroups() (firstContacts, reuses uint64) {
+	hs.lock.Lock()
+	defer hs.lock.Unlock()
+	return hs.firstContacts, hs.reuses
+}
+
+// linkGroupString converts the numbers of completed handshakes with first
+// contact and with link group reuse to a string
+func (hs *handshakeStats) linkGroupString() string {
+	firstContacts, reuses := hs.linkGroups()
+	completed := firstContacts + reuses
+	return fmt.Sprintf("%d first contact (%.1f%%), %d link group reuse "+
+		"(%.1f%%)", firstContacts, 100*ratio(firstContacts, completed),
+		reuses, 100*ratio(reuses, completed))
+}
+
+// ratio returns the ratio of n to the number of attempted handshakes or 0 if
+// there are no attempted handshakes
+func ratio(n, attempted uint64) float64 {
+	if attempted == 0 {
+		return 0
+	}
+	return float64(n) / float64(attempted)
+}
+
+// String converts the handshake statistics to a string
+func (hs *handshakeStats) String() string {
+	return countsString(hs.counts())
+}
+
+// countsString converts the numbers of attempted, succeeded, declined, and
+// fallen back handshakes to a string
+func countsString(attempted, succeeded, declined, fallbacks uint64) string {
+	return fmt.Sprintf("%d attempted, %d succeeded (%.1f%%), "+
+		"%d declined (%.1f%%), %d fell back (%.1f%%)", attempted,
+		succeeded, 100*ratio(succeeded, attempted),
+		declined, 100*ratio(declined, attempted),
+		fallbacks, 100*ratio(fallbacks, attempted))
+}
+
+// writeMetrics writes the handshake statistics in prometheus text format to
+// w
+func (hs *handshakeStats) writeMetrics(w io.Writer) {
+	attempted, succeeded, declined, fallbacks := hs.counts()
+	fmt.Fprintln(w, "# HELP smc_clc_handshakes_total Number of "+
+		"handshakes by result.")
+	fmt.Fprintln(w, "# TYPE smc_clc_handshakes_total counter")
+	fmt.Fprintf(w, "smc_clc_handshakes_total{result=\"attempted\"} %d\n",
+		attempted)
+	fmt.Fprintf(w, "smc_clc_handshakes_total{result=\"succeeded\"} %d\n",
+		succeeded)
+	fmt.Fprintf(w, "smc_clc_handshakes_total{result=\"declined\"} %d\n",
+		declined)
+	fmt.Fprintf(w, "smc_clc_handshakes_total{result=\"fallback\"} %d\n",
+		fallbacks)
+	fmt.Fprintln(w, "# HELP smc_clc_handshake_ratio Ratio of "+
+		"handshakes by result to attempted handshakes.")
+	fmt.Fprintln(w, "# TYPE smc_clc_handshake_ratio gauge")
+	fmt.Fprintf(w, "smc_clc_handshake_ratio{result=\"succeeded\"} %g\n",
+		ratio(succeeded, attempted))
+	fmt.Fprintf(w, "smc_clc_handshake_ratio{result=\"declined\"} %g\n",
+		ratio(declined, attempted))
+	fmt.Fprintf(w, "smc_clc_handshake_ratio{result=\"fallback\"} %g\n",
+		ratio(fallbacks, attempted))
+
+	firstContacts, reuses := hs.linkGroups()
+	fmt.Fprintln(w, "# HELP smc_clc_link_groups_total Number of completed "+
+		"handshakes by link group setup.")
+	fmt.Fprintln(w, "# TYPE smc_clc_link_groups_total counter")
+	fmt.Fprintf(w, "smc_clc_link_groups_total{setup=\"first_contact\"} "+
+		"%d\n", firstContacts)
+	fmt.Fprintf(w, "smc_clc_link_groups_total{setup=\"reuse\"} %d\n",
+		reuses)
+
+	// aggregate negotiated SMC paths over peers
+	type metricKey struct {
+		iface, path      string
+		version, release int
+	}
+	keys, counts := hs.negotiatedCounts()
+	var mkeys []metricKey
+	mcounts := make(map[metricKey]uint64)
+	for _, k := range keys {
+		mk := metricKey{k.iface, k.path, int(k.version), k.release}
+		if _, ok := mcounts[mk]; !ok {
+			mkeys = append(mkeys, mk)
+		}
+		mcounts[mk] += counts[k]
+	}
+	fmt.Fprintln(w, "# HELP smc_clc_negotiated_total Number of completed "+
+		"handshakes by negotiated SMC path.")
+	fmt.Fprintln(w, "# TYPE smc_clc_negotiated_total counter")
+	for _, mk := range mkeys {
+		release := ""
+		if mk.release >= 0 {
+			release = fmt.Sprint(mk.release)
+		}
+		fmt.Fprintf(w, "smc_clc_negotiated_total{interface=%q,path=%q,"+
+			"version=\"%d\",release=%q} %d\n", mk.iface, mk.path,
+			mk.version, release, mcounts[mk])
+	}
+}
+
+// startStatsInterval prints the handshake statistics and the statistics of
+// the last interval every interval of the clock until the returned function
+// is called
+func startStatsInterval(interval time.Duration) func() {
+	ticker := clock.newTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var last [4]uint64
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			a, s, d, f := stats.counts()
+			now := [4]uint64{a, s, d, f}
+			emit(&event{
+				typ:      eventStats,
+				counts:   now,
+				interval: interval,
+				last: countsString(now[0]-last[0],
+					now[1]-last[1], now[2]-last[2],
+					now[3]-last[3]),
+			})
+			last = now
+		}
+	}()
+	return func() {
+		clock.stopTicker(ticker)
+		close(done)
+		<-stopped
+	}
+}
+
+// printStatsInterval prints the handshake statistics and the statistics
+// of the last interval
+func printStatsInterval(interval time.Duration, last string) {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sHandshake Stats: %s\n", t, &stats)
+	fmt.Fprintf(stdout, "%sHandshake Stats: last %s: %s\n", t, interval,
+		last)
+	printCaptureStats(t)
+}
+
+// printStats prints the handshake statistics
+func printStats() {
+	t := timestamp()
+	fmt.Fprintf(stdout, "%sHandshake Stats: %s\n", t, &stats)
+	fmt.Fprintf(stdout, "%sHandshake Stats: Link Groups: %s\n", t,
+		stats.linkGroupString())
+	keys, counts := stats.negotiatedCounts()
+	for _, k := range keys {
+		fmt.Fprintf(stdout, "%sHandshake Stats: %s: %d\n", t, k,
+			counts[k])
+	}
+	printCaptureStats(t)
+	printVLANStats()
+}
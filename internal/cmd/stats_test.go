@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestHandshakeStats(t *testing.T) {
+	var hs handshakeStats
+
+	// test empty statistics
+	want := "0 attempted, 0 succeeded (0.0%), 0 declined (0.0%), " +
+		"0 fell back (0.0%)"
+	got := hs.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// add 4 attempts: 2 succeeded, 1 declined, 1 fell back
+	for i := 0; i < 4; i++ {
+		hs.addAttempt()
+	}
+	confirm := testHandshakeMessage("e2d4c3d903004410b1a098039babcdef" +
+		"fe800000000000009a039bfffeabcdef" +
+		"98039babcdef0000e50000187f010000" +
+		"0006230000000000f0a40000000d89a4" +
+		"e2d4c3d9")
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	hs.addMessage(confirm)
+	hs.addMessage(confirm)
+	hs.addMessage(decline)
+	hs.addFallback()
+
+	// test statistics
+	want = "4 attempted, 2 succeeded (50.0%), 1 declined (25.0%), " +
+		"1 fell back (25.0%)"
+	got = hs.String()
+	if got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test metrics
+	var buf bytes.Buffer
+	hs.writeMetrics(&buf)
+	for _, want := range []string{
+		"smc_clc_handshakes_total{result=\"attempted\"} 4\n",
+		"smc_clc_handshakes_total{result=\"succeeded\"} 2\n",
+		"smc_clc_handshake_ratio{result=\"succeeded\"} 0.5\n",
+		"smc_clc_handshake_ratio{result=\"fallback\"} 0.25\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got = %s; want %s", buf.String(), want)
+		}
+	}
+}
+
+func TestHandshakeStatsNegotiated(t *testing.T) {
+	var hs handshakeStats
+
+	// add two SMC-R v1 and one SMC-D v2 handshakes
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	key := handshakeKey{net: net}
+	r := &handshakeResult{key: key, path: clc.SMCTypeR, version: 1,
+		release: -1, firstContact: 1}
+	hs.addNegotiated("eth0", r)
+	hs.addNegotiated("eth0", r)
+	hs.addNegotiated("eth0", &handshakeResult{key: key,
+		path: clc.SMCTypeD, version: 2, release: 1})
+
+	// test link groups
+	want := "2 first contact (66.7%), 1 link group reuse (33.3%)"
+	if got := hs.linkGroupString(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// test counts
+	var got []string
+	keys, counts := hs.negotiatedCounts()
+	for _, k := range keys {
+		got = append(got, fmt.Sprintf("%s: %d", k, counts[k]))
+	}
+	wantCounts := []string{
+		"eth0: 1.2.3.4 -> 5.6.7.8: SMC-D v2 release 1: 1",
+		"eth0: 1.2.3.4 -> 5.6.7.8: SMC-R v1: 2",
+	}
+	if !reflect.DeepEqual(got, wantCounts) {
+		t.Errorf("got = %v; want %v", got, wantCounts)
+	}
+
+	// test metrics
+	var buf bytes.Buffer
+	hs.writeMetrics(&buf)
+	for _, want := range []string{
+		"smc_clc_link_groups_total{setup=\"first_contact\"} 2\n",
+		"smc_clc_link_groups_total{setup=\"reuse\"} 1\n",
+		"smc_clc_negotiated_total{interface=\"eth0\",path=\"SMC-R\"," +
+			"version=\"1\",release=\"\"} 2\n",
+		"smc_clc_negotiated_total{interface=\"eth0\",path=\"SMC-D\"," +
+			"version=\"2\",release=\"1\"} 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got = %s; want %s", buf.String(), want)
+		}
+	}
+}
+
+func TestStartStatsInterval(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	// test periodic statistics with wall clock
+	if err := clock.init(false, "max"); err != nil {
+		t.Fatal(err)
+	}
+	stopStats := startStatsInterval(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	stopStats()
+	want := "Handshake Stats: last 1ms: 0 attempted"
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("got = %s; want %s", buf.String(), want)
+	}
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// jsonAPIStats is the response of the statistics http api with the handshake
+// counts, the decline reasons, the negotiated SMC paths, and the peer IDs
+type jsonAPIStats struct {
+	Handshakes jsonAPIStatsHandshakes    `json:"handshakes"`
+	Declines   []*jsonAPIStatsDecline    `json:"declines"`
+	Negotiated []*jsonAPIStatsNegotiated `json:"negotiated"`
+	Peers      []*jsonAPIStatsPeer       `json:"peers"`
+}
+
+// jsonAPIStatsHandshakes are the handshake counts in the statistics http api
+type jsonAPIStatsHandshakes struct {
+	Attempted     uint64  `json:"attempted"`
+	Succeeded     uint64  `json:"succeeded"`
+	Declined      uint64  `json:"declined"`
+	Fallbacks     uint64  `json:"fallbacks"`
+	SuccessRate   float64 `json:"success_rate"`
+	FirstContacts uint64  `json:"first_contacts"`
+	Reuses        uint64  `json:"link_group_reuses"`
+}
+
+// jsonAPIStatsDecline is the number of declines of a decline reason and of its
+// peer pairs in the statistics http api
+type jsonAPIStatsDecline struct {
+	Diagnosis string                     `json:"diagnosis"`
+	Count     uint64                     `json:"count"`
+	Peers     []*jsonAPIStatsDeclinePeer `json:"peers"`
+}
+
+// jsonAPIStatsDeclinePeer is the number of declines of a peer pair, sender is
+// the peer that sent the decline message
+type jsonAPIStatsDeclinePeer struct {
+	Sender   string `json:"sender"`
+	Receiver string `json:"receiver"`
+	Count    uint64 `json:"count"`
+}
+
+// jsonAPIStatsNegotiated is the number of completed handshakes of peers with a
+// negotiated SMC path in the statistics http api
+type jsonAPIStatsNegotiated struct {
+	Interface string `json:"interface"`
+	Client    string `json:"client"`
+	Server    string `json:"server"`
+	Path      string `json:"path"`
+	Version   uint8  `json:"version"`
+	Release   *int   `json:"release,omitempty"`
+	Count     uint64 `json:"count"`
+}
+
+// jsonAPIStatsPeer is a peer ID with its ip addresses and RoCE MACs in the
+// statistics http api
+type jsonAPIStatsPeer struct {
+	PeerID string   `json:"peer_id"`
+	IPs    []string `json:"ips"`
+	MACs   []string `json:"macs,omitempty"`
+}
+
+// apiStats returns the decline reasons ordered by number of declines with
+// their peer pairs
+func (dt *declineTable) apiStats() []*jsonAPIStatsDecline {
+	dt.lock.Lock()
+	defer dt.lock.Unlock()
+
+	codes := make([]clc.PeerDiagnosis, 0, len(dt.codes))
+	for code := range dt.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if dt.codes[codes[i]] != dt.codes[codes[j]] {
+			return dt.codes[codes[i]] > dt.codes[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	keys := make([]declineKey, 0, len(dt.pairs))
+	for key := range dt.pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if dt.pairs[keys[i]] != dt.pairs[keys[j]] {
+			return dt.pairs[keys[i]] > dt.pairs[keys[j]]
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	reasons := []*jsonAPIStatsDecline{}
+	for _, code := range codes {
+		d := &jsonAPIStatsDecline{
+			Diagnosis: code.String(),
+			Count:     dt.codes[code],
+			Peers:     []*jsonAPIStatsDeclinePeer{},
+		}
+		for _, key := range keys {
+			if key.diagnosis != code {
+				continue
+			}
+			d.Peers = append(d.Peers, &jsonAPIStatsDeclinePeer{
+				Sender:   key.sender.String(),
+				Receiver: key.receiver.String(),
+				Count:    dt.pairs[key],
+			})
+		}
+		reasons = append(reasons, d)
+	}
+	return reasons
+}
+
+// apiStats returns the peer IDs ordered by peer ID
+func (pt *peerIDTable) apiStats() []*jsonAPIStatsPeer {
+	pt.lock.Lock()
+	defer pt.lock.Unlock()
+
+	peers := []*jsonAPIStatsPeer{}
+	for id, e := range pt.pmap {
+		ips := make([]gopacket.Endpoint, 0, len(e.ips))
+		for ip := range e.ips {
+			ips = append(ips, ip)
+		}
+		sort.Slice(ips, func(i, j int) bool {
+			return ips[i].LessThan(ips[j])
+		})
+		p := &jsonAPIStatsPeer{
+			PeerID: id.String(),
+			IPs:    make([]string, 0, len(ips)),
+			MACs:   sortedKeys(e.macs),
+		}
+		for _, ip := range ips {
+			p.IPs = append(p.IPs, ip.String())
+		}
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PeerID < peers[j].PeerID
+	})
+	return peers
+}
+
+// getStats returns the current statistics
+func getStats() *jsonAPIStats {
+	s := &jsonAPIStats{
+		Declines:   declines.apiStats(),
+		Negotiated: []*jsonAPIStatsNegotiated{},
+		Peers:      peerIDs.apiStats(),
+	}
+	h := &s.Handshakes
+	h.Attempted, h.Succeeded, h.Declined, h.Fallbacks = stats.counts()
+	h.SuccessRate = ratio(h.Succeeded, h.Attempted)
+	h.FirstContacts, h.Reuses = stats.linkGroups()
+
+	keys, counts := stats.negotiatedCounts()
+	for _, k := range keys {
+		n := &jsonAPIStatsNegotiated{
+			Interface: k.iface,
+			Client:    k.client,
+			Server:    k.server,
+			Path:      k.path,
+			Version:   k.version,
+			Count:     counts[k],
+		}
+		if k.version >= 2 && k.release >= 0 {
+			release := k.release
+			n.Release = &release
+		}
+		s.Negotiated = append(s.Negotiated, n)
+	}
+	return s
+}
+
+// handleStats handles http requests for the statistics
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(getStats()); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// registerStatsAPI registers the statistics http api
+func registerStatsAPI() {
+	http.HandleFunc("/api/v1/stats", handleStats)
+}
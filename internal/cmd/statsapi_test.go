@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+func TestHandleStats(t *testing.T) {
+	// reset statistics
+	stats = handshakeStats{}
+	declines = declineTable{}
+	peerIDs = peerIDTable{}
+	defer func() {
+		stats = handshakeStats{}
+		declines = declineTable{}
+		peerIDs = peerIDTable{}
+	}()
+	declines.init()
+	peerIDs.init()
+
+	// test empty statistics
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil)
+	w := httptest.NewRecorder()
+	handleStats(w, r)
+	want := `{"handshakes":{"attempted":0,"succeeded":0,"declined":0,` +
+		`"fallbacks":0,"success_rate":0,"first_contacts":0,` +
+		`"link_group_reuses":0},"declines":[],"negotiated":[],` +
+		`"peers":[]}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+
+	// add a declined and a completed handshake
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	stats.addAttempt()
+	stats.addAttempt()
+	stats.addMessage(decline)
+	declines.add(net, decline)
+	peerIDs.add(net, decline)
+	stats.addNegotiated("eth0", &handshakeResult{
+		key:          handshakeKey{net, trans},
+		path:         clc.SMCTypeD,
+		version:      2,
+		release:      1,
+		firstContact: 1,
+	})
+
+	// test statistics
+	w = httptest.NewRecorder()
+	handleStats(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q; want application/json", ct)
+	}
+	want = `{"handshakes":{"attempted":2,"succeeded":0,"declined":1,` +
+		`"fallbacks":0,"success_rate":0,"first_contacts":1,` +
+		`"link_group_reuses":0},"declines":[{"diagnosis":` +
+		`"0x3030000 (no SMC device found (R or D))","count":1,` +
+		`"peers":[{"sender":"1.2.3.4","receiver":"5.6.7.8",` +
+		`"count":1}]}],"negotiated":[{"interface":"eth0",` +
+		`"client":"1.2.3.4","server":"5.6.7.8","path":"SMC-D",` +
+		`"version":2,"release":1,"count":1}],"peers":[{"peer_id":` +
+		`"9509@25:25:25:25:25:00","ips":["1.2.3.4"]}]}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
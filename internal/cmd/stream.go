@@ -3,85 +3,298 @@ package cmd
 import (
 	"io"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/gopacket/gopacket"
 	"github.com/gopacket/gopacket/tcpassembly"
 	"github.com/gopacket/gopacket/tcpassembly/tcpreader"
-	"github.com/hwipl/smc-go/pkg/clc"
 )
 
-const (
-	// CLC message buffer size for 2 CLC messages per flow/direction
-	clcMessageBufSize = clc.MaxMessageSize * 2
+var (
+	// streams waits for the running smc stream goroutines
+	streams sync.WaitGroup
 )
 
+// streamChunk stores the end offset and capture timestamp of reassembled
+// stream data
+type streamChunk struct {
+	end  int64
+	seen time.Time
+}
+
 // smcStream is used for decoding smc packets
 type smcStream struct {
 	net, transport gopacket.Flow
 	r              tcpreader.ReaderStream
+
+	// capture timestamps of reassembled stream data, parser position,
+	// number of parsed messages, and number of gaps in reassembled data
+	lock     sync.Mutex
+	chunks   []streamChunk
+	received int64
+	parsed   int64
+	messages uint64
+	gaps     uint64
+}
+
+// seenAt returns the capture timestamp of the stream data at offset and
+// removes timestamps of data before offset
+func (s *smcStream) seenAt(offset int64) time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for len(s.chunks) > 0 {
+		c := s.chunks[0]
+		if c.end >= offset || len(s.chunks) == 1 {
+			return c.seen
+		}
+		s.chunks = s.chunks[1:]
+	}
+	return time.Time{}
+}
+
+// setParsed sets the parser position to offset and counts a parsed message
+func (s *smcStream) setParsed(offset int64) {
+	s.lock.Lock()
+	s.parsed = offset
+	s.messages++
+	s.lock.Unlock()
+}
+
+// positions returns the number of received bytes, the parser position, and
+// the number of parsed messages
+func (s *smcStream) positions() (int64, int64, uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.received, s.parsed, s.messages
+}
+
+// gapCount returns the number of gaps in the reassembled stream data
+func (s *smcStream) gapCount() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.gaps
 }
 
 // run parses the smc stream
 func (s *smcStream) run() {
-	var clcMsg clc.Message
-	var clcLen uint16
-	buf := make([]byte, clcMessageBufSize)
-	// get at least enough bytes for the CLC header
-	skip := clc.HeaderLen
-	eof := false
-	total := 0
-
+	d := newDecoder(&s.r)
+	d.invalid = *showInvalid
+	d.stats = &parsing
+	if *errorCorpusDir != "" {
+		d.errors = &corpus
+	}
 	for {
-		// try to read enough data into buffer and check EOF and errors
-		for total < skip && !eof {
-			n, err := s.r.Read(buf[total:])
-			if err != nil {
-				if err != io.EOF {
-					log.Println("Error reading stream:",
-						err)
-				}
-				eof = true
+		clcMsg, err := d.next()
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF &&
+				err != errInvalidMessage {
+				log.Println("Error reading stream:", err)
 			}
-			total += n
+			break
 		}
+		warnings := d.warnings
+		seen := s.seenAt(d.offset)
+		s.setParsed(d.offset)
+		fallbacks.addCLC(s.net, s.transport)
 
-		// parse and print current CLC message
-		if clcMsg != nil {
-			// parse and print message
-			clcMsg.Parse(buf[skip-int(clcLen) : skip])
-			printCLC(s.net, s.transport, clcMsg)
+		// add decoded message as comment to exported pcapng packets
+		if extractMode || *writeFile != "" {
+			annotatePcapExports(s.net, s.transport, seen, clcMsg,
+				warnings)
+		}
 
-			// wait for next handshake message
-			clcMsg = nil
-			clcLen = 0
-			skip += clc.HeaderLen
-			continue
+		// write message with capture metadata to binary event log
+		if *eventLogFile != "" {
+			eventLogs.add(seen, s.net, s.transport, clcMsg)
+		}
 
+		// remember peer hostname from first contact extension
+		if hostname := peerHostname(clcMsg); hostname != "" {
+			hostnames.add(s.net.Src(), hostname)
 		}
 
-		// if there is not enough data left in buffer, we are done
-		if total < skip {
-			break
+		// re-serialize valid message and report divergence
+		if _, invalid := clcMsg.(*invalidMessage); *checkRoundTrip &&
+			!invalid {
+			if div := roundTrips.check(clcMsg); div != "" {
+				emit(&event{typ: eventError,
+					reason: errorRoundTrip, net: s.net,
+					trans: s.transport, text: div})
+			}
 		}
 
-		// parse header of current CLC message
-		clcMsg, clcLen =
-			clc.NewMessage(buf[skip-clc.HeaderLen:])
-		if clcMsg == nil {
-			break
+		// in research mode, save reserved areas of message
+		if *researchFile != "" {
+			research.add(s.net, s.transport, clcMsg)
+		}
+
+		// apply rules, dropped messages are tracked but not emitted
+		res := rules.apply(s.net, s.transport, clcMsg)
+
+		// check message against previous messages in handshake and
+		// get session ID of handshake
+		checks, result := handshakes.add(s.net, s.transport, clcMsg,
+			seen)
+		session := handshakes.session(s.net, s.transport)
+		if result != nil {
+			session = result.id
+		}
+		pcapDownloads.setSession(s.net, s.transport, session)
+
+		// update flow state for reassembly flush age
+		switch {
+		case result != nil:
+			flowStates.set(s.net, s.transport, flowStateDone,
+				clock.now())
+		case session != 0:
+			flowStates.set(s.net, s.transport, flowStateHandshake,
+				clock.now())
+		}
+
+		// buffer message for smart sampling, emit message event and
+		// rule result unless the message is dropped
+		if !res.drop {
+			if *smartSampleRate > 0 && !*showSummary && textOutput {
+				smartSamples.add(s.net, s.transport, clcMsg,
+					session, warnings)
+			}
+			emit(&event{typ: eventMessage, net: s.net,
+				trans: s.transport, msg: clcMsg,
+				session: session, warnings: warnings})
+			emitRuleResult(s.net, s.transport, res)
+		}
+		report.addMessage(s.net, clcMsg)
+		runTotals.addMessage(clcMsg)
+		declines.add(s.net, clcMsg)
+		peerIDs.add(s.net, clcMsg)
+		inventory.add(s.net, clcMsg)
+		stats.addMessage(clcMsg)
+		vlans.addMessage(s.net, s.transport, clcMsg)
+
+		// learn ExIDs of connection with valid CLC messages
+		if _, invalid := clcMsg.(*invalidMessage); *learnExIDs &&
+			!invalid {
+			for _, exid := range exids.learn(s.net, s.transport) {
+				printLearnedExID(s.net, s.transport, exid)
+			}
 		}
 
-		// skip to end of current message to be able to parse it
-		skip += int(clcLen) - clc.HeaderLen
+		// print handshake inconsistencies, measure handshake latencies,
+		// summarize handshake, and count negotiated SMC paths
+		if *checkHandshakes {
+			for _, c := range checks {
+				emit(&event{typ: eventError, net: s.net,
+					trans: s.transport, reason: errorCheck,
+					text: c})
+			}
+		}
+		if len(checks) > 0 {
+			smartSamples.markAnomalous(s.net, s.transport)
+		}
+		if result == nil {
+			continue
+		}
+		extracts.finish(s.net, s.transport)
+		pcapDownloads.finish(s.net, s.transport)
+		if *smartSampleRate > 0 {
+			printSmartSample(smartSamples.finish(s.net, s.transport,
+				result, *smartSampleRate))
+		}
+		emit(&event{typ: eventHandshake, result: result})
+		if result.confirmed {
+			stats.addNegotiated(captureSource(), result)
+		}
+		if *declineThreshold > 0 &&
+			declineLoops.add(result, *declineThreshold) {
+			emit(declineLoopAlert(result))
+		}
+		if previous, ok := pathSelections.add(result); ok &&
+			*pathSummary {
+			printPathSwitch(result, previous)
+		}
+		if *checkHandshakes {
+			for _, w := range qps.add(result) {
+				emit(&event{typ: eventError,
+					reason: errorCheck, net: result.key.net,
+					trans: result.key.trans, text: w})
+			}
+		}
+		if *checkLinkIDs {
+			for _, w := range smcdLinks.add(result) {
+				emit(&event{typ: eventError,
+					reason: errorLinkID, net: result.key.net,
+					trans: result.key.trans, text: w})
+			}
+		}
+		durations.add(result.total)
+		bufferSizes.add(result)
+		latencies.add(seen, result)
+		report.addHandshake(result)
 	}
 
 	// discard everything
 	tcpreader.DiscardBytesToEOF(&s.r)
+
+	// report handshake with message missing in this stream as one-sided
+	if o, ok := handshakes.oneSided(s.net, s.transport); ok &&
+		*checkHandshakes {
+		emit(&event{typ: eventError, net: o.key.net, trans: o.key.trans,
+			reason: errorCheck, text: o.check(s.gapCount())})
+	}
+
+	// remove entries from handshake, ExID, and fallback tables after all
+	// messages are handled
+	handshakes.del(s.net, s.transport)
+	exids.del(s.net, s.transport)
+
+	// print incomplete handshake buffered for smart sampling
+	if *smartSampleRate > 0 {
+		printSmartSample(smartSamples.del(s.net, s.transport))
+	}
+
+	// report connection without CLC messages as tcp fallback
+	if key, reason, ok := fallbacks.del(s.net, s.transport); ok {
+		stats.addFallback()
+		vlans.addFallback(s.net, s.transport)
+		emit(&event{typ: eventFallback, net: key.net, trans: key.trans,
+			reason: reason})
+	}
+
+	// remove VLAN of this direction after its statistics are counted
+	vlans.del(s.net, s.transport)
+}
+
+// Reassembled is called by the TCP assembler with reassembled stream data,
+// it stores the capture timestamps and passes the data to the reader
+func (s *smcStream) Reassembled(reassembly []tcpassembly.Reassembly) {
+	s.lock.Lock()
+	for _, r := range reassembly {
+		if r.Skip > 0 {
+			quality.addGap()
+		}
+		if r.Skip != 0 {
+			s.gaps++
+		}
+		if len(r.Bytes) == 0 {
+			continue
+		}
+		s.received += int64(len(r.Bytes))
+		s.chunks = append(s.chunks, streamChunk{s.received, r.Seen})
+	}
+	s.lock.Unlock()
+
+	s.r.Reassembled(reassembly)
 }
 
 // ReassemblyComplete is called when the TCP assembler believes the stream has
 // finished
 func (s *smcStream) ReassemblyComplete() {
+	s.r.ReassemblyComplete()
+	liveStreams.complete(s)
+	flowStates.del(s.net, s.transport)
+
 	// remove entry from flow table
 	flows.del(s.net, s.transport)
 }
@@ -98,9 +311,15 @@ func (h *smcStreamFactory) New(
 		transport: transport,
 		r:         tcpreader.NewReaderStream(),
 	}
-	go sstream.run() // parse stream in goroutine
+	// parse stream in goroutine
+	runTotals.addFlow()
+	liveStreams.add(sstream)
+	streams.Add(1)
+	go func() {
+		sstream.run()
+		liveStreams.del(sstream)
+		streams.Done()
+	}()
 
-	// ReaderStream implements tcpassembly.Stream, so we can return a
-	// pointer to it.
-	return &sstream.r
+	return sstream
 }
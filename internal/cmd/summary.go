@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// interrupted indicates if capturing was interrupted with SIGINT or
+	// the shutdown http api
+	interrupted atomic.Bool
+
+	// runTotals stores the totals of the end-of-run summary
+	runTotals runSummary
+)
+
+// runSummary stores the number of handled packets, tracked flows, and CLC
+// messages by type protected by a mutex
+type runSummary struct {
+	lock    sync.Mutex
+	packets uint64
+	flows   uint64
+	types   map[string]uint64
+}
+
+// addPacket adds a handled packet to the run summary
+func (rs *runSummary) addPacket() {
+	rs.lock.Lock()
+	rs.packets++
+	rs.lock.Unlock()
+}
+
+// addFlow adds a tracked flow, i.e., a reassembled tcp stream, to the run
+// summary
+func (rs *runSummary) addFlow() {
+	rs.lock.Lock()
+	rs.flows++
+	rs.lock.Unlock()
+}
+
+// addMessage adds the CLC message msg to the run summary
+func (rs *runSummary) addMessage(msg clc.Message) {
+	typ := "Invalid"
+	if hdr := messageHeader(msg); hdr != nil {
+		typ = hdr.Type.String()
+	}
+
+	rs.lock.Lock()
+	if rs.types == nil {
+		rs.types = make(map[string]uint64)
+	}
+	rs.types[typ]++
+	rs.lock.Unlock()
+}
+
+// runCounts are the numbers of handled packets, tracked flows, and CLC
+// messages of the run
+type runCounts struct {
+	packets  uint64
+	flows    uint64
+	messages uint64
+}
+
+// counts returns the current run totals
+func (rs *runSummary) counts() *runCounts {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	c := &runCounts{packets: rs.packets, flows: rs.flows}
+	for _, n := range rs.types {
+		c.messages += n
+	}
+	return c
+}
+
+// lines returns the run summary with the parse errors, the flow table
+// overflows, the duplicate packets, and the declines by decline reason
+func (rs *runSummary) lines() []string {
+	rs.lock.Lock()
+	lines := []string{
+		fmt.Sprintf("Packets: %d", rs.packets),
+		fmt.Sprintf("Flows: %d", rs.flows),
+		fmt.Sprintf("Messages: %s", messageCounts(rs.types)),
+	}
+	rs.lock.Unlock()
+
+	detected, parsed := parsing.totals()
+	lines = append(lines, fmt.Sprintf("Parse Errors: %d",
+		detected-parsed))
+	if rejected, evicted := flows.overflows(); rejected+evicted > 0 {
+		lines = append(lines, fmt.Sprintf("Flow Table Overflows: "+
+			"%d rejected, %d evicted", rejected, evicted))
+	}
+	if n := dedups.count(); n > 0 {
+		lines = append(lines, fmt.Sprintf("Duplicates: %d", n))
+	}
+	for _, line := range declines.codeSummary() {
+		lines = append(lines, fmt.Sprintf("Declines: %s", line))
+	}
+	return lines
+}
+
+// messageCounts converts the message counts by type in types to a string
+// ordered by message type
+func messageCounts(types map[string]uint64) string {
+	var total uint64
+	var counts []string
+	for _, typ := range []string{"Proposal", "Accept", "Confirm",
+		"Decline", "Invalid"} {
+		if n := types[typ]; n > 0 {
+			total += n
+			counts = append(counts, fmt.Sprintf("%s: %d", typ, n))
+		}
+	}
+	if total == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%d (%s)", total, strings.Join(counts, ", "))
+}
+
+// writeRunSummary writes the end-of-run summary to w
+func writeRunSummary(w io.Writer) {
+	for _, line := range runTotals.lines() {
+		fmt.Fprintf(w, "Summary: %s\n", line)
+	}
+}
+
+// handleInterrupt stops capturing on the first SIGINT, so the program prints
+// its summaries before it exits. A second SIGINT terminates the program
+func handleInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		signal.Stop(c)
+		interruptCapture()
+	}()
+}
+
+// interruptCapture stops capturing, so the program prints its summaries
+// before it exits
+func interruptCapture() {
+	interrupted.Store(true)
+	stopListener()
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestRunSummary(t *testing.T) {
+	var rs runSummary
+
+	// test empty summary
+	want := []string{"Packets: 0", "Flows: 0", "Messages: 0"}
+	got := rs.lines()
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("got = %s; want %s", got[i], w)
+		}
+	}
+
+	// add packets, flows, and messages
+	rs.addPacket()
+	rs.addPacket()
+	rs.addFlow()
+	decline := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	rs.addMessage(decline)
+	rs.addMessage(newInvalidMessage("invalid trailer"))
+	want = []string{"Packets: 2", "Flows: 1",
+		"Messages: 2 (Decline: 1, Invalid: 1)"}
+	got = rs.lines()
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("got = %s; want %s", got[i], w)
+		}
+	}
+}
+
+func TestWriteRunSummary(t *testing.T) {
+	declines = declineTable{}
+	declines.init()
+	defer func() { declines = declineTable{} }()
+
+	// add decline
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	declines.add(net, testHandshakeMessage("e2d4c3d904001c10"+
+		"25252525252525000303000000000000e2d4c3d9"))
+
+	// test summary
+	var buf bytes.Buffer
+	writeRunSummary(&buf)
+	for _, want := range []string{
+		"Summary: Packets: ",
+		"Summary: Parse Errors: ",
+		"Summary: Declines: 0x3030000 (no SMC device found (R or D)): " +
+			"1 declines\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("got = %s; want %s", buf.String(), want)
+		}
+	}
+}
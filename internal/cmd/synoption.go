@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+const (
+	// tcpOptionMD5 is the tcp MD5 signature option
+	tcpOptionMD5 = 19
+
+	// tcpOptionSpace is the maximum length of the tcp options in bytes
+	tcpOptionSpace = 40
+
+	// smcOptionSpace is the length of the aligned SMC option in bytes
+	smcOptionSpace = 8
+)
+
+// tcpOptionsLen returns the length of the tcp options in tcp
+func tcpOptionsLen(tcp *layers.TCP) int {
+	n := 0
+	for _, opt := range tcp.Options {
+		switch opt.OptionType {
+		case layers.TCPOptionKindEndList, layers.TCPOptionKindNop:
+			n++
+		default:
+			n += int(opt.OptionLength)
+		}
+	}
+	return n
+}
+
+// checkSYNOptions checks the tcp options of the SYN or SYN-ACK tcp of a
+// connection with SMC option for combinations known to interfere with the
+// SMC option, smcOption indicates if the SMC option is set in tcp. It
+// returns the warnings found
+func checkSYNOptions(tcp *layers.TCP, smcOption bool) []string {
+	md5, ts := false, false
+	for _, opt := range tcp.Options {
+		switch opt.OptionType {
+		case tcpOptionMD5:
+			md5 = true
+		case layers.TCPOptionKindTimestamps:
+			ts = true
+		}
+	}
+
+	var warnings []string
+	switch {
+	case md5 && ts:
+		warnings = append(warnings, "MD5 signature and timestamp "+
+			"options set, Linux omits timestamps with MD5 "+
+			"signatures, options may be rewritten on the path")
+	case md5:
+		warnings = append(warnings, "MD5 signature option set, it "+
+			"takes 20 bytes of option space and SMC is usually "+
+			"not used with MD5 signatures")
+	}
+
+	// without SMC option, check if there was space left for it
+	if left := tcpOptionSpace - tcpOptionsLen(tcp); !smcOption &&
+		left < smcOptionSpace {
+		warnings = append(warnings, fmt.Sprintf("%d bytes of option "+
+			"space left, SMC option needs %d bytes", left,
+			smcOptionSpace))
+	}
+	return warnings
+}
+
+// emitSYNOptionWarnings emits the warnings about the tcp options in the SYN
+// or SYN-ACK tcp sent over the network flow net and the transport flow trans
+// as error events if enabled, smcOption indicates if the SMC option is set
+// in tcp
+func emitSYNOptionWarnings(net, trans gopacket.Flow, tcp *layers.TCP,
+	smcOption bool) {
+	if !*checkSYNOpts {
+		return
+	}
+	source := errorSYNOption
+	if tcp.ACK {
+		source = errorSYNACKOption
+	}
+	for _, warning := range checkSYNOptions(tcp, smcOption) {
+		emit(&event{typ: eventError, reason: source, net: net,
+			trans: trans, text: warning})
+	}
+}
+
+// printSYNOptionWarning prints the warning about the tcp options in the
+// packet of type typ, i.e., SYN or SYN-ACK, sent over the network flow net
+// and the transport flow trans
+func printSYNOptionWarning(net, trans gopacket.Flow, typ, warning string) {
+	synFmt := "%s%s -> %s: %s Option Warning: %s\n"
+	t := timestamp()
+	fmt.Fprintf(stdout, synFmt, t, hostString(net.Src(), trans.Src()),
+		hostString(net.Dst(), trans.Dst()), typ, warning)
+}
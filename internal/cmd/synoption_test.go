@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestCheckSYNOptions(t *testing.T) {
+	mss := layers.TCPOption{OptionType: layers.TCPOptionKindMSS,
+		OptionLength: 4}
+	ts := layers.TCPOption{OptionType: layers.TCPOptionKindTimestamps,
+		OptionLength: 10}
+	md5 := layers.TCPOption{OptionType: tcpOptionMD5, OptionLength: 18}
+	nop := layers.TCPOption{OptionType: layers.TCPOptionKindNop,
+		OptionLength: 1}
+	smc := layers.TCPOption{OptionType: tcpOptionExp2, OptionLength: 6}
+
+	// test options without warnings
+	tcp := &layers.TCP{Options: []layers.TCPOption{mss, ts, nop, nop,
+		smc}}
+	if got := checkSYNOptions(tcp, true); got != nil {
+		t.Errorf("got = %v; want nil", got)
+	}
+
+	// test MD5 signature with SMC option
+	tcp.Options = []layers.TCPOption{mss, md5, nop, nop, smc}
+	want := []string{"MD5 signature option set, it takes 20 bytes of " +
+		"option space and SMC is usually not used with MD5 signatures"}
+	if got := checkSYNOptions(tcp, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+
+	// test MD5 signature and timestamps without space for SMC option
+	tcp.Options = []layers.TCPOption{mss, md5, nop, nop, ts, nop, nop,
+		nop, nop}
+	want = []string{
+		"MD5 signature and timestamp options set, Linux omits " +
+			"timestamps with MD5 signatures, options may be " +
+			"rewritten on the path",
+		"2 bytes of option space left, SMC option needs 8 bytes",
+	}
+	if got := checkSYNOptions(tcp, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("got = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogTimeFormat is the RFC 5424 timestamp format with at most
+	// microseconds
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+	// syslogAppName is the app name in syslog messages
+	syslogAppName = "smc-clc"
+)
+
+var (
+	// syslogEvents is the syslog sink
+	syslogEvents syslogSink
+
+	// syslogFacilities are the syslog facility codes by name
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4,
+		"syslog": 5, "lpr": 6, "news": 7, "uucp": 8, "cron": 9,
+		"authpriv": 10, "ftp": 11, "local0": 16, "local1": 17,
+		"local2": 18, "local3": 19, "local4": 20, "local5": 21,
+		"local6": 22, "local7": 23,
+	}
+
+	// syslogSeverities are the syslog severity codes by name
+	syslogSeverities = map[string]int{
+		"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4,
+		"notice": 5, "info": 6, "debug": 7,
+	}
+)
+
+// parseSyslogAddress parses the syslog address in spec, i.e.,
+// udp://host:port, tcp://host:port, or unix:///path, to network and address
+func parseSyslogAddress(spec string) (string, string, error) {
+	network, address, ok := strings.Cut(spec, "://")
+	if !ok || address == "" {
+		return "", "", fmt.Errorf("invalid syslog address %q", spec)
+	}
+	switch network {
+	case "udp", "tcp", "unix":
+		return network, address, nil
+	}
+	return "", "", fmt.Errorf("unknown syslog network %q", network)
+}
+
+// syslogMessage returns the RFC 5424 syslog message with priority pri, the
+// hostname, the process id pid, and the message ID id of the event with msg
+// at time t
+func syslogMessage(pri int, t time.Time, hostname string, pid int, id,
+	msg string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s", pri,
+		t.Format(syslogTimeFormat), hostname, syslogAppName, pid, id,
+		msg)
+}
+
+// syslogSink renders the event types selected on the command line as JSON in
+// RFC 5424 syslog messages to a syslog server over udp, tcp, or a unix socket
+type syslogSink struct {
+	lock     sync.Mutex
+	network  string
+	address  string
+	conn     net.Conn
+	stream   bool
+	pri      int
+	hostname string
+	pid      int
+}
+
+// init initializes the syslog sink with the syslog address, facility, and
+// severity and connects to the syslog server
+func (s *syslogSink) init(address, facility, severity string) error {
+	network, address, err := parseSyslogAddress(address)
+	if err != nil {
+		return err
+	}
+	f, ok := syslogFacilities[facility]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	sev, ok := syslogSeverities[severity]
+	if !ok {
+		return fmt.Errorf("unknown syslog severity %q", severity)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.network = network
+	s.address = address
+	s.pri = f*8 + sev
+	s.hostname = hostname
+	s.pid = os.Getpid()
+	return s.connect()
+}
+
+// connect connects to the syslog server, unix sockets are tried as datagram
+// and stream sockets, s must be locked
+func (s *syslogSink) connect() error {
+	var err error
+	switch s.network {
+	case "unix":
+		s.conn, err = net.Dial("unixgram", s.address)
+		s.stream = false
+		if err != nil {
+			s.conn, err = net.Dial("unix", s.address)
+			s.stream = true
+		}
+	default:
+		s.conn, err = net.Dial(s.network, s.address)
+		s.stream = s.network == "tcp"
+	}
+	if err != nil {
+		s.conn = nil
+	}
+	return err
+}
+
+// close closes the connection to the syslog server
+func (s *syslogSink) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn == nil {
+		return
+	}
+	if err := s.conn.Close(); err != nil {
+		log.Println("Error closing syslog connection:", err)
+	}
+	s.conn = nil
+	s.network = ""
+}
+
+// accepts checks if the syslog sink renders events of type typ
+func (s *syslogSink) accepts(typ string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.network != "" && jsonEvents.types[typ]
+}
+
+// render renders the event e as syslog message, stream sockets use octet
+// counting to frame the messages (RFC 6587)
+func (s *syslogSink) render(e *event) {
+	v := jsonEvent(e)
+	if v == nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error encoding syslog message:", err)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.network == "" {
+		return
+	}
+	msg := syslogMessage(s.pri, e.time, s.hostname, s.pid, e.typ,
+		string(b))
+	if s.stream {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	// reconnect after errors, e.g., a restarted syslog server
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return
+		}
+	}
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		log.Println("Error writing syslog message:", err)
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// setSyslogOutput sets the syslog output according to the syslog command line
+// arguments, the returned function closes the syslog connection
+func setSyslogOutput() func() {
+	if *syslogAddress == "" {
+		return func() {}
+	}
+	err := syslogEvents.init(*syslogAddress, *syslogFacility,
+		*syslogSeverity)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return syslogEvents.close
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogAddress(t *testing.T) {
+	for _, test := range []struct {
+		spec    string
+		network string
+		address string
+		err     bool
+	}{
+		{"udp://127.0.0.1:514", "udp", "127.0.0.1:514", false},
+		{"tcp://[::1]:601", "tcp", "[::1]:601", false},
+		{"unix:///dev/log", "unix", "/dev/log", false},
+		{"127.0.0.1:514", "", "", true},
+		{"udp://", "", "", true},
+		{"http://127.0.0.1:514", "", "", true},
+	} {
+		network, address, err := parseSyslogAddress(test.spec)
+		if network != test.network || address != test.address ||
+			(err != nil) != test.err {
+			t.Errorf("%s: got = %s, %s, %v; want %s, %s, %t",
+				test.spec, network, address, err, test.network,
+				test.address, test.err)
+		}
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	types := jsonEvents.types
+	jsonEvents.types = map[string]bool{eventAnnotation: true}
+	defer func() { jsonEvents.types = types }()
+
+	// check invalid arguments
+	var s syslogSink
+	if err := s.init("udp://127.0.0.1:514", "none", "info"); err == nil {
+		t.Error("init() with unknown facility succeeded")
+	}
+	if err := s.init("udp://127.0.0.1:514", "daemon", "none"); err == nil {
+		t.Error("init() with unknown severity succeeded")
+	}
+
+	// start tcp syslog server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+	if err := s.init("tcp://"+l.Addr().String(), "local0",
+		"notice"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// render events
+	if s.accepts(eventMessage) {
+		t.Error("s.accepts(message) = true; want false")
+	}
+	if !s.accepts(eventAnnotation) {
+		t.Error("s.accepts(annotation) = false; want true")
+	}
+	s.render(&event{typ: eventAnnotation, text: "test",
+		time: time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)})
+
+	// check octet counted syslog message
+	msg, err := bufio.NewReader(conn).ReadString('}')
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := "<133>1 2026-01-02T03:04:05.000006Z " + s.hostname +
+		" smc-clc "
+	suffix := " annotation - {\"time\":\"2026-01-02T03:04:05.000006Z\"," +
+		"\"type\":\"annotation\",\"text\":\"test\"}"
+	length, msg, _ := strings.Cut(msg, " ")
+	if length == "" || !strings.HasPrefix(msg, prefix) ||
+		!strings.HasSuffix(msg, suffix) {
+		t.Errorf("got = %q; want %q...%q", msg, prefix, suffix)
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// table column widths, wider values extend their column
+const (
+	tableSessionWidth = 7
+	tableHostWidth    = 21
+	tableTypeWidth    = 8
+	tablePathWidth    = 14
+)
+
+var (
+	// tableFields are the columns of the CSV output shown as key fields in
+	// the table output
+	tableFields = []string{"peer_id", "ib_gid", "ib_mac", "qpn", "psn",
+		"rmbe_size", "qp_mtu", "smcd_gid", "token", "dmbe_size",
+		"link_id", "eid", "diagnosis", "os_type"}
+)
+
+// tableRow returns the columns time t, session if sessions are shown, src,
+// dst, type, version, path, and fields as aligned table row
+func tableRow(t, session, src, dst, typ, version, path, fields string) string {
+	var b strings.Builder
+	b.WriteString(t)
+	if *showSessions {
+		fmt.Fprintf(&b, "%-*s ", tableSessionWidth, session)
+	}
+	fmt.Fprintf(&b, "%-*s %-*s %-*s %-1s %-*s %s", tableHostWidth, src,
+		tableHostWidth, dst, tableTypeWidth, typ, version,
+		tablePathWidth, path, fields)
+	return strings.TrimRight(b.String(), " ") + "\n"
+}
+
+// writeTableHeader writes the header row of the table output to w
+func writeTableHeader(w io.Writer) {
+	t := timestamp()
+	if t != "" {
+		t = fmt.Sprintf("%-*s ", len(t)-1, "TIME")
+	}
+	fmt.Fprint(w, tableRow(t, "SESSION", "SRC", "DST", "TYPE", "V",
+		"PATH", "FIELDS"))
+}
+
+// printTableHeader prints the header row of the table output
+func printTableHeader() {
+	writeTableHeader(stdout)
+}
+
+// writeCLCRow writes the CLC message msg of the handshake session with its
+// parse warnings sent over the network flow net and the transport flow trans
+// as table row with the key fields of its message type to w
+func writeCLCRow(w io.Writer, net, trans gopacket.Flow, msg clc.Message,
+	session uint64, warnings parseWarnings) {
+	r := csvMessageRow(time.Now(), net, trans, msg, session, warnings)
+	var fields []string
+	for _, f := range tableFields {
+		if r[f] != "" {
+			fields = append(fields, f+"="+r[f])
+		}
+	}
+	if len(warnings) > 0 {
+		fields = append(fields, "warnings="+r["warnings"])
+	}
+	if session == 0 {
+		r["session"] = "-"
+	}
+	fmt.Fprint(w, tableRow(timestamp(), r["session"], r["src"], r["dst"],
+		r["type"], r["version"], r["path"], strings.Join(fields, " ")))
+}
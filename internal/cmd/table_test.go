@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestWriteCLCRow(t *testing.T) {
+	defer func(table, timestamps, sessions bool) {
+		*showTable = table
+		*showTimestamps = timestamps
+		*showSessions = sessions
+	}(*showTable, *showTimestamps, *showSessions)
+	*showTable = true
+	*showTimestamps = false
+	*showSessions = true
+
+	// write header and decline message as table rows
+	var buf bytes.Buffer
+	net, _ := gopacket.FlowFromEndpoints(layers.NewIPEndpoint(net.IPv4(1,
+		2, 3, 4)), layers.NewIPEndpoint(net.IPv4(5, 6, 7, 8)))
+	trans, _ := gopacket.FlowFromEndpoints(layers.NewTCPPortEndpoint(123),
+		layers.NewTCPPortEndpoint(456))
+	msg := testHandshakeMessage("e2d4c3d904001c102525252525252500" +
+		"0303000000000000e2d4c3d9")
+	writeTableHeader(&buf)
+	writeCLC(&buf, net, trans, msg, 42, parseWarnings{"test"}, false)
+
+	want := "SESSION SRC                   DST                   " +
+		"TYPE     V PATH           FIELDS\n" +
+		"42      1.2.3.4:123           5.6.7.8:456           " +
+		"decline  1 SMC-R          peer_id=9509@25:25:25:25:25:00 " +
+		"diagnosis=0x3030000 (no SMC device found (R or D)) " +
+		"warnings=test\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got = %q; want %q", got, want)
+	}
+}
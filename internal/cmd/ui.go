@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// uiPage is the html dashboard of the http server
+	//go:embed ui.html
+	uiPage []byte
+)
+
+// handleUI handles http requests for the html dashboard
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(uiPage); err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+}
+
+// registerUI registers the html dashboard of the http server. It shows the
+// handshakes in the messages http api and the decline summary
+func registerUI() {
+	http.HandleFunc("/ui", handleUI)
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleUI(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ui", nil)
+	w := httptest.NewRecorder()
+	handleUI(w, r)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct,
+		"text/html") {
+		t.Errorf("got content type %q; want text/html", ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		`fetch("api/v1/messages`,
+		`fetch("api/v1/declines")`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+}
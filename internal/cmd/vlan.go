@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+var (
+	// vlans stores the VLAN table
+	vlans vlanTable
+)
+
+// vlanKey identifies a direction of a connection by the network flow and the
+// transport flow
+type vlanKey struct {
+	net, trans gopacket.Flow
+}
+
+// vlanTable stores the VLAN IDs of the tracked directions of connections and
+// the numbers of attempted, succeeded, declined, and fallen back handshakes
+// per VLAN ID protected by a mutex
+type vlanTable struct {
+	lock   sync.Mutex
+	vmap   map[vlanKey]uint16
+	counts map[uint16]*[4]uint64
+}
+
+// init initializes the VLAN table
+func (vt *vlanTable) init() {
+	vt.lock.Lock()
+	if vt.vmap == nil {
+		vt.vmap = make(map[vlanKey]uint16)
+		vt.counts = make(map[uint16]*[4]uint64)
+	}
+	vt.lock.Unlock()
+}
+
+// seen remembers the VLAN ID of the packet sent over the network flow net
+// and the transport flow trans if the packet has a VLAN tag
+func (vt *vlanTable) seen(net, trans gopacket.Flow, packet gopacket.Packet) {
+	dot1q, ok := packet.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q)
+	if !ok {
+		return
+	}
+
+	vt.lock.Lock()
+	if vt.vmap != nil {
+		vt.vmap[vlanKey{net, trans}] = dot1q.VLANIdentifier
+	}
+	vt.lock.Unlock()
+}
+
+// add adds 1 to the count with index i of the VLAN of the network flow net
+// and the transport flow trans if the VLAN is known
+func (vt *vlanTable) add(net, trans gopacket.Flow, i int) {
+	vt.lock.Lock()
+	defer vt.lock.Unlock()
+
+	vlan, ok := vt.vmap[vlanKey{net, trans}]
+	if !ok {
+		return
+	}
+	if vt.counts[vlan] == nil {
+		vt.counts[vlan] = &[4]uint64{}
+	}
+	vt.counts[vlan][i]++
+}
+
+// addAttempt adds a handshake attempt, i.e., a SYN with SMC option sent over
+// the network flow net and the transport flow trans, to the statistics of
+// its VLAN
+func (vt *vlanTable) addAttempt(net, trans gopacket.Flow) {
+	vt.add(net, trans, 0)
+}
+
+// addMessage adds the CLC message msg sent over the network flow net and the
+// transport flow trans to the statistics of its VLAN if it finishes a
+// handshake, i.e., it is a confirm or decline message
+func (vt *vlanTable) addMessage(net, trans gopacket.Flow, msg clc.Message) {
+	hdr := messageHeader(msg)
+	if hdr == nil {
+		return
+	}
+	switch hdr.Type {
+	case clc.TypeConfirm:
+		vt.add(net, trans, 1)
+	case clc.TypeDecline:
+		vt.add(net, trans, 2)
+	}
+}
+
+// addFallback adds a handshake over the network flow net and the transport
+// flow trans that fell back to tcp to the statistics of its VLAN
+func (vt *vlanTable) addFallback(net, trans gopacket.Flow) {
+	vt.add(net, trans, 3)
+}
+
+// del removes the direction of a connection identified by the network flow
+// net and the transport flow trans from the VLAN table
+func (vt *vlanTable) del(net, trans gopacket.Flow) {
+	vt.lock.Lock()
+	delete(vt.vmap, vlanKey{net, trans})
+	vt.lock.Unlock()
+}
+
+// list returns the sorted VLAN IDs and the numbers of attempted, succeeded,
+// declined, and fallen back handshakes per VLAN ID
+func (vt *vlanTable) list() ([]uint16, map[uint16][4]uint64) {
+	vt.lock.Lock()
+	defer vt.lock.Unlock()
+
+	ids := make([]uint16, 0, len(vt.counts))
+	counts := make(map[uint16][4]uint64, len(vt.counts))
+	for id, c := range vt.counts {
+		ids = append(ids, id)
+		counts[id] = *c
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, counts
+}
+
+// writeMetrics writes the handshake statistics per VLAN in prometheus text
+// format to w
+func (vt *vlanTable) writeMetrics(w io.Writer) {
+	ids, counts := vt.list()
+	if len(ids) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# HELP smc_clc_vlan_handshakes_total Number of "+
+		"handshakes by VLAN and result.")
+	fmt.Fprintln(w, "# TYPE smc_clc_vlan_handshakes_total counter")
+	for _, id := range ids {
+		for i, result := range []string{"attempted", "succeeded",
+			"declined", "fallback"} {
+			fmt.Fprintf(w, "smc_clc_vlan_handshakes_total{vlan=\"%d\","+
+				"result=%q} %d\n", id, result, counts[id][i])
+		}
+	}
+}
+
+// printVLANStats prints the handshake statistics per VLAN
+func printVLANStats() {
+	t := timestamp()
+	ids, counts := vlans.list()
+	for _, id := range ids {
+		c := counts[id]
+		fmt.Fprintf(stdout, "%sHandshake Stats: VLAN %d: %s\n", t, id,
+			countsString(c[0], c[1], c[2], c[3]))
+	}
+}
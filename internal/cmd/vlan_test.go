@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+)
+
+func TestVLANTable(t *testing.T) {
+	var vt vlanTable
+
+	// create packets with and without VLAN tag
+	newPacket := func(vlan bool) gopacket.Packet {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    net.IPv4(1, 2, 3, 4),
+			DstIP:    net.IPv4(5, 6, 7, 8),
+		}
+		tcp := &layers.TCP{SrcPort: 123, DstPort: 456, SYN: true}
+		tcp.SetNetworkLayerForChecksum(ip)
+		l := []gopacket.SerializableLayer{eth, ip, tcp}
+		if vlan {
+			eth.EthernetType = layers.EthernetTypeDot1Q
+			l = []gopacket.SerializableLayer{eth, &layers.Dot1Q{
+				VLANIdentifier: 10,
+				Type:           layers.EthernetTypeIPv4,
+			}, ip, tcp}
+		}
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true,
+			ComputeChecksums: true}
+		if err := gopacket.SerializeLayers(buf, opts, l...); err != nil {
+			t.Fatal(err)
+		}
+		return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeEthernet,
+			gopacket.Default)
+	}
+	tagged := newPacket(true)
+	untagged := newPacket(false)
+	nflow := tagged.NetworkLayer().NetworkFlow()
+	tflow := tagged.TransportLayer().TransportFlow()
+
+	// count handshakes of connection without VLAN tag
+	vt.init()
+	vt.seen(nflow, tflow, untagged)
+	vt.addAttempt(nflow, tflow)
+	if ids, _ := vt.list(); len(ids) != 0 {
+		t.Errorf("got = %v; want none", ids)
+	}
+
+	// count handshakes of connection with VLAN tag
+	vt.seen(nflow, tflow, tagged)
+	vt.addAttempt(nflow, tflow)
+	vt.addMessage(nflow, tflow, testHandshakeMessage(
+		"e2d4c3d904001c102525252525252500"+"0303000000000000e2d4c3d9"))
+	vt.addFallback(nflow, tflow)
+	vt.del(nflow, tflow)
+	vt.addAttempt(nflow, tflow)
+	ids, counts := vt.list()
+	if len(ids) != 1 || ids[0] != 10 ||
+		counts[10] != [4]uint64{1, 0, 1, 1} {
+		t.Errorf("got = %v, %v; want [10], [1 0 1 1]", ids, counts)
+	}
+
+	// test metrics
+	var b bytes.Buffer
+	vt.writeMetrics(&b)
+	want := "smc_clc_vlan_handshakes_total{vlan=\"10\"," +
+		"result=\"declined\"} 1\n"
+	if !bytes.Contains(b.Bytes(), []byte(want)) {
+		t.Errorf("got = %s; want %s", b.String(), want)
+	}
+}
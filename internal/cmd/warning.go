@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hwipl/smc-go/pkg/clc"
+)
+
+// parseWarnings stores the non-fatal parse warnings of a CLC message
+type parseWarnings []string
+
+// String converts the parse warnings to inline message suffixes
+func (w parseWarnings) String() string {
+	var b strings.Builder
+	for _, warning := range w {
+		fmt.Fprintf(&b, " [warn: %s]", warning)
+	}
+	return b.String()
+}
+
+// fixedMessageLen returns the length of the CLC message msg if all messages
+// of its type have the same length or 0 otherwise
+func fixedMessageLen(msg clc.Message) int {
+	switch msg.(type) {
+	case *clc.AcceptSMCR, *clc.ConfirmSMCR:
+		return clc.AcceptSMCRLen
+	case *clc.AcceptSMCD, *clc.ConfirmSMCD:
+		return clc.AcceptSMCDLen
+	case *clc.Decline, *clc.DeclineV2:
+		return clc.DeclineLen
+	default:
+		return 0
+	}
+}
+
+// checkWarnings checks the valid CLC message msg in buf for unusual but
+// non-fatal content and returns the parse warnings
+func checkWarnings(msg clc.Message, buf []byte) parseWarnings {
+	var warnings parseWarnings
+	hdr := messageHeader(msg)
+	if hdr == nil {
+		return nil
+	}
+
+	// the reserved bit in the header is the second path bit in SMCv2
+	// proposals
+	v2Proposal := hdr.Type == clc.TypeProposal && hdr.Version >= clc.SMCv2
+	if !v2Proposal && buf[7]&0b00000100 != 0 {
+		warnings = append(warnings, "reserved bits set")
+	}
+
+	// messages with fixed length should not contain more bytes
+	if n := fixedMessageLen(msg); n > 0 && len(buf) > n {
+		warnings = append(warnings, fmt.Sprintf("length %d larger "+
+			"than known fields (%d)", len(buf), n))
+	}
+
+	// header and trailer should contain the same eyecatcher
+	var trailer clc.Eyecatcher
+	copy(trailer[:], buf[len(buf)-clc.TrailerLen:])
+	if trailer != hdr.Eyecatcher {
+		warnings = append(warnings, fmt.Sprintf("trailer eyecatcher "+
+			"type %s differs from header %s", trailer,
+			hdr.Eyecatcher))
+	}
+	return warnings
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestCheckWarnings(t *testing.T) {
+	for _, test := range []struct {
+		msg  string
+		want parseWarnings
+	}{
+		// valid decline message
+		{"e2d4c3d904001c102525252525252500" +
+			"0303000000000000e2d4c3d9", nil},
+		// decline message with reserved bit set
+		{"e2d4c3d904001c142525252525252500" +
+			"0303000000000000e2d4c3d9",
+			parseWarnings{"reserved bits set"}},
+		// decline message with additional bytes
+		{"e2d4c3d90400201025252525252525000" +
+			"30300000000000000000000e2d4c3d9",
+			parseWarnings{"length 32 larger than known fields " +
+				"(28)"}},
+		// decline message with SMC-D trailer
+		{"e2d4c3d904001c102525252525252500" +
+			"0303000000000000e2d4c3c4",
+			parseWarnings{"trailer eyecatcher type SMC-D " +
+				"differs from header SMC-R"}},
+	} {
+		buf, err := hex.DecodeString(test.msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		d := newDecoder(bytes.NewReader(buf))
+		if _, err := d.next(); err != nil {
+			t.Fatalf("d.next() error = %v; want nil", err)
+		}
+		if !reflect.DeepEqual(d.warnings, test.want) {
+			t.Errorf("got = %v; want %v", d.warnings, test.want)
+		}
+	}
+
+	// test inline suffixes
+	w := parseWarnings{"reserved bits set", "length 32 larger than " +
+		"known fields (28)"}
+	want := " [warn: reserved bits set] [warn: length 32 larger than " +
+		"known fields (28)]"
+	if got := w.String(); got != want {
+		t.Errorf("got = %s; want %s", got, want)
+	}
+}
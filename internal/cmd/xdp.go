@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gopacket/gopacket"
+	"github.com/gopacket/gopacket/layers"
+	gopcap "github.com/gopacket/gopacket/pcap"
+)
+
+const (
+	// xdpPass is the XDP action that passes packets to the network stack
+	xdpPass = 2
+
+	// bpfFuncRedirectMap is the eBPF helper function bpf_redirect_map
+	bpfFuncRedirectMap = 51
+
+	// eBPF instruction opcodes used in the XDP program
+	bpfLdxMemW   = 0x61 // BPF_LDX | BPF_MEM | BPF_W
+	bpfLdImm64   = 0x18 // BPF_LD | BPF_IMM | BPF_DW
+	bpfMov64Imm  = 0xb7 // BPF_ALU64 | BPF_MOV | BPF_K
+	bpfCall      = 0x85 // BPF_JMP | BPF_CALL
+	bpfExit      = 0x95 // BPF_JMP | BPF_EXIT
+	bpfPseudoMap = 1    // BPF_PSEUDO_MAP_FD
+
+	// xdpRxQueueIndex is the offset of rx_queue_index in struct xdp_md
+	xdpRxQueueIndex = 16
+)
+
+var (
+	// sysfsNet is the sysfs directory with the network interfaces of the host
+	sysfsNet = "/sys/class/net"
+)
+
+// xdpQueues returns the number of receive queues of the network interface
+// device
+func xdpQueues(device string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(sysfsNet, device,
+		"queues"))
+	if err != nil {
+		return 0, err
+	}
+	queues := 0
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), "rx-") {
+			queues++
+		}
+	}
+	return queues, nil
+}
+
+// xdpCheckDevice checks if AF_XDP capture may take all packets of the
+// network interface device away from the network stack. Interfaces with IP
+// addresses other than link-local addresses carry the traffic of the host,
+// so they are rejected unless force is set
+func xdpCheckDevice(device string, force bool) error {
+	if force {
+		return nil
+	}
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if ok && ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		return fmt.Errorf("interface %s has IP address %s, AF_XDP "+
+			"capture takes its packets away from the host, use "+
+			"a mirror port or -xdp-force", device, a)
+	}
+	return nil
+}
+
+// bpfInsn encodes an eBPF instruction with opcode op, destination register
+// dst, source register src, offset off, and immediate value imm in byte
+// order. The register nibbles are bit fields, so their order depends on the
+// byte order, too
+func bpfInsn(order binary.ByteOrder, op, dst, src uint8, off int16,
+	imm int32) []byte {
+	insn := make([]byte, 8)
+	insn[0] = op
+	insn[1] = dst | src<<4
+	if order.Uint16([]byte{0, 1}) == 1 {
+		// big endian
+		insn[1] = dst<<4 | src
+	}
+	order.PutUint16(insn[2:], uint16(off))
+	order.PutUint32(insn[4:], uint32(imm))
+	return insn
+}
+
+// xdpProgram returns the eBPF instructions of the XDP program in byte order
+// that redirects each packet to the AF_XDP socket of its receive queue in
+// the XSKMAP mapFD. Packets of queues without socket are passed to the
+// network stack
+func xdpProgram(order binary.ByteOrder, mapFD int) []byte {
+	var prog []byte
+	for _, insn := range [][]byte{
+		// r2 = ctx->rx_queue_index
+		bpfInsn(order, bpfLdxMemW, 2, 1, xdpRxQueueIndex, 0),
+		// r1 = map, 64 bit immediate value in 2 instructions
+		bpfInsn(order, bpfLdImm64, 1, bpfPseudoMap, 0, int32(mapFD)),
+		bpfInsn(order, 0, 0, 0, 0, 0),
+		// r3 = XDP_PASS if there is no socket
+		bpfInsn(order, bpfMov64Imm, 3, 0, 0, xdpPass),
+		// return bpf_redirect_map(map, queue, XDP_PASS)
+		bpfInsn(order, bpfCall, 0, 0, 0, bpfFuncRedirectMap),
+		bpfInsn(order, bpfExit, 0, 0, 0, 0),
+	} {
+		prog = append(prog, insn...)
+	}
+	return prog
+}
+
+// xdpCapture is an AF_XDP capture on network interfaces with one socket per
+// receive queue, its packets are handled in the handler of all sockets
+type xdpCapture struct {
+	devices  []string
+	sockets  []*xdpSocket
+	stopped  atomic.Bool
+	filter   atomic.Pointer[gopcap.BPF]
+	received atomic.Uint64
+}
+
+// stop stops the AF_XDP capture
+func (c *xdpCapture) stop() {
+	c.stopped.Store(true)
+}
+
+// setFilter sets the pcap packet filter of the AF_XDP capture, an empty
+// filter passes all packets
+func (c *xdpCapture) setFilter(filter string) error {
+	if filter == "" {
+		c.filter.Store(nil)
+		return nil
+	}
+	bpf, err := gopcap.NewBPF(layers.LinkTypeEthernet, *pcapSnaplen,
+		filter)
+	if err != nil {
+		return err
+	}
+	c.filter.Store(bpf)
+	return nil
+}
+
+// packet returns the packet with data received at timestamp on the network
+// interface with index ifindex, truncated to snaplen, if it passes the
+// packet filter
+func (c *xdpCapture) packet(data []byte, ifindex int,
+	timestamp time.Time) gopacket.Packet {
+	ci := gopacket.CaptureInfo{
+		Timestamp:      timestamp,
+		CaptureLength:  min(len(data), *pcapSnaplen),
+		Length:         len(data),
+		InterfaceIndex: ifindex,
+	}
+	data = data[:ci.CaptureLength]
+	if bpf := c.filter.Load(); bpf != nil && !bpf.Matches(ci, data) {
+		return nil
+	}
+	c.received.Add(1)
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet,
+		gopacket.Default)
+	packet.Metadata().CaptureInfo = ci
+	return packet
+}
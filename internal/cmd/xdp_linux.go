@@ -0,0 +1,494 @@
+//go:build linux && (amd64 || arm64 || ppc64le || riscv64 || s390x)
+
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/gopacket/gopacket/layers"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// xdpFrames is the number of frames in the umem of an AF_XDP socket
+	xdpFrames = 2048
+
+	// xdpFrameSize is the size of a frame in the umem of an AF_XDP
+	// socket
+	xdpFrameSize = 4096
+
+	// xdpPollTimeout is the timeout in milliseconds for waiting for
+	// packets on an AF_XDP socket before checking if capturing stopped
+	xdpPollTimeout = 100
+)
+
+// bpfMapCreateAttr are the attributes of the bpf BPF_MAP_CREATE command
+type bpfMapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+}
+
+// bpfMapUpdateAttr are the attributes of the bpf BPF_MAP_UPDATE_ELEM command
+type bpfMapUpdateAttr struct {
+	mapFD uint32
+	_     uint32
+	key   unsafe.Pointer
+	value unsafe.Pointer
+	flags uint64
+}
+
+// bpfProgLoadAttr are the attributes of the bpf BPF_PROG_LOAD command
+type bpfProgLoadAttr struct {
+	progType uint32
+	insnCnt  uint32
+	insns    unsafe.Pointer
+	license  unsafe.Pointer
+}
+
+// bpfLinkCreateAttr are the attributes of the bpf BPF_LINK_CREATE command
+type bpfLinkCreateAttr struct {
+	progFD        uint32
+	targetIfindex uint32
+	attachType    uint32
+	flags         uint32
+}
+
+// bpf runs the bpf command cmd with the attributes attr of size and returns
+// the resulting file descriptor
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd),
+		uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// xdpSockopt sets the AF_XDP socket option opt of socket fd to the value of
+// size
+func xdpSockopt(fd, opt int, value unsafe.Pointer, size uintptr) error {
+	_, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd),
+		unix.SOL_XDP, uintptr(opt), uintptr(value), size, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// xdpGetSockopt gets the AF_XDP socket option opt of socket fd into the
+// value of size
+func xdpGetSockopt(fd, opt int, value unsafe.Pointer, size uintptr) error {
+	length := uint32(size)
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd),
+		unix.SOL_XDP, uintptr(opt), uintptr(value),
+		uintptr(unsafe.Pointer(&length)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// xdpRing is a ring of an AF_XDP socket shared with the kernel
+type xdpRing struct {
+	mem      []byte
+	producer *uint32
+	consumer *uint32
+	descs    unsafe.Pointer
+	mask     uint32
+}
+
+// mmapXDPRing maps the ring with size entries of descSize bytes at the page
+// offset pgoff and the ring offsets off of the AF_XDP socket fd
+func mmapXDPRing(fd int, off unix.XDPRingOffset, pgoff int64, size,
+	descSize uint32) (*xdpRing, error) {
+	mem, err := unix.Mmap(fd, pgoff, int(off.Desc)+int(size*descSize),
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return nil, err
+	}
+	return &xdpRing{
+		mem:      mem,
+		producer: (*uint32)(unsafe.Pointer(&mem[off.Producer])),
+		consumer: (*uint32)(unsafe.Pointer(&mem[off.Consumer])),
+		descs:    unsafe.Pointer(&mem[off.Desc]),
+		mask:     size - 1,
+	}, nil
+}
+
+// addr returns the umem address at index i in the fill ring
+func (r *xdpRing) addr(i uint32) *uint64 {
+	return (*uint64)(unsafe.Add(r.descs, uintptr(i&r.mask)*8))
+}
+
+// desc returns the descriptor at index i in the rx ring
+func (r *xdpRing) desc(i uint32) *unix.XDPDesc {
+	return (*unix.XDPDesc)(unsafe.Add(r.descs,
+		uintptr(i&r.mask)*unsafe.Sizeof(unix.XDPDesc{})))
+}
+
+// xdpSocket is an AF_XDP socket bound to a receive queue of a network
+// interface with its own umem
+type xdpSocket struct {
+	fd      int
+	ifindex int
+	umem    []byte
+	fill    *xdpRing
+	rx      *xdpRing
+}
+
+// newXDPSocket creates an AF_XDP socket bound to the receive queue of the
+// network interface with index ifindex and passes all frames of its umem to
+// the kernel
+func newXDPSocket(ifindex, queue int) (*xdpSocket, error) {
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := &xdpSocket{fd: fd, ifindex: ifindex}
+	if err := s.setup(queue); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// setup registers the umem, creates and maps the rings, fills the fill ring,
+// and binds the socket to the receive queue
+func (s *xdpSocket) setup(queue int) error {
+	umem, err := unix.Mmap(-1, 0, xdpFrames*xdpFrameSize,
+		unix.PROT_READ|unix.PROT_WRITE,
+		unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	if err != nil {
+		return err
+	}
+	s.umem = umem
+	reg := unix.XDPUmemReg{
+		Addr: uint64(uintptr(unsafe.Pointer(&umem[0]))),
+		Len:  uint64(len(umem)),
+		Size: xdpFrameSize,
+	}
+	err = xdpSockopt(s.fd, unix.XDP_UMEM_REG, unsafe.Pointer(&reg),
+		unsafe.Sizeof(reg))
+	if err != nil {
+		return fmt.Errorf("cannot register umem: %w", err)
+	}
+	size := uint32(xdpFrames)
+	for _, opt := range []int{unix.XDP_UMEM_FILL_RING,
+		unix.XDP_UMEM_COMPLETION_RING, unix.XDP_RX_RING} {
+		err := xdpSockopt(s.fd, opt, unsafe.Pointer(&size),
+			unsafe.Sizeof(size))
+		if err != nil {
+			return fmt.Errorf("cannot set ring size: %w", err)
+		}
+	}
+
+	// map rings
+	var off unix.XDPMmapOffsets
+	err = xdpGetSockopt(s.fd, unix.XDP_MMAP_OFFSETS, unsafe.Pointer(&off),
+		unsafe.Sizeof(off))
+	if err != nil {
+		return err
+	}
+	s.fill, err = mmapXDPRing(s.fd, off.Fr, unix.XDP_UMEM_PGOFF_FILL_RING,
+		xdpFrames, 8)
+	if err != nil {
+		return err
+	}
+	s.rx, err = mmapXDPRing(s.fd, off.Rx, unix.XDP_PGOFF_RX_RING,
+		xdpFrames, uint32(unsafe.Sizeof(unix.XDPDesc{})))
+	if err != nil {
+		return err
+	}
+
+	// pass all frames to the kernel
+	for i := uint32(0); i < xdpFrames; i++ {
+		*s.fill.addr(i) = uint64(i) * xdpFrameSize
+	}
+	atomic.StoreUint32(s.fill.producer, xdpFrames)
+
+	return unix.Bind(s.fd, &unix.SockaddrXDP{
+		Ifindex: uint32(s.ifindex),
+		QueueID: uint32(queue),
+	})
+}
+
+// receive handles the packets received on the socket with handler until the
+// capture c is stopped
+func (s *xdpSocket) receive(c *xdpCapture, handler *syncHandler) {
+	fds := []unix.PollFd{{Fd: int32(s.fd), Events: unix.POLLIN}}
+	for !c.stopped.Load() {
+		prod := atomic.LoadUint32(s.rx.producer)
+		cons := atomic.LoadUint32(s.rx.consumer)
+		if prod == cons {
+			_, err := unix.Poll(fds, xdpPollTimeout)
+			if err != nil && !errors.Is(err, unix.EINTR) {
+				log.Println("Error polling AF_XDP socket:", err)
+				return
+			}
+			continue
+		}
+
+		// handle packets and pass their frames back to the kernel
+		fill := atomic.LoadUint32(s.fill.producer)
+		for ; cons != prod; cons++ {
+			d := s.rx.desc(cons)
+			data := s.umem[d.Addr : d.Addr+uint64(d.Len)]
+			p := c.packet(data, s.ifindex, time.Now())
+			if p != nil {
+				handler.HandlePacket(p)
+			}
+			*s.fill.addr(fill) = d.Addr &^ (xdpFrameSize - 1)
+			fill++
+		}
+		atomic.StoreUint32(s.rx.consumer, cons)
+		atomic.StoreUint32(s.fill.producer, fill)
+		if *pcapMaxPkts > 0 &&
+			c.received.Load() >= uint64(*pcapMaxPkts) {
+			c.stop()
+		}
+	}
+}
+
+// dropped returns the number of packets dropped by the kernel because the
+// rings of the socket were full or empty
+func (s *xdpSocket) dropped() (int, error) {
+	var stats unix.XDPStatistics
+	err := xdpGetSockopt(s.fd, unix.XDP_STATISTICS,
+		unsafe.Pointer(&stats), unsafe.Sizeof(stats))
+	if err != nil {
+		return 0, err
+	}
+	return int(stats.Rx_dropped + stats.Rx_ring_full +
+		stats.Rx_fill_ring_empty_descs), nil
+}
+
+// close closes the socket and unmaps its rings and umem
+func (s *xdpSocket) close() {
+	for _, r := range []*xdpRing{s.fill, s.rx} {
+		if r != nil {
+			unix.Munmap(r.mem)
+		}
+	}
+	unix.Close(s.fd)
+	if s.umem != nil {
+		unix.Munmap(s.umem)
+	}
+}
+
+// xdpDevice is a network interface with an attached XDP program that
+// redirects packets to the AF_XDP sockets in its XSKMAP
+type xdpDevice struct {
+	mapFD  int
+	progFD int
+	linkFD int
+}
+
+// attachXDP creates the XSKMAP with the AF_XDP sockets for the queues of the
+// network interface with index ifindex, loads the XDP program, and attaches
+// it to the network interface
+func attachXDP(ifindex int, sockets []*xdpSocket) (*xdpDevice, error) {
+	d := &xdpDevice{mapFD: -1, progFD: -1, linkFD: -1}
+	var err error
+	mapAttr := &bpfMapCreateAttr{
+		mapType:    unix.BPF_MAP_TYPE_XSKMAP,
+		keySize:    4,
+		valueSize:  4,
+		maxEntries: uint32(len(sockets)),
+	}
+	d.mapFD, err = bpf(unix.BPF_MAP_CREATE, unsafe.Pointer(mapAttr),
+		unsafe.Sizeof(*mapAttr))
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("cannot create XSKMAP: %w", err)
+	}
+	for queue, s := range sockets {
+		key, value := uint32(queue), uint32(s.fd)
+		updateAttr := &bpfMapUpdateAttr{
+			mapFD: uint32(d.mapFD),
+			key:   unsafe.Pointer(&key),
+			value: unsafe.Pointer(&value),
+		}
+		_, err := bpf(unix.BPF_MAP_UPDATE_ELEM,
+			unsafe.Pointer(updateAttr), unsafe.Sizeof(*updateAttr))
+		if err != nil {
+			d.close()
+			return nil, fmt.Errorf("cannot update XSKMAP: %w", err)
+		}
+	}
+
+	prog := xdpProgram(binary.NativeEndian, d.mapFD)
+	license := []byte("MIT\x00")
+	progAttr := &bpfProgLoadAttr{
+		progType: unix.BPF_PROG_TYPE_XDP,
+		insnCnt:  uint32(len(prog) / 8),
+		insns:    unsafe.Pointer(&prog[0]),
+		license:  unsafe.Pointer(&license[0]),
+	}
+	d.progFD, err = bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(progAttr),
+		unsafe.Sizeof(*progAttr))
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("cannot load XDP program: %w", err)
+	}
+
+	linkAttr := &bpfLinkCreateAttr{
+		progFD:        uint32(d.progFD),
+		targetIfindex: uint32(ifindex),
+		attachType:    unix.BPF_XDP,
+	}
+	d.linkFD, err = bpf(unix.BPF_LINK_CREATE, unsafe.Pointer(linkAttr),
+		unsafe.Sizeof(*linkAttr))
+	if err != nil {
+		d.close()
+		return nil, fmt.Errorf("cannot attach XDP program: %w", err)
+	}
+	return d, nil
+}
+
+// close detaches the XDP program and closes the XSKMAP
+func (d *xdpDevice) close() {
+	for _, fd := range []int{d.linkFD, d.progFD, d.mapFD} {
+		if fd >= 0 {
+			unix.Close(fd)
+		}
+	}
+}
+
+// openXDP creates AF_XDP sockets for all receive queues of the network
+// interface device and attaches the XDP program that redirects its packets
+// to the sockets
+func openXDP(device string) (*xdpDevice, []*xdpSocket, error) {
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	queues, err := xdpQueues(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sockets []*xdpSocket
+	closeSockets := func() {
+		for _, s := range sockets {
+			s.close()
+		}
+	}
+	for queue := 0; queue < queues; queue++ {
+		s, err := newXDPSocket(iface.Index, queue)
+		if err != nil {
+			closeSockets()
+			return nil, nil, fmt.Errorf("cannot create AF_XDP "+
+				"socket on %s queue %d: %w", device, queue, err)
+		}
+		sockets = append(sockets, s)
+	}
+	d, err := attachXDP(iface.Index, sockets)
+	if err != nil {
+		closeSockets()
+		return nil, nil, err
+	}
+	return d, sockets, nil
+}
+
+// drops returns the number of received and dropped packets of the AF_XDP
+// capture
+func (c *xdpCapture) drops() (received, dropped int, ok bool) {
+	for _, s := range c.sockets {
+		d, err := s.dropped()
+		if err != nil {
+			return 0, 0, false
+		}
+		dropped += d
+	}
+	return int(c.received.Load()) + dropped, dropped, true
+}
+
+// listenXDP reads packets from the network interfaces in devices with one
+// AF_XDP socket per receive queue and handles them with handler until the
+// capture is stopped. Interfaces with IP addresses are rejected unless forced
+func listenXDP(handler *handler, devices []string) {
+	for _, device := range devices {
+		if err := xdpCheckDevice(device, *xdpForce); err != nil {
+			log.Fatal(err)
+		}
+	}
+	c := &xdpCapture{devices: devices}
+	err := c.setFilter(captureFilter(*getSettings().Filter,
+		layers.LinkTypeEthernet))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// older kernels account umem and bpf maps to the locked memory limit
+	unix.Setrlimit(unix.RLIMIT_MEMLOCK, &unix.Rlimit{
+		Cur: unix.RLIM_INFINITY,
+		Max: unix.RLIM_INFINITY,
+	})
+	var xdpDevices []*xdpDevice
+	for _, device := range devices {
+		d, sockets, err := openXDP(device)
+		if err != nil {
+			log.Fatal(err)
+		}
+		xdpDevices = append(xdpDevices, d)
+		c.sockets = append(c.sockets, sockets...)
+		log.Printf("Listening on interface %s with %d AF_XDP "+
+			"sockets:\n", device, len(sockets))
+	}
+	defer func() {
+		for _, d := range xdpDevices {
+			d.close()
+		}
+		for _, s := range c.sockets {
+			s.close()
+		}
+	}()
+
+	// start receiving on all sockets
+	setXDPCapture(c)
+	if interrupted.Load() {
+		stopListener()
+	}
+	if *pcapMaxTime > 0 {
+		timer := time.AfterFunc(time.Duration(*pcapMaxTime)*time.Second,
+			c.stop)
+		defer timer.Stop()
+	}
+	sh := &syncHandler{h: handler}
+	var wg sync.WaitGroup
+	for _, s := range c.sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.receive(c, sh)
+		}()
+	}
+
+	// handle timer events until all sockets stopped
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-ticker.C:
+			sh.HandleTimer()
+		case <-done:
+			running = false
+		}
+	}
+	setXDPCapture(nil)
+}
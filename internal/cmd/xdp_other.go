@@ -0,0 +1,19 @@
+//go:build !linux || !(amd64 || arm64 || ppc64le || riscv64 || s390x)
+
+package cmd
+
+import "log"
+
+// xdpSocket is an AF_XDP socket, it is not supported on this platform
+type xdpSocket struct{}
+
+// drops returns the number of received and dropped packets of the AF_XDP
+// capture, it is not supported on this platform
+func (c *xdpCapture) drops() (received, dropped int, ok bool) {
+	return 0, 0, false
+}
+
+// listenXDP is not supported on this platform
+func listenXDP(handler *handler, devices []string) {
+	log.Fatal("AF_XDP capture is not supported on this platform")
+}
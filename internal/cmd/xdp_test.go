@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestXDPQueues(t *testing.T) {
+	// create temporary sysfs directory with queues
+	dir, err := os.MkdirTemp("", "xdpsysfs")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { sysfsNet = d }(sysfsNet)
+	sysfsNet = dir
+	for _, q := range []string{"rx-0", "rx-1", "rx-2", "tx-0", "tx-1"} {
+		err := os.MkdirAll(filepath.Join(dir, "eth0", "queues", q),
+			0700)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	got, err := xdpQueues("eth0")
+	if err != nil || got != 3 {
+		t.Errorf("got %d, %v; want 3", got, err)
+	}
+	if _, err := xdpQueues("eth1"); err == nil {
+		t.Errorf("got nil; want error")
+	}
+}
+
+func TestXDPProgram(t *testing.T) {
+	for _, test := range []struct {
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{binary.LittleEndian, []byte{
+			0x61, 0x12, 16, 0, 0, 0, 0, 0,
+			0x18, 0x11, 0, 0, 5, 0, 0, 0,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0xb7, 0x03, 0, 0, 2, 0, 0, 0,
+			0x85, 0x00, 0, 0, 51, 0, 0, 0,
+			0x95, 0x00, 0, 0, 0, 0, 0, 0,
+		}},
+		{binary.BigEndian, []byte{
+			0x61, 0x21, 0, 16, 0, 0, 0, 0,
+			0x18, 0x11, 0, 0, 0, 0, 0, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+			0xb7, 0x30, 0, 0, 0, 0, 0, 2,
+			0x85, 0x00, 0, 0, 0, 0, 0, 51,
+			0x95, 0x00, 0, 0, 0, 0, 0, 0,
+		}},
+	} {
+		got := xdpProgram(test.order, 5)
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%v: got %x; want %x", test.order, got,
+				test.want)
+		}
+	}
+}
+
+func TestXDPCapturePacket(t *testing.T) {
+	defer func(s int) { *pcapSnaplen = s }(*pcapSnaplen)
+	*pcapSnaplen = 16
+
+	var c xdpCapture
+	if err := c.setFilter(""); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 64)
+	now := time.Now()
+	packet := c.packet(data, 3, now)
+	if packet == nil {
+		t.Fatal("got nil; want packet")
+	}
+	ci := packet.Metadata().CaptureInfo
+	if ci.Timestamp != now || ci.CaptureLength != 16 || ci.Length != 64 ||
+		ci.InterfaceIndex != 3 || len(packet.Data()) != 16 {
+		t.Errorf("got %+v; want truncated packet", ci)
+	}
+	if got := c.received.Load(); got != 1 {
+		t.Errorf("got %d; want 1", got)
+	}
+
+	// test stopping
+	c.stop()
+	if !c.stopped.Load() {
+		t.Errorf("got false; want true")
+	}
+}
+
+func TestXDPCheckDevice(t *testing.T) {
+	if err := xdpCheckDevice("does-not-exist", false); err == nil {
+		t.Error("unknown interface: got nil error; want error")
+	}
+
+	// loopback interfaces carry traffic of the host
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback == 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		if len(addrs) == 0 {
+			continue
+		}
+		if err := xdpCheckDevice(iface.Name, false); err == nil {
+			t.Errorf("%s: got nil error; want error", iface.Name)
+		}
+		if err := xdpCheckDevice(iface.Name, true); err != nil {
+			t.Errorf("%s: got %v; want nil error", iface.Name, err)
+		}
+		return
+	}
+	t.Skip("no loopback interface with addresses")
+}